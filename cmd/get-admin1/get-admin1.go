@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/simplify"
+)
+
+// get-admin1 builds internal/resources/admin1.zip, the admin-1 (states and
+// provinces) boundaries embedded for the subdivisions setting. It downloads
+// Natural Earth's 1:10m data set, keeps only the properties iptw reads,
+// simplifies the geometry and zips the result like w320.zip.
+
+const (
+	downloadURL = "https://raw.githubusercontent.com/nvkelso/natural-earth-vector/master/geojson/ne_10m_admin_1_states_provinces.geojson"
+	outFileName = "internal/resources/admin1.zip"
+	zipEntry    = "admin1.json"
+)
+
+func main() {
+	in := flag.String("in", "", "Read a Natural Earth admin-1 GeoJSON file instead of downloading it")
+	out := flag.String("out", outFileName, "Zip archive to write")
+	tolerance := flag.Float64("tolerance", 0.01, "Simplification tolerance in degrees")
+	flag.Parse()
+
+	if err := buildAdmin1(*in, *out, *tolerance); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func buildAdmin1(in, out string, tolerance float64) error {
+	var data []byte
+	var err error
+	if in != "" {
+		data, err = os.ReadFile(in)
+	} else {
+		fmt.Println("Downloading Natural Earth admin-1 boundaries...")
+		data, err = download(downloadURL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read admin-1 data: %w", err)
+	}
+
+	fc, err := geojson.UnmarshalFeatureCollection(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse admin-1 GeoJSON: %w", err)
+	}
+	simplified := simplifyAdmin1(fc, tolerance)
+	if len(simplified.Features) == 0 {
+		return fmt.Errorf("no subdivisions with ISO 3166-2 codes in %s", in)
+	}
+
+	jsonData, err := simplified.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to encode admin-1 GeoJSON: %w", err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(zipEntry)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(jsonData); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+
+	fmt.Printf("Wrote %d subdivisions to %s (%d KB)\n", len(simplified.Features), out, buf.Len()/1024)
+	fmt.Println("Rebuild iptw to embed them.")
+	return nil
+}
+
+// simplifyAdmin1 keeps the features with an ISO 3166-2 code, with only their
+// name and code, simplified polygons and coordinates rounded to about 100 m.
+func simplifyAdmin1(fc *geojson.FeatureCollection, tolerance float64) *geojson.FeatureCollection {
+	simplifier := simplify.DouglasPeucker(tolerance)
+	result := geojson.NewFeatureCollection()
+	for _, feature := range fc.Features {
+		code := feature.Properties.MustString("iso_3166_2", "")
+		if alpha2, _, ok := strings.Cut(code, "-"); !ok || len(alpha2) != 2 || strings.HasSuffix(code, "-") {
+			continue
+		}
+
+		var geom orb.MultiPolygon
+		switch g := feature.Geometry.(type) {
+		case orb.Polygon:
+			geom = orb.MultiPolygon{g}
+		case orb.MultiPolygon:
+			geom = g
+		default:
+			continue
+		}
+		geom = simplifyPolygons(simplifier, geom)
+		if len(geom) == 0 {
+			continue
+		}
+
+		simplified := geojson.NewFeature(geom)
+		simplified.Properties["iso_3166_2"] = code
+		simplified.Properties["name"] = feature.Properties.MustString("name", code)
+		result.Append(simplified)
+	}
+	return result
+}
+
+// simplifyPolygons simplifies each polygon and rounds it to about 100 m. A
+// polygon whose outer ring collapses, such as a small island, is kept as it
+// was instead; holes that collapse are dropped.
+func simplifyPolygons(simplifier *simplify.DouglasPeuckerSimplifier, mp orb.MultiPolygon) orb.MultiPolygon {
+	var kept orb.MultiPolygon
+	for _, polygon := range mp {
+		simplified := orb.Round(simplifier.Polygon(polygon.Clone()), 1e3).(orb.Polygon)
+		if len(simplified) == 0 || len(simplified[0]) < 4 {
+			kept = append(kept, polygon)
+			continue
+		}
+		rings := orb.Polygon{simplified[0]}
+		for _, ring := range simplified[1:] {
+			if len(ring) >= 4 {
+				rings = append(rings, ring)
+			}
+		}
+		kept = append(kept, rings)
+	}
+	return kept
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
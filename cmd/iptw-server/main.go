@@ -0,0 +1,148 @@
+// Command iptw-server collects the signed summaries iptw clients push with a
+// shared team key, and serves the combined team map and leaderboard.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"iptw/internal/logging"
+	"iptw/internal/resources"
+	"iptw/internal/team"
+	"iptw/internal/timelapse"
+)
+
+// Version information set during build
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+	GitCommit = "unknown"
+)
+
+func main() {
+	listen := flag.String("listen", team.DefaultServerAddress, "Address to listen on, e.g. 0.0.0.0:32790 for the LAN")
+	keyFile := flag.String("key-file", "", "File holding the team key (default: ~/.config/iptw/team-key); IPTW_TEAM_KEY overrides it")
+	dataPath := flag.String("data", "", "File the summaries are kept in (default: ~/.config/iptw/team-server.json); \"off\" keeps them in memory")
+	themeName := flag.String("theme", resources.ThemeLight, "Theme of the team map")
+	width := flag.Int("width", timelapse.DefaultWidth, fmt.Sprintf("Width of the team map in pixels, at most %d", timelapse.MaxWidth))
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	showVersion := flag.Bool("version", false, "Show version information")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("iptw-server %s (built %s, commit %s)\n", Version, BuildTime, GitCommit)
+		return
+	}
+	logging.SetupLogger(*logLevel)
+	if err := run(*listen, *keyFile, *dataPath, *themeName, *width); err != nil {
+		fmt.Fprintf(os.Stderr, "iptw-server: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run serves the team until SIGINT or SIGTERM.
+func run(listen, keyFile, dataPath, themeName string, width int) error {
+	key, err := loadTeamKey(keyFile)
+	if err != nil {
+		return err
+	}
+	switch dataPath {
+	case "off":
+		dataPath = ""
+	case "":
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dataPath = filepath.Join(homeDir, ".config", "iptw", "team-server.json")
+	}
+	server, err := team.NewServer(key, dataPath)
+	if err != nil {
+		return err
+	}
+	if server.RenderMap, err = newMapRenderer(themeName, width); err != nil {
+		slog.Warn("Failed to load map resources - the team map image is disabled", "error", err)
+	}
+
+	httpServer := &http.Server{Addr: listen, Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() { errs <- httpServer.ListenAndServe() }()
+	slog.Info("🤝 Team server listening", "url", "http://"+listen, "data", dataPath)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve: %w", err)
+	case sig := <-signals:
+		slog.Info("Shutting down", "signal", sig.String())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	return nil
+}
+
+// loadTeamKey returns the team key from IPTW_TEAM_KEY or the key file.
+func loadTeamKey(keyFile string) (string, error) {
+	if key := os.Getenv("IPTW_TEAM_KEY"); key != "" {
+		return key, nil
+	}
+	if keyFile == "" {
+		var err error
+		if keyFile, err = team.DefaultKeyPath(); err != nil {
+			return "", err
+		}
+	}
+	key, err := team.LoadKey(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("%w; create one with: iptw team key", err)
+	}
+	return key, nil
+}
+
+// newMapRenderer returns a function drawing the team map with the embedded
+// map resources.
+func newMapRenderer(themeName string, width int) (func(map[string]int) (image.Image, error), error) {
+	theme, err := resources.ResolveTheme(themeName, false)
+	if err != nil {
+		return nil, err
+	}
+	naturalEarth, err := resources.LoadNaturalEarthData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Natural Earth data: %w", err)
+	}
+	fonts, err := resources.LoadFonts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fonts: %w", err)
+	}
+	flags, err := resources.LoadFlags()
+	if err != nil {
+		flags = nil // Render without flags
+	}
+	renderer := &timelapse.Renderer{
+		NaturalEarth: naturalEarth,
+		Flags:        flags,
+		Fonts:        fonts,
+		Options:      timelapse.Options{Width: width, Theme: theme},
+	}
+	var mu sync.Mutex // one map at a time keeps memory bounded
+	return func(hits map[string]int) (image.Image, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return renderer.RenderMap(timelapse.Day{Date: time.Now(), Hits: hits})
+	}, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"iptw/internal/localapi"
+)
+
+// challengeInfo is a daily or weekly challenge as returned by the API.
+type challengeInfo struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Period     string `json:"period"`
+	Title      string `json:"title"`
+	Current    bool   `json:"current"`
+	Progress   int    `json:"progress"`
+	Target     int    `json:"target"`
+	Limit      bool   `json:"limit"`
+	Completed  bool   `json:"completed"`
+	Streak     int    `json:"streak"`
+	BestStreak int    `json:"best_streak"`
+}
+
+// runChallenges implements "iptw challenges": show the daily and weekly
+// challenges with their progress and streaks.
+func runChallenges(args []string) error {
+	fs := newFlagSet("challenges", "challenges [-json] [-date YYYY-MM-DD]",
+		"Show the daily and weekly challenges of the running iptw, their progress and streaks.\n"+
+			"Everyone gets the same challenges on the same day; -date shows those of another day.")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	date := fs.String("date", "", "Day whose challenges to show; today by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	client, _, err := connect(localapi.ScopeRead)
+	if err != nil {
+		return err
+	}
+	path := "/api/v1/challenges"
+	if *date != "" {
+		path += "?date=" + url.QueryEscape(*date)
+	}
+	var list struct {
+		Challenges []challengeInfo `json:"challenges"`
+	}
+	if err := client.Get(context.Background(), path, &list); err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(list.Challenges)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, c := range list.Challenges {
+		mark := " "
+		if c.Completed {
+			mark = "✓"
+		}
+		progress := ""
+		switch {
+		case !c.Current:
+		case c.Limit:
+			progress = fmt.Sprintf("%d%% (under %d%%)", c.Progress, c.Target)
+		default:
+			progress = fmt.Sprintf("%d/%d", c.Progress, c.Target)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\tstreak %d, best %d\n", mark, c.Period, c.Title, progress, c.Streak, c.BestStreak)
+	}
+	return tw.Flush()
+}
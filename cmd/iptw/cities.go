@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"iptw/internal/history"
+	"iptw/internal/resources"
+)
+
+// visitedCity is a city of the travel history.
+type visitedCity struct {
+	Country     string    `json:"country"`
+	Name        string    `json:"name"`
+	Subdivision string    `json:"subdivision,omitempty"`
+	Hits        int       `json:"hits"`
+	FirstVisit  time.Time `json:"first_visit"`
+	LastHit     time.Time `json:"last_hit"`
+}
+
+// runCities implements "iptw cities": list the cities of the travel history.
+// It is safe while iptw is running.
+func runCities(args []string) error {
+	fs := newFlagSet("cities", "cities [-json] [-country COUNTRY]",
+		"List the visited cities with their hits, most visited first, from the travel history.")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	country := fs.String("country", "", "Only list the cities of this country, by name or ISO alpha-2 code")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	journalPath, err := journalPath()
+	if err != nil {
+		return err
+	}
+
+	byKey := make(map[string]*visitedCity)
+	err = history.OpenReadOnly(journalPath).Scan(time.Time{}, func(e history.Event) bool {
+		if e.Type != history.EventHit || e.City == "" {
+			return true
+		}
+		if *country != "" && !strings.EqualFold(e.Country, *country) {
+			if alpha2, err := resources.GetAlpha2ByName(e.Country); err != nil || !strings.EqualFold(alpha2, *country) {
+				return true
+			}
+		}
+		key := e.Country + "|" + e.City
+		city := byKey[key]
+		if city == nil {
+			city = &visitedCity{Country: e.Country, Name: e.City, FirstVisit: e.Time}
+			byKey[key] = city
+		}
+		if e.Subdivision != "" {
+			city.Subdivision = e.Subdivision
+		}
+		city.Hits++
+		city.LastHit = e.Time
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	cities := make([]visitedCity, 0, len(byKey))
+	for _, city := range byKey {
+		cities = append(cities, *city)
+	}
+	sort.Slice(cities, func(i, j int) bool {
+		if cities[i].Hits != cities[j].Hits {
+			return cities[i].Hits > cities[j].Hits
+		}
+		if cities[i].Country != cities[j].Country {
+			return cities[i].Country < cities[j].Country
+		}
+		return cities[i].Name < cities[j].Name
+	})
+	if *asJSON {
+		return printJSON(cities)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CITY\tCOUNTRY\tSUBDIVISION\tHITS\tFIRST VISIT")
+	for _, city := range cities {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", city.Name, city.Country, city.Subdivision, city.Hits, city.FirstVisit.Local().Format("2006-01-02"))
+	}
+	fmt.Fprintf(tw, "%d cities\n", len(cities))
+	return tw.Flush()
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"iptw/internal/achievements"
+	"iptw/internal/config"
+	"iptw/internal/control"
+	"iptw/internal/history"
+	"iptw/internal/localapi"
+	"iptw/internal/profile"
+	"iptw/internal/resources"
+	"iptw/internal/timelapse"
+)
+
+// apiClient calls the REST API of the running instance, through the control
+// socket or over HTTP.
+type apiClient interface {
+	Do(ctx context.Context, method, path string, body, out interface{}) error
+	Get(ctx context.Context, path string, out interface{}) error
+}
+
+// connect returns a client for the running instance. The control socket is
+// preferred; over HTTP a token of scope is needed. The socket connection is
+// closed when the command exits.
+func connect(scope localapi.Scope) (apiClient, localapi.Instance, error) {
+	if conn, err := dialControl(); err == nil {
+		var inst localapi.Instance
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := conn.Call(ctx, control.MethodInstance, nil, &inst); err == nil {
+			return control.APIClient{Client: conn}, inst, nil
+		}
+		_ = conn.Close()
+	}
+
+	inst, token, err := instanceToken(scope)
+	if err != nil {
+		return nil, inst, err
+	}
+	client, err := localapi.NewClient(inst, token.Value)
+	return client, inst, err
+}
+
+// instanceToken returns the running instance and an API token of scope.
+func instanceToken(scope localapi.Scope) (localapi.Instance, localapi.Token, error) {
+	instancePath, err := localapi.DefaultInstancePath()
+	if err != nil {
+		return localapi.Instance{}, localapi.Token{}, err
+	}
+	inst, err := localapi.ReadInstance(instancePath)
+	if err != nil {
+		return inst, localapi.Token{}, err
+	}
+	tokens, err := loadTokens()
+	if err != nil {
+		return inst, localapi.Token{}, err
+	}
+	token, ok := tokens.ForScope(scope)
+	if !ok {
+		return inst, token, fmt.Errorf("no API token, create one with: iptw token create -scope %s NAME", scope)
+	}
+	return inst, token, nil
+}
+
+// existingConfig returns the settings without creating a config file: the
+// defaults when there is none.
+func existingConfig() (*config.Config, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "iptwrc")); err != nil {
+		return config.DefaultConfig(), nil
+	}
+	return config.LoadConfig()
+}
+
+// journalPath returns the travel history of the active profile.
+func journalPath() (string, error) {
+	cfg, err := existingConfig()
+	if err != nil {
+		return "", err
+	}
+	return profile.HistoryPath(cfg.Profile)
+}
+
+// replayToday returns the game state rebuilt from the travel history, for
+// commands that work while iptw is not running.
+func replayToday() (timelapse.Day, error) {
+	journalPath, err := journalPath()
+	if err != nil {
+		return timelapse.Day{}, err
+	}
+	now := time.Now()
+	days, err := timelapse.Replay(history.OpenReadOnly(journalPath), now, now)
+	if err != nil {
+		return timelapse.Day{}, err
+	}
+	return days[len(days)-1], nil
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// newFlagSet returns a flag set for a subcommand with a usage message.
+func newFlagSet(name, usage, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: iptw "+usage)
+		fmt.Fprintln(fs.Output(), description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// statusReport is printed by "iptw status".
+type statusReport struct {
+	Running      bool         `json:"running"`
+	URL          string       `json:"url,omitempty"`
+	PID          int          `json:"pid,omitempty"`
+	Started      *time.Time   `json:"started,omitempty"`
+	Visited      int          `json:"visited"`
+	Prison       int          `json:"prison"`
+	Liberated    int          `json:"liberated"`
+	Achievements *int         `json:"achievements,omitempty"` // only known while running
+	Connections  *int         `json:"connections,omitempty"`  // only known from the history
+	Target       string       `json:"target,omitempty"`
+	TopCountries []countryRow `json:"top_countries,omitempty"`
+}
+
+// runStatus implements "iptw status": the game status of the running
+// instance, or from the travel history when iptw is not running.
+func runStatus(args []string) error {
+	fs := newFlagSet("status", "status [-json]", "Show the game status of the running iptw, or from the travel history when it is not running.")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var report statusReport
+	client, inst, err := connect(localapi.ScopeRead)
+	switch {
+	case err == nil:
+		var stats struct {
+			VisitedCount     int          `json:"visited_count"`
+			PrisonCount      int          `json:"prison_count"`
+			LiberatedCount   int          `json:"liberated_count"`
+			AchievementCount int          `json:"achievement_count"`
+			TargetCountry    string       `json:"target_country"`
+			TopCountries     []countryRow `json:"top_countries"`
+		}
+		if err := client.Get(context.Background(), "/api/v1/stats", &stats); err != nil {
+			return err
+		}
+		report = statusReport{
+			Running: true, URL: inst.URL, PID: inst.PID, Started: &inst.Started,
+			Visited: stats.VisitedCount, Prison: stats.PrisonCount, Liberated: stats.LiberatedCount,
+			Achievements: &stats.AchievementCount, Target: stats.TargetCountry, TopCountries: stats.TopCountries,
+		}
+	case errors.Is(err, localapi.ErrNotRunning):
+		day, err := replayToday()
+		if err != nil {
+			return err
+		}
+		rows := dayCountries(day)
+		sortCountries(rows, "hits")
+		report = statusReport{
+			Visited: day.Visited, Prison: day.Imprisoned, Liberated: len(day.Liberated),
+			Connections: &day.Connections, Target: day.Target, TopCountries: rows[:min(len(rows), 10)],
+		}
+	default:
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(report)
+	}
+	if report.Running {
+		fmt.Printf("iptw is running at %s (pid %d, up %s)\n", report.URL, report.PID, time.Since(*report.Started).Round(time.Second))
+	} else {
+		fmt.Println("iptw is not running; status from the travel history:")
+	}
+	fmt.Printf("Countries visited: %d (%d in Matrix Prison, %d liberated)\n", report.Visited, report.Prison, report.Liberated)
+	if report.Achievements != nil {
+		fmt.Printf("Achievements unlocked: %d\n", *report.Achievements)
+	}
+	if report.Connections != nil {
+		fmt.Printf("Connections recorded: %d\n", *report.Connections)
+	}
+	if report.Target != "" {
+		fmt.Printf("Target: %s\n", report.Target)
+	}
+	if len(report.TopCountries) > 0 {
+		top := make([]string, len(report.TopCountries))
+		for i, row := range report.TopCountries {
+			top[i] = fmt.Sprintf("%s %d", row.Country, row.Hits)
+		}
+		fmt.Printf("Top countries: %s\n", strings.Join(top, ", "))
+	}
+	return nil
+}
+
+// countryRow is one line of "iptw countries".
+type countryRow struct {
+	Country string `json:"country"`
+	State   string `json:"state,omitempty"`
+	Hits    int    `json:"hits"`
+}
+
+// dayCountries lists the visited countries of a replayed day. Hits are the
+// journaled connections, as in the timelapse.
+func dayCountries(day timelapse.Day) []countryRow {
+	rows := make([]countryRow, 0, len(day.Hits))
+	for country, hits := range day.Hits {
+		state := resources.CountryState(hits, day.Prison[country], day.Liberated[country])
+		rows = append(rows, countryRow{Country: country, State: state, Hits: hits})
+	}
+	return rows
+}
+
+// sortCountries sorts rows by hits (most first) or name.
+func sortCountries(rows []countryRow, by string) {
+	sort.Slice(rows, func(i, j int) bool {
+		if by == "hits" && rows[i].Hits != rows[j].Hits {
+			return rows[i].Hits > rows[j].Hits
+		}
+		return rows[i].Country < rows[j].Country
+	})
+}
+
+// runCountries implements "iptw countries": the visited countries of the
+// running instance, or from the travel history when iptw is not running.
+func runCountries(args []string) error {
+	fs := newFlagSet("countries", "countries [flags]", "List the visited countries of the running iptw, or from the travel history when it is not running.")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	state := fs.String("state", "", "Comma-separated states: visited, prison or liberated (default: all three)")
+	region := fs.String("region", "", "Only countries in this region or sub-region")
+	sortBy := fs.String("sort", "hits", "Sort by hits or name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *sortBy != "hits" && *sortBy != "name" {
+		return fmt.Errorf("unknown sort %q, expected hits or name", *sortBy)
+	}
+
+	var rows []countryRow
+	client, _, err := connect(localapi.ScopeRead)
+	switch {
+	case err == nil:
+		query := url.Values{"sort": {*sortBy}}
+		if *state != "" {
+			query.Set("state", *state)
+		}
+		if *region != "" {
+			query.Set("region", *region)
+		}
+		var list struct {
+			Countries []struct {
+				Name  string `json:"name"`
+				State string `json:"state"`
+				Hits  int    `json:"hits"`
+			} `json:"countries"`
+		}
+		if err := client.Get(context.Background(), "/api/v1/countries?"+query.Encode(), &list); err != nil {
+			return err
+		}
+		for _, c := range list.Countries {
+			rows = append(rows, countryRow{Country: c.Name, State: c.State, Hits: c.Hits})
+		}
+	case errors.Is(err, localapi.ErrNotRunning):
+		day, err := replayToday()
+		if err != nil {
+			return err
+		}
+		rows = filterCountries(dayCountries(day), *state, *region)
+		sortCountries(rows, *sortBy)
+	default:
+		return err
+	}
+
+	if *asJSON {
+		if rows == nil {
+			rows = []countryRow{}
+		}
+		return printJSON(rows)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COUNTRY\tSTATE\tHITS")
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", row.Country, row.State, row.Hits)
+	}
+	return tw.Flush()
+}
+
+// filterCountries applies the state and region filters of "iptw countries"
+// to rows from the travel history.
+func filterCountries(rows []countryRow, states, region string) []countryRow {
+	wanted := make(map[string]bool)
+	for _, state := range strings.Split(states, ",") {
+		if state = strings.TrimSpace(state); state != "" {
+			wanted[state] = true
+		}
+	}
+	filtered := rows[:0]
+	for _, row := range rows {
+		if len(wanted) > 0 && !wanted[row.State] {
+			continue
+		}
+		if region != "" {
+			alpha2, err := resources.GetAlpha2ByName(row.Country)
+			if err != nil {
+				continue
+			}
+			info, err := resources.GetCountryByAlpha2(alpha2)
+			if err != nil || (!strings.EqualFold(info.Region, region) && !strings.EqualFold(info.SubRegion, region)) {
+				continue
+			}
+		}
+		filtered = append(filtered, row)
+	}
+	return filtered
+}
+
+// runImprison implements "iptw imprison": send a country to Matrix Prison.
+func runImprison(args []string) error {
+	fs := newFlagSet("imprison", "imprison COUNTRY", "Send a country of the running iptw to Matrix Prison.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected a country name or ISO code")
+	}
+	client, _, err := connect(localapi.ScopeWrite)
+	if err != nil {
+		return err
+	}
+	var country struct {
+		Name      string `json:"name"`
+		Liberated bool   `json:"liberated"`
+	}
+	path := "/api/v1/countries/" + url.PathEscape(fs.Arg(0)) + "/imprison"
+	if err := client.Do(context.Background(), http.MethodPost, path, nil, &country); err != nil {
+		return err
+	}
+	if country.Liberated {
+		fmt.Printf("%s was liberated\n", country.Name)
+	} else {
+		fmt.Printf("%s is now in Matrix Prison\n", country.Name)
+	}
+	return nil
+}
+
+// runAchievements implements "iptw achievements": the achievements of the
+// running instance and their progress.
+func runAchievements(args []string) error {
+	fs := newFlagSet("achievements", "achievements [-json] [-unlocked]", "List the achievements of the running iptw and their progress.")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	unlockedOnly := fs.Bool("unlocked", false, "Only unlocked achievements")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	client, _, err := connect(localapi.ScopeRead)
+	if err != nil {
+		return err
+	}
+	var list struct {
+		Achievements []*achievements.Achievement `json:"achievements"`
+	}
+	if err := client.Get(context.Background(), "/api/v1/achievements", &list); err != nil {
+		return err
+	}
+	shown := list.Achievements[:0]
+	for _, achievement := range list.Achievements {
+		if achievement.Unlocked || !*unlockedOnly {
+			shown = append(shown, achievement)
+		}
+	}
+	sort.SliceStable(shown, func(i, j int) bool { return shown[i].Unlocked && !shown[j].Unlocked })
+
+	if *asJSON {
+		return printJSON(shown)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, achievement := range shown {
+		mark := " "
+		if achievement.Unlocked {
+			mark = "✓"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d/%d\t%s\n", mark, achievement.Name, achievement.Progress, achievement.Target, achievement.Description)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"iptw/internal/config"
+	"iptw/internal/geoip"
+	"iptw/internal/history"
+	"iptw/internal/localapi"
+	"iptw/internal/network"
+	"iptw/internal/resources"
+	"iptw/internal/team"
+)
+
+// checkResult is the outcome of one "iptw doctor" check.
+type checkResult struct {
+	status  string // ok, warn or fail
+	message string
+}
+
+func checkOK(format string, args ...interface{}) checkResult {
+	return checkResult{"ok", fmt.Sprintf(format, args...)}
+}
+
+func checkWarn(format string, args ...interface{}) checkResult {
+	return checkResult{"warn", fmt.Sprintf(format, args...)}
+}
+
+func checkFail(format string, args ...interface{}) checkResult {
+	return checkResult{"fail", fmt.Sprintf(format, args...)}
+}
+
+// doctorChecks are run in order by "iptw doctor".
+var doctorChecks = []struct {
+	name  string
+	check func() checkResult
+}{
+	{"config", checkConfig},
+	{"geoip", checkGeoIP},
+	{"asn", checkASN},
+	{"subdivisions", checkSubdivisions},
+	{"history", checkHistory},
+	{"output", checkOutputDir},
+	{"tokens", checkTokens},
+	{"connections", checkConnections},
+	{"desktop", checkDesktop},
+	{"instance", checkInstance},
+	{"team", checkTeam},
+}
+
+// runDoctor implements "iptw doctor": check the installation and the state
+// files and report problems with a hint how to fix them.
+func runDoctor(args []string) error {
+	fs := newFlagSet("doctor", "doctor", "Check the configuration, databases, state files and the running iptw.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	marks := map[string]string{"ok": "✓", "warn": "!", "fail": "✗"}
+	failed := 0
+	for _, c := range doctorChecks {
+		result := c.check()
+		fmt.Printf("%s %-12s %s\n", marks[result.status], c.name, result.message)
+		if result.status == "fail" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+// configDir returns ~/.config/iptw.
+func configDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw"), nil
+}
+
+// checkConfig reports settings in iptwrc that are ignored because they are
+// unknown or invalid.
+func checkConfig() checkResult {
+	dir, err := configDir()
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	path := filepath.Join(dir, "iptwrc")
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return checkOK("no config file yet; defaults are used")
+	} else if err != nil {
+		return checkFail("%v", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var problems []string
+	cfg := config.DefaultConfig()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.Fields(text)
+		if len(parts) < 2 {
+			problems = append(problems, fmt.Sprintf("line %d: missing value", line))
+		} else if err := cfg.Set(parts[0], parts[1]); err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return checkFail("failed to read %s: %v", path, err)
+	}
+	if len(problems) > 0 {
+		return checkWarn("%s: ignored settings, the defaults are used instead: %s", path, strings.Join(problems, "; "))
+	}
+	return checkOK("%s", path)
+}
+
+func checkGeoIP() checkResult {
+	db, err := geoip.NewDatabase("")
+	if err != nil {
+		return checkFail("embedded GeoIP database: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+	location, err := db.Lookup("8.8.8.8")
+	if err != nil {
+		return checkFail("GeoIP lookup failed: %v", err)
+	}
+	return checkOK("embedded GeoIP database works (8.8.8.8 is in %s)", location.Country)
+}
+
+func checkASN() checkResult {
+	path, err := geoip.DefaultASNPath()
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return checkWarn("no ASN database; download GeoLite2-ASN.mmdb to %s to record networks", path)
+	}
+	db, err := geoip.NewDatabase("")
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	defer func() { _ = db.Close() }()
+	if err := db.LoadASN(path); err != nil {
+		return checkFail("%v", err)
+	}
+	return checkOK("%s", path)
+}
+
+func checkSubdivisions() checkResult {
+	path, err := resources.DefaultAdmin1Path()
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	sd, err := resources.LoadSubdivisions(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkFail("no admin-1 data embedded; run \"make admin1\" and rebuild, or save Natural Earth states and provinces as %s", path)
+	} else if err != nil {
+		return checkFail("%v", err)
+	}
+	return checkOK("%d subdivisions", len(sd.Subdivisions))
+}
+
+func checkHistory() checkResult {
+	path, err := journalPath()
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return checkOK("no travel history yet")
+	}
+	events := 0
+	var first, last time.Time
+	err = history.OpenReadOnly(path).Scan(time.Time{}, func(e history.Event) bool {
+		if events == 0 {
+			first = e.Time
+		}
+		last = e.Time
+		events++
+		return true
+	})
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	if events == 0 {
+		return checkOK("%s is empty", path)
+	}
+	return checkOK("%s: %d events from %s to %s", path, events, first.Local().Format(time.DateOnly), last.Local().Format(time.DateOnly))
+}
+
+func checkOutputDir() checkResult {
+	dir, err := configDir()
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	dir = filepath.Join(dir, "output")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return checkFail("%v", err)
+	}
+	probe, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return checkFail("map images cannot be written to %s: %v", dir, err)
+	}
+	_ = probe.Close()
+	_ = os.Remove(probe.Name())
+	return checkOK("%s is writable", dir)
+}
+
+func checkTokens() checkResult {
+	path, err := localapi.DefaultTokensPath()
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return checkOK("no API tokens yet; iptw creates one on start")
+	} else if err != nil {
+		return checkFail("%v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return checkFail("%s is readable by other users; run chmod 600 %s", path, path)
+	}
+	tokens, err := loadTokens()
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	return checkOK("%s: %d tokens", path, len(tokens.List()))
+}
+
+func checkConnections() checkResult {
+	monitor := network.NewMonitor()
+	if err := monitor.RefreshConnections(); err != nil {
+		return checkFail("cannot list connections: %v", err)
+	}
+	return checkOK("%d open connections", len(monitor.GetConnections()))
+}
+
+// checkDesktop warns when the tray cannot be shown, which headless mode
+// does not need.
+func checkDesktop() checkResult {
+	if runtime.GOOS != "linux" && runtime.GOOS != "freebsd" {
+		return checkOK("%s desktop", runtime.GOOS)
+	}
+	if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return checkWarn("no desktop session; the tray needs one, run iptw --headless instead")
+	}
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return checkWarn("no D-Bus session bus; the tray icon may not appear")
+	}
+	return checkOK("desktop session found")
+}
+
+func checkInstance() checkResult {
+	client, inst, err := connect(localapi.ScopeRead)
+	if errors.Is(err, localapi.ErrNotRunning) {
+		return checkOK("iptw is not running")
+	} else if err != nil {
+		return checkFail("%v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Get(ctx, "/api/v1/stats", nil); err != nil {
+		var apiErr *localapi.APIError
+		if errors.As(err, &apiErr) {
+			return checkFail("%s answered with an error: %v", inst.URL, err)
+		}
+		return checkFail("%s (pid %d) is not reachable; the instance file may be stale: %v", inst.URL, inst.PID, err)
+	}
+	return checkOK("iptw is running at %s (pid %d)", inst.URL, inst.PID)
+}
+
+func checkTeam() checkResult {
+	cfg, err := existingConfig()
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	if cfg.TeamServer == "off" {
+		return checkOK("no team server")
+	}
+	keyPath, err := team.DefaultKeyPath()
+	if err != nil {
+		return checkFail("%v", err)
+	}
+	if _, err := team.LoadKey(keyPath); err != nil {
+		return checkFail("%v; save the team's key with: iptw team key KEY", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	board, err := fetchLeaderboard(ctx, cfg.TeamServer)
+	if err != nil {
+		return checkWarn("%v; summaries are pushed again once it is back", err)
+	}
+	return checkOK("%s has %d players", cfg.TeamServer, board.Players)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"iptw/internal/localapi"
+)
+
+// expeditionInfo is the running or last expedition as returned by the API.
+type expeditionInfo struct {
+	ID               string     `json:"id"`
+	Active           bool       `json:"active"`
+	Outcome          string     `json:"outcome"`
+	Deadline         *time.Time `json:"deadline"`
+	RemainingSeconds int64      `json:"remaining_seconds"`
+	Reached          int        `json:"reached"`
+	Targets          []struct {
+		Country string     `json:"country"`
+		Reached *time.Time `json:"reached"`
+		Hint    *struct {
+			Text string `json:"text"`
+		} `json:"hint"`
+	} `json:"targets"`
+}
+
+// runExpedition implements "iptw expedition": show, start or abandon an
+// expedition to several target countries with a deadline.
+func runExpedition(args []string) error {
+	fs := newFlagSet("expedition", "expedition [start [-size N] [-duration 24h] | abandon]",
+		"Show the running or last expedition, start one to several unvisited countries that must all be\n"+
+			"reached before a deadline, or abandon it. Size and duration default to the expedition_size and\n"+
+			"expedition_duration settings.")
+	size := fs.Int("size", 0, "number of countries to reach")
+	duration := fs.String("duration", "", "time to reach them, e.g. 24h or 3d")
+	// The command comes first, followed by its flags
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	scope := localapi.ScopeRead
+	if command != "" {
+		scope = localapi.ScopeWrite
+	}
+	client, _, err := connect(scope)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var info expeditionInfo
+	switch command {
+	case "":
+		err = client.Get(ctx, "/api/v1/expedition", &info)
+	case "start":
+		body := map[string]interface{}{}
+		if *size != 0 {
+			body["size"] = *size
+		}
+		if *duration != "" {
+			body["duration"] = *duration
+		}
+		err = client.Do(ctx, http.MethodPost, "/api/v1/expedition", body, &info)
+	case "abandon":
+		err = client.Do(ctx, http.MethodDelete, "/api/v1/expedition", nil, &info)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown expedition command %q", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.ID == "" {
+		fmt.Println("No expedition yet: start one with iptw expedition start")
+		return nil
+	}
+	if info.Active {
+		left := time.Duration(info.RemainingSeconds) * time.Second
+		fmt.Printf("Expedition %s: %d of %d reached, %s left (until %s)\n", info.ID, info.Reached, len(info.Targets), left.Round(time.Minute), info.Deadline.Local().Format("2006-01-02 15:04"))
+	} else {
+		fmt.Printf("Expedition %s %s: %d of %d reached\n", info.ID, info.Outcome, info.Reached, len(info.Targets))
+	}
+	for _, target := range info.Targets {
+		switch {
+		case target.Reached != nil:
+			fmt.Printf("  ✓ %s (%s)\n", target.Country, target.Reached.Local().Format("2006-01-02 15:04"))
+		case target.Hint != nil && target.Hint.Text != "":
+			fmt.Printf("  · %s: %s\n", target.Country, target.Hint.Text)
+		default:
+			fmt.Printf("  · %s\n", target.Country)
+		}
+	}
+	return nil
+}
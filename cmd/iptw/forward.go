@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"iptw/internal/control"
+)
+
+// dialControl connects to the control socket of the running instance.
+func dialControl() (*control.Client, error) {
+	path, err := control.DefaultSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	return control.Dial(path)
+}
+
+// forwardLaunch hands a launch over to the running instance by calling
+// method, one of show_map, reload or quit. It reports false when no instance
+// answers on the control socket.
+func forwardLaunch(method string) (bool, error) {
+	conn, err := dialControl()
+	if err != nil {
+		return false, nil
+	}
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := conn.Call(ctx, method, nil, nil); err != nil {
+		return true, fmt.Errorf("the running iptw could not %s: %w", forwardedActions[method], err)
+	}
+	return true, nil
+}
+
+// forwardedActions describes the methods a launch can forward.
+var forwardedActions = map[string]string{
+	control.MethodShowMap: "open the map",
+	control.MethodReload:  "reload the config",
+	control.MethodQuit:    "quit",
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"iptw/internal/localapi"
+)
+
+// runInstance implements "iptw instance": print the URL of the running
+// instance and a token, so scripts can call the API.
+func runInstance(args []string) error {
+	fs := flag.NewFlagSet("instance", flag.ContinueOnError)
+	var scopeName string
+	var asJSON bool
+	fs.StringVar(&scopeName, "scope", "write", "Scope of the printed token: read or write")
+	fs.BoolVar(&asJSON, "json", false, "Print JSON instead of shell variable assignments")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: iptw instance [flags]")
+		fmt.Fprintln(fs.Output(), "Print the URL of the running iptw and an API token, e.g. eval \"$(iptw instance)\".")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	scope, err := localapi.ParseScope(scopeName)
+	if err != nil {
+		return err
+	}
+
+	inst, token, err := instanceToken(scope)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			localapi.Instance
+			Token string `json:"token"`
+			Scope string `json:"scope"`
+		}{inst, token.Value, string(token.Scope)})
+	}
+	fmt.Printf("IPTW_URL=%s\n", shellQuote(inst.URL))
+	fmt.Printf("IPTW_TOKEN=%s\n", shellQuote(token.Value))
+	if inst.CertFile != "" {
+		fmt.Printf("IPTW_CACERT=%s\n", shellQuote(inst.CertFile))
+	}
+	return nil
+}
+
+// runToken implements "iptw token": list, create and revoke API tokens.
+func runToken(args []string) error {
+	fs := flag.NewFlagSet("token", flag.ContinueOnError)
+	var scopeName string
+	fs.StringVar(&scopeName, "scope", "read", "Scope of a created token: read or write")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: iptw token list | create [-scope read|write] NAME | revoke NAME")
+		fmt.Fprintln(fs.Output(), "Manage the API tokens in ~/.config/iptw/api-tokens. Changes apply to a running iptw immediately.")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	command := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	tokens, err := loadTokens()
+	if err != nil {
+		return err
+	}
+	switch command {
+	case "list":
+		for _, token := range tokens.List() {
+			fmt.Printf("%-20s %-5s %s\n", token.Name, token.Scope, token.Value)
+		}
+		return nil
+	case "create":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("expected a token name")
+		}
+		scope, err := localapi.ParseScope(scopeName)
+		if err != nil {
+			return err
+		}
+		token, err := tokens.Create(fs.Arg(0), scope)
+		if err != nil {
+			return err
+		}
+		fmt.Println(token.Value)
+		return nil
+	case "revoke":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("expected a token name")
+		}
+		return tokens.Revoke(fs.Arg(0))
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown token command %q", command)
+	}
+}
+
+// loadTokens opens the API token file, creating it if needed.
+func loadTokens() (*localapi.Tokens, error) {
+	path, err := localapi.DefaultTokensPath()
+	if err != nil {
+		return nil, err
+	}
+	return localapi.LoadTokens(path)
+}
+
+// shellQuote quotes a value for POSIX shells.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
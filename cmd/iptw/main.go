@@ -1,13 +1,17 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"sort"
 
 	"iptw/internal/config"
+	"iptw/internal/control"
 	"iptw/internal/geoip"
 	"iptw/internal/gui"
 	"iptw/internal/logging"
@@ -22,15 +26,82 @@ var (
 	GitCommit = "unknown"
 )
 
+// subcommand runs to completion without starting the tray application.
+type subcommand struct {
+	run         func(args []string) error
+	description string
+}
+
+// subcommands by name; most talk to the running instance through its API or
+// work on the state files in ~/.config/iptw.
+var subcommands = map[string]subcommand{
+	"status":       {runStatus, "Show the game status"},
+	"countries":    {runCountries, "List the visited countries"},
+	"target":       {runTarget, "Show, choose or queue target countries and the pool they are drawn from"},
+	"expedition":   {runExpedition, "Show, start or abandon an expedition to several countries"},
+	"imprison":     {runImprison, "Send a country to Matrix Prison"},
+	"achievements": {runAchievements, "List the achievements and their progress"},
+	"challenges":   {runChallenges, "Show the daily and weekly challenges and streaks"},
+	"score":        {runScore, "Show the score, best days and streaks"},
+	"cities":       {runCities, "List the visited cities"},
+	"profile":      {runProfile, "List the player profiles or switch to another one"},
+	"team":         {runTeam, "Show the team leaderboard or manage the team key"},
+	"export":       {runExport, "Write the travel history as JSON lines"},
+	"import":       {runImport, "Merge exported travel history"},
+	"reset":        {runReset, "Start the travel history over"},
+	"render":       {runRender, "Render the map of the travel history as a PNG image"},
+	"timelapse":    {runTimelapse, "Render the travel history as an animation"},
+	"doctor":       {runDoctor, "Check the installation and the state files"},
+	"instance":     {runInstance, "Print the URL of the running iptw and an API token"},
+	"token":        {runToken, "Manage API tokens"},
+}
+
+// usage prints the flags of the application and the subcommands.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: iptw [flags]          start the tray application")
+	fmt.Fprintln(out, "       iptw COMMAND [args]   run a command; iptw COMMAND -h for help")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "\nCommands:")
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-13s %s\n", name, subcommands[name].description)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			if err := subcommand.run(os.Args[2:]); err != nil {
+				if !errors.Is(err, flag.ErrHelp) {
+					fmt.Fprintf(os.Stderr, "iptw %s: %v\n", os.Args[1], err)
+					os.Exit(1)
+				}
+			}
+			return
+		}
+	}
+
 	var forceStart bool
 	var showVersion bool
 	var foreground bool
 	var pprofAddr string
+	var headless bool
+	var reloadConfig bool
+	var quitInstance bool
 	flag.BoolVar(&forceStart, "force", false, "Force start even if another instance appears to be running")
 	flag.BoolVar(&showVersion, "version", false, "Show version information")
 	flag.BoolVar(&foreground, "foreground", false, "Run in the foreground (keep terminal attached)")
+	flag.BoolVar(&headless, "headless", false, "Run without the system tray, as a data collector serving the HTTP API (implies --foreground)")
+	flag.BoolVar(&reloadConfig, "reload", false, "Make the running iptw re-read its config file, then exit")
+	flag.BoolVar(&quitInstance, "quit", false, "Make the running iptw quit, then exit")
 	flag.StringVar(&pprofAddr, "pprof", "", "Enable pprof profiling server on the given address (e.g. 127.0.0.1:6060)")
+	flag.Usage = usage
 	flag.Parse()
 
 	// Handle version request
@@ -41,10 +112,37 @@ func main() {
 		return
 	}
 
+	// Hand the launch over to the running instance instead of failing with
+	// "already running": a second launch opens its map, --reload and --quit
+	// control it
+	if reloadConfig || quitInstance || (!forceStart && !headless) {
+		method := control.MethodShowMap
+		switch {
+		case quitInstance:
+			method = control.MethodQuit
+		case reloadConfig:
+			method = control.MethodReload
+		}
+		forwarded, err := forwardLaunch(method)
+		if err != nil {
+			fatalError("Already Running", err.Error())
+			os.Exit(1)
+		}
+		if forwarded {
+			return
+		}
+		if method != control.MethodShowMap {
+			fatalError("Not Running", "iptw is not running")
+			os.Exit(1)
+		}
+	}
+
 	// On macOS/Linux: detach from the terminal so the user can close the
 	// launching shell.  The process re-execs itself with --foreground and
-	// the parent exits immediately.  This is a no-op on Windows.
-	maybeDaemonize(foreground)
+	// the parent exits immediately.  This is a no-op on Windows.  Headless
+	// runs stay attached so service managers and containers can supervise
+	// them.
+	maybeDaemonize(foreground || headless)
 
 	// Start pprof server if requested.
 	if pprofAddr != "" {
@@ -99,7 +197,7 @@ func main() {
 		}
 	}()
 
-	if err := run(); err != nil {
+	if err := run(headless); err != nil {
 		fatalError("Application Error", err.Error())
 	}
 }
@@ -107,7 +205,7 @@ func main() {
 // run contains the main application logic. Returning an error (instead of
 // calling os.Exit) ensures that all deferred cleanup in main() executes,
 // most importantly releasing the singleton lock file.
-func run() error {
+func run(headless bool) error {
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -124,16 +222,31 @@ func run() error {
 	}
 	defer func() { _ = geoipDB.Close() }()
 
+	// Autonomous system lookups need a separately downloaded GeoLite2-ASN database
+	if asnPath, err := geoip.DefaultASNPath(); err == nil {
+		if _, err := os.Stat(asnPath); err == nil {
+			if err := geoipDB.LoadASN(asnPath); err != nil {
+				slog.Warn("Failed to load ASN database - ASNs will not be recorded", "error", err)
+			} else {
+				slog.Info("ASN database loaded", "path", asnPath)
+			}
+		}
+	}
+
 	// Initialize network monitor
 	netMon := network.NewMonitor()
 
-	// Create GUI application
+	// Create the engine
 	app, err := gui.NewApp(cfg, geoipDB, netMon)
 	if err != nil {
 		return fmt.Errorf("failed to create application: %w", err)
 	}
 	defer app.Shutdown()
 
+	if headless {
+		slog.Info("Starting IP Travel Wallpaper (iptw) without the system tray")
+		return app.RunHeadless()
+	}
 	slog.Info("Starting IP Travel Wallpaper (iptw)")
-	return app.Run()
+	return gui.NewTray(app).Run()
 }
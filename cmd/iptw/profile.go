@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"iptw/internal/config"
+	"iptw/internal/localapi"
+	"iptw/internal/profile"
+)
+
+// profileInfo is a player profile as returned by the API.
+type profileInfo struct {
+	Name    string `json:"name"`
+	Active  bool   `json:"active"`
+	Visited int    `json:"visited"`
+	History string `json:"history,omitempty"`
+}
+
+// profileList is returned by the API and printed by "iptw profile -json".
+type profileList struct {
+	Active   string        `json:"active"`
+	Profiles []profileInfo `json:"profiles"`
+	Routes   []string      `json:"routes"`
+}
+
+// runProfile implements "iptw profile": list the player profiles or switch
+// to another one. Without a running iptw, the profiles are read from disk and
+// a switch only changes the config file.
+func runProfile(args []string) error {
+	fs := newFlagSet("profile", "profile [-json] [switch NAME]",
+		"List the player profiles, or switch to another one, creating it if needed. Each profile has its\n"+
+			"own game, achievements and travel history in ~/.config/iptw/profiles/NAME.")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	// The command comes first, followed by its flags
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var list profileList
+	switch command {
+	case "":
+		if fs.NArg() > 0 {
+			fs.Usage()
+			return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+		}
+		client, _, err := connect(localapi.ScopeRead)
+		if err == nil {
+			err = client.Get(context.Background(), "/api/v1/profiles", &list)
+		} else {
+			list, err = localProfiles()
+		}
+		if err != nil {
+			return err
+		}
+	case "switch":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return fmt.Errorf("expected one profile name")
+		}
+		name := fs.Arg(0)
+		if !profile.ValidName(name) {
+			return fmt.Errorf("invalid profile name %q: use lowercase letters, digits, - and _", name)
+		}
+		client, _, err := connect(localapi.ScopeWrite)
+		if err == nil {
+			err = client.Do(context.Background(), http.MethodPut, "/api/v1/profiles/active", map[string]string{"name": name}, &list)
+		} else {
+			list, err = switchLocalProfile(name)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown profile command %q", command)
+	}
+
+	if *asJSON {
+		return printJSON(list)
+	}
+	for _, p := range list.Profiles {
+		mark := " "
+		if p.Active {
+			mark = "*"
+		}
+		fmt.Printf("%s %-20s %s\n", mark, p.Name, p.History)
+	}
+	if len(list.Routes) > 0 {
+		fmt.Printf("Routes: %s\n", strings.Join(list.Routes, ", "))
+	}
+	return nil
+}
+
+// localProfiles lists the profiles on disk while iptw is not running.
+func localProfiles() (profileList, error) {
+	names, err := profile.List()
+	if err != nil {
+		return profileList{}, err
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return profileList{}, err
+	}
+	list := profileList{Active: cfg.Profile, Profiles: []profileInfo{}, Routes: []string{}}
+	if !slices.Contains(names, cfg.Profile) {
+		names = append(names, cfg.Profile)
+	}
+	for _, name := range names {
+		info := profileInfo{Name: name, Active: name == cfg.Profile}
+		if journalPath, err := profile.HistoryPath(name); err == nil {
+			info.History = journalPath
+		}
+		list.Profiles = append(list.Profiles, info)
+	}
+	routes, _ := profile.ParseRoutes(cfg.ProfileRoutes) // validated when loaded
+	for _, route := range routes {
+		list.Routes = append(list.Routes, route.String())
+	}
+	return list, nil
+}
+
+// switchLocalProfile makes another profile the active one in the config file,
+// for the next start of iptw.
+func switchLocalProfile(name string) (profileList, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return profileList{}, err
+	}
+	if err := cfg.Set("profile", name); err != nil {
+		return profileList{}, err
+	}
+	dir, err := configDir()
+	if err != nil {
+		return profileList{}, err
+	}
+	if err := cfg.Save(filepath.Join(dir, "iptwrc")); err != nil {
+		return profileList{}, err
+	}
+	return localProfiles()
+}
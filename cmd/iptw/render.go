@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+
+	"iptw/internal/resources"
+	"iptw/internal/timelapse"
+)
+
+// runRender implements "iptw render": draw the map of the travel history as
+// a PNG image. It works whether or not iptw is running.
+func runRender(args []string) error {
+	fs := newFlagSet("render", "render [flags]", "Render the map of the travel history as a PNG image.")
+	output := fs.String("o", "map.png", "Output PNG file")
+	width := fs.Int("width", timelapse.DefaultWidth, fmt.Sprintf("Image width in pixels, at most %d; the height is half of it", timelapse.MaxWidth))
+	themeName := fs.String("theme", "", "Theme name (default: the configured theme)")
+	dark := fs.Bool("dark", false, "Shorthand for -theme dark")
+	labels := fs.String("labels", "", "Country labels: off, names or iso (default: the configured labels)")
+	legend := fs.String("legend", "", "Legend position: off, top-left, top-right, bottom-left or bottom-right (default: the configured legend)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *width > timelapse.MaxWidth {
+		return fmt.Errorf("width %d is larger than %d", *width, timelapse.MaxWidth)
+	}
+	if *dark {
+		*themeName = resources.ThemeDark
+	}
+
+	day, err := replayToday()
+	if err != nil {
+		return err
+	}
+	renderer, err := newRenderer(mapStyle{theme: *themeName, labels: *labels, legend: *legend}, timelapse.Options{Width: *width})
+	if err != nil {
+		return err
+	}
+	img, err := renderer.RenderMap(day)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *output, err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to encode %s: %w", *output, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %dx%d map of %d countries to %s\n", img.Bounds().Dx(), img.Bounds().Dy(), day.Visited, *output)
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"iptw/internal/history"
+	"iptw/internal/resources"
+	"iptw/internal/score"
+)
+
+// runScore implements "iptw score": compute the score from the travel
+// history. It is safe while iptw is running.
+func runScore(args []string) error {
+	fs := newFlagSet("score", "score [-json]",
+		"Show the daily, weekly and all-time score, the best days and the streaks.\n"+
+			"The score is recomputed from the travel history, whether iptw is running or not.")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	journalPath, err := journalPath()
+	if err != nil {
+		return err
+	}
+	scorer, err := score.Replay(history.OpenReadOnly(journalPath), func(country string) string {
+		alpha2, _ := resources.GetAlpha2ByName(country)
+		return alpha2
+	})
+	if err != nil {
+		return err
+	}
+	summary := scorer.Summary(time.Now())
+	if *asJSON {
+		return printJSON(summary)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Today:\t%d\n", summary.Today)
+	fmt.Fprintf(tw, "This week:\t%d\n", summary.Week)
+	fmt.Fprintf(tw, "All time:\t%d\n", summary.Total)
+	for _, reason := range score.Reasons {
+		fmt.Fprintf(tw, "  %s:\t%d\n", reason, summary.Reasons[reason])
+	}
+	fmt.Fprintf(tw, "Streak:\t%d days, longest %d\n", summary.Streak, summary.LongestStreak)
+	for i, day := range summary.BestDays {
+		fmt.Fprintf(tw, "Best day #%d:\t%s, %d points\n", i+1, day.Date, day.Points)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"iptw/internal/history"
+	"iptw/internal/singleton"
+)
+
+// withoutInstance runs fn while holding the singleton lock, so iptw cannot
+// start while the state files are rewritten.
+func withoutInstance(fn func() error) error {
+	lock, err := singleton.NewLock("iptw")
+	if err != nil {
+		return fmt.Errorf("failed to create singleton lock: %w", err)
+	}
+	if err := lock.Acquire(); err != nil {
+		return fmt.Errorf("iptw is running, quit it first: %w", err)
+	}
+	defer func() { _ = lock.Release() }()
+	return fn()
+}
+
+// runExport implements "iptw export": write the travel history in the
+// journal format. It is safe while iptw is running.
+func runExport(args []string) error {
+	fs := newFlagSet("export", "export [-o FILE] [-since YYYY-MM-DD]", "Write the travel history as JSON lines, for backups or another machine.")
+	output := fs.String("o", "-", "Output file, or - for stdout")
+	since := fs.String("since", "", "Only events from this day on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	sinceDate, err := parseDate(*since)
+	if err != nil {
+		return err
+	}
+	journalPath, err := journalPath()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if *output != "-" {
+		if file, err = os.Create(*output); err != nil {
+			return fmt.Errorf("failed to create %s: %w", *output, err)
+		}
+		w = file
+	}
+	n, err := history.Export(history.OpenReadOnly(journalPath), w, sinceDate)
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		fmt.Printf("Exported %d events to %s\n", n, *output)
+	}
+	return nil
+}
+
+// runImport implements "iptw import": merge exported events into the travel
+// history. iptw must not be running.
+func runImport(args []string) error {
+	fs := newFlagSet("import", "import FILE", "Merge events exported with \"iptw export\" into the travel history; - reads stdin. iptw must not be running.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected a file to import")
+	}
+	var r io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		defer func() { _ = file.Close() }()
+		r = file
+	}
+	journalPath, err := journalPath()
+	if err != nil {
+		return err
+	}
+
+	return withoutInstance(func() error {
+		added, err := history.Import(journalPath, r)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d new events\n", added)
+		return nil
+	})
+}
+
+// runReset implements "iptw reset": start the travel history over. The old
+// journal is kept as a backup. iptw must not be running.
+func runReset(args []string) error {
+	fs := newFlagSet("reset", "reset [-yes]", "Start the travel history over; the old history is kept as a backup. iptw must not be running.")
+	yes := fs.Bool("yes", false, "Do not ask for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	journalPath, err := journalPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(journalPath); os.IsNotExist(err) {
+		fmt.Println("The travel history is already empty")
+		return nil
+	}
+	if !*yes {
+		fmt.Print("Start the travel history over? Type yes to confirm: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+			return fmt.Errorf("reset cancelled")
+		}
+	}
+
+	return withoutInstance(func() error {
+		backup := fmt.Sprintf("%s.%s.bak", journalPath, time.Now().Format("20060102-150405"))
+		if err := os.Rename(journalPath, backup); err != nil {
+			return fmt.Errorf("failed to back up the travel history: %w", err)
+		}
+		fmt.Printf("Travel history reset; the old history is in %s\n", backup)
+		return nil
+	})
+}
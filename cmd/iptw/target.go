@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"iptw/internal/localapi"
+)
+
+// targetInfo is the target as returned by the API.
+type targetInfo struct {
+	Country string     `json:"country"`
+	SetAt   *time.Time `json:"set_at,omitempty"`
+	Hint    *struct {
+		Text string `json:"text"`
+	} `json:"hint,omitempty"`
+	Queue []string `json:"queue"`
+	Pool  string   `json:"pool"`
+	Mode  string   `json:"mode"`
+}
+
+// targetQueue is the target queue as sent to and returned by the API.
+type targetQueue struct {
+	Countries []string `json:"countries"`
+}
+
+// runTarget implements "iptw target": show, re-roll or choose the target
+// country, manage the queue of upcoming targets and the pool they are drawn
+// from.
+func runTarget(args []string) error {
+	fs := newFlagSet("target", "target [next | set COUNTRY | queue [add|set COUNTRY... | clear] | pool [REGION,...|all] | mode random|weighted]",
+		"Show the target country of the running iptw, draw the next one or choose it, queue upcoming targets,\n"+
+			"and restrict draws to regions such as western-africa or favour rare countries.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	scope := localapi.ScopeRead
+	if fs.NArg() > 1 || (fs.NArg() == 1 && fs.Arg(0) != "queue" && fs.Arg(0) != "pool") {
+		scope = localapi.ScopeWrite
+	}
+	client, _, err := connect(scope)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var target targetInfo
+	switch fs.Arg(0) {
+	case "":
+		err = client.Get(ctx, "/api/v1/target", &target)
+	case "next", "reroll":
+		err = client.Do(ctx, http.MethodPost, "/api/v1/target/reroll", nil, &target)
+	case "set":
+		if fs.NArg() != 2 {
+			return fmt.Errorf("expected a country name or ISO code")
+		}
+		err = client.Do(ctx, http.MethodPut, "/api/v1/target", map[string]string{"country": fs.Arg(1)}, &target)
+	case "queue":
+		return runTargetQueue(ctx, client, fs.Args()[1:])
+	case "pool":
+		return runTargetPool(ctx, client, fs.Args()[1:])
+	case "mode":
+		if fs.NArg() != 2 || (fs.Arg(1) != "random" && fs.Arg(1) != "weighted") {
+			return fmt.Errorf("expected random or weighted")
+		}
+		if err := client.Do(ctx, http.MethodPatch, "/api/v1/config", map[string]string{"target_mode": fs.Arg(1)}, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Targets are drawn %s\n", map[string]string{"random": "at random", "weighted": "weighted towards rare countries and nearly finished regions"}[fs.Arg(1)])
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown target command %q", fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	if target.Country == "" {
+		fmt.Println("No target: every country has been visited")
+	} else {
+		fmt.Print(target.Country)
+		if target.SetAt != nil {
+			fmt.Printf(" (since %s)", target.SetAt.Local().Format("2006-01-02 15:04"))
+		}
+		fmt.Println()
+		if target.Hint != nil && target.Hint.Text != "" {
+			fmt.Printf("Hint: %s\n", target.Hint.Text)
+		}
+	}
+	if len(target.Queue) > 0 {
+		fmt.Printf("Next: %s\n", strings.Join(target.Queue, ", "))
+	}
+	if target.Pool != "" && target.Pool != "all" {
+		fmt.Printf("Pool: %s\n", target.Pool)
+	}
+	if target.Mode == "weighted" {
+		fmt.Println("Draws are weighted towards rare countries and nearly finished regions")
+	}
+	return nil
+}
+
+// runTargetQueue implements "iptw target queue".
+func runTargetQueue(ctx context.Context, client apiClient, args []string) error {
+	var queue targetQueue
+	var err error
+	switch {
+	case len(args) == 0:
+		err = client.Get(ctx, "/api/v1/target/queue", &queue)
+	case args[0] == "add" && len(args) > 1:
+		err = client.Do(ctx, http.MethodPost, "/api/v1/target/queue", targetQueue{Countries: args[1:]}, &queue)
+	case args[0] == "set":
+		err = client.Do(ctx, http.MethodPut, "/api/v1/target/queue", targetQueue{Countries: append([]string{}, args[1:]...)}, &queue)
+	case args[0] == "clear" && len(args) == 1:
+		err = client.Do(ctx, http.MethodDelete, "/api/v1/target/queue", nil, &queue)
+	default:
+		return fmt.Errorf("expected queue, queue add COUNTRY..., queue set COUNTRY... or queue clear")
+	}
+	if err != nil {
+		return err
+	}
+	if len(queue.Countries) == 0 {
+		fmt.Println("No targets queued")
+		return nil
+	}
+	for i, country := range queue.Countries {
+		fmt.Printf("%d. %s\n", i+1, country)
+	}
+	return nil
+}
+
+// runTargetPool implements "iptw target pool": list the regions, or set the
+// pool targets are drawn from.
+func runTargetPool(ctx context.Context, client apiClient, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("expected comma-separated regions or all")
+	}
+	if len(args) == 1 {
+		if err := client.Do(ctx, http.MethodPatch, "/api/v1/config", map[string]string{"target_pool": args[0]}, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Targets are drawn from %s\n", args[0])
+		return nil
+	}
+
+	var list struct {
+		Pool    string `json:"pool"`
+		Regions []struct {
+			ID        string `json:"id"`
+			Parent    string `json:"parent"`
+			Countries int    `json:"countries"`
+			Unvisited int    `json:"unvisited"`
+		} `json:"regions"`
+	}
+	if err := client.Get(ctx, "/api/v1/target/regions", &list); err != nil {
+		return err
+	}
+	pool := make(map[string]bool)
+	for _, id := range strings.Split(list.Pool, ",") {
+		pool[id] = true
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tCOUNTRIES\tUNVISITED\t")
+	for _, region := range list.Regions {
+		name := region.ID
+		if region.Parent != "" {
+			name = "  " + name
+		}
+		if pool[region.ID] {
+			name += " *"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t\n", name, region.Countries, region.Unvisited)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Pool: %s\n", list.Pool)
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"iptw/internal/team"
+)
+
+// runTeam implements "iptw team": show the leaderboard of the team server, or
+// print or set the team key.
+func runTeam(args []string) error {
+	fs := newFlagSet("team", "team [-json] [key [KEY]]",
+		"Show the leaderboard of the team server set by team_server. \"team key\" prints the team key,\n"+
+			"creating one to share with the team when there is none; \"team key KEY\" saves the key you were given.")
+	asJSON := fs.Bool("json", false, "Print JSON")
+	// The command comes first, followed by its flags
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch command {
+	case "":
+		if fs.NArg() > 0 {
+			fs.Usage()
+			return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+		}
+		return showLeaderboard(*asJSON)
+	case "key":
+		if fs.NArg() > 1 {
+			fs.Usage()
+			return fmt.Errorf("expected at most one key")
+		}
+		return teamKey(fs.Arg(0))
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown team command %q", command)
+	}
+}
+
+// teamKey saves key as the team key, or prints the team key, creating it
+// when key is empty.
+func teamKey(key string) error {
+	path, err := team.DefaultKeyPath()
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		if err := team.SaveKey(path, key); err != nil {
+			return err
+		}
+		fmt.Printf("Saved the team key to %s\n", path)
+		return nil
+	}
+
+	key, err = team.LoadKey(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if key, err = team.NewKey(); err != nil {
+			return err
+		}
+		err = team.SaveKey(path, key)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
+
+// showLeaderboard prints the leaderboard of the configured team server.
+func showLeaderboard(asJSON bool) error {
+	cfg, err := existingConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.TeamServer == "off" {
+		return fmt.Errorf("no team server; set team_server in ~/.config/iptw/iptwrc")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	board, err := fetchLeaderboard(ctx, cfg.TeamServer)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(board)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tPLAYER\tSCORE\tTODAY\tCOUNTRIES\tPRISON\tACHIEVEMENTS\tUPDATED")
+	for _, s := range board.Standings {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n", s.Rank, s.Player, s.Score.Total, s.Score.Today, s.Visited, s.Prison, s.Achievements, s.Updated.Local().Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(tw, "%d players; team map at %s\n", board.Players, cfg.TeamServer)
+	return tw.Flush()
+}
+
+// fetchLeaderboard returns the leaderboard of the team server at serverURL.
+func fetchLeaderboard(ctx context.Context, serverURL string) (team.Leaderboard, error) {
+	var board team.Leaderboard
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(serverURL, "/")+"/api/v1/leaderboard", nil)
+	if err != nil {
+		return board, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return board, fmt.Errorf("failed to reach team server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return board, fmt.Errorf("team server answered %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&board); err != nil {
+		return board, fmt.Errorf("failed to decode leaderboard: %w", err)
+	}
+	return board, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"iptw/internal/config"
+	"iptw/internal/history"
+	"iptw/internal/resources"
+	"iptw/internal/timelapse"
+)
+
+// runTimelapse implements "iptw timelapse": render the travel history as an
+// animation without starting the tray application.
+func runTimelapse(args []string) error {
+	fs := flag.NewFlagSet("timelapse", flag.ContinueOnError)
+	var from, to, format, output, themeName, labels, legend string
+	var fps, width int
+	var dark bool
+	fs.StringVar(&from, "from", "", "First day (YYYY-MM-DD); defaults to the start of the history")
+	fs.StringVar(&to, "to", "", "Last day (YYYY-MM-DD); defaults to today")
+	fs.StringVar(&format, "format", "", "Output format: gif, apng or frames (default: from the -o extension)")
+	fs.StringVar(&output, "o", "timelapse.gif", "Output file, or directory for -format frames")
+	fs.IntVar(&fps, "fps", timelapse.DefaultFPS, "Frames (days) per second")
+	fs.IntVar(&width, "width", timelapse.DefaultWidth, "Frame width in pixels")
+	fs.StringVar(&themeName, "theme", "", "Theme name (default: the configured theme)")
+	fs.BoolVar(&dark, "dark", false, "Shorthand for -theme dark")
+	fs.StringVar(&labels, "labels", "", "Country labels: off, names or iso (default: the configured labels)")
+	fs.StringVar(&legend, "legend", "", "Legend position: off, top-left, top-right, bottom-left or bottom-right (default: the configured legend)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: iptw timelapse [flags]")
+		fmt.Fprintln(fs.Output(), "Render the travel history as an animated GIF, APNG or PNG sequence.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fromDate, err := parseDate(from)
+	if err != nil {
+		return err
+	}
+	toDate, err := parseDate(to)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		if format, err = timelapse.FormatFromPath(output); err != nil {
+			return err
+		}
+	}
+
+	if dark {
+		themeName = resources.ThemeDark
+	}
+	journalPath, err := journalPath()
+	if err != nil {
+		return err
+	}
+	days, err := timelapse.Replay(history.OpenReadOnly(journalPath), fromDate, toDate)
+	if err != nil {
+		return err
+	}
+	renderer, err := newRenderer(mapStyle{theme: themeName, labels: labels, legend: legend}, timelapse.Options{FPS: fps, Width: width})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch format {
+	case timelapse.FormatFrames:
+		err = renderer.WriteFrames(ctx, output, days)
+	case timelapse.FormatGIF, timelapse.FormatAPNG:
+		err = writeTimelapseFile(ctx, renderer, format, output, days)
+	default:
+		return fmt.Errorf("unknown format %q; use gif, apng or frames", format)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d days (%s to %s) to %s\n", len(days),
+		days[0].Date.Format(time.DateOnly), days[len(days)-1].Date.Format(time.DateOnly), output)
+	return nil
+}
+
+// mapStyle selects how maps rendered from the command line look. Empty
+// fields use the configured value.
+type mapStyle struct {
+	theme  string
+	labels string
+	legend string
+}
+
+// newRenderer returns a renderer with the map resources loaded and opts
+// completed from style and the config.
+func newRenderer(style mapStyle, opts timelapse.Options) (*timelapse.Renderer, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if style.theme == "" {
+		style.theme = cfg.Theme
+	}
+	if style.labels == "" {
+		style.labels = cfg.Labels
+	}
+	if style.legend == "" {
+		style.legend = cfg.Legend
+	}
+	if opts.Theme, err = resources.ResolveTheme(style.theme, cfg.Black); err != nil {
+		return nil, err
+	}
+	opts.Insets = resources.NewInsetOptions(cfg.InsetMinArea)
+	opts.Labels = resources.NewLabelOptions(style.labels, cfg.LabelCountries != "all", cfg.LabelMinArea)
+	opts.Legend = resources.NewLegendOptions(style.legend)
+
+	naturalEarth, err := resources.LoadNaturalEarthData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Natural Earth data: %w", err)
+	}
+	fonts, err := resources.LoadFonts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fonts: %w", err)
+	}
+	flags, err := resources.LoadFlags()
+	if err != nil {
+		flags = nil // Render without flags
+	}
+	return &timelapse.Renderer{NaturalEarth: naturalEarth, Flags: flags, Fonts: fonts, Options: opts}, nil
+}
+
+// writeTimelapseFile renders an animated GIF or APNG to path.
+func writeTimelapseFile(ctx context.Context, renderer *timelapse.Renderer, format, path string, days []timelapse.Day) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if format == timelapse.FormatGIF {
+		err = renderer.WriteGIF(ctx, file, days)
+	} else {
+		err = renderer.WriteAPNG(ctx, file, days)
+	}
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// parseDate parses a YYYY-MM-DD date in local time; empty yields the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (want YYYY-MM-DD)", value)
+	}
+	return t, nil
+}
@@ -9,6 +9,7 @@ require (
 	github.com/oschwald/geoip2-golang v1.13.0
 	github.com/paulmach/orb v0.12.0
 	github.com/skratchdot/open-golang v0.0.0-20200116055534-eef842397966
+	golang.org/x/image v0.36.0
 )
 
 require (
@@ -20,6 +21,5 @@ require (
 	github.com/oschwald/maxminddb-golang v1.13.1 // indirect
 	github.com/stretchr/testify v1.11.1 // indirect
 	go.mongodb.org/mongo-driver v1.17.9 // indirect
-	golang.org/x/image v0.36.0 // indirect
 	golang.org/x/sys v0.41.0 // indirect
 )
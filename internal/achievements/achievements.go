@@ -2,7 +2,9 @@
 package achievements
 
 import (
+	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 )
 
@@ -113,8 +115,53 @@ func (am *AchievementManager) initializeAchievements() {
 		Target:      10,
 		Countries:   getRareCountries(),
 	}
+
+	// Expedition Achievements
+	am.achievements["expedition_leader"] = &Achievement{
+		ID:          "expedition_leader",
+		Name:        "Expedition Leader",
+		Description: "Complete an expedition",
+		Target:      1,
+	}
+
+	am.achievements["seasoned_explorer"] = &Achievement{
+		ID:          "seasoned_explorer",
+		Name:        "Seasoned Explorer",
+		Description: "Complete 10 expeditions",
+		Target:      10,
+	}
+
+	am.achievements["grand_expedition"] = &Achievement{
+		ID:          "grand_expedition",
+		Name:        "Grand Expedition",
+		Description: "Complete an expedition to 5 or more countries",
+		Target:      5,
+	}
+
+	// City Achievements
+	am.achievements["city_hopper"] = &Achievement{
+		ID:          "city_hopper",
+		Name:        "City Hopper",
+		Description: "Visit 25 cities",
+		Target:      25,
+	}
+
+	am.achievements["urban_legend"] = &Achievement{
+		ID:          "urban_legend",
+		Name:        "Urban Legend",
+		Description: "Visit 100 cities",
+		Target:      100,
+	}
 }
 
+// CityExplorerTarget is the number of cities of one country that unlocks its
+// City Explorer achievement.
+const CityExplorerTarget = 5
+
+// cityExplorerPrefix starts the IDs of the per-country City Explorer
+// achievements.
+const cityExplorerPrefix = "city_explorer_"
+
 // UpdateProgress updates achievement progress when a country is visited
 func (am *AchievementManager) UpdateProgress(countryName string, totalCountriesVisited int) []string {
 	var newUnlocks []string
@@ -125,9 +172,12 @@ func (am *AchievementManager) UpdateProgress(countryName string, totalCountriesV
 		}
 
 		// Update progress based on achievement type
-		switch achievement.ID {
-		case "world_traveler", "global_nomad":
+		switch {
+		case achievement.ID == "world_traveler" || achievement.ID == "global_nomad":
 			achievement.Progress = totalCountriesVisited
+		case strings.HasPrefix(achievement.ID, cityExplorerPrefix):
+			// Counts cities, see RecordCity
+			continue
 		default:
 			// Region/continent specific achievements
 			if achievement.Countries != nil {
@@ -151,6 +201,85 @@ func (am *AchievementManager) UpdateProgress(countryName string, totalCountriesV
 	return newUnlocks
 }
 
+// RecordExpedition updates the expedition achievements when an expedition to
+// size countries is completed in time
+func (am *AchievementManager) RecordExpedition(size int) []string {
+	var newUnlocks []string
+
+	for _, id := range []string{"expedition_leader", "seasoned_explorer", "grand_expedition"} {
+		achievement := am.achievements[id]
+		if achievement.Unlocked {
+			continue
+		}
+
+		if id == "grand_expedition" {
+			// Progress is the largest expedition completed so far
+			achievement.Progress = max(achievement.Progress, min(size, achievement.Target))
+		} else {
+			achievement.Progress++
+		}
+
+		if achievement.Progress >= achievement.Target {
+			achievement.Unlocked = true
+			newUnlocks = append(newUnlocks, achievement.ID)
+			slog.Info("Achievement unlocked!",
+				"achievement", achievement.Name,
+				"description", achievement.Description,
+			)
+		}
+	}
+
+	return newUnlocks
+}
+
+// RecordCity updates the city achievements when a new city is visited, given
+// the number of cities visited in its country and in total. The City Explorer
+// achievement of the country is created with its first city.
+func (am *AchievementManager) RecordCity(countryName string, citiesInCountry, totalCities int) []string {
+	var newUnlocks []string
+
+	explorerID := cityExplorerPrefix + strings.ToLower(strings.ReplaceAll(countryName, " ", "_"))
+	if _, exists := am.achievements[explorerID]; !exists {
+		am.achievements[explorerID] = &Achievement{
+			ID:          explorerID,
+			Name:        "City Explorer: " + countryName,
+			Description: fmt.Sprintf("Visit %d cities in %s", CityExplorerTarget, countryName),
+			Target:      CityExplorerTarget,
+			Countries:   []string{countryName},
+		}
+	}
+
+	for _, id := range []string{explorerID, "city_hopper", "urban_legend"} {
+		achievement := am.achievements[id]
+		if achievement.Unlocked {
+			continue
+		}
+
+		if id == explorerID {
+			achievement.Progress = min(citiesInCountry, achievement.Target)
+		} else {
+			achievement.Progress = min(totalCities, achievement.Target)
+		}
+
+		if achievement.Progress >= achievement.Target {
+			achievement.Unlocked = true
+			newUnlocks = append(newUnlocks, achievement.ID)
+			slog.Info("Achievement unlocked!",
+				"achievement", achievement.Name,
+				"description", achievement.Description,
+			)
+		}
+	}
+
+	return newUnlocks
+}
+
+// Exchange swaps the achievements and progress of two managers, for
+// switching player profiles
+func (am *AchievementManager) Exchange(other *AchievementManager) {
+	am.achievements, other.achievements = other.achievements, am.achievements
+}
+
 // GetUnlockedAchievements returns only unlocked achievements
 func (am *AchievementManager) GetUnlockedAchievements() []*Achievement {
 	var unlocked []*Achievement
@@ -162,6 +291,38 @@ func (am *AchievementManager) GetUnlockedAchievements() []*Achievement {
 	return unlocked
 }
 
+// GetAllAchievements returns every achievement, locked or not, sorted by ID
+func (am *AchievementManager) GetAllAchievements() []*Achievement {
+	all := make([]*Achievement, 0, len(am.achievements))
+	for _, achievement := range am.achievements {
+		all = append(all, achievement)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
+}
+
+// GetCountryAchievements returns the achievements a visit to the country
+// counts towards, sorted by ID
+func (am *AchievementManager) GetCountryAchievements(countryName string) []*Achievement {
+	var matching []*Achievement
+	for _, achievement := range am.GetAllAchievements() {
+		switch achievement.ID {
+		case "world_traveler", "global_nomad":
+			matching = append(matching, achievement)
+		default:
+			if containsCountry(achievement.Countries, countryName) {
+				matching = append(matching, achievement)
+			}
+		}
+	}
+	return matching
+}
+
+// GetAchievement returns the achievement with the given ID, or nil
+func (am *AchievementManager) GetAchievement(id string) *Achievement {
+	return am.achievements[id]
+}
+
 // UnlockFastestTravelerAchievement creates and unlocks a "fastest traveler" achievement for a specific country
 func (am *AchievementManager) UnlockFastestTravelerAchievement(countryName string) string {
 	achievementID := "fastest_traveler_" + strings.ToLower(strings.ReplaceAll(countryName, " ", "_"))
@@ -13,6 +13,19 @@ import (
 	"time"
 )
 
+// OverlayFileName is the file the composited overlay wallpaper is written to.
+const OverlayFileName = "iptw_overlay.png"
+
+// isIPTWWallpaper reports whether a wallpaper file was written by iptw: the
+// map, the overlay or a timestamped copy of either. Such files are never
+// backed up as the original wallpaper.
+func isIPTWWallpaper(path string) bool {
+	baseName := filepath.Base(path)
+	return strings.Contains(baseName, "iptw_wallpaper_") ||
+		strings.Contains(baseName, "iptw.png") ||
+		strings.Contains(baseName, OverlayFileName)
+}
+
 // SetDesktopBackground sets an image as the desktop background
 // This implementation is macOS-specific using osascript
 // Creates a timestamped copy to force wallpaper refresh
@@ -102,7 +115,7 @@ func setLinuxBackground(imagePath string) error {
 			d.currentConfigGroup = Array("Wallpaper", "org.kde.image", "General");
 			d.writeConfig("Image", "file://%s");
 		}`, imagePath)
-	if err := exec.Command("qdbus", "org.kde.plasmashell", "/PlasmaShell", "org.kde.PlasmaShell.evaluateScript", kdeScript).Run(); err == nil {
+	if err := evaluatePlasmaScript(kdeScript); err == nil {
 		log.Printf("✅ Linux desktop background set successfully using qdbus")
 		return nil
 	}
@@ -185,6 +198,11 @@ func BackupCurrentWallpaper(backupDir string) (string, error) {
 	case "darwin":
 		currentWallpaperPath, err = getMacOSCurrentWallpaper()
 	case "linux":
+		// Plasma keeps one wallpaper per desktop containment, so it is backed
+		// up as a manifest of images rather than a single file.
+		if isKDESession() {
+			return backupKDEWallpapers(backupDir)
+		}
 		currentWallpaperPath, err = getLinuxCurrentWallpaper()
 	case "windows":
 		currentWallpaperPath, err = getWindowsCurrentWallpaper()
@@ -202,8 +220,7 @@ func BackupCurrentWallpaper(backupDir string) (string, error) {
 
 	// Don't backup if the current wallpaper is already an IPTW wallpaper
 	// This prevents overwriting the true "original" with our generated output
-	baseName := filepath.Base(currentWallpaperPath)
-	if strings.Contains(baseName, "iptw_wallpaper_") || strings.Contains(baseName, "iptw.png") {
+	if isIPTWWallpaper(currentWallpaperPath) {
 		return "", fmt.Errorf("current wallpaper is already an IPTW wallpaper, skipping backup to preserve original")
 	}
 
@@ -265,14 +282,51 @@ func getLinuxCurrentWallpaper() (string, error) {
 		return strings.TrimSpace(string(output)), nil
 	}
 
-	// KDE - this is more complex, try to get from config
-	homeDir, _ := os.UserHomeDir()
-	kdePlasmaConfig := filepath.Join(homeDir, ".config", "plasma-org.kde.plasma.desktop-appletsrc")
-	if _, err := os.Stat(kdePlasmaConfig); err == nil {
-		// This is a simplified approach - KDE config parsing is complex
-		slog.Warn("KDE wallpaper detection is limited - backup may not work perfectly")
-		return "", fmt.Errorf("KDE wallpaper backup not fully supported")
+	// KDE outside a detected Plasma session: report the first desktop's image
+	if file, err := os.Open(plasmaAppletsrcPath()); err == nil {
+		desktops, err := parsePlasmaAppletsrc(file)
+		_ = file.Close()
+		if err == nil && len(desktops) > 0 {
+			return resolvePlasmaImage(desktops[0].Image)
+		}
 	}
 
 	return "", fmt.Errorf("could not detect current wallpaper on this Linux desktop environment")
 }
+
+// RemoveBackup deletes a wallpaper backup created by BackupCurrentWallpaper,
+// including the per-desktop images referenced by a KDE manifest. A KDE copy is
+// kept when its desktop was restored to it because the original is gone, as
+// Plasma now points at that copy.
+func RemoveBackup(backupPath string) error {
+	if isKDEManifest(backupPath) {
+		if manifest, err := readKDEManifest(backupPath); err == nil {
+			for _, desktop := range manifest.Desktops {
+				if desktop.restoreImage() == desktop.Image {
+					slog.Info("Keeping KDE wallpaper backup in use by Plasma", "path", desktop.Image)
+					continue
+				}
+				if err := os.Remove(desktop.Image); err != nil && !os.IsNotExist(err) {
+					slog.Warn("Failed to delete KDE wallpaper backup", "path", desktop.Image, "error", err)
+				}
+			}
+		}
+	}
+	return os.Remove(backupPath)
+}
+
+// BackupImage returns the image file of a wallpaper backup. For KDE manifests
+// this is the wallpaper of the first desktop (primary screen).
+func BackupImage(backupPath string) (string, error) {
+	if !isKDEManifest(backupPath) {
+		return backupPath, nil
+	}
+	manifest, err := readKDEManifest(backupPath)
+	if err != nil {
+		return "", err
+	}
+	if len(manifest.Desktops) == 0 {
+		return "", fmt.Errorf("KDE wallpaper manifest lists no desktops")
+	}
+	return manifest.Desktops[0].Image, nil
+}
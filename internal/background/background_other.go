@@ -16,10 +16,14 @@ func getWindowsCurrentWallpaper() (string, error) {
 }
 
 // RestoreWallpaper restores the wallpaper from a backup file using SetDesktopBackground.
+// KDE manifests are restored desktop by desktop.
 func RestoreWallpaper(backupPath string) error {
 	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
 		return fmt.Errorf("backup wallpaper file does not exist: %s", backupPath)
 	}
+	if isKDEManifest(backupPath) {
+		return restoreKDEWallpapers(backupPath)
+	}
 	if err := SetDesktopBackground(backupPath); err != nil {
 		return fmt.Errorf("failed to restore wallpaper: %w", err)
 	}
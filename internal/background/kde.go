@@ -0,0 +1,375 @@
+package background
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kdeManifestSuffix marks a backup that is not an image but a manifest listing
+// one backed-up image per Plasma desktop containment.
+const kdeManifestSuffix = ".kde.json"
+
+// kdeDesktop describes the wallpaper of a single Plasma desktop containment as
+// found in plasma-org.kde.plasma.desktop-appletsrc. In a manifest, Image is the
+// backed-up copy and Original the Image value Plasma had before the backup.
+type kdeDesktop struct {
+	Containment int    `json:"containment"`
+	Screen      int    `json:"screen"`
+	Activity    string `json:"activity,omitempty"`
+	Image       string `json:"image"`
+	Original    string `json:"original,omitempty"`
+}
+
+// restoreImage returns the image a desktop is restored to: its original
+// wallpaper while that still exists, otherwise the backed-up copy. Manifests
+// written before Original was recorded always restore to the copy.
+func (d kdeDesktop) restoreImage() string {
+	if d.Original != "" {
+		if _, err := os.Stat(d.Original); err == nil {
+			return d.Original
+		}
+	}
+	return d.Image
+}
+
+// kdeManifest is the on-disk shape of a KDE wallpaper backup.
+type kdeManifest struct {
+	Desktops []kdeDesktop `json:"desktops"`
+}
+
+// kdeContainment collects the keys of one [Containments][N] group and its
+// wallpaper sub-group while the appletsrc file is being scanned.
+type kdeContainment struct {
+	id       int
+	screen   int
+	activity string
+	plugin   string
+	wpPlugin string
+	image    string
+}
+
+// isKDESession reports whether the current session is KDE Plasma.
+func isKDESession() bool {
+	if os.Getenv("KDE_FULL_SESSION") == "true" {
+		return true
+	}
+	for _, de := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if strings.EqualFold(de, "KDE") {
+			return true
+		}
+	}
+	return false
+}
+
+// plasmaAppletsrcPath returns the location of the Plasma desktop config file.
+func plasmaAppletsrcPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		homeDir, _ := os.UserHomeDir()
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "plasma-org.kde.plasma.desktop-appletsrc")
+}
+
+// parsePlasmaAppletsrc extracts the current image wallpaper of every desktop
+// containment from a plasma-org.kde.plasma.desktop-appletsrc file. Panels,
+// slideshow desktops and desktops still using the default wallpaper (no Image
+// key) are skipped. Results are ordered by screen, then containment ID.
+func parsePlasmaAppletsrc(r io.Reader) ([]kdeDesktop, error) {
+	containments := make(map[int]*kdeContainment)
+	var current *kdeContainment
+	inWallpaperGroup := false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			groups := strings.Split(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"), "][")
+			current, inWallpaperGroup = nil, false
+			if len(groups) < 2 || groups[0] != "Containments" {
+				continue
+			}
+			id, err := strconv.Atoi(groups[1])
+			if err != nil {
+				continue
+			}
+			switch {
+			case len(groups) == 2:
+				// [Containments][N]
+			case len(groups) == 5 && groups[2] == "Wallpaper" && groups[3] == "org.kde.image" && groups[4] == "General":
+				inWallpaperGroup = true
+			default:
+				// Applet, configuration or other wallpaper plugin groups.
+				continue
+			}
+			if containments[id] == nil {
+				containments[id] = &kdeContainment{id: id, screen: -1}
+			}
+			current = containments[id]
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		if inWallpaperGroup {
+			if key == "Image" {
+				current.image = value
+			}
+			continue
+		}
+		switch key {
+		case "lastScreen":
+			if screen, err := strconv.Atoi(value); err == nil {
+				current.screen = screen
+			}
+		case "activityId":
+			current.activity = value
+		case "plugin":
+			current.plugin = value
+		case "wallpaperplugin":
+			current.wpPlugin = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read Plasma config: %w", err)
+	}
+
+	var desktops []kdeDesktop
+	for _, c := range containments {
+		if c.plugin == "org.kde.panel" || c.image == "" {
+			continue
+		}
+		// An unset wallpaperplugin means the default, which is org.kde.image.
+		if c.wpPlugin != "" && c.wpPlugin != "org.kde.image" {
+			continue
+		}
+		desktops = append(desktops, kdeDesktop{
+			Containment: c.id,
+			Screen:      c.screen,
+			Activity:    c.activity,
+			Image:       strings.TrimPrefix(c.image, "file://"),
+		})
+	}
+	sort.Slice(desktops, func(i, j int) bool {
+		if desktops[i].Screen != desktops[j].Screen {
+			return desktops[i].Screen < desktops[j].Screen
+		}
+		return desktops[i].Containment < desktops[j].Containment
+	})
+	return desktops, nil
+}
+
+// resolvePlasmaImage turns an Image value into a concrete image file. Plasma
+// stores wallpaper packages as directories (e.g. /usr/share/wallpapers/Next/);
+// for those the largest file in contents/images is chosen, based on the
+// WIDTHxHEIGHT file naming convention of wallpaper packages.
+func resolvePlasmaImage(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return path, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(path, "contents", "images"))
+	if err != nil {
+		return "", fmt.Errorf("wallpaper package %s has no images: %w", path, err)
+	}
+	best, bestPixels := "", -1
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		pixels := 0
+		base := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if w, h, ok := strings.Cut(base, "x"); ok {
+			width, errW := strconv.Atoi(w)
+			height, errH := strconv.Atoi(h)
+			if errW == nil && errH == nil {
+				pixels = width * height
+			}
+		}
+		if pixels > bestPixels {
+			best, bestPixels = entry.Name(), pixels
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("wallpaper package %s has no images", path)
+	}
+	return filepath.Join(path, "contents", "images", best), nil
+}
+
+// backupKDEWallpapers copies the wallpaper of every Plasma desktop into
+// backupDir and writes a manifest describing which image belongs to which
+// containment. The manifest path is returned as the backup path.
+func backupKDEWallpapers(backupDir string) (string, error) {
+	file, err := os.Open(plasmaAppletsrcPath())
+	if err != nil {
+		return "", fmt.Errorf("failed to open Plasma config: %w", err)
+	}
+	desktops, err := parsePlasmaAppletsrc(file)
+	_ = file.Close()
+	if err != nil {
+		return "", err
+	}
+	if len(desktops) == 0 {
+		return "", fmt.Errorf("no KDE desktop with an image wallpaper found")
+	}
+
+	timestamp := time.Now().Format("20060102_150405")
+	manifest := kdeManifest{}
+	backedUp := false
+	defer func() {
+		// Leave no partial backup behind when a later step fails.
+		if !backedUp {
+			for _, desktop := range manifest.Desktops {
+				_ = os.Remove(desktop.Image)
+			}
+		}
+	}()
+	for _, desktop := range desktops {
+		src, err := resolvePlasmaImage(desktop.Image)
+		if err != nil {
+			slog.Warn("Skipping KDE desktop wallpaper", "containment", desktop.Containment, "error", err)
+			continue
+		}
+		if isIPTWWallpaper(src) {
+			return "", fmt.Errorf("current wallpaper is already an IPTW wallpaper, skipping backup to preserve original")
+		}
+
+		dst := filepath.Join(backupDir, fmt.Sprintf("kde_wallpaper_%s_%d%s", timestamp, desktop.Containment, filepath.Ext(src)))
+		if err := copyFile(src, dst); err != nil {
+			return "", fmt.Errorf("failed to backup wallpaper of containment %d: %w", desktop.Containment, err)
+		}
+		desktop.Original, desktop.Image = desktop.Image, dst
+		manifest.Desktops = append(manifest.Desktops, desktop)
+	}
+	if len(manifest.Desktops) == 0 {
+		return "", fmt.Errorf("no KDE desktop wallpaper could be backed up")
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode KDE wallpaper manifest: %w", err)
+	}
+	manifestPath := filepath.Join(backupDir, fmt.Sprintf("original_wallpaper_%s%s", timestamp, kdeManifestSuffix))
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write KDE wallpaper manifest: %w", err)
+	}
+
+	backedUp = true
+	slog.Info("💾 KDE wallpapers backed up", "desktops", len(manifest.Desktops), "manifest", manifestPath)
+	return manifestPath, nil
+}
+
+// isKDEManifest reports whether a backup path refers to a KDE manifest.
+func isKDEManifest(path string) bool {
+	return strings.HasSuffix(path, kdeManifestSuffix)
+}
+
+// readKDEManifest loads a KDE wallpaper backup manifest.
+func readKDEManifest(path string) (*kdeManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest kdeManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid KDE wallpaper manifest %s: %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// restoreKDEWallpapers restores every desktop listed in a KDE manifest to its
+// own original wallpaper, or to the backed-up copy when the original is gone.
+// The PlasmaShell scripting interface is tried first as it can address each
+// containment individually; plasma-apply-wallpaperimage is used as a fallback,
+// which applies one image to all desktops.
+func restoreKDEWallpapers(manifestPath string) error {
+	manifest, err := readKDEManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Desktops) == 0 {
+		return fmt.Errorf("KDE wallpaper manifest lists no desktops")
+	}
+	for _, desktop := range manifest.Desktops {
+		if image := desktop.restoreImage(); image == desktop.Image {
+			if _, err := os.Stat(image); err != nil {
+				return fmt.Errorf("backup wallpaper file does not exist: %s", image)
+			}
+		}
+	}
+
+	if err := evaluatePlasmaScript(kdeRestoreScript(manifest.Desktops)); err == nil {
+		slog.Info("✅ KDE wallpapers restored", "desktops", len(manifest.Desktops))
+		return nil
+	}
+
+	if len(manifest.Desktops) > 1 {
+		slog.Warn("PlasmaShell scripting unavailable - restoring the first backed-up wallpaper on all desktops")
+	}
+	if err := exec.Command("plasma-apply-wallpaperimage", manifest.Desktops[0].restoreImage()).Run(); err != nil {
+		return fmt.Errorf("failed to restore KDE wallpaper: %w", err)
+	}
+	return nil
+}
+
+// kdeRestoreScript builds a PlasmaShell script assigning each containment the
+// image returned by restoreImage.
+func kdeRestoreScript(desktops []kdeDesktop) string {
+	var b strings.Builder
+	b.WriteString("var images = {};\n")
+	for _, desktop := range desktops {
+		image, _ := json.Marshal("file://" + desktop.restoreImage())
+		fmt.Fprintf(&b, "images[%d] = %s;\n", desktop.Containment, image)
+	}
+	b.WriteString(`var allDesktops = desktops();
+for (var i = 0; i < allDesktops.length; i++) {
+	var d = allDesktops[i];
+	if (images[d.id] === undefined) {
+		continue;
+	}
+	d.wallpaperPlugin = "org.kde.image";
+	d.currentConfigGroup = Array("Wallpaper", "org.kde.image", "General");
+	d.writeConfig("Image", images[d.id]);
+}`)
+	return b.String()
+}
+
+// evaluatePlasmaScript runs a script through the PlasmaShell D-Bus interface,
+// trying the Plasma 5 (qdbus) and Plasma 6 (qdbus6) command names.
+func evaluatePlasmaScript(script string) error {
+	var lastErr error
+	for _, tool := range []string{"qdbus", "qdbus6"} {
+		if err := exec.Command(tool, "org.kde.plasmashell", "/PlasmaShell", "org.kde.PlasmaShell.evaluateScript", script).Run(); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
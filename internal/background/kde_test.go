@@ -0,0 +1,213 @@
+package background
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePlasmaAppletsrc(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		expected []kdeDesktop
+	}{
+		{
+			name:    "Multi-screen with panel and slideshow",
+			fixture: "plasma-org.kde.plasma.desktop-appletsrc",
+			expected: []kdeDesktop{
+				{Containment: 1, Screen: 0, Activity: "3f2a9c4e-1b7d-4c8e-9a51-6d0e2f4b8c11", Image: "/home/user/Pictures/mountains.jpg"},
+				{Containment: 12, Screen: 0, Activity: "3f2a9c4e-1b7d-4c8e-9a51-6d0e2f4b8c11", Image: "/home/user/Pictures/second activity.png"},
+				{Containment: 7, Screen: 1, Activity: "3f2a9c4e-1b7d-4c8e-9a51-6d0e2f4b8c11", Image: "/usr/share/wallpapers/Next/"},
+			},
+		},
+		{
+			name:    "Single screen with plain path",
+			fixture: "plasma-single-screen-appletsrc",
+			expected: []kdeDesktop{
+				{Containment: 23, Screen: 0, Activity: "b5f1d0a2-7c44-4e1b-8d2e-0a9f3c6e7d55", Image: "/home/user/.local/share/wallpapers/beach.webp"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.Open(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatalf("failed to open fixture: %v", err)
+			}
+			defer func() { _ = file.Close() }()
+
+			desktops, err := parsePlasmaAppletsrc(file)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(desktops, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, desktops)
+			}
+		})
+	}
+}
+
+func TestParsePlasmaAppletsrcWithoutDesktops(t *testing.T) {
+	input := "[General]\nshowToolbox=false\n\n[Containments][4]\nplugin=org.kde.panel\n"
+	desktops, err := parsePlasmaAppletsrc(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(desktops) != 0 {
+		t.Errorf("expected no desktops, got %+v", desktops)
+	}
+}
+
+func TestResolvePlasmaImage(t *testing.T) {
+	dir := t.TempDir()
+
+	plain := filepath.Join(dir, "plain.png")
+	if err := os.WriteFile(plain, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := filepath.Join(dir, "Next")
+	images := filepath.Join(pkg, "contents", "images")
+	if err := os.MkdirAll(images, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"1280x800.png", "5120x2880.png", "1920x1080.png"} {
+		if err := os.WriteFile(filepath.Join(images, name), []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, err := resolvePlasmaImage(plain); err != nil || got != plain {
+		t.Errorf("expected %s, got %s (err %v)", plain, got, err)
+	}
+
+	expected := filepath.Join(images, "5120x2880.png")
+	if got, err := resolvePlasmaImage(pkg + "/"); err != nil || got != expected {
+		t.Errorf("expected %s, got %s (err %v)", expected, got, err)
+	}
+
+	if _, err := resolvePlasmaImage(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected error for missing image")
+	}
+}
+
+func TestKDERestoreScript(t *testing.T) {
+	original := filepath.Join(t.TempDir(), "mountains.jpg")
+	if err := os.WriteFile(original, []byte("jpg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	script := kdeRestoreScript([]kdeDesktop{
+		{Containment: 1, Image: "/backup/kde_wallpaper_1.jpg"},
+		{Containment: 7, Image: `/backup/it's "quoted".png`},
+		{Containment: 9, Image: "/backup/kde_wallpaper_9.jpg", Original: original},
+		{Containment: 12, Image: "/backup/kde_wallpaper_12.jpg", Original: "/deleted/beach.jpg"},
+	})
+
+	for _, want := range []string{
+		`images[1] = "file:///backup/kde_wallpaper_1.jpg";`,
+		`images[7] = "file:///backup/it's \"quoted\".png";`,
+		`images[9] = "file://` + original + `";`,
+		`images[12] = "file:///backup/kde_wallpaper_12.jpg";`,
+		`d.writeConfig("Image", images[d.id]);`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestRemoveKDEBackup(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("img"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	original := write("mountains.jpg")
+	restoredCopy := write("kde_wallpaper_1.jpg")
+	fallbackCopy := write("kde_wallpaper_7.jpg")
+
+	data, err := json.Marshal(kdeManifest{Desktops: []kdeDesktop{
+		{Containment: 1, Image: restoredCopy, Original: original},
+		{Containment: 7, Image: fallbackCopy, Original: filepath.Join(dir, "deleted.jpg")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(dir, "original_wallpaper_1"+kdeManifestSuffix)
+	if err := os.WriteFile(manifest, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RemoveBackup(manifest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for path, kept := range map[string]bool{
+		manifest:     false,
+		restoredCopy: false,
+		fallbackCopy: true,
+		original:     true,
+	} {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("%s: expected kept=%t, stat error %v", filepath.Base(path), kept, err)
+		}
+	}
+}
+
+func TestBackupKDEWallpapersRemovesPartialCopies(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	backupDir := filepath.Join(dir, "backup")
+	if err := os.Mkdir(backupDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(dir, "mountains.jpg")
+	if err := os.WriteFile(existing, []byte("img"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The first desktop is copied, then the backup is refused because the
+	// second already shows an IPTW wallpaper.
+	broken := filepath.Join(dir, "iptw.png")
+	if err := os.WriteFile(broken, []byte("img"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := "[Containments][1]\nplugin=org.kde.desktopcontainment\nwallpaperplugin=org.kde.image\n\n" +
+		"[Containments][1][Wallpaper][org.kde.image][General]\nImage=file://" + existing + "\n\n" +
+		"[Containments][2]\nplugin=org.kde.desktopcontainment\nwallpaperplugin=org.kde.image\n\n" +
+		"[Containments][2][Wallpaper][org.kde.image][General]\nImage=file://" + broken + "\n"
+	if err := os.WriteFile(plasmaAppletsrcPath(), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backupKDEWallpapers(backupDir); err == nil {
+		t.Fatal("expected an error when a desktop already shows an IPTW wallpaper")
+	}
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("partial backup left behind: %s", entry.Name())
+	}
+}
+
+func TestIsIPTWWallpaper(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/home/ada/.config/iptw/output/iptw.png":                   true,
+		"/home/ada/.config/iptw/output/iptw_overlay.png":           true,
+		"/tmp/iptw_wallpaper_20260101_120000_000.png":              true,
+		"/usr/share/wallpapers/Next/contents/images/1920x1080.png": false,
+	} {
+		if got := isIPTWWallpaper(path); got != want {
+			t.Errorf("isIPTWWallpaper(%q) = %t, want %t", path, got, want)
+		}
+	}
+}
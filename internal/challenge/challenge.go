@@ -0,0 +1,236 @@
+// Package challenge generates daily and weekly challenges.
+//
+// A challenge is drawn from a random source seeded by its period, the local
+// calendar date or the ISO week, so everyone running the same version gets
+// the same challenge on the same day and can compare results. A Generator
+// picks one of its Rules for each period. Rules are plain values: each turns
+// the seeded source into a Goal, and a Goal measures an Activity, so rules can
+// be tested on their own with a fixed seed and a hand-made Activity.
+package challenge
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the length of a challenge period.
+type Kind string
+
+const (
+	Daily  Kind = "daily"
+	Weekly Kind = "weekly"
+)
+
+// Kinds lists the period kinds in display order.
+var Kinds = []Kind{Daily, Weekly}
+
+// Period is the span of time a challenge runs for.
+type Period struct {
+	Kind  Kind
+	Key   string    // the date for a day (2026-10-18), the ISO week for a week (2026-W42)
+	Start time.Time // local midnight starting the period
+	End   time.Time // local midnight after the period
+}
+
+// PeriodOf returns the period of the given kind containing t, in t's location.
+func PeriodOf(kind Kind, t time.Time) Period {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if kind == Weekly {
+		monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		year, week := monday.ISOWeek()
+		return Period{Kind: Weekly, Key: fmt.Sprintf("%04d-W%02d", year, week), Start: monday, End: monday.AddDate(0, 0, 7)}
+	}
+	return Period{Kind: Daily, Key: day.Format("2006-01-02"), Start: day, End: day.AddDate(0, 0, 1)}
+}
+
+// ParsePeriod parses the key of a period in the local time zone.
+func ParsePeriod(kind Kind, key string) (Period, error) {
+	switch kind {
+	case Daily:
+		day, err := time.ParseInLocation("2006-01-02", key, time.Local)
+		if err != nil {
+			return Period{}, fmt.Errorf("invalid day %q: %w", key, err)
+		}
+		return PeriodOf(Daily, day), nil
+	case Weekly:
+		yearPart, weekPart, ok := strings.Cut(key, "-W")
+		year, yearErr := strconv.Atoi(yearPart)
+		week, weekErr := strconv.Atoi(weekPart)
+		if !ok || yearErr != nil || weekErr != nil || week < 1 || week > 53 {
+			return Period{}, fmt.Errorf("invalid week %q: expected a year and an ISO week such as 2026-W42", key)
+		}
+		// January 4th is always in the first ISO week
+		p := PeriodOf(Weekly, time.Date(year, time.January, 4, 0, 0, 0, 0, time.Local).AddDate(0, 0, 7*(week-1)))
+		if p.Key != key {
+			return Period{}, fmt.Errorf("invalid week %q: %d has no week %d", key, year, week)
+		}
+		return p, nil
+	}
+	return Period{}, fmt.Errorf("unknown challenge kind %q", kind)
+}
+
+// ID identifies the period across kinds, e.g. daily-2026-10-18.
+func (p Period) ID() string {
+	return string(p.Kind) + "-" + p.Key
+}
+
+// Contains reports whether t falls within the period.
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && t.Before(p.End)
+}
+
+// Previous returns the period before p.
+func (p Period) Previous() Period {
+	return PeriodOf(p.Kind, p.Start.Add(-time.Hour))
+}
+
+// Next returns the period after p.
+func (p Period) Next() Period {
+	return PeriodOf(p.Kind, p.End.Add(time.Hour))
+}
+
+// seed derives the random seed of the period from its kind and key only, so
+// it does not depend on the time zone or the time of day.
+func (p Period) seed() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("iptw/" + p.ID()))
+	return int64(h.Sum64())
+}
+
+// Activity is what happened during a challenge period.
+type Activity struct {
+	Hits         map[string]int  // journaled connections per country
+	NewCountries map[string]bool // countries visited for the first time
+}
+
+// NewActivity returns an empty activity.
+func NewActivity() *Activity {
+	return &Activity{Hits: make(map[string]int), NewCountries: make(map[string]bool)}
+}
+
+// AddHit counts a connection to a country.
+func (a *Activity) AddHit(country string) {
+	if country != "" {
+		a.Hits[country]++
+	}
+}
+
+// AddVisit counts a first visit to a country.
+func (a *Activity) AddVisit(country string) {
+	if country != "" {
+		a.NewCountries[country] = true
+	}
+}
+
+// TotalHits returns the number of connections to all countries.
+func (a *Activity) TotalHits() int {
+	total := 0
+	for _, hits := range a.Hits {
+		total += hits
+	}
+	return total
+}
+
+// Result is a goal measured against an activity.
+type Result struct {
+	Progress  int  `json:"progress"`
+	Target    int  `json:"target"`
+	Limit     bool `json:"limit,omitempty"` // progress must stay below target until the period is over
+	Completed bool `json:"completed"`
+}
+
+// Goal is a challenge drawn by a rule.
+type Goal interface {
+	// Title describes the goal, e.g. "Reach a country in Oceania".
+	Title() string
+	// Evaluate measures the activity of the period; final is set once the
+	// period is over.
+	Evaluate(a *Activity, final bool) Result
+}
+
+// World describes the countries goals can refer to.
+type World struct {
+	Regions  []string                    // regions a goal can name, sorted
+	RegionOf func(country string) string // region of a country, "" when unknown
+	Alpha2Of func(country string) string // ISO 3166-1 alpha-2 code of a country, "" when unknown
+}
+
+// Rule draws one kind of goal.
+type Rule interface {
+	// Name identifies the rule in the API, e.g. "region".
+	Name() string
+	// Generate draws a goal for the period. It must take all its randomness
+	// from rng so the same period always yields the same goal, and returns
+	// nil when the world offers nothing to draw from.
+	Generate(rng *rand.Rand, p Period, w World) Goal
+}
+
+// Challenge is the goal of one period.
+type Challenge struct {
+	Period Period
+	Rule   string // name of the rule that drew the goal
+	Goal   Goal   // nil when no rule could draw a goal
+}
+
+// Title describes the challenge.
+func (c Challenge) Title() string {
+	if c.Goal == nil {
+		return "No challenge"
+	}
+	return c.Goal.Title()
+}
+
+// Generator draws challenges from a set of rules.
+type Generator struct {
+	Rules []Rule
+	World World
+}
+
+// NewGenerator returns a generator with the default rules.
+func NewGenerator(w World) *Generator {
+	return &Generator{Rules: DefaultRules(), World: w}
+}
+
+// Generate draws the challenge of a period. Rules that cannot draw a goal in
+// the world are skipped, in seeded order.
+func (g *Generator) Generate(p Period) Challenge {
+	rng := rand.New(rand.NewSource(p.seed()))
+	for _, i := range rng.Perm(len(g.Rules)) {
+		if goal := g.Rules[i].Generate(rng, p, g.World); goal != nil {
+			return Challenge{Period: p, Rule: g.Rules[i].Name(), Goal: goal}
+		}
+	}
+	return Challenge{Period: p}
+}
+
+// Streaks returns the number of consecutive completed periods up to current,
+// and the longest such run. done holds the keys of the completed periods. A
+// current period that is not completed yet does not break the streak.
+func Streaks(current Period, done map[string]bool) (streak, best int) {
+	p := current
+	if !done[p.Key] {
+		p = p.Previous()
+	}
+	for done[p.Key] {
+		streak++
+		p = p.Previous()
+	}
+
+	// Count every run forward from its first period
+	for key := range done {
+		p, err := ParsePeriod(current.Kind, key)
+		if err != nil || done[p.Previous().Key] {
+			continue
+		}
+		run := 0
+		for ; done[p.Key]; p = p.Next() {
+			run++
+		}
+		best = max(best, run)
+	}
+	return streak, best
+}
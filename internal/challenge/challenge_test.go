@@ -0,0 +1,145 @@
+package challenge
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// testWorld knows two regions and the alpha-2 codes of a few countries.
+var testWorld = World{
+	Regions: []string{"Europe", "Oceania"},
+	RegionOf: func(country string) string {
+		return map[string]string{"France": "Europe", "Fiji": "Oceania", "Samoa": "Oceania", "Tonga": "Oceania"}[country]
+	},
+	Alpha2Of: func(country string) string {
+		return map[string]string{"France": "FR", "United States of America": "US", "Fiji": "FJ"}[country]
+	},
+}
+
+func TestPeriodOf(t *testing.T) {
+	sunday := time.Date(2026, 10, 18, 15, 30, 0, 0, time.Local)
+	day := PeriodOf(Daily, sunday)
+	if day.Key != "2026-10-18" || !day.Contains(sunday) || day.Contains(day.End) || day.Next().Key != "2026-10-19" {
+		t.Errorf("unexpected day %+v", day)
+	}
+	week := PeriodOf(Weekly, sunday)
+	if week.Key != "2026-W42" || week.Start.Weekday() != time.Monday || week.Start.Day() != 12 || week.End.Day() != 19 {
+		t.Errorf("unexpected week %+v", week)
+	}
+	if prev := PeriodOf(Weekly, time.Date(2027, 1, 1, 0, 0, 0, 0, time.Local)); prev.Key != "2026-W53" || prev.Next().Key != "2027-W01" {
+		t.Errorf("expected 2027 to start in week 53 of 2026, got %s", prev.Key)
+	}
+
+	for _, p := range []Period{day, week, PeriodOf(Weekly, time.Date(2026, 12, 31, 0, 0, 0, 0, time.Local))} {
+		parsed, err := ParsePeriod(p.Kind, p.Key)
+		if err != nil || !parsed.Start.Equal(p.Start) {
+			t.Errorf("expected %s to parse back, got %+v (%v)", p.Key, parsed, err)
+		}
+	}
+	for _, key := range []string{"2026-W54", "2025-W53", "2026-42", "yesterday"} {
+		if _, err := ParsePeriod(Weekly, key); err == nil {
+			t.Errorf("expected %q to be an invalid week", key)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	g := NewGenerator(testWorld)
+	day := PeriodOf(Daily, time.Date(2026, 10, 18, 9, 0, 0, 0, time.Local))
+	first := g.Generate(day)
+	if first.Goal == nil || first.Rule == "" {
+		t.Fatalf("expected a challenge, got %+v", first)
+	}
+
+	// The same period gives the same challenge at any time of day and in any
+	// time zone
+	tokyo := time.FixedZone("Tokyo", 9*3600)
+	again := g.Generate(PeriodOf(Daily, time.Date(2026, 10, 18, 23, 0, 0, 0, tokyo)))
+	if again.Rule != first.Rule || again.Title() != first.Title() {
+		t.Errorf("expected the same challenge, got %q and %q", first.Title(), again.Title())
+	}
+
+	titles := make(map[string]bool)
+	for i := range 28 {
+		titles[g.Generate(PeriodOf(Daily, day.Start.AddDate(0, 0, i))).Title()] = true
+	}
+	if len(titles) < 5 {
+		t.Errorf("expected varied challenges over four weeks, got %v", titles)
+	}
+
+	// Rules that cannot draw a goal are skipped
+	g.World = World{}
+	for i := range 10 {
+		if c := g.Generate(PeriodOf(Daily, day.Start.AddDate(0, 0, i))); c.Rule == "region" || c.Rule == "triad" {
+			t.Errorf("expected the region and Triad rules to be skipped without a world, got %s", c.Rule)
+		}
+	}
+	if c := (&Generator{}).Generate(day); c.Goal != nil || c.Title() != "No challenge" {
+		t.Errorf("expected no challenge without rules, got %+v", c)
+	}
+}
+
+func TestRules(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	day := PeriodOf(Daily, time.Now())
+	week := PeriodOf(Weekly, time.Now())
+	activity := NewActivity()
+	activity.AddHit("Fiji")
+	activity.AddHit("Samoa")
+	activity.AddVisit("Samoa")
+
+	world := testWorld
+	world.Regions = []string{"Oceania"}
+	if r := (RegionRule{}).Generate(rng, day, world).Evaluate(activity, false); !r.Completed || r.Target != 1 {
+		t.Errorf("expected the daily region goal completed, got %+v", r)
+	}
+	region := (RegionRule{}).Generate(rng, week, world)
+	if r := region.Evaluate(activity, true); r.Completed || r.Progress != 2 || r.Target != 3 {
+		t.Errorf("expected 2 of 3 countries for the weekly region goal, got %+v", r)
+	}
+	if region.Title() != "Reach 3 countries in Oceania" {
+		t.Errorf("unexpected title %q", region.Title())
+	}
+
+	if r := (NewCountriesRule{}).Generate(rng, day, world).Evaluate(activity, false); r.Progress != 1 || r.Completed {
+		t.Errorf("expected 1 new country, got %+v", r)
+	}
+	if r := (CountriesRule{}).Generate(rng, day, world).Evaluate(activity, false); r.Progress != 2 || r.Target < 5 {
+		t.Errorf("expected 2 countries, got %+v", r)
+	}
+
+	triad := (TriadRule{}).Generate(rng, day, world)
+	if r := triad.Evaluate(NewActivity(), true); r.Completed {
+		t.Error("expected the Triad goal to need connections")
+	}
+	if r := triad.Evaluate(activity, false); r.Completed || r.Progress != 0 || !r.Limit {
+		t.Errorf("expected the Triad goal to wait for the end of the day, got %+v", r)
+	}
+	if r := triad.Evaluate(activity, true); !r.Completed {
+		t.Errorf("expected the Triad goal completed at the end of the day, got %+v", r)
+	}
+	activity.Hits["United States of America"] = 6
+	if r := triad.Evaluate(activity, true); r.Completed || r.Progress != 75 {
+		t.Errorf("expected a 75%% Triad share, got %+v", r)
+	}
+}
+
+func TestStreaks(t *testing.T) {
+	today := PeriodOf(Daily, time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local))
+	done := map[string]bool{
+		"2026-10-01": true, "2026-10-02": true, "2026-10-03": true, "2026-10-04": true,
+		"2026-10-16": true, "2026-10-17": true,
+	}
+	// Today is not completed yet, so yesterday's streak still counts
+	if streak, best := Streaks(today, done); streak != 2 || best != 4 {
+		t.Errorf("expected a streak of 2 and a best of 4, got %d and %d", streak, best)
+	}
+	done["2026-10-18"] = true
+	if streak, _ := Streaks(today, done); streak != 3 {
+		t.Errorf("expected a streak of 3, got %d", streak)
+	}
+	if streak, best := Streaks(today.Next().Next(), done); streak != 0 || best != 4 {
+		t.Errorf("expected a broken streak, got %d and %d", streak, best)
+	}
+}
@@ -0,0 +1,163 @@
+package challenge
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// TriadAlpha2 lists the countries of the Triad: the United States, China and
+// the member states of the European Union.
+var TriadAlpha2 = []string{
+	"US", "CN",
+	"AT", "BE", "BG", "HR", "CY", "CZ", "DK", "EE", "FI", "FR", "DE", "GR",
+	"HU", "IE", "IT", "LV", "LT", "LU", "MT", "NL", "PL", "PT", "RO", "SK",
+	"SI", "ES", "SE",
+}
+
+// DefaultRules returns the rules used by NewGenerator.
+func DefaultRules() []Rule {
+	return []Rule{RegionRule{}, NewCountriesRule{}, CountriesRule{}, TriadRule{}}
+}
+
+// span names the period in titles.
+func span(p Period) string {
+	if p.Kind == Weekly {
+		return "this week"
+	}
+	return "today"
+}
+
+// countryCount formats a number of countries, using "a" for one.
+func countryCount(n int) string {
+	if n == 1 {
+		return "a country"
+	}
+	return fmt.Sprintf("%d countries", n)
+}
+
+// countGoal is a goal to reach a number of something by the end of the
+// period.
+type countGoal struct {
+	title  string
+	target int
+	count  func(a *Activity) int
+}
+
+func (g countGoal) Title() string { return g.title }
+
+func (g countGoal) Evaluate(a *Activity, final bool) Result {
+	progress := g.count(a)
+	return Result{Progress: min(progress, g.target), Target: g.target, Completed: progress >= g.target}
+}
+
+// RegionRule asks to reach countries in a region: one a day, three a week.
+type RegionRule struct{}
+
+func (RegionRule) Name() string { return "region" }
+
+func (RegionRule) Generate(rng *rand.Rand, p Period, w World) Goal {
+	if len(w.Regions) == 0 || w.RegionOf == nil {
+		return nil
+	}
+	region := w.Regions[rng.Intn(len(w.Regions))]
+	target := 1
+	if p.Kind == Weekly {
+		target = 3
+	}
+	return countGoal{
+		title:  fmt.Sprintf("Reach %s in %s", countryCount(target), region),
+		target: target,
+		count: func(a *Activity) int {
+			n := 0
+			for country := range a.Hits {
+				if w.RegionOf(country) == region {
+					n++
+				}
+			}
+			return n
+		},
+	}
+}
+
+// NewCountriesRule asks to visit countries never visited before: 2 or 3 a
+// day, 5 to 8 a week.
+type NewCountriesRule struct{}
+
+func (NewCountriesRule) Name() string { return "new_countries" }
+
+func (NewCountriesRule) Generate(rng *rand.Rand, p Period, w World) Goal {
+	target := 2 + rng.Intn(2)
+	if p.Kind == Weekly {
+		target = 5 + rng.Intn(4)
+	}
+	return countGoal{
+		title:  fmt.Sprintf("Visit %d countries you've never visited", target),
+		target: target,
+		count:  func(a *Activity) int { return len(a.NewCountries) },
+	}
+}
+
+// CountriesRule asks to connect to a number of different countries: 5 to 10
+// a day, 15 to 25 a week.
+type CountriesRule struct{}
+
+func (CountriesRule) Name() string { return "countries" }
+
+func (CountriesRule) Generate(rng *rand.Rand, p Period, w World) Goal {
+	target := 5 + rng.Intn(6)
+	if p.Kind == Weekly {
+		target = 15 + rng.Intn(11)
+	}
+	return countGoal{
+		title:  fmt.Sprintf("Connect to %d different countries %s", target, span(p)),
+		target: target,
+		count:  func(a *Activity) int { return len(a.Hits) },
+	}
+}
+
+// TriadRule asks to keep the share of connections to the Triad under 40, 50
+// or 60 percent. It is only completed once the period is over, and only when
+// there were connections at all.
+type TriadRule struct{}
+
+func (TriadRule) Name() string { return "triad" }
+
+func (TriadRule) Generate(rng *rand.Rand, p Period, w World) Goal {
+	if w.Alpha2Of == nil {
+		return nil
+	}
+	limit := []int{40, 50, 60}[rng.Intn(3)]
+	return triadGoal{
+		title: fmt.Sprintf("Keep the Triad share under %d%% %s", limit, span(p)),
+		limit: limit,
+		world: w,
+	}
+}
+
+// triadGoal keeps the percentage of connections to the Triad under limit.
+type triadGoal struct {
+	title string
+	limit int
+	world World
+}
+
+func (g triadGoal) Title() string { return g.title }
+
+func (g triadGoal) Evaluate(a *Activity, final bool) Result {
+	triad := make(map[string]bool, len(TriadAlpha2))
+	for _, code := range TriadAlpha2 {
+		triad[code] = true
+	}
+	total, inTriad := 0, 0
+	for country, hits := range a.Hits {
+		total += hits
+		if triad[g.world.Alpha2Of(country)] {
+			inTriad += hits
+		}
+	}
+	share := 0
+	if total > 0 {
+		share = inTriad * 100 / total
+	}
+	return Result{Progress: share, Target: g.limit, Limit: true, Completed: final && total > 0 && share < g.limit}
+}
@@ -3,39 +3,113 @@ package config
 import (
 	"bufio"
 	"fmt"
+	"math"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
+
+	"iptw/internal/profile"
+	"iptw/internal/team"
 )
 
 // Config represents the application configuration
 type Config struct {
-	MapWidth         int    `config:"map_width"`
-	AutoDetectScreen bool   `config:"auto_detect_screen"`
-	Black            bool   `config:"black"`
-	UpdateInterval   int    `config:"update_interval"`
-	TargetInterval   int    `config:"target_interval"`  // Minutes between target changes
-	LogLevel         string `config:"log_level"`        // debug, info, warn, error
-	StatsX           int    `config:"stats_x"`          // X position of stats rectangle (-1 for auto)
-	StatsY           int    `config:"stats_y"`          // Y position of stats rectangle (-1 for auto)
-	UpdateWallpaper  bool   `config:"update_wallpaper"` // Opt-in to update OS wallpaper
-	StartOnLogin     bool   `config:"start_on_login"`   // Auto-start app on login
+	MapWidth           int    `config:"map_width"`
+	AutoDetectScreen   bool   `config:"auto_detect_screen"`
+	Black              bool   `config:"black"`
+	UpdateInterval     int    `config:"update_interval"`
+	TargetInterval     int    `config:"target_interval"`     // Minutes between target changes
+	LogLevel           string `config:"log_level"`           // debug, info, warn, error
+	StatsX             int    `config:"stats_x"`             // X position of stats rectangle (-1 for auto)
+	StatsY             int    `config:"stats_y"`             // Y position of stats rectangle (-1 for auto)
+	UpdateWallpaper    bool   `config:"update_wallpaper"`    // Opt-in to update OS wallpaper
+	StartOnLogin       bool   `config:"start_on_login"`      // Auto-start app on login
+	WallpaperMode      string `config:"wallpaper_mode"`      // replace or overlay (composite onto the original wallpaper)
+	OverlayStyle       string `config:"overlay_style"`       // full, inset or visited
+	OverlayOpacity     int    `config:"overlay_opacity"`     // Overlay opacity in percent (0-100)
+	OverlayScale       int    `config:"overlay_scale"`       // Inset width as a percentage of the wallpaper width
+	OverlayPosition    string `config:"overlay_position"`    // top-left, top-right, bottom-left, bottom-right or center
+	HomeLocation       string `config:"home_location"`       // off, auto (from public IP) or "lat,lng" origin of connection arcs
+	ArcFade            int    `config:"arc_fade"`            // Minutes a connection arc takes to fade out after it closes
+	Heatmap            bool   `config:"heatmap"`             // Draw the connection density heatmap on the live map and wallpaper
+	HeatmapWindow      string `config:"heatmap_window"`      // Default heatmap time window: a duration such as 24h or 7d, or "all"
+	HeatmapRadius      int    `config:"heatmap_radius"`      // Heatmap kernel radius in pixels at a 1000px wide map
+	HeatmapColormap    string `config:"heatmap_colormap"`    // inferno, viridis, hot or blues
+	Theme              string `config:"theme"`               // auto (light or dark from black), a preset or a file in ~/.config/iptw/themes
+	Labels             string `config:"labels"`              // off, names or iso (ISO 3166-1 alpha-3 codes)
+	LabelCountries     string `config:"label_countries"`     // visited or all
+	LabelMinArea       int    `config:"label_min_area"`      // Countries smaller than this many pixels get no label
+	Legend             string `config:"legend"`              // off, top-left, top-right, bottom-left or bottom-right
+	InsetMinArea       int    `config:"inset_min_area"`      // Visited, target or prison countries smaller than this many pixels get a callout; 0 disables
+	HTTPListen         string `config:"http_listen"`         // host:port of the local web UI and API; port 0 picks a free port
+	HTTPAllowLAN       bool   `config:"http_allow_lan"`      // Allow http_listen to bind a non-loopback address
+	HTTPTLS            bool   `config:"http_tls"`            // Serve HTTPS with a self-signed certificate
+	TargetPool         string `config:"target_pool"`         // all, or comma-separated regions or sub-regions targets are drawn from, e.g. western-africa
+	TargetMode         string `config:"target_mode"`         // random, or weighted towards rare countries and nearly finished regions
+	ExpeditionSize     int    `config:"expedition_size"`     // Countries drawn for a new expedition
+	ExpeditionDuration string `config:"expedition_duration"` // Time to reach them: a duration such as 24h or 7d
+	Subdivisions       bool   `config:"subdivisions"`        // Track states and provinces, and draw them on the zoomed-in web map
+	Profile            string `config:"profile"`             // Active player profile
+	ProfileRoutes      string `config:"profile_routes"`      // off, or comma-separated uid:N=profile and process:NAME=profile routes
+	TeamServer         string `config:"team_server"`         // off, or the http(s) URL of the iptw-server summaries are pushed to
+	TeamPlayer         string `config:"team_player"`         // Name on the team leaderboard; auto for the profile or user name
+	TeamInterval       int    `config:"team_interval"`       // Minutes between pushes to the team server
 }
 
+// MaxExpeditionSize is the largest number of countries in one expedition.
+const MaxExpeditionSize = 20
+
+// DefaultHTTPListen is the default address of the local web UI and API.
+const DefaultHTTPListen = "127.0.0.1:32782"
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
-		MapWidth:         1000,
-		AutoDetectScreen: true, // Default to auto-detection
-		Black:            false,
-		UpdateInterval:   1,
-		TargetInterval:   5,      // New target every 5 minutes
-		LogLevel:         "info", // Default log level
-		StatsX:           -1,     // -1 means auto-position (default behavior)
-		StatsY:           -1,     // -1 means auto-position (default behavior)
-		UpdateWallpaper:  false,  // Disabled by default
-		StartOnLogin:     false,  // Disabled by default
+		MapWidth:           1000,
+		AutoDetectScreen:   true, // Default to auto-detection
+		Black:              false,
+		UpdateInterval:     1,
+		TargetInterval:     5,      // New target every 5 minutes
+		LogLevel:           "info", // Default log level
+		StatsX:             -1,     // -1 means auto-position (default behavior)
+		StatsY:             -1,     // -1 means auto-position (default behavior)
+		UpdateWallpaper:    false,  // Disabled by default
+		StartOnLogin:       false,  // Disabled by default
+		WallpaperMode:      "replace",
+		OverlayStyle:       "full",
+		OverlayOpacity:     60,
+		OverlayScale:       35,
+		OverlayPosition:    "bottom-right",
+		HomeLocation:       "off",
+		ArcFade:            3,
+		Heatmap:            false,
+		HeatmapWindow:      "24h",
+		HeatmapRadius:      12,
+		HeatmapColormap:    "inferno",
+		Theme:              "auto",
+		Labels:             "off",
+		LabelCountries:     "visited",
+		LabelMinArea:       150,
+		Legend:             "off",
+		InsetMinArea:       30,
+		HTTPListen:         DefaultHTTPListen,
+		HTTPAllowLAN:       false,
+		HTTPTLS:            false,
+		TargetPool:         "all",
+		TargetMode:         "random",
+		ExpeditionSize:     3,
+		ExpeditionDuration: "24h",
+		Subdivisions:       false,
+		Profile:            profile.Default,
+		ProfileRoutes:      "off",
+		TeamServer:         "off",
+		TeamPlayer:         "auto",
+		TeamInterval:       5,
 	}
 }
 
@@ -83,48 +157,8 @@ func LoadConfig() (*Config, error) {
 			continue
 		}
 
-		key := parts[0]
-		value := parts[1]
-
-		switch key {
-
-		case "map_width":
-			if val, err := strconv.Atoi(value); err == nil {
-				cfg.MapWidth = val
-			}
-		case "auto_detect_screen":
-			cfg.AutoDetectScreen = value == "true"
-		case "black":
-			cfg.Black = value == "true"
-		case "update_interval":
-			if val, err := strconv.Atoi(value); err == nil {
-				cfg.UpdateInterval = val
-			}
-		case "target_interval":
-			if val, err := strconv.Atoi(value); err == nil {
-				cfg.TargetInterval = val
-			}
-		case "log_level":
-			// Validate log level
-			switch value {
-			case "debug", "info", "warn", "error":
-				cfg.LogLevel = value
-			default:
-				cfg.LogLevel = "info" // Default to info for invalid values
-			}
-		case "stats_x":
-			if val, err := strconv.Atoi(value); err == nil {
-				cfg.StatsX = val
-			}
-		case "stats_y":
-			if val, err := strconv.Atoi(value); err == nil {
-				cfg.StatsY = val
-			}
-		case "update_wallpaper":
-			cfg.UpdateWallpaper = value == "true"
-		case "start_on_login":
-			cfg.StartOnLogin = value == "true"
-		}
+		// Invalid values keep the default
+		_ = cfg.Set(parts[0], parts[1])
 	}
 
 	return cfg, scanner.Err()
@@ -149,7 +183,283 @@ stats_x %d
 stats_y %d
 update_wallpaper %t
 start_on_login %t
-`, c.MapWidth, c.AutoDetectScreen, c.Black, c.UpdateInterval, c.TargetInterval, c.LogLevel, c.StatsX, c.StatsY, c.UpdateWallpaper, c.StartOnLogin)
+wallpaper_mode %s
+overlay_style %s
+overlay_opacity %d
+overlay_scale %d
+overlay_position %s
+home_location %s
+arc_fade %d
+heatmap %t
+heatmap_window %s
+heatmap_radius %d
+heatmap_colormap %s
+theme %s
+labels %s
+label_countries %s
+label_min_area %d
+legend %s
+inset_min_area %d
+http_listen %s
+http_allow_lan %t
+http_tls %t
+target_pool %s
+target_mode %s
+expedition_size %d
+expedition_duration %s
+subdivisions %t
+profile %s
+profile_routes %s
+team_server %s
+team_player %s
+team_interval %d
+`, c.MapWidth, c.AutoDetectScreen, c.Black, c.UpdateInterval, c.TargetInterval, c.LogLevel, c.StatsX, c.StatsY, c.UpdateWallpaper, c.StartOnLogin,
+		c.WallpaperMode, c.OverlayStyle, c.OverlayOpacity, c.OverlayScale, c.OverlayPosition,
+		c.HomeLocation, c.ArcFade,
+		c.Heatmap, c.HeatmapWindow, c.HeatmapRadius, c.HeatmapColormap,
+		c.Theme, c.Labels, c.LabelCountries, c.LabelMinArea, c.Legend, c.InsetMinArea,
+		c.HTTPListen, c.HTTPAllowLAN, c.HTTPTLS,
+		c.TargetPool, c.TargetMode, c.ExpeditionSize, c.ExpeditionDuration,
+		c.Subdivisions, c.Profile, c.ProfileRoutes,
+		c.TeamServer, c.TeamPlayer, c.TeamInterval)
 
 	return err
 }
+
+// isThemeName reports whether value is usable as a theme file name.
+func isThemeName(value string) bool {
+	for i, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case (r == '-' || r == '_') && i > 0:
+		default:
+			return false
+		}
+	}
+	return value != ""
+}
+
+// ParseLatLng parses a "lat,lng" pair such as "52.52,13.40".
+func ParseLatLng(value string) (lat, lng float64, err error) {
+	latStr, lngStr, ok := strings.Cut(value, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected lat,lng: %q", value)
+	}
+	lat, err = strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("invalid latitude: %q", latStr)
+	}
+	lng, err = strconv.ParseFloat(strings.TrimSpace(lngStr), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, fmt.Errorf("invalid longitude: %q", lngStr)
+	}
+	return lat, lng, nil
+}
+
+// ParseWindow parses a time window such as "90m", "24h" or "7d". "all" (and
+// the empty string) means no limit and yields 0.
+func ParseWindow(value string) (time.Duration, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	if value == "" || value == "all" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", value)
+	}
+	return d, nil
+}
+
+// Set validates value and assigns it to the setting named key, as written in
+// the config file.
+func (c *Config) Set(key, value string) error {
+	invalid := func(expected string) error {
+		return fmt.Errorf("invalid value %q for %s: expected %s", value, key, expected)
+	}
+	setInt := func(dst *int, min, max int) error {
+		val, err := strconv.Atoi(value)
+		if err != nil || val < min || val > max {
+			return invalid(fmt.Sprintf("an integer from %d to %d", min, max))
+		}
+		*dst = val
+		return nil
+	}
+	setBool := func(dst *bool) error {
+		val, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalid("true or false")
+		}
+		*dst = val
+		return nil
+	}
+	setEnum := func(dst *string, allowed ...string) error {
+		for _, a := range allowed {
+			if value == a {
+				*dst = value
+				return nil
+			}
+		}
+		return invalid(strings.Join(allowed, ", "))
+	}
+
+	switch key {
+	case "map_width":
+		return setInt(&c.MapWidth, math.MinInt, math.MaxInt)
+	case "auto_detect_screen":
+		return setBool(&c.AutoDetectScreen)
+	case "black":
+		return setBool(&c.Black)
+	case "update_interval":
+		return setInt(&c.UpdateInterval, math.MinInt, math.MaxInt)
+	case "target_interval":
+		return setInt(&c.TargetInterval, math.MinInt, math.MaxInt)
+	case "log_level":
+		return setEnum(&c.LogLevel, "debug", "info", "warn", "error")
+	case "stats_x":
+		return setInt(&c.StatsX, math.MinInt, math.MaxInt)
+	case "stats_y":
+		return setInt(&c.StatsY, math.MinInt, math.MaxInt)
+	case "update_wallpaper":
+		return setBool(&c.UpdateWallpaper)
+	case "start_on_login":
+		return setBool(&c.StartOnLogin)
+	case "wallpaper_mode":
+		return setEnum(&c.WallpaperMode, "replace", "overlay")
+	case "overlay_style":
+		return setEnum(&c.OverlayStyle, "full", "inset", "visited")
+	case "overlay_opacity":
+		return setInt(&c.OverlayOpacity, 0, 100)
+	case "overlay_scale":
+		return setInt(&c.OverlayScale, 1, 100)
+	case "overlay_position":
+		return setEnum(&c.OverlayPosition, "top-left", "top-right", "bottom-left", "bottom-right", "center")
+	case "home_location":
+		if value != "off" && value != "auto" {
+			if _, _, err := ParseLatLng(value); err != nil {
+				return invalid("off, auto or lat,lng")
+			}
+		}
+		c.HomeLocation = value
+	case "arc_fade":
+		return setInt(&c.ArcFade, 0, math.MaxInt)
+	case "heatmap":
+		return setBool(&c.Heatmap)
+	case "heatmap_window":
+		if _, err := ParseWindow(value); err != nil {
+			return invalid("a duration such as 24h or 7d, or all")
+		}
+		c.HeatmapWindow = value
+	case "heatmap_radius":
+		return setInt(&c.HeatmapRadius, 1, math.MaxInt)
+	case "heatmap_colormap":
+		return setEnum(&c.HeatmapColormap, "inferno", "viridis", "hot", "blues")
+	case "labels":
+		return setEnum(&c.Labels, "off", "names", "iso")
+	case "label_countries":
+		return setEnum(&c.LabelCountries, "visited", "all")
+	case "label_min_area":
+		return setInt(&c.LabelMinArea, 0, math.MaxInt)
+	case "legend":
+		return setEnum(&c.Legend, "off", "top-left", "top-right", "bottom-left", "bottom-right")
+	case "inset_min_area":
+		return setInt(&c.InsetMinArea, 0, math.MaxInt)
+	case "http_listen":
+		host, port, err := net.SplitHostPort(value)
+		if err != nil || (host != "" && net.ParseIP(host) == nil && host != "localhost") {
+			return invalid("an IP address and port such as 127.0.0.1:32782")
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			return invalid("a port from 0 to 65535")
+		}
+		c.HTTPListen = value
+	case "http_allow_lan":
+		return setBool(&c.HTTPAllowLAN)
+	case "http_tls":
+		return setBool(&c.HTTPTLS)
+	case "target_pool":
+		// Region names are checked when a target is drawn, as for themes
+		if value != "all" {
+			for _, region := range strings.Split(value, ",") {
+				if !isThemeName(region) {
+					return invalid("all or comma-separated region names of lowercase letters, digits, - and _")
+				}
+			}
+		}
+		c.TargetPool = value
+	case "target_mode":
+		return setEnum(&c.TargetMode, "random", "weighted")
+	case "expedition_size":
+		return setInt(&c.ExpeditionSize, 1, MaxExpeditionSize)
+	case "expedition_duration":
+		if d, err := ParseWindow(value); err != nil || d == 0 {
+			return invalid("a duration such as 24h or 7d")
+		}
+		c.ExpeditionDuration = value
+	case "subdivisions":
+		return setBool(&c.Subdivisions)
+	case "profile":
+		if !profile.ValidName(value) {
+			return invalid("a profile name of lowercase letters, digits, - and _")
+		}
+		c.Profile = value
+	case "profile_routes":
+		if _, err := profile.ParseRoutes(value); err != nil {
+			return invalid("off or comma-separated routes such as uid:1001=alice,process:firefox=bob")
+		}
+		c.ProfileRoutes = value
+	case "team_server":
+		if value != "off" {
+			u, err := url.Parse(value)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return invalid("off or an http(s) URL such as http://team.lan:32790")
+			}
+		}
+		c.TeamServer = value
+	case "team_player":
+		if value != "auto" && !team.ValidPlayer(value) {
+			return invalid("auto or a name of up to 32 letters, digits, ., - and _")
+		}
+		c.TeamPlayer = value
+	case "team_interval":
+		return setInt(&c.TeamInterval, 1, 1440)
+	case "theme":
+		// Existence is checked when the theme is loaded; files may appear later
+		if !isThemeName(value) {
+			return invalid("a theme name of lowercase letters, digits, - and _")
+		}
+		c.Theme = value
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+// Values returns every setting keyed by its name in the config file.
+func (c *Config) Values() map[string]string {
+	values := make(map[string]string)
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if key := v.Type().Field(i).Tag.Get("config"); key != "" {
+			values[key] = fmt.Sprint(v.Field(i).Interface())
+		}
+	}
+	return values
+}
+
+// NeedsRestart reports whether a change to the setting only takes effect
+// after the application is restarted.
+func NeedsRestart(key string) bool {
+	switch key {
+	case "update_interval", "target_interval", "log_level", "home_location", "black",
+		"http_listen", "http_allow_lan", "http_tls", "subdivisions":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"iptw/internal/localapi"
+)
+
+// Methods served by a running iptw.
+const (
+	MethodInstance = "instance" // localapi.Instance of the HTTP server
+	MethodShowMap  = "show_map" // open the web map in the browser
+	MethodReload   = "reload"   // re-read the config file
+	MethodQuit     = "quit"     // shut down
+	MethodAPI      = "api"      // call the REST API: APIRequest to APIResponse
+)
+
+// APIRequest is the params of MethodAPI: one call of the REST API under
+// /api/v1. Calls over the socket have write scope.
+type APIRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"` // including the query string
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// APIResponse is the result of MethodAPI.
+type APIResponse struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// APIClient calls the REST API through the control socket. It has the same
+// methods as localapi.Client, so commands can use either.
+type APIClient struct {
+	*Client
+}
+
+// Do sends a request to path with body encoded as JSON when it is not nil,
+// and decodes the JSON response into out when it is not nil. Error responses
+// are returned as *localapi.APIError.
+func (c APIClient) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	req := APIRequest{Method: method, Path: path}
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		req.Body = raw
+	}
+	var resp APIResponse
+	if err := c.Call(ctx, MethodAPI, req, &resp); err != nil {
+		return err
+	}
+
+	if resp.Status >= 400 {
+		var envelope struct {
+			Error *localapi.APIError `json:"error"`
+		}
+		if json.Unmarshal(resp.Body, &envelope) == nil && envelope.Error != nil {
+			return envelope.Error
+		}
+		return &localapi.APIError{Status: resp.Status, Code: "http_error", Message: http.StatusText(resp.Status)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Body, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// Get decodes the JSON response to a GET of path into out.
+func (c APIClient) Get(ctx context.Context, path string, out interface{}) error {
+	return c.Do(ctx, http.MethodGet, path, nil, out)
+}
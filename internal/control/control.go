@@ -0,0 +1,338 @@
+// Package control implements the control socket of a running iptw.
+//
+// The instance holding the singleton lock listens on a Unix domain socket in
+// ~/.config/iptw/control (Windows 10 and later support them too). A second
+// launch and the CLI commands connect to it to hand over what they were asked
+// to do instead of failing with "already running", and without knowing the
+// HTTP port or an API token. On Unix the socket's directory is only
+// accessible to the user. On Windows file modes do not apply; the socket
+// relies on the ACL it inherits from the user profile directory, which
+// standard users other than the owner cannot open by default.
+//
+// The protocol is JSON-RPC 2.0 with one JSON object per line in each
+// direction. A connection may carry any number of requests; requests without
+// an id are notifications and get no response.
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Error codes defined by JSON-RPC 2.0.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// maxMessageSize bounds a single request or response line.
+const maxMessageSize = 4 << 20
+
+// Request is a JSON-RPC request.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC response; exactly one of Result and Error is set.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error. Handlers return it to choose the code.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// InvalidParams returns an error for params a handler cannot use.
+func InvalidParams(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// DefaultSocketPath returns the path of the control socket,
+// ~/.config/iptw/control/control.sock. The socket gets a directory of its own
+// so that directory can be closed to other users.
+func DefaultSocketPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw", "control", "control.sock"), nil
+}
+
+// Handler answers one method. params is nil when the request has none.
+type Handler func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// Server dispatches requests from control socket connections to handlers.
+type Server struct {
+	mu       sync.Mutex
+	handlers map[string]Handler
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer returns a server without methods.
+func NewServer() *Server {
+	return &Server{handlers: make(map[string]Handler), conns: make(map[net.Conn]struct{})}
+}
+
+// Handle registers the handler for method.
+func (s *Server) Handle(method string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// Listen creates the socket at path. On Unix the directory of path must be
+// accessible to the user only, so no one else can connect between the socket
+// being created and its mode being restricted; it is created that way when
+// missing. A socket left behind by an instance that crashed is replaced; one
+// that still answers is not.
+func Listen(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create control socket directory: %w", err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check control socket directory: %w", err)
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			return nil, fmt.Errorf("control socket directory %s is accessible to other users (mode %v); restrict it with chmod 700", dir, info.Mode().Perm())
+		}
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use by another instance", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+	return ln, nil
+}
+
+// Serve accepts connections on ln until Close is called.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return net.ErrClosed
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return fmt.Errorf("failed to accept control connection: %w", err)
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections, closes the open ones and waits for
+// running handlers to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		resp, reply := s.dispatch(ctx, scanner.Bytes())
+		if !reply {
+			continue
+		}
+		if err := encoder.Encode(resp); err != nil {
+			slog.Debug("Failed to write control response", "error", err)
+			return
+		}
+	}
+}
+
+// dispatch runs one request line; reply is false for notifications.
+func (s *Server) dispatch(ctx context.Context, line []byte) (resp Response, reply bool) {
+	resp = Response{JSONRPC: "2.0", ID: json.RawMessage("null")}
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		resp.Error = &Error{Code: CodeParseError, Message: "invalid JSON"}
+		return resp, true
+	}
+	if len(req.ID) > 0 {
+		resp.ID = req.ID
+	}
+	notification := len(req.ID) == 0
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &Error{Code: CodeInvalidRequest, Message: "expected a JSON-RPC 2.0 request with a method"}
+		return resp, !notification
+	}
+
+	s.mu.Lock()
+	handler, ok := s.handlers[req.Method]
+	s.mu.Unlock()
+	if !ok {
+		resp.Error = &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+		return resp, !notification
+	}
+
+	result, err := handler(ctx, req.Params)
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+		return resp, !notification
+	}
+	if resp.Result, err = json.Marshal(result); err != nil {
+		resp.Error = &Error{Code: CodeInternalError, Message: fmt.Sprintf("failed to encode result: %v", err)}
+	}
+	return resp, !notification
+}
+
+// Client calls methods of a control server. It is safe for concurrent use;
+// calls are sent one at a time.
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	scanner *bufio.Scanner
+	nextID  atomic.Uint64
+}
+
+// Dial connects to the control socket at path. It fails quickly when no
+// instance is listening.
+func Dial(path string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to control socket: %w", err)
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	return &Client{conn: conn, scanner: scanner}, nil
+}
+
+// Call invokes method with params, which may be nil, and decodes the result
+// into result unless it is nil. Errors from the server are *Error.
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	req := Request{JSONRPC: "2.0", Method: method}
+	req.ID = json.RawMessage(fmt.Sprint(c.nextID.Add(1)))
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to encode params: %w", err)
+		}
+		req.Params = raw
+	}
+	line, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+		defer func() { _ = c.conn.SetDeadline(time.Time{}) }()
+	}
+	if _, err := c.conn.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to send %s: %w", method, err)
+	}
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read %s response: %w", method, err)
+		}
+		return fmt.Errorf("control connection closed during %s", method)
+	}
+	var resp Response
+	if err := json.Unmarshal(c.scanner.Bytes(), &resp); err != nil {
+		return fmt.Errorf("invalid %s response: %w", method, err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("failed to decode %s result: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,187 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"iptw/internal/localapi"
+)
+
+// socketPath returns a socket path short enough for the sun_path limit,
+// which t.TempDir paths can exceed.
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "iptw")
+	if err != nil {
+		t.Fatalf("MkdirTemp failed: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "control.sock")
+}
+
+// startServer serves s on a new socket and returns its path.
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	path := socketPath(t)
+	ln, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { _ = s.Close() })
+	return path
+}
+
+func TestCall(t *testing.T) {
+	s := NewServer()
+	notified := make(chan string, 1)
+	s.Handle("echo", func(_ context.Context, params json.RawMessage) (interface{}, error) {
+		var p struct{ Text string }
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, InvalidParams("expected {text}")
+		}
+		return p, nil
+	})
+	s.Handle("fail", func(context.Context, json.RawMessage) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	s.Handle("notify", func(_ context.Context, params json.RawMessage) (interface{}, error) {
+		notified <- string(params)
+		return nil, nil
+	})
+	path := startServer(t, s)
+
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var echo struct{ Text string }
+	if err := client.Call(ctx, "echo", map[string]string{"text": "hi"}, &echo); err != nil || echo.Text != "hi" {
+		t.Fatalf("expected the params echoed, got %+v (%v)", echo, err)
+	}
+
+	var rpcErr *Error
+	if err := client.Call(ctx, "echo", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != CodeInvalidParams {
+		t.Errorf("expected invalid params, got %v", err)
+	}
+	if err := client.Call(ctx, "fail", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != CodeInternalError || rpcErr.Message != "boom" {
+		t.Errorf("expected an internal error, got %v", err)
+	}
+	if err := client.Call(ctx, "missing", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != CodeMethodNotFound {
+		t.Errorf("expected method not found, got %v", err)
+	}
+
+	// Notifications get no response, so the next call reads its own
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte(`{"jsonrpc":"2.0","method":"notify","params":1}` + "\n" + `{"jsonrpc":"2.0","id":7,"method":"echo","params":{"text":"x"}}` + "\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if string(resp.ID) != "7" || resp.Error != nil {
+		t.Errorf("expected the response to id 7, got %+v", resp)
+	}
+	if got := <-notified; got != "1" {
+		t.Errorf("expected the notification params, got %q", got)
+	}
+}
+
+func TestListen(t *testing.T) {
+	path := startServer(t, NewServer())
+	if _, err := Listen(path); err == nil {
+		t.Error("expected a socket in use to be kept")
+	}
+
+	// A socket file nobody listens on is replaced
+	stale := socketPath(t)
+	if err := os.WriteFile(stale, nil, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	ln, err := Listen(stale)
+	if err != nil {
+		t.Fatalf("expected a stale socket to be replaced: %v", err)
+	}
+	_ = ln.Close()
+
+	if _, err := Dial(stale); err == nil {
+		t.Error("expected Dial to fail without a server")
+	}
+
+	// A directory other users can open is refused, a missing one is created
+	// for the user only
+	if runtime.GOOS != "windows" {
+		open := socketPath(t)
+		if err := os.Chmod(filepath.Dir(open), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Listen(open); err == nil {
+			t.Error("expected a socket in a shared directory to be refused")
+		}
+
+		nested := filepath.Join(filepath.Dir(socketPath(t)), "control", "control.sock")
+		ln, err := Listen(nested)
+		if err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		_ = ln.Close()
+		info, err := os.Stat(filepath.Dir(nested))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0700 {
+			t.Errorf("expected a 0700 socket directory, got %v", perm)
+		}
+	}
+}
+
+func TestAPIClient(t *testing.T) {
+	s := NewServer()
+	s.Handle(MethodAPI, func(_ context.Context, params json.RawMessage) (interface{}, error) {
+		var req APIRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, err
+		}
+		if req.Path == "/api/v1/missing" {
+			return APIResponse{Status: 404, Body: json.RawMessage(`{"error":{"status":404,"code":"not_found","message":"gone"}}`)}, nil
+		}
+		body, _ := json.Marshal(map[string]string{"method": req.Method, "body": string(req.Body)})
+		return APIResponse{Status: 200, Body: body}, nil
+	})
+	client, err := Dial(startServer(t, s))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	api := APIClient{Client: client}
+	ctx := context.Background()
+
+	var got map[string]string
+	if err := api.Do(ctx, "PUT", "/api/v1/target", map[string]string{"country": "France"}, &got); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if got["method"] != "PUT" || got["body"] != `{"country":"France"}` {
+		t.Errorf("expected the request forwarded, got %v", got)
+	}
+
+	var apiErr *localapi.APIError
+	if err := api.Get(ctx, "/api/v1/missing", nil); !errors.As(err, &apiErr) || apiErr.Status != 404 || apiErr.Code != "not_found" {
+		t.Errorf("expected the API error, got %v", err)
+	}
+}
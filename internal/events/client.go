@@ -0,0 +1,140 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client subscribes to an event stream served by a Broker and reconnects
+// when the connection drops, resuming after the last event it delivered.
+type Client struct {
+	// URL of the stream, e.g. http://127.0.0.1:8080/api/events.
+	URL string
+	// HTTPClient is used for requests; http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// Header is added to every request.
+	Header http.Header
+	// LastEventID is the ID of the last delivered event. Set it before
+	// subscribing to resume an earlier session.
+	LastEventID uint64
+	// RetryDelay is the wait between reconnects (default: 2s).
+	RetryDelay time.Duration
+}
+
+// NewClient returns a client for the stream at url.
+func NewClient(url string) *Client {
+	return &Client{URL: url}
+}
+
+// Subscribe calls handle for every event until ctx is done or handle returns
+// an error, which is then returned. Dropped connections are retried.
+func (c *Client) Subscribe(ctx context.Context, handle func(Event) error) error {
+	delay := c.RetryDelay
+	if delay <= 0 {
+		delay = 2 * time.Second
+	}
+	for {
+		err := c.stream(ctx, handle)
+		var handlerErr *handlerError
+		if errors.As(err, &handlerErr) {
+			return handlerErr.err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// handlerError marks errors returned by the event handler, which end the
+// subscription instead of triggering a reconnect.
+type handlerError struct{ err error }
+
+func (e *handlerError) Error() string { return e.err.Error() }
+
+// stream reads one connection until it ends.
+func (c *Client) stream(ctx context.Context, handle func(Event) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return &handlerError{fmt.Errorf("failed to create event stream request: %w", err)}
+	}
+	for key, values := range c.Header {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if c.LastEventID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(c.LastEventID, 10))
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to event stream: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("event stream returned %s", resp.Status)
+	}
+
+	return ReadStream(resp.Body, func(e Event) error {
+		if err := handle(e); err != nil {
+			return &handlerError{err}
+		}
+		c.LastEventID = e.ID
+		return nil
+	})
+}
+
+// ReadStream parses Server-Sent Events written by a Broker from r and calls
+// handle for each one until r ends or handle returns an error.
+func ReadStream(r io.Reader, handle func(Event) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// A blank line ends the event
+			if data.Len() == 0 {
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(data.String()), &e); err != nil {
+				return fmt.Errorf("failed to decode event: %w", err)
+			}
+			data.Reset()
+			if err := handle(e); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// id, event and retry fields repeat what the JSON data carries, and
+		// lines starting with ':' are heartbeats
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+// Package events streams live application events to the web UI and other
+// local tools over Server-Sent Events.
+//
+// Every published event gets an increasing ID and is kept in a bounded
+// backlog, so a client that reconnects with the ID of the last event it saw
+// (the Last-Event-ID header, or the last_event_id query parameter) receives
+// what it missed before the live stream continues. Subscribers that fall too
+// far behind are disconnected rather than slowing down publishers; they
+// resume from their last event ID like any other reconnect.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type identifies the kind of an event. It is sent as the SSE event name.
+type Type string
+
+const (
+	// TypeHit is published when a new connection to a country is observed.
+	TypeHit Type = "hit"
+	// TypeCountry is published when a country changes state: first visit,
+	// Matrix Prison or liberation.
+	TypeCountry Type = "country"
+	// TypeTarget is published when the target country changes. An empty
+	// Country means the target was cleared.
+	TypeTarget Type = "target"
+	// TypeAchievement is published when an achievement is unlocked.
+	TypeAchievement Type = "achievement"
+	// TypeFact is published with a "Did you know?" fact about a newly
+	// discovered place.
+	TypeFact Type = "fact"
+	// TypeConfig is published when a setting is changed at runtime.
+	TypeConfig Type = "config"
+	// TypeExpedition is published when an expedition starts, when one of its
+	// countries is reached and when it ends.
+	TypeExpedition Type = "expedition"
+	// TypeChallenge is published when a daily or weekly challenge is
+	// completed.
+	TypeChallenge Type = "challenge"
+	// TypeScore is published when points are earned or lost.
+	TypeScore Type = "score"
+	// TypeRecord is published when a personal score record is set.
+	TypeRecord Type = "record"
+)
+
+// Event is a single entry of the stream. Data holds the JSON payload for the
+// event type: Hit, CountryChange, TargetChange, Achievement, Fact,
+// ConfigChange, ExpeditionChange, ChallengeCompleted, ScoreChange or
+// ScoreRecord.
+type Event struct {
+	ID   uint64          `json:"id"`
+	Type Type            `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Decode unmarshals the event payload into v.
+func (e Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("failed to decode %s event %d: %w", e.Type, e.ID, err)
+	}
+	return nil
+}
+
+// Hit is the payload of TypeHit events.
+type Hit struct {
+	Country     string  `json:"country"`
+	City        string  `json:"city,omitempty"`
+	Subdivision string  `json:"subdivision,omitempty"` // ISO 3166-2 code, with the subdivisions setting
+	Lat         float64 `json:"lat"`
+	Lng         float64 `json:"lng"`
+	IP          string  `json:"ip"`
+	Port        string  `json:"port,omitempty"`
+	Protocol    string  `json:"proto,omitempty"`
+	ASN         uint    `json:"asn,omitempty"`
+}
+
+// CountryChange is the payload of TypeCountry events. State is one of
+// "visited", "prison" or "liberated".
+type CountryChange struct {
+	Country string `json:"country"`
+	State   string `json:"state"`
+	Hits    int    `json:"hits"`
+}
+
+// TargetChange is the payload of TypeTarget events.
+type TargetChange struct {
+	Country  string `json:"country"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// Achievement is the payload of TypeAchievement events.
+type Achievement struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Fact is the payload of TypeFact events.
+type Fact struct {
+	Country string `json:"country"`
+	City    string `json:"city,omitempty"`
+	Level   string `json:"level"`
+	Place   string `json:"place"`
+	Text    string `json:"text"`
+}
+
+// ExpeditionChange is the payload of TypeExpedition events. Outcome is one of
+// the history.Expedition* values; Country is set when a target was reached.
+type ExpeditionChange struct {
+	ID        string    `json:"id"`
+	Outcome   string    `json:"outcome"`
+	Country   string    `json:"country,omitempty"`
+	Countries []string  `json:"countries"`
+	Reached   []string  `json:"reached"`
+	Deadline  time.Time `json:"deadline"`
+}
+
+// ChallengeCompleted is the payload of TypeChallenge events. ID names the
+// period, e.g. daily-2026-10-18; Streak counts the consecutive periods
+// completed up to it.
+type ChallengeCompleted struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Title  string `json:"title"`
+	Streak int    `json:"streak"`
+}
+
+// ScoreChange is the payload of TypeScore events. Points is negative for a
+// penalty; Today and Total are the scores after the change.
+type ScoreChange struct {
+	Points  int    `json:"points"`
+	Reason  string `json:"reason"`
+	Country string `json:"country,omitempty"`
+	Today   int    `json:"today"`
+	Total   int    `json:"total"`
+}
+
+// ScoreRecord is the payload of TypeRecord events. Record is best_day or
+// streak; Value is the points of the day or the number of days of the streak.
+type ScoreRecord struct {
+	Record string `json:"record"`
+	Day    string `json:"day"`
+	Value  int    `json:"value"`
+}
+
+// ConfigChange is the payload of TypeConfig events. Key is the setting name
+// as written in the config file.
+type ConfigChange struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// DefaultBacklog is the number of events kept for clients that reconnect.
+const DefaultBacklog = 512
+
+// subscriberBuffer is how many events a subscriber may lag behind before it
+// is disconnected.
+const subscriberBuffer = 64
+
+// heartbeatInterval keeps idle streams alive through proxies and lets the
+// server notice closed connections.
+const heartbeatInterval = 15 * time.Second
+
+// Broker fans published events out to subscribers and keeps a backlog for
+// resuming. It is safe for concurrent use.
+type Broker struct {
+	mu      sync.Mutex
+	lastID  uint64
+	backlog []Event // oldest first, at most size entries
+	size    int
+	subs    map[chan Event]struct{}
+	closed  bool
+}
+
+// NewBroker returns a broker that keeps the last backlog events for clients
+// that reconnect.
+func NewBroker(backlog int) *Broker {
+	if backlog <= 0 {
+		backlog = DefaultBacklog
+	}
+	return &Broker{size: backlog, subs: make(map[chan Event]struct{})}
+}
+
+// Publish sends an event with the JSON encoding of data to every subscriber.
+func (b *Broker) Publish(t Type, data interface{}) Event {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		slog.Warn("Failed to encode event", "type", t, "error", err)
+		raw = nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	e := Event{ID: b.lastID, Type: t, Time: time.Now().UTC(), Data: raw}
+	b.backlog = append(b.backlog, e)
+	if len(b.backlog) > b.size {
+		b.backlog = b.backlog[len(b.backlog)-b.size:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// Too far behind: drop it, the client resumes from its last ID
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return e
+}
+
+// Subscribe returns the backlogged events after lastID and a channel of the
+// events published from now on. An ID the broker has not issued yet, for
+// example from before a restart, replays the whole backlog. The channel is
+// closed by cancel, or by the broker when the subscriber falls behind.
+func (b *Broker) Subscribe(lastID uint64) (replay []Event, ch <-chan Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastID > b.lastID {
+		lastID = 0
+	}
+	for _, e := range b.backlog {
+		if e.ID > lastID {
+			replay = append(replay, e)
+		}
+	}
+
+	c := make(chan Event, subscriberBuffer)
+	if b.closed {
+		close(c)
+		return replay, c, func() {}
+	}
+	b.subs[c] = struct{}{}
+	return replay, c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[c]; ok {
+			delete(b.subs, c)
+			close(c)
+		}
+	}
+}
+
+// Close closes every subscriber channel, ending open streams so a server can
+// shut down. Later subscribers get a closed channel; Publish still records
+// events in the backlog.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// ServeHTTP streams events as Server-Sent Events. The optional "types" query
+// parameter is a comma-separated list of event types to receive.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastIDParam := r.Header.Get("Last-Event-ID")
+	if lastIDParam == "" {
+		lastIDParam = r.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if lastIDParam != "" {
+		id, err := strconv.ParseUint(lastIDParam, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid last event ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	var types map[Type]bool
+	if param := r.URL.Query().Get("types"); param != "" {
+		types = make(map[Type]bool)
+		for _, t := range strings.Split(param, ",") {
+			types[Type(strings.TrimSpace(t))] = true
+		}
+	}
+
+	replay, ch, cancel := b.Subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, "retry: 2000\n\n"); err != nil {
+		return
+	}
+
+	for _, e := range replay {
+		if types == nil || types[e.Type] {
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if types != nil && !types[e.Type] {
+				continue
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes one event in SSE framing; the data line is the JSON
+// encoding of the whole event.
+func writeEvent(w http.ResponseWriter, e Event) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, raw)
+	return err
+}
@@ -0,0 +1,137 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBrokerResume(t *testing.T) {
+	b := NewBroker(3)
+	for _, country := range []string{"France", "Japan", "Chile", "Kenya"} {
+		b.Publish(TypeHit, Hit{Country: country})
+	}
+
+	replay, _, cancel := b.Subscribe(2)
+	cancel()
+	if len(replay) != 2 || replay[0].ID != 3 || replay[1].ID != 4 {
+		t.Fatalf("expected events 3 and 4, got %v", replay)
+	}
+	var hit Hit
+	if err := replay[1].Decode(&hit); err != nil || hit.Country != "Kenya" {
+		t.Errorf("expected Kenya, got %+v (%v)", hit, err)
+	}
+
+	// Only the last three events are kept
+	replay, _, cancel = b.Subscribe(0)
+	cancel()
+	if len(replay) != 3 || replay[0].ID != 2 {
+		t.Errorf("expected the backlog of 3 from event 2, got %v", replay)
+	}
+
+	// An ID from before a restart replays the whole backlog
+	replay, _, cancel = b.Subscribe(100)
+	cancel()
+	if len(replay) != 3 {
+		t.Errorf("expected the whole backlog for an unknown ID, got %d events", len(replay))
+	}
+}
+
+func TestBrokerDropsSlowSubscriber(t *testing.T) {
+	b := NewBroker(0)
+	_, ch, cancel := b.Subscribe(0)
+	defer cancel()
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.Publish(TypeTarget, TargetChange{Country: "Peru"})
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("expected %d buffered events before the channel closed, got %d", subscriberBuffer, n)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker(0)
+	_, ch, cancel := b.Subscribe(0)
+	defer cancel()
+	b.Close()
+	if _, ok := <-ch; ok {
+		t.Error("expected Close to close subscriber channels")
+	}
+
+	// Streams opened after Close end at once but still replay the backlog
+	b.Publish(TypeTarget, TargetChange{Country: "Peru"})
+	replay, ch, cancel := b.Subscribe(0)
+	cancel()
+	if _, ok := <-ch; ok || len(replay) != 1 {
+		t.Errorf("expected a closed channel and one replayed event, got %d", len(replay))
+	}
+}
+
+func TestClientSubscribe(t *testing.T) {
+	b := NewBroker(0)
+	b.Publish(TypeConfig, ConfigChange{Key: "theme", Value: "dark"})
+	b.Publish(TypeHit, Hit{Country: "Germany"})
+	server := httptest.NewServer(b)
+	defer server.Close()
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelCtx()
+
+	// Filter by type and stop after the first live event
+	done := errors.New("done")
+	client := NewClient(server.URL + "?types=hit,target")
+	client.RetryDelay = 10 * time.Millisecond
+	var got []Event
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		b.Publish(TypeCountry, CountryChange{Country: "Germany", State: "visited", Hits: 1})
+		b.Publish(TypeTarget, TargetChange{Country: "Peru"})
+	}()
+	err := client.Subscribe(ctx, func(e Event) error {
+		got = append(got, e)
+		if e.Type == TypeTarget {
+			return done
+		}
+		return nil
+	})
+	if !errors.Is(err, done) {
+		t.Fatalf("expected the handler error, got %v", err)
+	}
+	if len(got) != 2 || got[0].Type != TypeHit || got[1].ID != 4 {
+		t.Fatalf("expected the hit then the target event, got %v", got)
+	}
+	if client.LastEventID != 2 {
+		t.Errorf("expected last event ID 2 (the failed event is not acknowledged), got %d", client.LastEventID)
+	}
+
+	// Resuming sends only what came after the last delivered event
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	req.Header.Set("Last-Event-ID", "3")
+	reqCtx, cancelReq := context.WithCancel(ctx)
+	resp, err := http.DefaultClient.Do(req.WithContext(reqCtx))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	err = ReadStream(resp.Body, func(e Event) error {
+		if e.ID != 4 {
+			t.Errorf("expected event 4 after resuming from 3, got %d", e.ID)
+		}
+		cancelReq()
+		return done
+	})
+	if !errors.Is(err, done) {
+		t.Errorf("expected the handler error, got %v", err)
+	}
+}
@@ -7,6 +7,10 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 
 	"github.com/oschwald/geoip2-golang"
 )
@@ -17,17 +21,42 @@ import (
 //go:embed GeoLite2-City.mmdb.zip
 var embeddedDB []byte
 
+// maxCachedLookups bounds the lookup cache; it is emptied when full.
+const maxCachedLookups = 4096
+
 // Database wraps the GeoIP2 database
 type Database struct {
-	db *geoip2.Reader
+	db  *geoip2.Reader
+	asn *geoip2.Reader // optional GeoLite2-ASN database; nil when not loaded
+
+	cacheMu sync.Mutex
+	cache   map[string]Location // successful lookups by IP string
+
+	lookups     atomic.Uint64
+	errors      atomic.Uint64
+	cacheHits   atomic.Uint64
+	cacheMisses atomic.Uint64
+}
+
+// Stats counts lookups since the database was opened.
+type Stats struct {
+	Lookups      uint64 // calls to Lookup
+	Errors       uint64 // lookups that failed
+	CacheHits    uint64
+	CacheMisses  uint64
+	CacheEntries int
 }
 
 // Location represents a geographic location
 type Location struct {
-	Latitude  float64
-	Longitude float64
-	Country   string
-	City      string
+	Latitude        float64
+	Longitude       float64
+	Country         string
+	City            string
+	Subdivision     string // First-level administrative division: state, province...
+	SubdivisionCode string // ISO 3166-2 code of the subdivision, e.g. US-CA
+	ASN             uint   // Autonomous system number; 0 without an ASN database
+	ASOrg           string // Organization owning the autonomous system
 }
 
 // NewDatabase creates a new GeoIP database instance
@@ -50,7 +79,7 @@ func NewDatabase(dbPath string) (*Database, error) {
 		}
 	}
 
-	return &Database{db: db}, nil
+	return &Database{db: db, cache: make(map[string]Location)}, nil
 }
 
 // loadEmbeddedDatabase decompresses and loads the embedded zipped database
@@ -100,13 +129,85 @@ func loadEmbeddedDatabase() (*geoip2.Reader, error) {
 	return db, nil
 }
 
+// DefaultASNPath returns where an optional GeoLite2-ASN database is looked
+// for, next to the City database downloaded by get-ip-database.
+func DefaultASNPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw", "resources", "GeoLite2-ASN.mmdb"), nil
+}
+
+// LoadASN opens a GeoLite2-ASN database so lookups also report the
+// autonomous system of an address. The ASN database is not embedded.
+func (d *Database) LoadASN(path string) error {
+	asn, err := geoip2.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open ASN database from %s: %w", path, err)
+	}
+	if d.asn != nil {
+		_ = d.asn.Close()
+	}
+	d.asn = asn
+	d.cacheMu.Lock()
+	d.cache = make(map[string]Location)
+	d.cacheMu.Unlock()
+	return nil
+}
+
 // Close closes the database
 func (d *Database) Close() error {
+	if d.asn != nil {
+		_ = d.asn.Close()
+	}
 	return d.db.Close()
 }
 
-// Lookup looks up the location for an IP address
+// Lookup looks up the location for an IP address. Results are cached, and
+// every call returns a copy the caller may modify.
 func (d *Database) Lookup(ipStr string) (*Location, error) {
+	d.lookups.Add(1)
+	d.cacheMu.Lock()
+	cached, ok := d.cache[ipStr]
+	d.cacheMu.Unlock()
+	if ok {
+		d.cacheHits.Add(1)
+		return &cached, nil
+	}
+	d.cacheMisses.Add(1)
+
+	location, err := d.lookup(ipStr)
+	if err != nil {
+		d.errors.Add(1)
+		return nil, err
+	}
+
+	d.cacheMu.Lock()
+	if d.cache == nil || len(d.cache) >= maxCachedLookups {
+		d.cache = make(map[string]Location)
+	}
+	d.cache[ipStr] = *location
+	d.cacheMu.Unlock()
+	return location, nil
+}
+
+// Stats returns the lookup and cache counters.
+func (d *Database) Stats() Stats {
+	d.cacheMu.Lock()
+	entries := len(d.cache)
+	d.cacheMu.Unlock()
+	return Stats{
+		Lookups:      d.lookups.Load(),
+		Errors:       d.errors.Load(),
+		CacheHits:    d.cacheHits.Load(),
+		CacheMisses:  d.cacheMisses.Load(),
+		CacheEntries: entries,
+	}
+}
+
+// lookup reads the location of an IP address from the databases.
+func (d *Database) lookup(ipStr string) (*Location, error) {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
@@ -130,5 +231,20 @@ func (d *Database) Lookup(ipStr string) (*Location, error) {
 		location.City = record.City.Names["en"]
 	}
 
+	if len(record.Subdivisions) > 0 {
+		subdivision := record.Subdivisions[0]
+		location.Subdivision = subdivision.Names["en"]
+		if subdivision.IsoCode != "" && record.Country.IsoCode != "" {
+			location.SubdivisionCode = record.Country.IsoCode + "-" + subdivision.IsoCode
+		}
+	}
+
+	if d.asn != nil {
+		if asn, err := d.asn.ASN(ip); err == nil {
+			location.ASN = asn.AutonomousSystemNumber
+			location.ASOrg = asn.AutonomousSystemOrganization
+		}
+	}
+
 	return location, nil
 }
@@ -0,0 +1,242 @@
+package gui
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"iptw/internal/localapi"
+)
+
+// tokenCookie carries a read token for browsers on other machines, which
+// cannot add headers to image, tile and event stream requests.
+const tokenCookie = "iptw_token"
+
+// isLoopbackHost reports whether a listen host only accepts local
+// connections. The empty host binds every interface.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// listenLocal binds the configured http_listen address. Non-loopback
+// addresses need http_allow_lan; a busy port falls back to a free one so the
+// UI stays available. It returns the listener, wrapped in TLS when http_tls
+// is on, and the base URL.
+func (a *App) listenLocal() (net.Listener, string, error) {
+	a.configMu.RLock()
+	addr, allowLAN, useTLS := a.config.HTTPListen, a.config.HTTPAllowLAN, a.config.HTTPTLS
+	a.configMu.RUnlock()
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid http_listen %q: %w", addr, err)
+	}
+	if !isLoopbackHost(host) && !allowLAN {
+		slog.Warn("http_listen is not a loopback address and http_allow_lan is off - listening on 127.0.0.1 only", "http_listen", addr)
+		host = "127.0.0.1"
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil && port != "0" {
+		slog.Warn("Failed to bind configured HTTP address - using a free port", "address", net.JoinHostPort(host, port), "error", err)
+		ln, err = net.Listen("tcp", net.JoinHostPort(host, "0"))
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to bind local HTTP server: %w", err)
+	}
+	tcpAddr, ok := ln.Addr().(*net.TCPAddr)
+	if !ok {
+		_ = ln.Close()
+		return nil, "", fmt.Errorf("unexpected listener address type %T", ln.Addr())
+	}
+
+	// Wildcard binds are reached locally through the loopback address
+	urlHost := host
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		urlHost = "127.0.0.1"
+	}
+	scheme := "http"
+	if useTLS {
+		cert, err := a.loadCertificate(host)
+		if err != nil {
+			_ = ln.Close()
+			return nil, "", err
+		}
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+		scheme = "https"
+	}
+	return ln, fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(urlHost, fmt.Sprint(tcpAddr.Port))), nil
+}
+
+// loadCertificate returns the self-signed certificate, covering the loopback
+// names, the listen host and, for wildcard binds, every interface address.
+func (a *App) loadCertificate(host string) (tls.Certificate, error) {
+	certFile, keyFile, err := localapi.DefaultTLSPaths()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		if addrs, err := net.InterfaceAddrs(); err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+					hosts = append(hosts, ipNet.IP.String())
+				}
+			}
+		}
+	} else if !isLoopbackHost(host) {
+		hosts = append(hosts, host)
+	}
+	cert, err := localapi.LoadOrCreateCertificate(certFile, keyFile, hosts)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to prepare TLS certificate: %w", err)
+	}
+	a.certFile = certFile
+	return cert, nil
+}
+
+// requestToken returns the token sent with a request in the X-Session-Token
+// header, an Authorization bearer header or the _t query parameter.
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get("X-Session-Token"); token != "" {
+		return token
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.URL.Query().Get("_t")
+}
+
+// tokenScope returns the scope of a token: write for the session token of
+// the embedded UI, or the scope of a token from the token file.
+func (a *App) tokenScope(token string) (localapi.Scope, bool) {
+	if token == "" {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.sessionToken)) == 1 {
+		return localapi.ScopeWrite, true
+	}
+	if a.apiTokens != nil {
+		if t, ok := a.apiTokens.Lookup(token); ok {
+			return t.Scope, true
+		}
+	}
+	return "", false
+}
+
+// authorized reports whether a request carries a token allowing need. The
+// cookie only grants reads, so other sites cannot forge writes with it.
+func (a *App) authorized(r *http.Request, need localapi.Scope) bool {
+	if scope, ok := a.tokenScope(requestToken(r)); ok {
+		return scope.Allows(need)
+	}
+	if need == localapi.ScopeRead {
+		if cookie, err := r.Cookie(tokenCookie); err == nil {
+			_, ok := a.tokenScope(cookie.Value)
+			return ok
+		}
+	}
+	return false
+}
+
+// isLocalRequest reports whether a request comes from this machine.
+func isLocalRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLocalHost reports whether a request names this server in its Host
+// header: a loopback name or the configured listen host. Any other name on a
+// local request is a foreign domain rebound to the loopback address, whose
+// pages must not read the session token.
+func (a *App) isLocalHost(r *http.Request) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	switch strings.ToLower(host) {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	case "":
+		return false
+	}
+
+	a.configMu.RLock()
+	listen := a.config.HTTPListen
+	a.configMu.RUnlock()
+	listenHost, _, err := net.SplitHostPort(listen)
+	return err == nil && strings.EqualFold(host, listenHost)
+}
+
+// requireReadAccess lets local requests addressed to a local host through and
+// requires a token from other machines. A valid token in the _t parameter is
+// stored in a cookie, so opening /?_t=TOKEN once signs a browser in.
+func (a *App) requireReadAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isLocalRequest(r) {
+			if !a.isLocalHost(r) {
+				slog.Warn("Rejected local request for a foreign host", "host", r.Host, "path", r.URL.Path)
+				if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+					writeAPIError(w, http.StatusForbidden, "Requests must be addressed to localhost or 127.0.0.1")
+				} else {
+					http.Error(w, "Forbidden: open this page through localhost or 127.0.0.1", http.StatusForbidden)
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !a.authorized(r, localapi.ScopeRead) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="iptw"`)
+			if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+				writeAPIError(w, http.StatusUnauthorized, "An API token is required for requests from other machines")
+			} else {
+				http.Error(w, "Unauthorized: open this page with ?_t=<token>", http.StatusUnauthorized)
+			}
+			return
+		}
+		if token := r.URL.Query().Get("_t"); token != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pageToken returns the token to embed in the UI page: the session token for
+// local browsers on a local host, and the token the request was authorized
+// with otherwise.
+func (a *App) pageToken(r *http.Request) string {
+	if isLocalRequest(r) {
+		if !a.isLocalHost(r) {
+			return ""
+		}
+		return a.sessionToken
+	}
+	if token := requestToken(r); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(tokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
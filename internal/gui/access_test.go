@@ -0,0 +1,135 @@
+package gui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"iptw/internal/localapi"
+)
+
+func TestAPITokenAccess(t *testing.T) {
+	a := newTestApp(t)
+	tokens, err := localapi.LoadTokens(filepath.Join(t.TempDir(), "api-tokens"))
+	if err != nil {
+		t.Fatalf("LoadTokens failed: %v", err)
+	}
+	a.apiTokens = tokens
+	read, err := tokens.Create("dashboard", localapi.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write, _ := tokens.ForScope(localapi.ScopeWrite)
+
+	mux := http.NewServeMux()
+	a.registerAPI(mux)
+	handler := a.requireReadAccess(mux)
+	serve := func(method, path, remote string, header map[string]string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remote
+		req.Host = "127.0.0.1:32782"
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	const local, lan = "127.0.0.1:50000", "192.168.1.20:50000"
+
+	// Reads are open locally and need a token from other machines
+	if rec := serve(http.MethodGet, "/api/v1/stats", local, nil); rec.Code != http.StatusOK {
+		t.Errorf("expected a local read to succeed, got %d", rec.Code)
+	}
+	expectAPIError(t, serve(http.MethodGet, "/api/v1/stats", lan, nil), http.StatusUnauthorized, "unauthorized")
+	bearer := map[string]string{"Authorization": "Bearer " + read.Value}
+	if rec := serve(http.MethodGet, "/api/v1/stats", lan, bearer); rec.Code != http.StatusOK {
+		t.Errorf("expected a read with a read token to succeed, got %d", rec.Code)
+	}
+
+	// A token in the query string signs the browser in with a cookie
+	rec := serve(http.MethodGet, "/api/v1/stats?_t="+read.Value, lan, nil)
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != tokenCookie || !cookies[0].HttpOnly {
+		t.Fatalf("expected a session cookie, got %d %v", rec.Code, cookies)
+	}
+	if rec := serve(http.MethodGet, "/api/v1/hits", lan, nil, cookies[0]); rec.Code != http.StatusOK {
+		t.Errorf("expected the cookie to allow reads, got %d", rec.Code)
+	}
+
+	// Writes need write scope, and never come from the cookie
+	path := "/api/v1/target/reroll"
+	expectAPIError(t, serve(http.MethodPost, path, local, bearer), http.StatusForbidden, "forbidden")
+	writeCookie := &http.Cookie{Name: tokenCookie, Value: write.Value}
+	expectAPIError(t, serve(http.MethodPost, path, lan, nil, writeCookie), http.StatusForbidden, "forbidden")
+	if rec := serve(http.MethodPost, path, lan, map[string]string{"Authorization": "Bearer " + write.Value}); rec.Code != http.StatusOK {
+		t.Errorf("expected a write token to reroll the target, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(http.MethodPost, path, local, map[string]string{"X-Session-Token": "secret"}); rec.Code != http.StatusOK {
+		t.Errorf("expected the session token to keep working, got %d", rec.Code)
+	}
+}
+
+func TestDNSRebinding(t *testing.T) {
+	a := newTestApp(t)
+	a.config.HTTPListen = "iptw.home.arpa:32782"
+	mux := http.NewServeMux()
+	a.registerAPI(mux)
+	handler := a.requireReadAccess(mux)
+
+	for host, allowed := range map[string]bool{
+		"127.0.0.1:32782":      true,
+		"localhost:32782":      true,
+		"[::1]:32782":          true,
+		"iptw.home.arpa:32782": true,
+		"attacker.example":     false,
+		"":                     false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil)
+		req.RemoteAddr = "127.0.0.1:50000"
+		req.Host = host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if allowed && rec.Code != http.StatusOK {
+			t.Errorf("expected host %q to be served, got %d", host, rec.Code)
+		} else if !allowed {
+			expectAPIError(t, rec, http.StatusForbidden, "forbidden")
+		}
+
+		if token := a.pageToken(req); (token == a.sessionToken) != allowed {
+			t.Errorf("host %q: unexpected page token %q", host, token)
+		}
+	}
+}
+
+func TestListenLocal(t *testing.T) {
+	a := newTestApp(t)
+	a.config.HTTPListen = "0.0.0.0:0"
+	ln, url, err := a.listenLocal()
+	if err != nil {
+		t.Fatalf("listenLocal failed: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+	if host := ln.Addr().String(); !strings.HasPrefix(host, "127.0.0.1:") {
+		t.Errorf("expected a loopback bind without http_allow_lan, got %s", host)
+	}
+	if !strings.HasPrefix(url, "http://127.0.0.1:") {
+		t.Errorf("unexpected URL %s", url)
+	}
+
+	a.config.HTTPTLS = true
+	a.config.HTTPListen = "127.0.0.1:0"
+	tlsLn, tlsURL, err := a.listenLocal()
+	if err != nil {
+		t.Fatalf("listenLocal with TLS failed: %v", err)
+	}
+	defer func() { _ = tlsLn.Close() }()
+	if !strings.HasPrefix(tlsURL, "https://") || a.certFile == "" {
+		t.Errorf("expected an https URL and a certificate, got %s %q", tlsURL, a.certFile)
+	}
+}
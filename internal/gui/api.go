@@ -0,0 +1,716 @@
+package gui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"iptw/internal/achievements"
+	"iptw/internal/config"
+	"iptw/internal/factdb"
+	"iptw/internal/history"
+	"iptw/internal/localapi"
+	"iptw/internal/resources"
+	"iptw/internal/score"
+)
+
+// apiPrefix is the root of the versioned REST API.
+const apiPrefix = "/api/v1"
+
+// apiError is the body of every /api/v1 error response.
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+// apiErrorBody describes what went wrong. Code is a stable machine-readable
+// name for Status.
+type apiErrorBody struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiErrorCodes names the HTTP statuses the API responds with.
+var apiErrorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusConflict:            "conflict",
+	http.StatusInternalServerError: "internal_error",
+	http.StatusServiceUnavailable:  "unavailable",
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode API response", "error", err)
+	}
+}
+
+// writeAPIError writes an error envelope.
+func writeAPIError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	code, ok := apiErrorCodes[status]
+	if !ok {
+		code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+	writeJSON(w, status, apiError{Error: apiErrorBody{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}})
+}
+
+// decodeJSONBody decodes a request body into v, rejecting unknown fields.
+func decodeJSONBody(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// apiParam documents a query or path parameter.
+type apiParam struct {
+	Name        string
+	In          string // "query" or "path"
+	Description string
+}
+
+// apiRoute is one operation of the API. The route table drives both the mux
+// and the OpenAPI document, so the two cannot drift apart.
+type apiRoute struct {
+	Method   string
+	Path     string // ServeMux pattern without the method, e.g. /api/v1/countries/{country}
+	Summary  string
+	Write    bool // requires the session token
+	Params   []apiParam
+	Request  interface{} // zero value of the JSON request body, nil when there is none
+	Response interface{} // zero value of the JSON response body
+	Handler  http.HandlerFunc
+}
+
+// apiRoutes returns the operations of the v1 API.
+func (a *App) apiRoutes() []apiRoute {
+	countryParam := apiParam{Name: "country", In: "path", Description: "Country name or ISO 3166-1 alpha-2 or alpha-3 code"}
+	return []apiRoute{
+		{Method: http.MethodGet, Path: apiPrefix + "/stats", Summary: "Game statistics and recent hits", Response: statsResponse{}, Handler: a.handleAPIStats},
+		{Method: http.MethodGet, Path: apiPrefix + "/countries", Summary: "Countries filtered by state, region or name", Params: []apiParam{
+			{Name: "state", In: "query", Description: "Comma-separated states: unvisited, visited, prison, liberated (default: all but unvisited)"},
+			{Name: "region", In: "query", Description: "Region or sub-region, e.g. Europe or Western Africa"},
+			{Name: "q", In: "query", Description: "Case-insensitive substring of the country name"},
+			{Name: "sort", In: "query", Description: "hits (default), name or last_hit"},
+			{Name: "order", In: "query", Description: "asc or desc; defaults to desc, or asc when sorting by name"},
+			{Name: "limit", In: "query", Description: "Maximum number of countries; 0 for all"},
+			{Name: "offset", In: "query", Description: "Number of countries to skip"},
+		}, Response: countryList{}, Handler: a.handleAPICountries},
+		{Method: http.MethodGet, Path: apiPrefix + "/countries/{country}", Summary: "State, history and facts of one country", Params: []apiParam{
+			countryParam,
+			{Name: "days", In: "query", Description: "Days in the daily hit series (default 30, at most 366)"},
+		}, Response: countryDetail{}, Handler: a.handleAPICountry},
+		{Method: http.MethodPost, Path: apiPrefix + "/countries/{country}/imprison", Summary: "Send a country to Matrix Prison", Write: true, Params: []apiParam{countryParam}, Response: countryStatus{}, Handler: a.handleAPIImprison},
+		{Method: http.MethodGet, Path: apiPrefix + "/cities", Summary: "Collection of visited cities", Params: []apiParam{
+			{Name: "country", In: "query", Description: "Only the cities of this country"},
+		}, Response: cityList{}, Handler: a.handleAPICities},
+		{Method: http.MethodGet, Path: apiPrefix + "/subdivisions", Summary: "Visited states and provinces, with those not visited yet for a country", Params: []apiParam{
+			{Name: "country", In: "query", Description: "Only the subdivisions of this country"},
+		}, Response: subdivisionList{}, Handler: a.handleAPISubdivisions},
+		{Method: http.MethodGet, Path: apiPrefix + "/target", Summary: "Current target country and research hint", Response: targetResponse{}, Handler: a.handleAPITarget},
+		{Method: http.MethodPut, Path: apiPrefix + "/target", Summary: "Choose the target country; it must not be visited yet", Write: true, Request: targetRequest{}, Response: targetResponse{}, Handler: a.handleAPISetTarget},
+		{Method: http.MethodPost, Path: apiPrefix + "/target/reroll", Summary: "Make the next queued country the target, or draw one from the target pool", Write: true, Response: targetResponse{}, Handler: a.handleAPIRerollTarget},
+		{Method: http.MethodGet, Path: apiPrefix + "/target/queue", Summary: "Countries to make the target next, in order", Response: targetQueue{}, Handler: a.handleAPITargetQueue},
+		{Method: http.MethodPut, Path: apiPrefix + "/target/queue", Summary: "Replace the queue of upcoming targets", Write: true, Request: targetQueue{}, Response: targetQueue{}, Handler: a.handleAPISetTargetQueue},
+		{Method: http.MethodPost, Path: apiPrefix + "/target/queue", Summary: "Add countries to the end of the target queue", Write: true, Request: targetQueue{}, Response: targetQueue{}, Handler: a.handleAPIQueueTargets},
+		{Method: http.MethodDelete, Path: apiPrefix + "/target/queue", Summary: "Clear the target queue", Write: true, Response: targetQueue{}, Handler: a.handleAPIClearTargetQueue},
+		{Method: http.MethodGet, Path: apiPrefix + "/target/regions", Summary: "Regions and sub-regions for the target_pool setting", Response: targetRegionList{}, Handler: a.handleAPITargetRegions},
+		{Method: http.MethodGet, Path: apiPrefix + "/expedition", Summary: "Running or last expedition and its countries", Response: expeditionStatus{}, Handler: a.handleAPIExpedition},
+		{Method: http.MethodPost, Path: apiPrefix + "/expedition", Summary: "Start an expedition to several countries with a deadline", Write: true, Request: expeditionRequest{}, Response: expeditionStatus{}, Handler: a.handleAPIStartExpedition},
+		{Method: http.MethodDelete, Path: apiPrefix + "/expedition", Summary: "Abandon the running expedition", Write: true, Response: expeditionStatus{}, Handler: a.handleAPIAbandonExpedition},
+		{Method: http.MethodGet, Path: apiPrefix + "/challenges", Summary: "Daily and weekly challenges with progress and streaks", Params: []apiParam{
+			{Name: "date", In: "query", Description: "Day whose challenges to show as YYYY-MM-DD; today by default"},
+		}, Response: challengeList{}, Handler: a.handleAPIChallenges},
+		{Method: http.MethodGet, Path: apiPrefix + "/score", Summary: "Daily, weekly and all-time score, best days and streaks", Response: score.Summary{}, Handler: a.handleAPIScore},
+		{Method: http.MethodGet, Path: apiPrefix + "/achievements", Summary: "All achievements and their progress", Response: achievementList{}, Handler: a.handleAPIAchievements},
+		{Method: http.MethodGet, Path: apiPrefix + "/hits", Summary: "Most recent hits, newest first", Response: hitList{}, Handler: a.handleAPIHits},
+		{Method: http.MethodGet, Path: apiPrefix + "/profiles", Summary: "Player profiles, the active one and the routes of hits to profiles", Response: profileList{}, Handler: a.handleAPIProfiles},
+		{Method: http.MethodPut, Path: apiPrefix + "/profiles/active", Summary: "Switch to another player profile, creating it if needed", Write: true, Request: profileRequest{}, Response: profileList{}, Handler: a.handleAPISetProfile},
+		{Method: http.MethodGet, Path: apiPrefix + "/config", Summary: "Current settings", Response: configResponse{}, Handler: a.handleAPIConfig},
+		{Method: http.MethodPatch, Path: apiPrefix + "/config", Summary: "Change settings; all or none are applied", Write: true, Request: configPatch{}, Response: configResponse{}, Handler: a.handleAPIPatchConfig},
+		{Method: http.MethodGet, Path: apiPrefix + "/facts", Summary: "A \"Did you know?\" fact about a country or city", Params: []apiParam{
+			{Name: "country", In: "query", Description: "Country name or ISO code (required)"},
+			{Name: "city", In: "query", Description: "City for a more specific fact"},
+		}, Response: factdb.Fact{}, Handler: a.handleAPIFact},
+		{Method: http.MethodGet, Path: apiPrefix + "/facts/random", Summary: "A fact about a random visited country", Response: factdb.Fact{}, Handler: a.handleAPIRandomFact},
+		{Method: http.MethodPost, Path: apiPrefix + "/wallpaper/restore", Summary: "Restore the original wallpaper", Write: true, Response: wallpaperRestoreResponse{}, Handler: a.handleAPIRestoreWallpaper},
+		{Method: http.MethodGet, Path: apiPrefix + "/openapi.json", Summary: "This OpenAPI document", Response: map[string]interface{}{}, Handler: a.handleAPIOpenAPI},
+	}
+}
+
+// registerAPI adds the v1 API to mux. Operations on the same path share a
+// handler that answers other methods with 405.
+func (a *App) registerAPI(mux *http.ServeMux) {
+	byPath := make(map[string]map[string]http.HandlerFunc)
+	var paths []string
+	for _, route := range a.apiRoutes() {
+		handler := route.Handler
+		if route.Write {
+			handler = a.requireAPIToken(handler)
+		}
+		if byPath[route.Path] == nil {
+			byPath[route.Path] = make(map[string]http.HandlerFunc)
+			paths = append(paths, route.Path)
+		}
+		byPath[route.Path][route.Method] = handler
+	}
+
+	for _, path := range paths {
+		methods := byPath[path]
+		allowed := make([]string, 0, len(methods))
+		for method := range methods {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			handler, ok := methods[r.Method]
+			if !ok && r.Method == http.MethodHead {
+				handler, ok = methods[http.MethodGet]
+			}
+			if !ok {
+				w.Header().Set("Allow", strings.Join(allowed, ", "))
+				writeAPIError(w, http.StatusMethodNotAllowed, "%s is not supported on %s", r.Method, r.URL.Path)
+				return
+			}
+			handler(w, r)
+		})
+	}
+
+	mux.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "No API resource at %s", r.URL.Path)
+	})
+}
+
+// requireAPIToken is requireSessionToken with an error envelope.
+func (a *App) requireAPIToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r, localapi.ScopeWrite) {
+			writeAPIError(w, http.StatusForbidden, "A token with write scope is required in the X-Session-Token or Authorization header")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// resolveCountry returns the canonical name of a country given by name or
+// ISO alpha-2 or alpha-3 code. Map names are preferred, so the result matches
+// the names hits are counted under.
+func (a *App) resolveCountry(param string) (string, bool) {
+	name := param
+	switch len(param) {
+	case 2:
+		if n, err := resources.GetNameByAlpha2(param); err == nil {
+			name = n
+		}
+	case 3:
+		for _, c := range resources.GetAllCountries() {
+			if strings.EqualFold(c.Alpha3, param) {
+				name = c.Name
+				break
+			}
+		}
+	}
+
+	if a.naturalEarth != nil {
+		for _, country := range a.naturalEarth.Countries {
+			if strings.EqualFold(country.Name, name) {
+				return country.Name, true
+			}
+		}
+	}
+	for _, c := range resources.GetAllCountries() {
+		if strings.EqualFold(c.Name, name) {
+			return c.Name, true
+		}
+	}
+	// Countries only known from GeoIP fallbacks
+	for country := range a.gameState.GetCountries() {
+		if strings.EqualFold(country, name) {
+			return country, true
+		}
+	}
+	return "", false
+}
+
+// statsResponse is returned by /api/stats and /api/v1/stats.
+type statsResponse struct {
+	VisitedCount     int           `json:"visited_count"`
+	PrisonCount      int           `json:"prison_count"`
+	LiberatedCount   int           `json:"liberated_count"`
+	AchievementCount int           `json:"achievement_count"`
+	Score            int           `json:"score"`
+	ScoreToday       int           `json:"score_today"`
+	TargetCountry    string        `json:"target_country"`
+	InMatrixPrison   bool          `json:"in_matrix_prison"` // a current connection goes to a Matrix Prison country
+	RecentHits       []RecentHit   `json:"recent_hits"`
+	TopCountries     []countryHits `json:"top_countries"` // at most 10
+}
+
+// countryHits is a country and its hit count.
+type countryHits struct {
+	Country string `json:"country"`
+	Hits    int    `json:"hits"`
+}
+
+// collectStats gathers the game statistics shown in the web UI.
+func (a *App) collectStats() statsResponse {
+	// Identify inMatrixPrison state
+	recentCountries := make(map[string]bool)
+	for _, conn := range a.monitor.GetConnections() {
+		loc, err := a.geoip.Lookup(conn.RemoteIP)
+		if err == nil {
+			country := a.naturalEarth.FindCountryAtPoint(loc.Latitude, loc.Longitude)
+			if country != "" {
+				recentCountries[country] = true
+			}
+		}
+	}
+
+	stats := statsResponse{TopCountries: []countryHits{}}
+	a.gameState.mutex.RLock()
+	stats.VisitedCount = len(a.gameState.countries)
+	for country, state := range a.gameState.countries {
+		if state.MatrixPrison && !state.Liberated {
+			stats.PrisonCount++
+			if recentCountries[country] {
+				stats.InMatrixPrison = true
+			}
+		}
+		if state.Liberated {
+			stats.LiberatedCount++
+		}
+		stats.TopCountries = append(stats.TopCountries, countryHits{Country: country, Hits: state.HitCount})
+	}
+	// Read targetCountry directly — we already hold the read lock.
+	// Calling GetTargetCountry() here would attempt a second RLock on the same
+	// mutex; if a writer (targetSelectionLoop) is queued, Go's RWMutex blocks
+	// all new RLock calls, causing both goroutines to wait on each other forever.
+	stats.TargetCountry = a.gameState.targetCountry
+	a.gameState.mutex.RUnlock()
+
+	// Sort top countries by hits descending
+	sort.Slice(stats.TopCountries, func(i, j int) bool {
+		return stats.TopCountries[i].Hits > stats.TopCountries[j].Hits
+	})
+	if len(stats.TopCountries) > 10 {
+		stats.TopCountries = stats.TopCountries[:10]
+	}
+
+	stats.AchievementCount = len(a.achievements.GetUnlockedAchievements())
+	summary := a.scores.summary(time.Now())
+	stats.Score, stats.ScoreToday = summary.Total, summary.Today
+	stats.RecentHits = a.recentHitsSnapshot()
+	return stats
+}
+
+// recentHitsSnapshot copies the recent hits, newest first.
+func (a *App) recentHitsSnapshot() []RecentHit {
+	a.recentHitsMu.RLock()
+	defer a.recentHitsMu.RUnlock()
+	hits := make([]RecentHit, len(a.recentHits))
+	copy(hits, a.recentHits)
+	return hits
+}
+
+func (a *App) handleAPIStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.collectStats())
+}
+
+// countryStatus is the game state of one country.
+type countryStatus struct {
+	Name      string     `json:"name"`
+	ISOA2     string     `json:"iso_a2,omitempty"`
+	ISOA3     string     `json:"iso_a3,omitempty"`
+	Region    string     `json:"region,omitempty"`
+	SubRegion string     `json:"sub_region,omitempty"`
+	State     string     `json:"state"` // unvisited, visited, prison or liberated
+	Hits      int        `json:"hits"`
+	Prison    bool       `json:"prison"`
+	Liberated bool       `json:"liberated"`
+	Target    bool       `json:"target"`
+	LastHit   *time.Time `json:"last_hit,omitempty"`
+}
+
+// newCountryStatus describes a country from its game state, which is nil for
+// countries without hits.
+func newCountryStatus(name string, state *CountryGameState, target string) countryStatus {
+	status := countryStatus{Name: name, State: resources.CountryUnvisited, Target: name == target}
+	if alpha2, err := resources.GetAlpha2ByName(name); err == nil {
+		status.ISOA2 = alpha2
+		if info, err := resources.GetCountryByAlpha2(alpha2); err == nil {
+			status.ISOA3, status.Region, status.SubRegion = info.Alpha3, info.Region, info.SubRegion
+		}
+	}
+	if state != nil {
+		status.Hits, status.Prison, status.Liberated = state.HitCount, state.MatrixPrison, state.Liberated
+		status.State = resources.CountryState(state.HitCount, state.MatrixPrison, state.Liberated)
+		if !state.LastHit.IsZero() {
+			lastHit := state.LastHit
+			status.LastHit = &lastHit
+		}
+	}
+	return status
+}
+
+// imprisonCountry sends a country to Matrix Prison, liberating it when it was
+// the target, and reports whether it was the target.
+func (a *App) imprisonCountry(country string) bool {
+	wasTarget, _ := a.gameState.ImprisonCountry(country)
+	a.recordEvent(history.Event{Type: history.EventImprison, Country: country, Liberated: wasTarget})
+	a.publishCountryState(country)
+	a.reachExpeditionCountry(country)
+	if wasTarget {
+		a.publishTarget("", country)
+		a.publishAchievements(a.achievements.UnlockFastestTravelerAchievement(country))
+	}
+	a.markMapDirty()
+	return wasTarget
+}
+
+func (a *App) handleAPIImprison(w http.ResponseWriter, r *http.Request) {
+	name, ok := a.resolveCountry(r.PathValue("country"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Unknown country %q", r.PathValue("country"))
+		return
+	}
+	a.imprisonCountry(name)
+	target, _ := a.gameState.GetTargetCountry()
+	writeJSON(w, http.StatusOK, newCountryStatus(name, a.gameState.GetCountryState(name), target))
+}
+
+// targetResponse describes the target country. Hint is the research
+// challenge fact, set once the target has gone a while without a hit.
+type targetResponse struct {
+	Country string       `json:"country"` // empty when there is no target
+	SetAt   *time.Time   `json:"set_at,omitempty"`
+	Hint    *factdb.Fact `json:"hint,omitempty"`
+	Queue   []string     `json:"queue"` // upcoming targets, in order
+	Pool    string       `json:"pool"`  // target_pool setting
+	Mode    string       `json:"mode"`  // target_mode setting
+}
+
+// challengeHint returns the target country and, when the research challenge
+// is active, its fact.
+func (a *App) challengeHint() (target string, setAt time.Time, fact factdb.Fact, active bool) {
+	a.gameState.mutex.RLock()
+	target = a.gameState.targetCountry
+	setAt = a.gameState.targetSetAt
+	hitSinceSet := false
+	if target != "" {
+		if state, exists := a.gameState.countries[target]; exists {
+			hitSinceSet = state.LastHit.After(setAt)
+		}
+	}
+	a.gameState.mutex.RUnlock()
+
+	if target == "" || hitSinceSet {
+		return target, setAt, factdb.Fact{}, false
+	}
+
+	a.targetChallengeFactMu.Lock()
+	fact = a.targetChallengeFact
+	a.targetChallengeFactMu.Unlock()
+	return target, setAt, fact, !fact.IsZero()
+}
+
+// targetHint is the research challenge fact of one target country.
+type targetHint struct {
+	Target     string      `json:"target"`
+	Fact       factdb.Fact `json:"fact"`
+	Expedition bool        `json:"expedition,omitempty"` // an expedition country rather than the target
+}
+
+// challengeHints returns the active research challenge facts: the target's
+// first, then those of the outstanding expedition countries.
+func (a *App) challengeHints() []targetHint {
+	var hints []targetHint
+	target, _, fact, active := a.challengeHint()
+	if active {
+		hints = append(hints, targetHint{Target: target, Fact: fact})
+	}
+	for _, hint := range a.expeditionHints() {
+		if hint.Target != target {
+			hints = append(hints, hint)
+		}
+	}
+	return hints
+}
+
+// currentTarget describes the target country.
+func (a *App) currentTarget() targetResponse {
+	target, setAt, fact, active := a.challengeHint()
+	resp := targetResponse{Country: target, Queue: a.queuedTargets()}
+	a.configMu.RLock()
+	resp.Pool, resp.Mode = a.config.TargetPool, a.config.TargetMode
+	a.configMu.RUnlock()
+	if target != "" {
+		resp.SetAt = &setAt
+	}
+	if active {
+		resp.Hint = &fact
+	}
+	return resp
+}
+
+func (a *App) handleAPITarget(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.currentTarget())
+}
+
+func (a *App) handleAPIRerollTarget(w http.ResponseWriter, r *http.Request) {
+	a.SelectNextTargetCountry()
+	target := a.currentTarget()
+	slog.Info("🎲 Target country re-rolled by user", "new_target", target.Country)
+	writeJSON(w, http.StatusOK, target)
+}
+
+// targetRequest is the body of PUT /api/v1/target.
+type targetRequest struct {
+	Country string `json:"country"` // name or ISO code
+}
+
+func (a *App) handleAPISetTarget(w http.ResponseWriter, r *http.Request) {
+	var req targetRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	name, ok := a.resolveTargetCountry(w, req.Country)
+	if !ok {
+		return
+	}
+	a.SetTargetCountry(name)
+	writeJSON(w, http.StatusOK, a.currentTarget())
+}
+
+// achievementList is returned by /api/v1/achievements.
+type achievementList struct {
+	Unlocked     int                         `json:"unlocked"`
+	Achievements []*achievements.Achievement `json:"achievements"`
+}
+
+func (a *App) handleAPIAchievements(w http.ResponseWriter, r *http.Request) {
+	list := achievementList{Achievements: a.achievements.GetAllAchievements()}
+	for _, achievement := range list.Achievements {
+		if achievement.Unlocked {
+			list.Unlocked++
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// hitList is returned by /api/v1/hits.
+type hitList struct {
+	Hits []RecentHit `json:"hits"`
+}
+
+func (a *App) handleAPIHits(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, hitList{Hits: a.recentHitsSnapshot()})
+}
+
+// configResponse lists every setting by its name in the config file.
+// RestartRequired names changed settings that only apply after a restart.
+type configResponse struct {
+	Settings        map[string]string `json:"settings"`
+	RestartRequired []string          `json:"restart_required,omitempty"`
+}
+
+// configPatch maps setting names to their new values.
+type configPatch map[string]string
+
+func (a *App) handleAPIConfig(w http.ResponseWriter, r *http.Request) {
+	a.configMu.RLock()
+	settings := a.config.Values()
+	a.configMu.RUnlock()
+	writeJSON(w, http.StatusOK, configResponse{Settings: settings})
+}
+
+func (a *App) handleAPIPatchConfig(w http.ResponseWriter, r *http.Request) {
+	var patch configPatch
+	if err := decodeJSONBody(r, &patch); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if len(patch) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "No settings to change")
+		return
+	}
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Validate everything on a copy first so a bad value changes nothing
+	a.configMu.RLock()
+	candidate := *a.config
+	a.configMu.RUnlock()
+	for _, key := range keys {
+		if err := candidate.Set(key, patch[key]); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+	if name, ok := patch["theme"]; ok {
+		if _, err := resources.ResolveTheme(name, candidate.Black); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+	if pool, ok := patch["target_pool"]; ok {
+		if unknown := a.unknownTargetRegions(pool); len(unknown) > 0 {
+			writeAPIError(w, http.StatusBadRequest, "Unknown target regions %s; %s/target/regions lists them", strings.Join(unknown, ", "), apiPrefix)
+			return
+		}
+	}
+
+	restart, err := a.applySettings(patch)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	if err := a.saveConfig(); err != nil {
+		slog.Error("Failed to save config after API change", "error", err)
+	}
+
+	a.configMu.RLock()
+	settings := a.config.Values()
+	a.configMu.RUnlock()
+	writeJSON(w, http.StatusOK, configResponse{Settings: settings, RestartRequired: restart})
+}
+
+// applySettings applies validated settings in key order and returns the keys
+// that only take effect after a restart. The caller saves the config.
+func (a *App) applySettings(patch configPatch) (restart []string, err error) {
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := patch[key]
+		switch key {
+		case "theme":
+			if err := a.applyTheme(value); err != nil {
+				return restart, fmt.Errorf("failed to change theme: %w", err)
+			}
+		case "update_wallpaper":
+			enabled, _ := strconv.ParseBool(value)
+			a.setUpdateWallpaper(enabled)
+		case "start_on_login":
+			enabled, _ := strconv.ParseBool(value)
+			a.setStartOnLogin(enabled)
+		case "profile":
+			if err := a.switchProfile(value); err != nil {
+				return restart, fmt.Errorf("failed to switch profile: %w", err)
+			}
+		default:
+			a.configMu.Lock()
+			err := a.config.Set(key, value)
+			a.configMu.Unlock()
+			if err != nil {
+				return restart, err
+			}
+			a.publishConfig(key, value)
+		}
+		if config.NeedsRestart(key) {
+			restart = append(restart, key)
+		}
+	}
+	if _, ok := patch["target_pool"]; ok {
+		a.retargetOutsidePool()
+	}
+	a.markMapDirty()
+	return restart, nil
+}
+
+func (a *App) handleAPIFact(w http.ResponseWriter, r *http.Request) {
+	param := r.URL.Query().Get("country")
+	if param == "" {
+		writeAPIError(w, http.StatusBadRequest, "The country query parameter is required")
+		return
+	}
+	country, ok := a.resolveCountry(param)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Unknown country %q", param)
+		return
+	}
+	if a.factDB == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "The fact database is not available")
+		return
+	}
+	fact := a.factDB.GetFact(country, r.URL.Query().Get("city"))
+	if fact.IsZero() {
+		writeAPIError(w, http.StatusNotFound, "No fact known about %s", country)
+		return
+	}
+	writeJSON(w, http.StatusOK, fact)
+}
+
+func (a *App) handleAPIRandomFact(w http.ResponseWriter, r *http.Request) {
+	if a.factDB == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "The fact database is not available")
+		return
+	}
+	visited := make([]string, 0)
+	for country := range a.gameState.GetCountries() {
+		visited = append(visited, country)
+	}
+	mathrand.Shuffle(len(visited), func(i, j int) { visited[i], visited[j] = visited[j], visited[i] })
+	for _, country := range visited {
+		if fact := a.factDB.GetCountryFact(country); !fact.IsZero() {
+			writeJSON(w, http.StatusOK, fact)
+			return
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, "No facts known about the visited countries")
+}
+
+// wallpaperRestoreResponse is returned after restoring the wallpaper.
+type wallpaperRestoreResponse struct {
+	Restored bool   `json:"restored"`
+	Message  string `json:"message"`
+}
+
+// errNoWallpaperBackup is returned when there is no wallpaper to restore.
+var errNoWallpaperBackup = errors.New("no original wallpaper backup found")
+
+// restoreWallpaper restores the backed up wallpaper.
+func (a *App) restoreWallpaper() error {
+	if a.originalWallpaper == "" {
+		return errNoWallpaperBackup
+	}
+	return a.RestoreOriginalWallpaper()
+}
+
+func (a *App) handleAPIRestoreWallpaper(w http.ResponseWriter, r *http.Request) {
+	if err := a.restoreWallpaper(); errors.Is(err, errNoWallpaperBackup) {
+		writeAPIError(w, http.StatusNotFound, "No original wallpaper backup found")
+		return
+	} else if err != nil {
+		slog.Error("Failed to restore wallpaper via API", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "Failed to restore wallpaper")
+		return
+	}
+	writeJSON(w, http.StatusOK, wallpaperRestoreResponse{Restored: true, Message: "Original wallpaper restored successfully"})
+}
+
+func (a *App) handleAPIOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPIDocument(a.apiRoutes()))
+}
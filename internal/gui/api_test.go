@@ -0,0 +1,278 @@
+package gui
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"iptw/internal/achievements"
+	"iptw/internal/challenge"
+	"iptw/internal/config"
+	"iptw/internal/events"
+	"iptw/internal/factdb"
+	"iptw/internal/network"
+	"iptw/internal/resources"
+)
+
+// newTestApp returns an app with map data and game state but no GeoIP
+// database or running loops. The config is saved to a temporary home.
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".config", "iptw"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ne, err := resources.LoadNaturalEarthData()
+	if err != nil {
+		t.Fatalf("LoadNaturalEarthData failed: %v", err)
+	}
+	fdb, err := factdb.New()
+	if err != nil {
+		t.Fatalf("factdb.New failed: %v", err)
+	}
+	cfg := config.DefaultConfig()
+	a := &App{
+		config:       cfg,
+		monitor:      network.NewMonitor(),
+		gameState:    &GameState{countries: make(map[string]*CountryGameState)},
+		naturalEarth: ne,
+		achievements: achievements.NewAchievementManager(),
+		factDB:       fdb,
+		sessionToken: "secret",
+		events:       events.NewBroker(0),
+		heat:         newHeatStore(),
+		challenges:   newChallengeTracker(challenge.NewGenerator(challengeWorld(ne))),
+		scores:       newScoreBoard(),
+		done:         make(chan struct{}),
+		quit:         make(chan struct{}),
+		theme:        loadConfiguredTheme(cfg),
+		themeName:    cfg.Theme,
+	}
+	a.metrics = newAppMetrics(a)
+	return a
+}
+
+// serveAPI runs one request against the app's HTTP routes.
+func serveAPI(t *testing.T, a *App, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	a.registerAPI(mux)
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, r)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeResponse checks the status and content type and decodes the body.
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("failed to decode %s: %v", rec.Body, err)
+	}
+}
+
+// expectAPIError checks that a response is an error envelope.
+func expectAPIError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var body apiError
+	decodeResponse(t, rec, status, &body)
+	if body.Error.Status != status || body.Error.Code != code || body.Error.Message == "" {
+		t.Errorf("expected a %d %s error, got %+v", status, code, body.Error)
+	}
+}
+
+func TestAPICountries(t *testing.T) {
+	a := newTestApp(t)
+	for i := 0; i < 3; i++ {
+		a.gameState.AddCountryHit("France")
+	}
+	a.gameState.AddCountryHit("Kenya")
+	a.gameState.SetTargetCountry("Peru")
+
+	var list countryList
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/countries", "", nil), http.StatusOK, &list)
+	if len(list.Countries) != 2 || list.Countries[0].Name != "France" || list.Countries[0].Hits != 3 {
+		t.Fatalf("expected France then Kenya, got %+v", list.Countries)
+	}
+	if c := list.Countries[1]; c.ISOA2 != "KE" || c.ISOA3 != "KEN" || c.State != resources.CountryVisited || c.LastHit == nil {
+		t.Errorf("unexpected Kenya status %+v", c)
+	}
+
+	// Countries can be addressed by name or ISO code
+	for _, param := range []string{"peru", "PE", "per"} {
+		var status countryStatus
+		decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/countries/"+param, "", nil), http.StatusOK, &status)
+		if status.Name != "Peru" || !status.Target || status.State != resources.CountryUnvisited {
+			t.Errorf("%s: unexpected status %+v", param, status)
+		}
+	}
+	expectAPIError(t, serveAPI(t, a, http.MethodGet, "/api/v1/countries/Atlantis", "", nil), http.StatusNotFound, "not_found")
+}
+
+func TestAPIImprison(t *testing.T) {
+	a := newTestApp(t)
+	a.gameState.SetTargetCountry("Chile")
+	_, stream, cancel := a.events.Subscribe(0)
+	defer cancel()
+
+	path := "/api/v1/countries/CL/imprison"
+	expectAPIError(t, serveAPI(t, a, http.MethodPost, path, "", nil), http.StatusForbidden, "forbidden")
+	expectAPIError(t, serveAPI(t, a, http.MethodGet, path, "", nil), http.StatusMethodNotAllowed, "method_not_allowed")
+
+	var status countryStatus
+	decodeResponse(t, serveAPI(t, a, http.MethodPost, path, "", map[string]string{"X-Session-Token": "secret"}), http.StatusOK, &status)
+	if status.Name != "Chile" || status.State != resources.CountryLiberated || status.Target {
+		t.Errorf("expected Chile liberated and no longer the target, got %+v", status)
+	}
+
+	// The change is announced on the event stream, next to the points earned
+	var types []events.Type
+	for len(types) < 3 {
+		select {
+		case e := <-stream:
+			if e.Type != events.TypeScore {
+				types = append(types, e.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected country, target and achievement events, got %v", types)
+		}
+	}
+	if types[0] != events.TypeCountry || types[1] != events.TypeTarget || types[2] != events.TypeAchievement {
+		t.Errorf("unexpected events %v", types)
+	}
+
+	var achievementsResp achievementList
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/achievements", "", nil), http.StatusOK, &achievementsResp)
+	if achievementsResp.Unlocked != 1 || len(achievementsResp.Achievements) < 2 {
+		t.Errorf("expected the fastest traveler achievement unlocked, got %d of %d", achievementsResp.Unlocked, len(achievementsResp.Achievements))
+	}
+}
+
+func TestAPIConfig(t *testing.T) {
+	a := newTestApp(t)
+	token := map[string]string{"X-Session-Token": "secret"}
+
+	var resp configResponse
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/config", "", nil), http.StatusOK, &resp)
+	if resp.Settings["legend"] != "off" || resp.Settings["map_width"] != "1000" {
+		t.Errorf("unexpected settings %v", resp.Settings)
+	}
+
+	// A bad value rejects the whole patch
+	rec := serveAPI(t, a, http.MethodPatch, "/api/v1/config", `{"legend": "top-left", "overlay_opacity": "150"}`, token)
+	expectAPIError(t, rec, http.StatusBadRequest, "bad_request")
+	if a.config.Legend != "off" {
+		t.Error("expected no setting to change after a rejected patch")
+	}
+	expectAPIError(t, serveAPI(t, a, http.MethodPatch, "/api/v1/config", `{"nope": "1"}`, token), http.StatusBadRequest, "bad_request")
+	expectAPIError(t, serveAPI(t, a, http.MethodPatch, "/api/v1/config", `{"theme": "no-such-theme"}`, token), http.StatusBadRequest, "bad_request")
+
+	rec = serveAPI(t, a, http.MethodPatch, "/api/v1/config", `{"legend": "top-left", "theme": "dark", "log_level": "debug"}`, token)
+	decodeResponse(t, rec, http.StatusOK, &resp)
+	if resp.Settings["legend"] != "top-left" || resp.Settings["theme"] != "dark" {
+		t.Errorf("expected the patch to apply, got %v", resp.Settings)
+	}
+	if len(resp.RestartRequired) != 1 || resp.RestartRequired[0] != "log_level" {
+		t.Errorf("expected log_level to need a restart, got %v", resp.RestartRequired)
+	}
+	if a.currentTheme().Name != "dark" {
+		t.Errorf("expected the dark theme to be active, got %s", a.currentTheme().Name)
+	}
+	saved, err := os.ReadFile(filepath.Join(os.Getenv("HOME"), ".config", "iptw", "iptwrc"))
+	if err != nil || !strings.Contains(string(saved), "legend top-left") {
+		t.Errorf("expected the change to be saved, got %q (%v)", saved, err)
+	}
+}
+
+func TestAPITargetAndFacts(t *testing.T) {
+	a := newTestApp(t)
+	var target targetResponse
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/target", "", nil), http.StatusOK, &target)
+	if target.Country != "" || target.SetAt != nil {
+		t.Errorf("expected no target, got %+v", target)
+	}
+
+	decodeResponse(t, serveAPI(t, a, http.MethodPost, "/api/v1/target/reroll", "", map[string]string{"X-Session-Token": "secret"}), http.StatusOK, &target)
+	if target.Country == "" || target.SetAt == nil {
+		t.Errorf("expected a new target, got %+v", target)
+	}
+
+	var fact factdb.Fact
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/facts?country=JP", "", nil), http.StatusOK, &fact)
+	if fact.IsZero() {
+		t.Error("expected a fact about Japan")
+	}
+	expectAPIError(t, serveAPI(t, a, http.MethodGet, "/api/v1/facts", "", nil), http.StatusBadRequest, "bad_request")
+	expectAPIError(t, serveAPI(t, a, http.MethodGet, "/api/v1/facts/random", "", nil), http.StatusNotFound, "not_found")
+	expectAPIError(t, serveAPI(t, a, http.MethodGet, "/api/v1/nothing-here", "", nil), http.StatusNotFound, "not_found")
+
+	token := map[string]string{"X-Session-Token": "secret"}
+	decodeResponse(t, serveAPI(t, a, http.MethodPut, "/api/v1/target", `{"country": "pe"}`, token), http.StatusOK, &target)
+	if target.Country != "Peru" {
+		t.Errorf("expected Peru as the target, got %+v", target)
+	}
+	a.gameState.AddCountryHit("France")
+	expectAPIError(t, serveAPI(t, a, http.MethodPut, "/api/v1/target", `{"country": "France"}`, token), http.StatusConflict, "conflict")
+	expectAPIError(t, serveAPI(t, a, http.MethodPut, "/api/v1/target", `{"country": "Atlantis"}`, token), http.StatusNotFound, "not_found")
+}
+
+func TestAPIOpenAPI(t *testing.T) {
+	a := newTestApp(t)
+	var doc struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	rec := serveAPI(t, a, http.MethodGet, "/api/v1/openapi.json", "", nil)
+	decodeResponse(t, rec, http.StatusOK, &doc)
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("expected an OpenAPI 3 document, got %q", doc.OpenAPI)
+	}
+
+	for _, route := range a.apiRoutes() {
+		op, ok := doc.Paths[route.Path][strings.ToLower(route.Method)]
+		if !ok {
+			t.Errorf("%s %s is missing from the document", route.Method, route.Path)
+			continue
+		}
+		if _, secured := op["security"]; secured != route.Write {
+			t.Errorf("%s %s: expected security only on write operations", route.Method, route.Path)
+		}
+	}
+
+	// Every reference resolves to a component
+	for _, ref := range strings.Split(rec.Body.String(), `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("unresolved schema reference %s", name)
+		}
+	}
+	for _, name := range []string{"ApiError", "CountryStatus", "Achievement", "Fact", "RecentHit"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("expected a %s schema", name)
+		}
+	}
+}
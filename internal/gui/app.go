@@ -19,6 +19,7 @@
 // - World map background (Natural Earth vector data)
 // - Country regions filled with colors/patterns based on visit counts
 // - White dots show active connection points
+// - Great-circle arcs link the home location to each destination and fade out after the connection closes
 // - National flags display for visited countries (1-9 hits)
 // - Matrix rain shows for Matrix Prison countries (10+ hits)
 // - Red borders highlight target countries for exploration
@@ -26,16 +27,18 @@
 // Resources:
 // - Natural Earth GeoJSON data is embedded in the binary using Go's embed package
 // - Vector graphics provide crisp rendering at any resolution
-// - Theme support: light and dark backgrounds
+// - Theme support: embedded presets plus user palette files in ~/.config/iptw/themes
 // - No external resource files required - completely self-contained application
 package gui
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	_ "embed"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
@@ -49,20 +52,25 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"fyne.io/systray"
-	"github.com/skratchdot/open-golang/open"
-
 	"iptw/internal/achievements"
 	"iptw/internal/background"
+	"iptw/internal/challenge"
 	"iptw/internal/config"
+	"iptw/internal/control"
+	"iptw/internal/events"
 	"iptw/internal/factdb"
 	"iptw/internal/geoip"
+	"iptw/internal/history"
+	"iptw/internal/localapi"
 	"iptw/internal/logging"
 	"iptw/internal/network"
+	"iptw/internal/profile"
 	"iptw/internal/resources"
 	"iptw/internal/screen"
 	"iptw/internal/service"
@@ -91,8 +99,10 @@ type RecentHit struct {
 // GameState manages the overall game state
 type GameState struct {
 	countries     map[string]*CountryGameState
-	targetCountry string    // Currently targeted country
-	targetSetAt   time.Time // When the target was set
+	subdivisions  map[string]*SubdivisionGameState     // by ISO 3166-2 code; only with the subdivisions setting
+	cities        map[string]map[string]*CityGameState // by country, then city name
+	targetCountry string                               // Currently targeted country
+	targetSetAt   time.Time                            // When the target was set
 	mutex         sync.RWMutex
 }
 
@@ -248,16 +258,25 @@ func (gs *GameState) GetCountryColor(country string) color.RGBA {
 	return color.RGBA{red, green, blue, alpha}
 }
 
-// App represents the main application
+// App is the core engine: it monitors connections, plays the game, renders
+// the map and serves the local HTTP API. It has no user interface of its own;
+// the tray (see Tray) or RunHeadless drives it through Start and Shutdown.
 type App struct {
 	config                 *config.Config
 	configMu               sync.RWMutex // protects concurrent access to config fields
 	geoip                  *geoip.Database
 	monitor                *network.Monitor
-	running                bool
+	headless               bool          // No desktop: the OS wallpaper is left alone
+	done                   chan struct{} // Closed by Stop to end the background loops
+	quit                   chan struct{} // Closed by RequestQuit to end RunHeadless or the tray
+	quitOnce               sync.Once
+	stopOnce               sync.Once
+	shutdownOnce           sync.Once
+	loops                  sync.WaitGroup // Background loops that must finish before shutdown
 	outputDir              string
 	gameState              *GameState
 	naturalEarth           *resources.NaturalEarthData
+	subdivisions           *resources.SubdivisionData // Admin-1 boundaries; nil when off or not available
 	achievements           *achievements.AchievementManager
 	factDB                 *factdb.DB
 	fontManager            *resources.FontManager
@@ -265,21 +284,51 @@ type App struct {
 	originalWallpaper      string // Path to the backed up original wallpaper
 	wallpaperBackedUp      bool   // Flag to track if we've backed up the wallpaper
 	wallpaperBackedUpError error
-	lastMapPNG             []byte       // Cached PNG bytes of the last generated map image
-	mapPNGMu               sync.RWMutex // protects lastMapPNG
-	sessionToken           string       // Per-session token for POST endpoint authorization
-	serverURL              string       // URL of the local HTTP server
-	serverListener         net.Listener // Local HTTP listener; closed on shutdown
-	lastAutoWidth          int          // Memoized screen detection width
-	lastAutoHeight         int          // Memoized screen detection height
-	recentHits             []RecentHit  // Store the last few hits for the UI
-	recentHitsMu           sync.RWMutex // protects recentHits
-	targetChallengeFact    factdb.Fact  // Cached fact for the current target country
-	targetChallengeFactMu  sync.Mutex   // protects targetChallengeFact
-	mapDirty               bool         // true when the map must be re-rendered and re-encoded
-	mapDirtyMu             sync.Mutex   // protects mapDirty
-	mapEncBuf              bytes.Buffer // reused encode buffer to avoid per-tick allocation
-	lastConnIPs            string       // fingerprint of last seen connections; dirty when changed
+	lastMapPNG             []byte                   // Cached PNG bytes of the last generated map image
+	mapPNGMu               sync.RWMutex             // protects lastMapPNG
+	sessionToken           string                   // Per-session token for POST endpoint authorization
+	serverURL              string                   // URL of the local HTTP server
+	server                 *http.Server             // Local HTTP server; shut down gracefully on exit
+	serverMu               sync.Mutex               // protects server and instance
+	instance               localapi.Instance        // Where the local HTTP server listens, as written to the instance file
+	control                *control.Server          // Control socket for second launches and the CLI
+	apiTokens              *localapi.Tokens         // Persistent API tokens; nil when the token file could not be loaded
+	certFile               string                   // Self-signed certificate served when http_tls is on
+	instancePath           string                   // Instance file the CLI reads the server URL from
+	lastAutoWidth          int                      // Memoized screen detection width
+	lastAutoHeight         int                      // Memoized screen detection height
+	recentHits             []RecentHit              // Store the last few hits for the UI
+	recentHitsMu           sync.RWMutex             // protects recentHits
+	targetChallengeFact    factdb.Fact              // Cached fact for the current target country
+	targetChallengeFactMu  sync.Mutex               // protects targetChallengeFact
+	targetQueue            []string                 // Countries to make the target next, in order
+	targetQueueMu          sync.Mutex               // protects targetQueue
+	expedition             *expedition              // Running or last expedition; nil before the first
+	expeditionMu           sync.Mutex               // protects expedition
+	mapDirty               bool                     // true when the map must be re-rendered and re-encoded
+	mapDirtyMu             sync.Mutex               // protects mapDirty
+	mapEncBuf              bytes.Buffer             // reused encode buffer to avoid per-tick allocation
+	lastConnIPs            string                   // fingerprint of last seen connections; dirty when changed
+	overlayBase            image.Image              // Decoded original wallpaper used by overlay mode
+	overlayBasePath        string                   // Backup path overlayBase was decoded from
+	arcs                   *arcTracker              // Connection endpoints drawn as arcs from the home location
+	history                *history.Journal         // Persistent event journal; nil when it could not be opened
+	heat                   *heatStore               // In-memory copy of journaled hit locations for the heatmap
+	challenges             *challengeTracker        // Daily and weekly challenges and their completions
+	scores                 *scoreBoard              // Points of the journaled events
+	profiles               map[string]*profileState // Inactive profiles played this session; protected by profileMu
+	profileMu              sync.Mutex               // serializes profile switches with hit processing
+	multiProfile           atomic.Bool              // true once a profile other than the default exists
+	tiles                  tileCache                // Encoded XYZ tiles for the current map version
+	events                 *events.Broker           // Live event stream served at /api/events
+	knownFlows             map[string]bool          // remote ip:port flows seen in the previous poll
+	hostnames              hostnameCache            // Reverse DNS names of remote IPs resolved this session
+	metrics                *appMetrics              // Instruments served at /metrics
+	lastMapWidth           int                      // Size of the last rendered map; protected by mapPNGMu
+	lastMapHeight          int
+	theme                  *resources.Theme // Colors and fonts the map is painted with
+	themeName              string           // Theme setting theme was loaded from
+	themeMu                sync.RWMutex     // protects theme and themeName
 }
 
 // NewApp creates a new application instance
@@ -301,6 +350,19 @@ func NewApp(cfg *config.Config, geoipDB *geoip.Database, monitor *network.Monito
 	}
 	logging.LogNaturalEarth(len(naturalEarth.Countries))
 
+	// Load admin-1 boundaries (optional - without them subdivisions are still
+	// tracked by their GeoIP code, but not drawn)
+	var subdivisions *resources.SubdivisionData
+	if cfg.Subdivisions {
+		if admin1Path, err := resources.DefaultAdmin1Path(); err != nil {
+			slog.Warn("Failed to locate admin-1 data - subdivisions will not be drawn", "error", err)
+		} else if subdivisions, err = resources.LoadSubdivisions(admin1Path); err != nil {
+			slog.Warn("Failed to load admin-1 data - subdivisions will not be drawn", "error", err)
+		} else {
+			slog.Info("Admin-1 subdivisions loaded successfully", "count", len(subdivisions.Subdivisions))
+		}
+	}
+
 	// Load embedded fonts
 	fontManager, err := resources.LoadFonts()
 	if err != nil {
@@ -323,6 +385,14 @@ func NewApp(cfg *config.Config, geoipDB *geoip.Database, monitor *network.Monito
 	}
 	generatedToken := hex.EncodeToString(tokenBytes)
 
+	// Load the persistent API tokens scripts authenticate with (optional)
+	var apiTokens *localapi.Tokens
+	if tokensPath, err := localapi.DefaultTokensPath(); err != nil {
+		slog.Warn("Failed to locate API token file - only the session token will be accepted", "error", err)
+	} else if apiTokens, err = localapi.LoadTokens(tokensPath); err != nil {
+		slog.Warn("Failed to load API token file - only the session token will be accepted", "error", err)
+	}
+
 	// Check for existing wallpaper backups in the output directory
 	var firstBackup string
 	if files, err := filepath.Glob(filepath.Join(outputDir, "original_wallpaper_*")); err == nil && len(files) > 0 {
@@ -337,14 +407,34 @@ func NewApp(cfg *config.Config, geoipDB *geoip.Database, monitor *network.Monito
 		slog.Warn("Failed to load fact database, Did-you-know will be unavailable", "error", err)
 	}
 
-	return &App{
+	// Open the event journal and load past hits for the heatmap, the
+	// challenges and the score (optional)
+	heat := newHeatStore()
+	challenges := newChallengeTracker(challenge.NewGenerator(challengeWorld(naturalEarth)))
+	scores := newScoreBoard()
+	var journal *history.Journal
+	if journalPath, err := profile.HistoryPath(cfg.Profile); err != nil {
+		slog.Warn("Failed to locate history journal - history will not be recorded", "error", err)
+	} else if journal, err = history.Open(journalPath); err != nil {
+		slog.Warn("Failed to open history journal - history will not be recorded", "error", err)
+	} else if err := heat.load(journal); err != nil {
+		slog.Warn("Failed to read history journal", "error", err)
+	} else if err := challenges.load(journal, time.Now()); err != nil {
+		slog.Warn("Failed to read challenges from history journal", "error", err)
+	} else if err := scores.load(journal); err != nil {
+		slog.Warn("Failed to read score from history journal", "error", err)
+	}
+
+	app := &App{
 		config:            cfg,
 		geoip:             geoipDB,
 		monitor:           monitor,
-		running:           true,
+		done:              make(chan struct{}),
+		quit:              make(chan struct{}),
 		outputDir:         outputDir,
 		gameState:         gameState,
 		naturalEarth:      naturalEarth,
+		subdivisions:      subdivisions,
 		achievements:      achievements.NewAchievementManager(),
 		factDB:            fdb,
 		fontManager:       fontManager,
@@ -352,28 +442,30 @@ func NewApp(cfg *config.Config, geoipDB *geoip.Database, monitor *network.Monito
 		originalWallpaper: firstBackup,
 		wallpaperBackedUp: firstBackup != "",
 		sessionToken:      generatedToken,
+		apiTokens:         apiTokens,
 		mapDirty:          true, // ensure first frame is always encoded
-	}, nil
+		arcs:              newArcTracker(),
+		history:           journal,
+		heat:              heat,
+		challenges:        challenges,
+		scores:            scores,
+		events:            events.NewBroker(events.DefaultBacklog),
+		theme:             loadConfiguredTheme(cfg),
+		themeName:         cfg.Theme,
+	}
+	if names, err := profile.List(); err == nil && len(names) > 1 {
+		app.multiProfile.Store(true)
+	}
+	app.metrics = newAppMetrics(app)
+	return app, nil
 }
 
-// Run starts the application
-func (a *App) Run() error {
-	// Start systray lifecycle. This blocks until systray quits.
-	systray.Run(a.onReady, a.onExit)
-	return nil
-}
-
-func (a *App) onReady() {
-	// Catch any panic inside onReady so it appears in the log file rather than
-	// silently terminating the systray message pump.
-	defer func() {
-		if r := recover(); r != nil {
-			slog.Error("panic in onReady", "recover", r)
-		}
-	}()
-
-	// Log startup information
-	slog.Info("onReady called – systray pump is live",
+// Start runs the engine in the background: connection monitoring, target
+// selection, map rendering and the local HTTP server. Call Shutdown to stop it.
+func (a *App) Start() {
+	a.configMu.RLock()
+	slog.Info("Starting engine",
+		"headless", a.headless,
 		"screen_auto_detection", a.config.AutoDetectScreen,
 		"log_level", a.config.LogLevel,
 		"target_interval_minutes", a.config.TargetInterval,
@@ -386,88 +478,63 @@ func (a *App) onReady() {
 			"height", a.config.MapWidth/2,
 		)
 	}
+	a.configMu.RUnlock()
 
-	// Setup Systray
-	setTrayIcon()
-	setTrayTitleAndTooltip("IPTW", "IP Travel Map")
-
-	mShowMap := systray.AddMenuItem("Show Map", "Open the interactive travel map")
-	mToggleWallpaper := systray.AddMenuItemCheckbox("Update OS Wallpaper", "Automatically update desktop wallpaper", a.config.UpdateWallpaper)
-	mStartOnLogin := systray.AddMenuItemCheckbox("Start on Login", "Automatically start IP Travel Map on system login", a.config.StartOnLogin)
-	systray.AddSeparator()
-	mQuit := systray.AddMenuItem("Quit", "Quit the whole app")
+	// The game starts empty, so the prisoners of the last session are free;
+	// the score stops charging for them from here
+	a.recordEvent(history.Event{Type: history.EventRelease})
 
-	// Start connection monitoring
+	// Start connection monitoring, target selection, the display loop and
+	// pushes to the team server
+	a.loops.Add(4)
 	go a.connectionMonitorLoop()
-
-	// Start target country selection loop
 	go a.targetSelectionLoop()
-
-	// Start image generation and display loop
 	go a.displayLoop()
+	go a.teamSyncLoop()
 
 	// Start local HTTP server to host the UI
 	go a.startLocalServer()
 
-	// Handle Menu events
-	go func() {
-		for {
-			select {
-			case <-mShowMap.ClickedCh:
-				a.showMapWindow()
-			case <-mToggleWallpaper.ClickedCh:
-				a.configMu.Lock()
-				a.config.UpdateWallpaper = !a.config.UpdateWallpaper
-				newVal := a.config.UpdateWallpaper
-				a.configMu.Unlock()
-				if newVal {
-					mToggleWallpaper.Check()
-				} else {
-					mToggleWallpaper.Uncheck()
-					// Restore original wallpaper if we backed it up
-					if a.HasWallpaperBackup() {
-						if err := a.RestoreOriginalWallpaper(); err != nil {
-							slog.Error("Failed to restore original wallpaper", "error", err)
-						}
-					}
-				}
-				if err := a.saveConfig(); err != nil {
-					slog.Error("Failed to save config after toggling wallpaper", "error", err)
-				}
-			case <-mStartOnLogin.ClickedCh:
-				a.configMu.Lock()
-				a.config.StartOnLogin = !a.config.StartOnLogin
-				newVal := a.config.StartOnLogin
-				a.configMu.Unlock()
-				if newVal {
-					mStartOnLogin.Check()
-					if sm, err := service.NewServiceManager(); err == nil {
-						if err := sm.Install(); err != nil {
-							slog.Error("Failed to install auto-start service", "error", err)
-						}
-					}
-				} else {
-					mStartOnLogin.Uncheck()
-					if sm, err := service.NewServiceManager(); err == nil {
-						if err := sm.Uninstall(); err != nil {
-							slog.Error("Failed to uninstall auto-start service", "error", err)
-						}
-					}
-				}
-				if err := a.saveConfig(); err != nil {
-					slog.Error("Failed to save config after toggling start-on-login", "error", err)
-				}
-			case <-mQuit.ClickedCh:
-				systray.Quit()
-				return
-			}
+	// Resolve the origin of connection arcs (may query the public IP)
+	go a.resolveHomeLocation()
+
+	// Let second launches and the CLI reach this instance
+	go a.startControlServer()
+}
+
+// setUpdateWallpaper turns wallpaper updates on or off, restoring the original
+// wallpaper when they are turned off. The caller saves the config.
+func (a *App) setUpdateWallpaper(enabled bool) {
+	a.configMu.Lock()
+	a.config.UpdateWallpaper = enabled
+	a.configMu.Unlock()
+	a.publishConfig("update_wallpaper", strconv.FormatBool(enabled))
+
+	// Restore original wallpaper if we backed it up
+	if !enabled && a.HasWallpaperBackup() {
+		if err := a.RestoreOriginalWallpaper(); err != nil {
+			slog.Error("Failed to restore original wallpaper", "error", err)
 		}
-	}()
+	}
 }
 
-func (a *App) onExit() {
-	slog.Info("Received shutdown signal from systray, cleaning up...")
-	a.Shutdown()
+// setStartOnLogin installs or removes the auto-start service. The caller
+// saves the config.
+func (a *App) setStartOnLogin(enabled bool) {
+	a.configMu.Lock()
+	a.config.StartOnLogin = enabled
+	a.configMu.Unlock()
+	a.publishConfig("start_on_login", strconv.FormatBool(enabled))
+
+	if sm, err := service.NewServiceManager(); err == nil {
+		if enabled {
+			if err := sm.Install(); err != nil {
+				slog.Error("Failed to install auto-start service", "error", err)
+			}
+		} else if err := sm.Uninstall(); err != nil {
+			slog.Error("Failed to uninstall auto-start service", "error", err)
+		}
+	}
 }
 
 // saveConfig saves the current configuration to disk. It resolves the config
@@ -484,14 +551,11 @@ func (a *App) saveConfig() error {
 }
 
 // requireSessionToken is middleware for POST endpoints that validates the
-// per-session token to prevent cross-site request forgery from malicious pages.
+// per-session token, or an API token with write scope, to prevent cross-site
+// request forgery from malicious pages.
 func (a *App) requireSessionToken(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("X-Session-Token")
-		if token == "" {
-			token = r.URL.Query().Get("_t")
-		}
-		if token != a.sessionToken {
+		if !a.authorized(r, localapi.ScopeWrite) {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
@@ -500,25 +564,28 @@ func (a *App) requireSessionToken(next http.HandlerFunc) http.HandlerFunc {
 }
 
 func (a *App) startLocalServer() {
-	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	ln, serverURL, err := a.listenLocal()
 	if err != nil {
-		slog.Error("Failed to bind local HTTP server", "error", err)
+		slog.Error("Failed to start local HTTP server", "error", err)
 		return
 	}
 
-	tcpAddr, ok := ln.Addr().(*net.TCPAddr)
-	if !ok {
-		slog.Error("Unexpected listener address type for local HTTP server")
-		if err := ln.Close(); err != nil {
-			slog.Warn("Failed to close temporary listener", "error", err)
+	a.serverURL = serverURL
+	slog.Info("Starting local HTTP server for UI", "url", a.serverURL)
+
+	// Tell the CLI where to find this instance
+	inst := localapi.Instance{URL: a.serverURL, PID: os.Getpid(), Started: time.Now(), CertFile: a.certFile}
+	a.serverMu.Lock()
+	a.instance = inst
+	a.serverMu.Unlock()
+	if path, err := localapi.DefaultInstancePath(); err == nil {
+		if err := localapi.WriteInstance(path, inst); err != nil {
+			slog.Warn("Failed to write instance file", "error", err)
+		} else {
+			a.instancePath = path
 		}
-		return
 	}
 
-	a.serverListener = ln
-	a.serverURL = fmt.Sprintf("http://127.0.0.1:%d", tcpAddr.Port)
-	slog.Info("Starting local HTTP server for UI", "url", a.serverURL)
-
 	mux := http.NewServeMux()
 
 	// Serve the embedded map HTML, injecting the session token so JS can use it
@@ -528,7 +595,7 @@ func (a *App) startLocalServer() {
 		injected := bytes.Replace(
 			mapHTMLContent,
 			[]byte("</head>"),
-			[]byte(fmt.Sprintf(`<script>window._sessionToken = %q;</script></head>`, a.sessionToken)),
+			[]byte(fmt.Sprintf(`<script>window._sessionToken = %q;</script></head>`, a.pageToken(r))),
 			1,
 		)
 		if _, err := w.Write(injected); err != nil {
@@ -538,6 +605,20 @@ func (a *App) startLocalServer() {
 
 	// Serve the latest map image as PNG bytes directly (no double-encoding)
 	mux.HandleFunc("/api/map.png", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("region") || r.URL.Query().Has("bbox") {
+			a.serveRegionPNG(w, r)
+			return
+		}
+		switch layer := r.URL.Query().Get("layer"); layer {
+		case "":
+		case "heat":
+			a.serveHeatmapPNG(w, r)
+			return
+		default:
+			http.Error(w, fmt.Sprintf("Unknown layer %q", layer), http.StatusBadRequest)
+			return
+		}
+
 		a.mapPNGMu.RLock()
 		pngBytes := a.lastMapPNG
 		a.mapPNGMu.RUnlock()
@@ -552,6 +633,29 @@ func (a *App) startLocalServer() {
 		}
 	})
 
+	// Read or switch the map theme
+	mux.HandleFunc("/api/theme", a.handleTheme)
+
+	// Render the travel history as an animated GIF
+	mux.HandleFunc("/api/timelapse.gif", a.serveTimelapseGIF)
+
+	// Web Mercator tiles, the version that invalidates them and country
+	// outlines with their states for the pan-and-zoom map
+	mux.HandleFunc("/tiles/", a.handleTile)
+	mux.HandleFunc("/api/map-version", a.handleMapVersion)
+	mux.HandleFunc("/api/countries.geojson", a.handleCountriesGeoJSON)
+
+	// Prometheus metrics in the text exposition format
+	mux.Handle("/metrics", a.metrics.registry)
+
+	// Push hits, country state, target, achievement, fact, config,
+	// expedition and challenge changes as Server-Sent Events; clients resume with Last-Event-ID
+	mux.Handle("/api/events", a.events)
+
+	// Versioned REST API with typed resources, JSON errors and an OpenAPI
+	// document; the routes above stay for the embedded UI
+	a.registerAPI(mux)
+
 	// Send a country to Matrix Prison manually
 	mux.HandleFunc("/countries/imprison", a.requireSessionToken(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -572,10 +676,7 @@ func (a *App) startLocalServer() {
 			return
 		}
 
-		wasTarget, _ := a.gameState.ImprisonCountry(data.Country)
-		if wasTarget {
-			a.achievements.UnlockFastestTravelerAchievement(data.Country)
-		}
+		a.imprisonCountry(data.Country)
 
 		if err := json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": true,
@@ -592,12 +693,10 @@ func (a *App) startLocalServer() {
 			return
 		}
 
-		if a.originalWallpaper == "" {
+		if err := a.restoreWallpaper(); errors.Is(err, errNoWallpaperBackup) {
 			http.Error(w, "No original wallpaper backup found", http.StatusNotFound)
 			return
-		}
-
-		if err := a.RestoreOriginalWallpaper(); err != nil {
+		} else if err != nil {
 			slog.Error("Failed to restore wallpaper via API", "error", err)
 			http.Error(w, "Failed to restore wallpaper", http.StatusInternalServerError)
 			return
@@ -613,78 +712,7 @@ func (a *App) startLocalServer() {
 
 	// Serve game statistics and recent hits
 	mux.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
-		// Get game statistics
-		a.gameState.mutex.RLock()
-		visitedCount := len(a.gameState.countries)
-		prisonCount := 0
-
-		// Identify inMatrixPrison state
-		inMatrixPrison := false
-		connections := a.monitor.GetConnections()
-		recentCountries := make(map[string]bool)
-		for _, conn := range connections {
-			loc, err := a.geoip.Lookup(conn.RemoteIP)
-			if err == nil {
-				country := a.naturalEarth.FindCountryAtPoint(loc.Latitude, loc.Longitude)
-				if country != "" {
-					recentCountries[country] = true
-				}
-			}
-		}
-
-		type summaryItem struct {
-			Country string `json:"country"`
-			Hits    int    `json:"hits"`
-		}
-		var topCountries []summaryItem
-
-		liberatedCount := 0
-		for country, state := range a.gameState.countries {
-			if state.MatrixPrison && !state.Liberated {
-				prisonCount++
-				if recentCountries[country] {
-					inMatrixPrison = true
-				}
-			}
-			if state.Liberated {
-				liberatedCount++
-			}
-			topCountries = append(topCountries, summaryItem{Country: country, Hits: state.HitCount})
-		}
-		// Read targetCountry directly — we already hold the read lock.
-		// Calling GetTargetCountry() here would attempt a second RLock on the same
-		// mutex; if a writer (targetSelectionLoop) is queued, Go's RWMutex blocks
-		// all new RLock calls, causing both goroutines to wait on each other forever.
-		targetCountry := a.gameState.targetCountry
-		a.gameState.mutex.RUnlock()
-
-		// Sort top countries by hits descending
-		sort.Slice(topCountries, func(i, j int) bool {
-			return topCountries[i].Hits > topCountries[j].Hits
-		})
-		if len(topCountries) > 10 {
-			topCountries = topCountries[:10]
-		}
-
-		// Get achievement count
-		achievementCount := len(a.achievements.GetUnlockedAchievements())
-
-		// Get recent hits
-		a.recentHitsMu.RLock()
-		recentHits := make([]RecentHit, len(a.recentHits))
-		copy(recentHits, a.recentHits)
-		a.recentHitsMu.RUnlock()
-
-		data := map[string]interface{}{
-			"visited_count":     visitedCount,
-			"prison_count":      prisonCount,
-			"liberated_count":   liberatedCount,
-			"achievement_count": achievementCount,
-			"target_country":    targetCountry,
-			"in_matrix_prison":  inMatrixPrison,
-			"recent_hits":       recentHits,
-			"top_countries":     topCountries,
-		}
+		data := a.collectStats()
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(data); err != nil {
@@ -731,42 +759,31 @@ func (a *App) startLocalServer() {
 		}
 	})
 
-	// Return the active research challenge hint.
-	// Responds with { active: false } when the hint is not yet due, or
-	// { active: true, target: "...", fact: {...} } after 1 minute without a
-	// hit on the target country.
+	// Return the active research challenge hints.
+	// Responds with { active: false } when no hint is due, or
+	// { active: true, target: "...", fact: {...}, hints: [...] } when the
+	// target has gone without a hit or an expedition is running. hints lists
+	// every target with its own fact; target and fact repeat the first one.
 	mux.HandleFunc("/api/challenge-hint", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		a.gameState.mutex.RLock()
-		target := a.gameState.targetCountry
-		setAt := a.gameState.targetSetAt
-		hitSinceSet := false
-		if target != "" {
-			if state, exists := a.gameState.countries[target]; exists {
-				hitSinceSet = state.LastHit.After(setAt)
-			}
-		}
-		a.gameState.mutex.RUnlock()
+		hints := a.challengeHints()
 
 		type hintResponse struct {
-			Active bool        `json:"active"`
-			Target string      `json:"target"`
-			Fact   factdb.Fact `json:"fact,omitempty"`
+			Active bool         `json:"active"`
+			Target string       `json:"target"`
+			Fact   factdb.Fact  `json:"fact,omitempty"`
+			Hints  []targetHint `json:"hints"`
 		}
 
-		if target == "" || hitSinceSet {
-			if err := json.NewEncoder(w).Encode(hintResponse{Active: false}); err != nil {
+		if len(hints) == 0 {
+			if err := json.NewEncoder(w).Encode(hintResponse{Active: false, Hints: []targetHint{}}); err != nil {
 				slog.Error("Failed to encode challenge-hint response", "error", err)
 			}
 			return
 		}
 
-		a.targetChallengeFactMu.Lock()
-		fact := a.targetChallengeFact
-		a.targetChallengeFactMu.Unlock()
-
-		if err := json.NewEncoder(w).Encode(hintResponse{Active: !fact.IsZero(), Target: target, Fact: fact}); err != nil {
+		if err := json.NewEncoder(w).Encode(hintResponse{Active: true, Target: hints[0].Target, Fact: hints[0].Fact, Hints: hints}); err != nil {
 			slog.Error("Failed to encode challenge-hint response", "error", err)
 		}
 	})
@@ -777,7 +794,7 @@ func (a *App) startLocalServer() {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		a.SelectRandomTargetCountry()
+		a.SelectNextTargetCountry()
 		newTarget, _ := a.gameState.GetTargetCountry()
 		slog.Info("🎲 Target country re-rolled by user", "new_target", newTarget)
 		w.Header().Set("Content-Type", "application/json")
@@ -794,29 +811,40 @@ func (a *App) startLocalServer() {
 		http.Redirect(w, r, "/map.html", http.StatusSeeOther)
 	})
 
-	if err := http.Serve(ln, mux); err != nil {
-		slog.Error("Local HTTP server stopped", "error", err)
-	}
-}
-
-func (a *App) showMapWindow() {
-	if a.serverURL == "" {
-		slog.Warn("Local HTTP server not yet ready, cannot open map")
+	server := &http.Server{Handler: a.requireReadAccess(mux)}
+	a.serverMu.Lock()
+	if a.stopped() {
+		a.serverMu.Unlock()
+		_ = ln.Close()
 		return
 	}
-	if err := open.Run(a.serverURL); err != nil {
-		slog.Error("Failed to open browser", "error", err)
+	a.server = server
+	a.serverMu.Unlock()
+
+	if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Local HTTP server stopped", "error", err)
 	}
 }
 
 // connectionMonitorLoop periodically updates network connections
 func (a *App) connectionMonitorLoop() {
+	defer a.loops.Done()
 	ticker := time.NewTicker(time.Duration(a.config.UpdateInterval) * time.Second)
 	defer ticker.Stop()
 
-	for a.running {
-		<-ticker.C
-		if err := a.monitor.RefreshConnections(); err != nil {
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+		// Socket owners are only needed to route hits to profiles
+		a.monitor.SetOwnerLookup(len(a.profileRoutes()) > 0)
+		start := time.Now()
+		err := a.monitor.RefreshConnections()
+		observeSince(a.metrics.refreshSeconds, start)
+		if err != nil {
+			a.metrics.refreshErrors.Inc()
 			logging.LogError("refresh connections", err)
 		}
 	}
@@ -824,30 +852,40 @@ func (a *App) connectionMonitorLoop() {
 
 // targetSelectionLoop periodically selects new target countries
 func (a *App) targetSelectionLoop() {
+	defer a.loops.Done()
 	// Set initial target
-	a.SelectRandomTargetCountry()
+	a.SelectNextTargetCountry()
 
 	ticker := time.NewTicker(time.Duration(a.config.TargetInterval) * time.Minute)
 	defer ticker.Stop()
 
-	for a.running {
-		<-ticker.C
-		a.SelectRandomTargetCountry()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+		a.SelectNextTargetCountry()
 		slog.Debug("New target country selected", "country", a.gameState.targetCountry)
 	}
 }
 
 // displayLoop generates and displays the map
 func (a *App) displayLoop() {
+	defer a.loops.Done()
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
 	statsTicker := time.NewTicker(10 * time.Second)
 	defer statsTicker.Stop()
 
-	for a.running {
+	for {
 		select {
-		case <-ticker.C:
+		case <-a.done:
+			return
+		case now := <-ticker.C:
+			a.checkExpeditionDeadline(now)
+			a.observeChallenges(nil)
 			if err := a.generateAndDisplayMap(); err != nil {
 				logging.LogError("generate map", err)
 			}
@@ -908,7 +946,12 @@ func (a *App) generateAndDisplayMap() error {
 	}
 
 	recentCountries := make(map[string]bool)
+	currentFlows := make(map[string]bool)
+	routedCountries := make(map[string]bool) // by profile/country
+	routes := a.profileRoutes()
 
+	// Hold off profile switches until every hit is counted
+	a.profileMu.Lock()
 	for _, conn := range connections {
 		location, err := a.geoip.Lookup(conn.RemoteIP)
 		if err != nil {
@@ -933,6 +976,20 @@ func (a *App) generateAndDisplayMap() error {
 			continue
 		}
 
+		// Journal each flow once, when it is first observed
+		flowKey := conn.RemoteIP + ":" + conn.RemotePort
+		currentFlows[flowKey] = true
+		newFlow := !a.knownFlows[flowKey]
+
+		// Connections of other players count towards their own profiles
+		if name := a.routeProfile(routes, conn); name != "" {
+			a.playRoutedHit(name, conn, location, countryName, newFlow, routedCountries)
+			continue
+		}
+		if newFlow {
+			a.recordHit(conn, location, countryName)
+		}
+
 		// Add hit to country (only once per update cycle per country)
 		if !recentCountries[countryName] {
 			// Update location country to match Natural Earth result for logging
@@ -951,9 +1008,23 @@ func (a *App) generateAndDisplayMap() error {
 			recentCountries[countryName] = true
 			a.markMapDirty()
 
+			if wasFirstVisit {
+				a.recordEvent(history.Event{Type: history.EventVisit, Country: countryName, City: location.City})
+			}
+			if sentToPrison {
+				a.recordEvent(history.Event{Type: history.EventImprison, Country: countryName, Liberated: wasTarget})
+			}
+			if wasFirstVisit || sentToPrison {
+				a.publishCountryState(countryName)
+			}
+			if wasFirstVisit {
+				a.reachExpeditionCountry(countryName)
+			}
+
 			// Handle fastest traveler achievement if country entered Matrix Prison and was target
 			if sentToPrison && wasTarget {
 				achievementID := a.achievements.UnlockFastestTravelerAchievement(countryName)
+				a.publishAchievements(achievementID)
 
 				if achievementID != "" {
 					slog.Info("🚀 Fastest Traveler Achievement earned automatically!",
@@ -964,7 +1035,7 @@ func (a *App) generateAndDisplayMap() error {
 				}
 
 				// Immediately select a new target country
-				a.SelectRandomTargetCountry()
+				a.SelectNextTargetCountry()
 
 				newTarget, _ := a.gameState.GetTargetCountry()
 				if newTarget != "" {
@@ -979,6 +1050,7 @@ func (a *App) generateAndDisplayMap() error {
 			if wasFirstVisit {
 				totalCountriesVisited := len(a.gameState.countries)
 				newUnlocks := a.achievements.UpdateProgress(countryName, totalCountriesVisited)
+				a.publishAchievements(newUnlocks...)
 
 				// Log any new achievement unlocks
 				for _, achievementID := range newUnlocks {
@@ -988,6 +1060,7 @@ func (a *App) generateAndDisplayMap() error {
 				// Log a "Did you know?" fact for this newly discovered country/city
 				if a.factDB != nil {
 					if fact := a.factDB.GetFact(countryName, location.City); !fact.IsZero() {
+						a.publishFact(countryName, location.City, fact)
 						slog.Info("🌍 Did you know?",
 							"country", countryName,
 							"city", location.City,
@@ -999,58 +1072,37 @@ func (a *App) generateAndDisplayMap() error {
 			}
 		}
 	}
+	a.profileMu.Unlock()
+	a.knownFlows = currentFlows
 
-	var outputImg image.Image
-	var err error
+	state := a.snapshotMapState()
 
-	// Generate map with Natural Earth data if available
-	// Get current hit counts for all countries
-	hitCountries := make(map[string]int)
-	a.gameState.mutex.RLock()
-	for country, state := range a.gameState.countries {
-		hitCountries[country] = state.HitCount
-	}
-	// Access target fields directly (same lock) to avoid nested RLock.
-	targetCountry := a.gameState.targetCountry
-	a.gameState.mutex.RUnlock()
+	// Track open and recently closed endpoints for connection arcs
+	a.updateArcs(connections)
 
-	// Get Matrix Prison countries
-	matrixPrisonCountries := a.getMatrixPrisonCountries()
+	a.configMu.RLock()
+	showHeat := a.config.Heatmap
+	heatWindow := a.config.HeatmapWindow
+	a.configMu.RUnlock()
 
-	// Get liberated countries (were the active target when conquered)
-	liberatedCountries := a.getLiberatedCountries()
+	layers := resources.MapLayers{Ocean: true, Unvisited: true}
+	if showHeat {
+		if window, err := config.ParseWindow(heatWindow); err == nil {
+			layers.Heat = a.heatmapLayer(window)
+		}
+	}
 
-	// Render map with Natural Earth data
-	outputImg, err = resources.RenderNaturalEarthMap(a.naturalEarth, width, height, a.config.Black, hitCountries, targetCountry, a.flagManager, a.fontManager, matrixPrisonCountries, recentCountries, liberatedCountries)
+	renderStart := time.Now()
+	rgbaImg, err := a.renderMapImage(width, height, state, recentCountries, layers)
+	observeSince(a.metrics.renderSeconds, renderStart)
 	if err != nil {
 		logging.LogError("render Natural Earth map", err)
 		return err
 	}
 
-	// Draw connection points for active connections
-	rgbaImg, ok := outputImg.(*image.RGBA)
-	if !ok {
-		// Convert to RGBA if necessary
-		bounds := outputImg.Bounds()
-		rgbaImg = image.NewRGBA(bounds)
-		draw.Draw(rgbaImg, bounds, outputImg, bounds.Min, draw.Src)
-	}
-
-	for _, conn := range connections {
-		location, err := a.geoip.Lookup(conn.RemoteIP)
-		if err != nil {
-			continue
-		}
-
-		// Convert lat/lng to map coordinates
-		x, y := a.latLngToMapCoords(location.Latitude, location.Longitude, width, height)
-
-		// Draw small connection point
-		a.drawCircle(rgbaImg, int(x), int(y), 2, color.RGBA{255, 255, 255, 255})
-	}
-
-	// Draw game status rectangle
-	a.drawGameStatusRectangle(rgbaImg, width, height, recentCountries)
+	a.mapPNGMu.Lock()
+	a.lastMapWidth, a.lastMapHeight = width, height
+	a.mapPNGMu.Unlock()
 
 	// Only re-encode and re-save when something actually changed.
 	a.mapDirtyMu.Lock()
@@ -1064,10 +1116,12 @@ func (a *App) generateAndDisplayMap() error {
 
 	// Encode once to buffer, then write to disk and cache for the HTTP server
 	a.mapEncBuf.Reset()
+	encodeStart := time.Now()
 	encoder := &png.Encoder{CompressionLevel: png.BestSpeed}
 	if err := encoder.Encode(&a.mapEncBuf, rgbaImg); err != nil {
 		return fmt.Errorf("failed to encode map image: %w", err)
 	}
+	observeSince(a.metrics.encodeSeconds, encodeStart)
 	// Copy the encoded bytes out of mapEncBuf so that the HTTP cache and disk write
 	// hold an independent slice. Without this copy, a.mapEncBuf.Reset() on the next
 	// dirty frame would overwrite the backing array that a.lastMapPNG still points into,
@@ -1089,9 +1143,10 @@ func (a *App) generateAndDisplayMap() error {
 
 	a.configMu.RLock()
 	updateWallpaper := a.config.UpdateWallpaper
+	wallpaperMode := a.config.WallpaperMode
 	a.configMu.RUnlock()
 
-	if updateWallpaper {
+	if updateWallpaper && !a.headless {
 		// Backup original wallpaper before first change
 		if !a.wallpaperBackedUp && a.wallpaperBackedUpError == nil {
 			backupPath, err := background.BackupCurrentWallpaper(a.outputDir)
@@ -1106,8 +1161,20 @@ func (a *App) generateAndDisplayMap() error {
 			}
 		}
 
+		// In overlay mode the map is blended onto the original wallpaper
+		// instead of replacing it; fall back to the plain map on failure.
+		wallpaperPath := outputPath
+		if wallpaperMode == "overlay" {
+			overlayPath, err := a.writeOverlayWallpaper(state, recentCountries, layers.Heat)
+			if err != nil {
+				slog.Warn("Failed to composite overlay wallpaper, using plain map", "error", err)
+			} else {
+				wallpaperPath = overlayPath
+			}
+		}
+
 		// Display using macOS Preview or similar
-		if err := background.SetDesktopBackground(outputPath); err != nil {
+		if err := background.SetDesktopBackground(wallpaperPath); err != nil {
 			slog.Error("Failed to set desktop background", "error", err)
 		}
 	}
@@ -1115,6 +1182,85 @@ func (a *App) generateAndDisplayMap() error {
 	return nil
 }
 
+// mapState is a snapshot of the game state needed to render the map.
+type mapState struct {
+	hitCountries          map[string]int
+	targetCountries       map[string]bool // the target and the outstanding expedition countries
+	matrixPrisonCountries map[string]bool
+	liberatedCountries    map[string]bool
+	visitedSubdivisions   map[string]int // hits by ISO 3166-2 code
+}
+
+// snapshotMapState copies the parts of the game state the renderer needs.
+func (a *App) snapshotMapState() mapState {
+	hitCountries := make(map[string]int)
+	a.gameState.mutex.RLock()
+	for country, state := range a.gameState.countries {
+		hitCountries[country] = state.HitCount
+	}
+	visitedSubdivisions := make(map[string]int, len(a.gameState.subdivisions))
+	for code, state := range a.gameState.subdivisions {
+		visitedSubdivisions[code] = state.HitCount
+	}
+	// Access target fields directly (same lock) to avoid nested RLock.
+	targetCountry := a.gameState.targetCountry
+	a.gameState.mutex.RUnlock()
+
+	targetCountries := a.expeditionTargets()
+	if targetCountry != "" {
+		targetCountries[targetCountry] = true
+	}
+
+	return mapState{
+		hitCountries:          hitCountries,
+		targetCountries:       targetCountries,
+		matrixPrisonCountries: a.getMatrixPrisonCountries(),
+		liberatedCountries:    a.getLiberatedCountries(),
+		visitedSubdivisions:   visitedSubdivisions,
+	}
+}
+
+// renderMapImage renders the world map for a state snapshot and decorates it
+// with connection points, arcs and the game status rectangle.
+func (a *App) renderMapImage(width, height int, state mapState, recentCountries map[string]bool, layers resources.MapLayers) (*image.RGBA, error) {
+	rgbaImg, err := a.renderMap(a.naturalEarth, width, height, state, recentCountries, layers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Draw connection points and arcs for active connections
+	a.drawConnections(rgbaImg, width, height)
+
+	// Draw game status rectangle
+	a.drawGameStatusRectangle(rgbaImg, width, height, recentCountries)
+
+	return rgbaImg, nil
+}
+
+// renderMap renders map data (the world or a cropped region) for a state
+// snapshot with the configured insets, labels and legend.
+func (a *App) renderMap(ne *resources.NaturalEarthData, width, height int, state mapState, recentCountries map[string]bool, layers resources.MapLayers) (*image.RGBA, error) {
+	a.configMu.RLock()
+	layers.Insets = resources.NewInsetOptions(a.config.InsetMinArea)
+	layers.Labels = resources.NewLabelOptions(a.config.Labels, a.config.LabelCountries != "all", a.config.LabelMinArea)
+	layers.Legend = resources.NewLegendOptions(a.config.Legend)
+	a.configMu.RUnlock()
+
+	outputImg, err := resources.RenderNaturalEarthMapLayers(ne, width, height, a.currentTheme(), state.hitCountries, state.targetCountries, a.flagManager, a.fontManager, state.matrixPrisonCountries, recentCountries, state.liberatedCountries, layers)
+	if err != nil {
+		return nil, err
+	}
+
+	rgbaImg, ok := outputImg.(*image.RGBA)
+	if !ok {
+		// Convert to RGBA if necessary
+		bounds := outputImg.Bounds()
+		rgbaImg = image.NewRGBA(bounds)
+		draw.Draw(rgbaImg, bounds, outputImg, bounds.Min, draw.Src)
+	}
+	return rgbaImg, nil
+}
+
 // latLngToMapCoords converts latitude/longitude to map pixel coordinates
 func (a *App) latLngToMapCoords(lat, lng float64, mapWidth, mapHeight int) (float64, float64) {
 	// Convert longitude (-180 to 180) to x coordinate (0 to width)
@@ -1158,11 +1304,15 @@ func (a *App) drawGameStatusRectangle(img *image.RGBA, mapWidth, mapHeight int,
 	achievementCount := len(unlockedAchievements)
 
 	// Prepare text lines for the game status
-	lines := []string{
-		"GAME STATUS",
+	lines := []string{"GAME STATUS"}
+	if line := a.profileLine(); line != "" {
+		lines = append(lines, line)
+	}
+	lines = append(lines,
 		fmt.Sprintf("Countries visited: %d", visitedCount),
 		fmt.Sprintf("Achievements: %d", achievementCount),
-	}
+		a.scoreLine(),
+	)
 
 	// Add target country line
 	if targetCountry != "" {
@@ -1174,6 +1324,10 @@ func (a *App) drawGameStatusRectangle(img *image.RGBA, mapWidth, mapHeight int,
 	} else {
 		lines = append(lines, "Let's visit: None")
 	}
+	if line := a.expeditionLine(); line != "" {
+		lines = append(lines, line)
+	}
+	lines = append(lines, a.challengeLines()...)
 
 	// Add status message
 	if visitedCount == 0 {
@@ -1236,35 +1390,12 @@ func (a *App) drawGameStatusRectangle(img *image.RGBA, mapWidth, mapHeight int,
 
 	// Use the simple game info rectangle function from resources package
 	// The function will automatically calculate dimensions and use appropriate theme
-	if err := resources.DrawGameInfoRectangle(img, a.fontManager, rectX, rectY, rectWidth, rectHeight, lines, a.getGameInfoConfig(a.config.Black, fontSize, padding)); err != nil {
+	if err := resources.DrawGameInfoRectangle(img, a.fontManager, rectX, rectY, rectWidth, rectHeight, lines, a.currentTheme().GameInfoConfig(a.fontManager, fontSize, padding)); err != nil {
 		// Log error if font rendering fails - the map will still be generated without the status rectangle
 		slog.Warn("Font rendering failed, status rectangle not displayed", "error", err)
 	}
 }
 
-// getGameInfoConfig returns the configuration for the game info rectangle
-func (a *App) getGameInfoConfig(darkTheme bool, fontSize float64, padding int) resources.GameInfoConfig {
-	if darkTheme {
-		return resources.GameInfoConfig{
-			BackgroundColor: color.RGBA{20, 20, 20, 240},    // Darker background for better contrast
-			TextColor:       color.RGBA{255, 255, 255, 255}, // Pure white text
-			BorderColor:     color.RGBA{150, 150, 150, 255}, // Lighter border
-			FontSize:        fontSize,
-			Padding:         padding,
-			BorderWidth:     2, // Thicker border for better visibility
-		}
-	} else {
-		return resources.GameInfoConfig{
-			BackgroundColor: color.RGBA{255, 255, 255, 240}, // Lighter background
-			TextColor:       color.RGBA{0, 0, 0, 255},       // Pure black text for maximum contrast
-			BorderColor:     color.RGBA{100, 100, 100, 255}, // Darker border
-			FontSize:        fontSize,
-			Padding:         padding,
-			BorderWidth:     2, // Thicker border for better visibility
-		}
-	}
-}
-
 // logGameStats logs current game statistics
 func (a *App) logGameStats() {
 	a.gameState.mutex.RLock()
@@ -1345,52 +1476,27 @@ func (gs *GameState) GetTargetCountry() (string, time.Time) {
 	return gs.targetCountry, gs.targetSetAt
 }
 
-// SelectRandomTargetCountry selects a random unhit country as the new target
-func (a *App) SelectRandomTargetCountry() {
-	if a.naturalEarth == nil {
-		return
-	}
-
-	// Get list of all countries from Natural Earth data
-	allCountries := make([]string, 0, len(a.naturalEarth.Countries))
-	for _, country := range a.naturalEarth.Countries {
-		allCountries = append(allCountries, country.Name)
-	}
-
-	// Filter out countries that have been hit
-	a.gameState.mutex.RLock()
-	unhitCountries := make([]string, 0)
-	for _, countryName := range allCountries {
-		if _, exists := a.gameState.countries[countryName]; !exists {
-			unhitCountries = append(unhitCountries, countryName)
-		}
-	}
-	a.gameState.mutex.RUnlock()
-
-	// If no unhit countries remain, clear the target
-	if len(unhitCountries) == 0 {
-		a.gameState.SetTargetCountry("")
-		slog.Info("No more unhit countries available for targeting")
-		return
-	}
-
-	// Select a random unhit country
-	rng := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
-	targetIndex := rng.Intn(len(unhitCountries))
-	newTarget := unhitCountries[targetIndex]
-
-	a.gameState.SetTargetCountry(newTarget)
-	logging.LogTarget(newTarget, len(unhitCountries))
+// SetTargetCountry makes country the target instead of a random draw.
+func (a *App) SetTargetCountry(country string) {
+	previousTarget, _ := a.gameState.GetTargetCountry()
+	a.gameState.SetTargetCountry(country)
+	a.recordEvent(history.Event{Type: history.EventTarget, Country: country})
+	a.publishTarget(country, previousTarget)
+	slog.Info("🎯 Target country set", "country", country, "previous", previousTarget)
 	a.markMapDirty()
+	a.cacheTargetFact(country)
+}
 
-	// Pre-fetch and cache a challenge fact for the new target so the banner
-	// has content ready without taking locks inside the render loop.
-	if a.factDB != nil {
-		fact := a.factDB.GetCountryFact(newTarget)
-		a.targetChallengeFactMu.Lock()
-		a.targetChallengeFact = fact
-		a.targetChallengeFactMu.Unlock()
+// cacheTargetFact pre-fetches a challenge fact for a new target so the banner
+// has content ready without taking locks inside the render loop.
+func (a *App) cacheTargetFact(target string) {
+	if a.factDB == nil {
+		return
 	}
+	fact := a.factDB.GetCountryFact(target)
+	a.targetChallengeFactMu.Lock()
+	a.targetChallengeFact = fact
+	a.targetChallengeFactMu.Unlock()
 }
 
 // logHit logs detailed information about a network hit
@@ -1435,6 +1541,7 @@ func (a *App) logHit(conn network.Connection, location *geoip.Location, mapWidth
 				}
 			}
 			a.recentHitsMu.Unlock()
+			a.hostnames.add(ip, strings.TrimSuffix(names[0], "."))
 		}
 	}(conn.RemoteIP, 0)
 
@@ -1498,32 +1605,89 @@ func (a *App) markMapDirty() {
 	a.mapDirtyMu.Unlock()
 }
 
-// Stop stops the application gracefully
+// Stop ends the background loops. It is safe to call more than once.
 func (a *App) Stop() {
-	a.running = false
+	a.stopOnce.Do(func() { close(a.done) })
 }
 
-// Shutdown performs cleanup operations including wallpaper restoration
+// stopped reports whether Stop was called.
+func (a *App) stopped() bool {
+	select {
+	case <-a.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdownTimeout bounds how long in-flight HTTP requests may take to finish.
+const shutdownTimeout = 5 * time.Second
+
+// Shutdown stops the engine and cleans up: the loops finish their current
+// tick, event streams are closed, in-flight requests complete, and the
+// original wallpaper is restored. Only the first call has any effect.
 func (a *App) Shutdown() {
+	a.shutdownOnce.Do(a.shutdown)
+}
+
+func (a *App) shutdown() {
 	slog.Info("🛑 Shutting down IP Travel Wallpaper...")
 
-	// Stop the application
+	// Stop the loops and wait so no map is written during the restore below
 	a.Stop()
+	a.loops.Wait()
+
+	// End event streams first; the server waits for open connections
+	a.events.Close()
+	a.serverMu.Lock()
+	server := a.server
+	a.serverMu.Unlock()
+	if server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("Failed to shut down local HTTP server", "error", err)
+		}
+		cancel()
+	}
+	a.serverMu.Lock()
+	controlServer := a.control
+	a.serverMu.Unlock()
+	if controlServer != nil {
+		if err := controlServer.Close(); err != nil {
+			slog.Warn("Failed to close control socket", "error", err)
+		}
+	}
+	if a.instancePath != "" {
+		if err := localapi.RemoveInstance(a.instancePath, os.Getpid()); err != nil {
+			slog.Warn("Failed to remove instance file", "error", err)
+		}
+	}
 
-	// Close the local HTTP server listener
-	if a.serverListener != nil {
-		if err := a.serverListener.Close(); err != nil {
-			slog.Warn("Failed to close local HTTP server listener", "error", err)
+	if a.history != nil {
+		if err := a.history.Close(); err != nil {
+			slog.Warn("Failed to close history journal", "error", err)
 		}
 	}
+	a.profileMu.Lock()
+	for name, p := range a.profiles {
+		if p.history == nil {
+			continue
+		}
+		if err := p.history.Close(); err != nil {
+			slog.Warn("Failed to close history journal", "profile", name, "error", err)
+		}
+	}
+	a.profileMu.Unlock()
 
 	// Restore original wallpaper if we backed it up
-	if a.HasWallpaperBackup() {
+	switch {
+	case a.headless:
+	case a.HasWallpaperBackup():
 		slog.Info("🔄 Restoring original wallpaper...")
 		if err := a.RestoreOriginalWallpaper(); err != nil {
 			slog.Error("Failed to restore original wallpaper during shutdown", "error", err)
 		}
-	} else {
+	default:
 		slog.Info("No wallpaper backup available - leaving current wallpaper as is")
 	}
 
@@ -1546,7 +1710,7 @@ func (a *App) RestoreOriginalWallpaper() error {
 	}
 
 	// Delete the backup file after successful restoration
-	if err := os.Remove(a.originalWallpaper); err != nil {
+	if err := background.RemoveBackup(a.originalWallpaper); err != nil {
 		slog.Warn("Failed to delete wallpaper backup file after restore", "path", a.originalWallpaper, "error", err)
 	} else {
 		slog.Info("🗑️  Wallpaper backup file deleted after successful restore")
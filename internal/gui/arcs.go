@@ -0,0 +1,223 @@
+package gui
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paulmach/orb"
+
+	"iptw/internal/config"
+	"iptw/internal/network"
+	"iptw/internal/resources"
+)
+
+// publicIPURL is queried once at startup when home_location is "auto" to learn
+// the public address, which is then located with the embedded GeoIP database.
+const publicIPURL = "https://api.ipify.org"
+
+// arcSegments is the number of great-circle segments used per connection arc.
+const arcSegments = 64
+
+// connectionArc tracks one remote endpoint drawn as an arc from home.
+type connectionArc struct {
+	lat, lng float64
+	flows    int              // open connections to the endpoint (kept after close for thickness)
+	active   bool             // present in the latest connection poll
+	lastSeen time.Time        // last poll the endpoint was present in
+	path     []orb.LineString // cached great-circle route from home, split at the antimeridian
+}
+
+// arcTracker keeps the set of current and recently closed connection
+// endpoints together with the home location arcs are drawn from.
+type arcTracker struct {
+	mu      sync.Mutex
+	homeSet bool
+	homeLat float64
+	homeLng float64
+	arcs    map[string]*connectionArc // keyed by remote IP
+}
+
+func newArcTracker() *arcTracker {
+	return &arcTracker{arcs: make(map[string]*connectionArc)}
+}
+
+// setHome sets the arc origin and drops cached routes so they are recomputed.
+func (t *arcTracker) setHome(lat, lng float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.homeSet, t.homeLat, t.homeLng = true, lat, lng
+	for _, arc := range t.arcs {
+		arc.path = nil
+	}
+}
+
+// resolveHomeLocation determines the arc origin from the home_location setting.
+// It may perform one HTTP request to learn the public IP and should therefore
+// run in its own goroutine.
+func (a *App) resolveHomeLocation() {
+	a.configMu.RLock()
+	setting := a.config.HomeLocation
+	a.configMu.RUnlock()
+
+	switch setting {
+	case "", "off":
+		return
+	case "auto":
+		ip, err := fetchPublicIP()
+		if err != nil {
+			slog.Warn("Failed to determine public IP for home location", "error", err)
+			return
+		}
+		loc, err := a.geoip.Lookup(ip)
+		if err != nil {
+			slog.Warn("Failed to locate public IP for home location", "error", err)
+			return
+		}
+		a.arcs.setHome(loc.Latitude, loc.Longitude)
+		slog.Info("🏠 Home location derived from public IP", "city", loc.City, "country", loc.Country)
+	default:
+		lat, lng, err := config.ParseLatLng(setting)
+		if err != nil {
+			slog.Warn("Invalid home_location setting", "value", setting, "error", err)
+			return
+		}
+		a.arcs.setHome(lat, lng)
+		slog.Info("🏠 Home location configured", "lat", lat, "lng", lng)
+	}
+	a.markMapDirty()
+}
+
+// fetchPublicIP asks publicIPURL for the address this machine is seen as.
+func fetchPublicIP() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, publicIPURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// updateArcs records the current connection set. Endpoints that disappeared
+// keep fading for arc_fade minutes; while any arc is fading the map is kept
+// dirty so the fade is animated.
+func (a *App) updateArcs(connections []network.Connection) {
+	flows := make(map[string]int)
+	for _, conn := range connections {
+		flows[conn.RemoteIP]++
+	}
+
+	a.configMu.RLock()
+	fade := time.Duration(a.config.ArcFade) * time.Minute
+	a.configMu.RUnlock()
+
+	now := time.Now()
+	animating := false
+
+	a.arcs.mu.Lock()
+	for ip, n := range flows {
+		arc := a.arcs.arcs[ip]
+		if arc == nil {
+			loc, err := a.geoip.Lookup(ip)
+			if err != nil {
+				continue
+			}
+			arc = &connectionArc{lat: loc.Latitude, lng: loc.Longitude}
+			a.arcs.arcs[ip] = arc
+		}
+		arc.flows = n
+		arc.active = true
+		arc.lastSeen = now
+	}
+	for ip, arc := range a.arcs.arcs {
+		if _, open := flows[ip]; open {
+			continue
+		}
+		arc.active = false
+		if now.Sub(arc.lastSeen) >= fade {
+			delete(a.arcs.arcs, ip)
+		}
+		animating = true
+	}
+	a.arcs.mu.Unlock()
+
+	if animating {
+		a.markMapDirty()
+	}
+}
+
+// drawConnections draws a dot for each open connection and, when a home
+// location is known, a great-circle arc from home to every current or recently
+// closed endpoint. Arc thickness and brightness grow with the number of open
+// flows; closed arcs fade out linearly over arc_fade minutes.
+func (a *App) drawConnections(img *image.RGBA, width, height int) {
+	a.configMu.RLock()
+	fade := time.Duration(a.config.ArcFade) * time.Minute
+	a.configMu.RUnlock()
+
+	now := time.Now()
+	palette := a.currentTheme().Connections
+
+	a.arcs.mu.Lock()
+	defer a.arcs.mu.Unlock()
+
+	if a.arcs.homeSet {
+		for _, arc := range a.arcs.arcs {
+			opacity := 1.0
+			if !arc.active {
+				if fade <= 0 {
+					continue
+				}
+				opacity = 1 - float64(now.Sub(arc.lastSeen))/float64(fade)
+				if opacity <= 0 {
+					continue
+				}
+			}
+			if arc.path == nil {
+				arc.path = resources.GreatCirclePath(a.arcs.homeLat, a.arcs.homeLng, arc.lat, arc.lng, arcSegments)
+			}
+
+			// log2 scaling: 1 flow → 0.25, 15+ flows → 1
+			weight := math.Min(1, math.Log2(1+float64(arc.flows))/4)
+			thickness := 1 + int(math.Round(weight*2))
+			alpha := uint8((110 + 145*weight) * opacity)
+			arcColor := color.RGBA(palette.Arc)
+			arcColor.A = uint8(float64(arcColor.A) * float64(alpha) / 255)
+			resources.DrawArc(img, arc.path, arcColor, thickness, width, height)
+		}
+
+		hx, hy := a.latLngToMapCoords(a.arcs.homeLat, a.arcs.homeLng, width, height)
+		a.drawCircle(img, int(hx), int(hy), 4, color.RGBA(palette.Home))
+		a.drawCircle(img, int(hx), int(hy), 2, color.RGBA(palette.HomeCenter))
+	}
+
+	for _, arc := range a.arcs.arcs {
+		if !arc.active {
+			continue
+		}
+		x, y := a.latLngToMapCoords(arc.lat, arc.lng, width, height)
+		a.drawCircle(img, int(x), int(y), 2, color.RGBA(palette.Dot))
+	}
+}
@@ -0,0 +1,304 @@
+package gui
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"iptw/internal/challenge"
+	"iptw/internal/events"
+	"iptw/internal/history"
+	"iptw/internal/resources"
+)
+
+// challengeWorld describes the map countries to the challenge rules: their
+// regions from countries.csv and their ISO codes.
+func challengeWorld(ne *resources.NaturalEarthData) challenge.World {
+	regionOf := func(country string) string {
+		alpha2, err := resources.GetAlpha2ByName(country)
+		if err != nil {
+			return ""
+		}
+		info, err := resources.GetCountryByAlpha2(alpha2)
+		if err != nil {
+			return ""
+		}
+		return info.Region
+	}
+
+	seen := make(map[string]bool)
+	var regions []string
+	if ne != nil {
+		for _, country := range ne.Countries {
+			if region := regionOf(country.Name); region != "" && !seen[region] {
+				seen[region] = true
+				regions = append(regions, region)
+			}
+		}
+	}
+	sort.Strings(regions)
+	return challenge.World{Regions: regions, RegionOf: regionOf, Alpha2Of: countryAlpha2}
+}
+
+// trackedChallenge is the challenge of a current period and what happened in
+// it so far.
+type trackedChallenge struct {
+	challenge challenge.Challenge
+	activity  *challenge.Activity
+}
+
+// challengeCompletion is a challenge that has just been completed.
+type challengeCompletion struct {
+	challenge challenge.Challenge
+	at        time.Time
+}
+
+// challengeTracker follows the daily and weekly challenges: the activity of
+// the current periods and the periods whose challenge was completed. It is
+// safe for concurrent use.
+type challengeTracker struct {
+	mu        sync.Mutex
+	generator *challenge.Generator
+	current   map[challenge.Kind]*trackedChallenge
+	done      map[challenge.Kind]map[string]time.Time // completion time by period key
+}
+
+func newChallengeTracker(generator *challenge.Generator) *challengeTracker {
+	t := &challengeTracker{
+		generator: generator,
+		current:   make(map[challenge.Kind]*trackedChallenge),
+		done:      make(map[challenge.Kind]map[string]time.Time),
+	}
+	for _, kind := range challenge.Kinds {
+		t.done[kind] = make(map[string]time.Time)
+	}
+	return t
+}
+
+// load reads the completed challenges, and the activity of the current
+// periods, from the journal, forgetting those of any other journal.
+func (t *challengeTracker) load(journal *history.Journal, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current = make(map[challenge.Kind]*trackedChallenge)
+	for _, kind := range challenge.Kinds {
+		t.done[kind] = make(map[string]time.Time)
+	}
+	t.roll(now)
+	return journal.Scan(time.Time{}, func(e history.Event) bool {
+		if e.Type == history.EventChallenge {
+			kind, key, _ := strings.Cut(e.Challenge, "-")
+			if done := t.done[challenge.Kind(kind)]; done != nil {
+				done[key] = e.Time
+			}
+			return true
+		}
+		t.add(e)
+		return true
+	})
+}
+
+// observe adds a journaled event to the activity of the current periods and
+// returns the challenges it completed. A nil event only rolls the periods
+// over and checks them, as the clock ticks.
+func (t *challengeTracker) observe(e *history.Event, now time.Time) []challengeCompletion {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	completed := t.roll(now)
+	if e != nil {
+		event := *e
+		if event.Time.IsZero() {
+			event.Time = now
+		}
+		t.add(event)
+	}
+	for _, kind := range challenge.Kinds {
+		if c := t.current[kind]; t.complete(c, false, now) {
+			completed = append(completed, challengeCompletion{challenge: c.challenge, at: now})
+		}
+	}
+	return completed
+}
+
+// roll starts the challenges of the periods containing now, giving the ones
+// ending a last, final evaluation. The caller holds mu.
+func (t *challengeTracker) roll(now time.Time) []challengeCompletion {
+	var completed []challengeCompletion
+	for _, kind := range challenge.Kinds {
+		c := t.current[kind]
+		if c != nil && c.challenge.Period.Contains(now) {
+			continue
+		}
+		if t.complete(c, true, now) {
+			completed = append(completed, challengeCompletion{challenge: c.challenge, at: now})
+		}
+		t.current[kind] = &trackedChallenge{
+			challenge: t.generator.Generate(challenge.PeriodOf(kind, now)),
+			activity:  challenge.NewActivity(),
+		}
+	}
+	return completed
+}
+
+// add counts a hit or first visit towards the current periods it falls in.
+// The caller holds mu.
+func (t *challengeTracker) add(e history.Event) {
+	for _, c := range t.current {
+		if !c.challenge.Period.Contains(e.Time) {
+			continue
+		}
+		switch e.Type {
+		case history.EventHit:
+			c.activity.AddHit(e.Country)
+		case history.EventVisit:
+			c.activity.AddVisit(e.Country)
+		}
+	}
+}
+
+// complete marks the challenge completed when its goal is met and it was not
+// completed before, and reports whether it did. The caller holds mu.
+func (t *challengeTracker) complete(c *trackedChallenge, final bool, now time.Time) bool {
+	if c == nil || c.challenge.Goal == nil {
+		return false
+	}
+	period := c.challenge.Period
+	if _, ok := t.done[period.Kind][period.Key]; ok || !c.challenge.Goal.Evaluate(c.activity, final).Completed {
+		return false
+	}
+	t.done[period.Kind][period.Key] = now
+	return true
+}
+
+// challengeStatus describes the challenge of one period. Progress is only
+// known for the current periods.
+type challengeStatus struct {
+	ID          string     `json:"id"` // kind and period, e.g. daily-2026-10-18
+	Kind        string     `json:"kind"`
+	Period      string     `json:"period"`
+	Start       time.Time  `json:"start"`
+	End         time.Time  `json:"end"`
+	Rule        string     `json:"rule,omitempty"`
+	Title       string     `json:"title"`
+	Current     bool       `json:"current"`
+	Progress    int        `json:"progress"`
+	Target      int        `json:"target"`
+	Limit       bool       `json:"limit,omitempty"` // progress must stay below target until the period is over
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Streak      int        `json:"streak"` // consecutive completed periods up to this one
+	BestStreak  int        `json:"best_streak"`
+}
+
+// status describes the challenge of the period of kind containing at. The
+// caller holds mu.
+func (t *challengeTracker) status(kind challenge.Kind, at time.Time) challengeStatus {
+	period := challenge.PeriodOf(kind, at)
+	tracked := t.current[kind]
+	current := tracked != nil && tracked.challenge.Period.Key == period.Key
+	var c challenge.Challenge
+	if current {
+		c = tracked.challenge
+	} else {
+		c = t.generator.Generate(period)
+	}
+
+	status := challengeStatus{
+		ID:      period.ID(),
+		Kind:    string(kind),
+		Period:  period.Key,
+		Start:   period.Start,
+		End:     period.End,
+		Rule:    c.Rule,
+		Title:   c.Title(),
+		Current: current,
+	}
+	if current && c.Goal != nil {
+		result := c.Goal.Evaluate(tracked.activity, false)
+		status.Progress, status.Target, status.Limit = result.Progress, result.Target, result.Limit
+	}
+	done := make(map[string]bool, len(t.done[kind]))
+	for key := range t.done[kind] {
+		done[key] = true
+	}
+	if at, ok := t.done[kind][period.Key]; ok {
+		status.Completed, status.CompletedAt = true, &at
+	}
+	status.Streak, status.BestStreak = challenge.Streaks(period, done)
+	return status
+}
+
+// statusOf describes the challenge of the period of kind containing at.
+func (t *challengeTracker) statusOf(kind challenge.Kind, at time.Time) challengeStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status(kind, at)
+}
+
+// statuses describes the daily and weekly challenges of the periods
+// containing at.
+func (t *challengeTracker) statuses(at time.Time) []challengeStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var list []challengeStatus
+	for _, kind := range challenge.Kinds {
+		list = append(list, t.status(kind, at))
+	}
+	return list
+}
+
+// observeChallenges feeds a journaled event (nil as the clock ticks) to the
+// challenge tracker, then records and announces the challenges completed.
+func (a *App) observeChallenges(e *history.Event) {
+	completed := a.challenges.observe(e, time.Now())
+	for _, done := range completed {
+		c := done.challenge
+		a.recordEvent(history.Event{Time: done.at, Type: history.EventChallenge, Challenge: c.Period.ID(), Title: c.Title()})
+		status := a.challenges.statusOf(c.Period.Kind, c.Period.Start)
+		a.events.Publish(events.TypeChallenge, events.ChallengeCompleted{ID: c.Period.ID(), Kind: string(c.Period.Kind), Title: c.Title(), Streak: status.Streak})
+		slog.Info("🏅 Challenge completed", "challenge", c.Period.ID(), "title", c.Title(), "streak", status.Streak)
+	}
+	if len(completed) > 0 {
+		a.markMapDirty()
+	}
+}
+
+// challengeLines describes the daily challenge for the game status
+// rectangle.
+func (a *App) challengeLines() []string {
+	status := a.challenges.statusOf(challenge.Daily, time.Now())
+	title := status.Title
+	if len(title) > 40 {
+		title = title[:37] + "..."
+	}
+	lines := []string{"Today: " + title}
+	switch {
+	case status.Completed:
+		lines = append(lines, fmt.Sprintf("Done! Streak: %d", status.Streak))
+	case status.Streak > 0:
+		lines = append(lines, fmt.Sprintf("Streak: %d, keep it going", status.Streak))
+	}
+	return lines
+}
+
+// challengeList is returned by /api/v1/challenges.
+type challengeList struct {
+	Challenges []challengeStatus `json:"challenges"`
+}
+
+func (a *App) handleAPIChallenges(w http.ResponseWriter, r *http.Request) {
+	at := time.Now()
+	if date := r.URL.Query().Get("date"); date != "" {
+		day, err := challenge.ParsePeriod(challenge.Daily, date)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Invalid date %q: expected YYYY-MM-DD", date)
+			return
+		}
+		at = day.Start
+	}
+	writeJSON(w, http.StatusOK, challengeList{Challenges: a.challenges.statuses(at)})
+}
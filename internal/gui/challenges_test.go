@@ -0,0 +1,123 @@
+package gui
+
+import (
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iptw/internal/challenge"
+	"iptw/internal/events"
+	"iptw/internal/history"
+)
+
+// hitsRule draws a goal of a number of hits, met either at once or only when
+// the period is over.
+type hitsRule struct {
+	hits    int
+	atClose bool
+}
+
+func (hitsRule) Name() string { return "hits" }
+
+func (r hitsRule) Generate(rng *rand.Rand, p challenge.Period, w challenge.World) challenge.Goal {
+	return hitsGoal(r)
+}
+
+type hitsGoal hitsRule
+
+func (g hitsGoal) Title() string { return "Make some hits" }
+
+func (g hitsGoal) Evaluate(a *challenge.Activity, final bool) challenge.Result {
+	hits := a.TotalHits()
+	return challenge.Result{Progress: hits, Target: g.hits, Completed: hits >= g.hits && (final || !g.atClose)}
+}
+
+func TestChallenges(t *testing.T) {
+	a := newTestApp(t)
+	a.challenges = newChallengeTracker(&challenge.Generator{Rules: []challenge.Rule{hitsRule{hits: 2}}})
+	_, changes, cancel := a.events.Subscribe(0)
+	defer cancel()
+
+	a.recordEvent(history.Event{Type: history.EventHit, Country: "Fiji"})
+	if status := a.challenges.statusOf(challenge.Daily, time.Now()); status.Completed || status.Progress != 1 || status.Title != "Make some hits" {
+		t.Fatalf("expected 1 of 2 hits, got %+v", status)
+	}
+	a.recordEvent(history.Event{Type: history.EventHit, Country: "Samoa"})
+
+	var list challengeList
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/challenges", "", nil), http.StatusOK, &list)
+	if len(list.Challenges) != 2 || list.Challenges[0].Kind != "daily" || list.Challenges[1].Kind != "weekly" {
+		t.Fatalf("expected the daily and weekly challenges, got %+v", list.Challenges)
+	}
+	for _, status := range list.Challenges {
+		if !status.Current || !status.Completed || status.Streak != 1 || status.BestStreak != 1 {
+			t.Errorf("expected a completed challenge with a streak of 1, got %+v", status)
+		}
+	}
+	completed := 0
+	for len(changes) > 0 {
+		if e := <-changes; e.Type == events.TypeChallenge {
+			completed++
+		}
+	}
+	if completed != 2 {
+		t.Errorf("expected 2 challenge events, got %d", completed)
+	}
+	if lines := a.challengeLines(); len(lines) != 2 || lines[1] != "Done! Streak: 1" {
+		t.Errorf("unexpected status lines %q", lines)
+	}
+
+	// Other days are drawn but have no progress
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/challenges?date=2030-01-01", "", nil), http.StatusOK, &list)
+	if status := list.Challenges[0]; status.Current || status.Completed || status.Period != "2030-01-01" {
+		t.Errorf("expected a future challenge, got %+v", status)
+	}
+	expectAPIError(t, serveAPI(t, a, http.MethodGet, "/api/v1/challenges?date=tomorrow", "", nil), http.StatusBadRequest, "bad_request")
+}
+
+func TestChallengeRollover(t *testing.T) {
+	tracker := newChallengeTracker(&challenge.Generator{Rules: []challenge.Rule{hitsRule{hits: 1, atClose: true}}})
+	today := time.Date(2026, 10, 14, 12, 0, 0, 0, time.Local) // a Wednesday
+	if done := tracker.observe(&history.Event{Time: today, Type: history.EventHit, Country: "Fiji"}, today); len(done) != 0 {
+		t.Fatalf("expected nothing completed before the end of the day, got %d", len(done))
+	}
+	done := tracker.observe(nil, today.AddDate(0, 0, 1))
+	if len(done) != 1 || done[0].challenge.Period.Key != "2026-10-14" {
+		t.Fatalf("expected the day to be completed as it ended, got %+v", done)
+	}
+	if status := tracker.statusOf(challenge.Daily, today.AddDate(0, 0, 1)); status.Completed || status.Progress != 0 || status.Streak != 1 {
+		t.Errorf("expected a fresh day keeping the streak, got %+v", status)
+	}
+}
+
+func TestLoadChallenges(t *testing.T) {
+	journal, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = journal.Close() }()
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.Local)
+	for _, e := range []history.Event{
+		{Time: now.AddDate(0, 0, -2), Type: history.EventChallenge, Challenge: "daily-2026-10-12"},
+		{Time: now.AddDate(0, 0, -1), Type: history.EventChallenge, Challenge: "daily-2026-10-13"},
+		{Time: now.AddDate(0, 0, -1), Type: history.EventHit, Country: "Fiji"},
+		{Time: now.Add(-time.Hour), Type: history.EventHit, Country: "Samoa"},
+	} {
+		if err := journal.Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	tracker := newChallengeTracker(&challenge.Generator{Rules: []challenge.Rule{hitsRule{hits: 3}}})
+	if err := tracker.load(journal, now); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if status := tracker.statusOf(challenge.Daily, now); status.Progress != 1 || status.Streak != 2 {
+		t.Errorf("expected today's hit and a streak of 2, got %+v", status)
+	}
+	if status := tracker.statusOf(challenge.Weekly, now); status.Progress != 2 || status.Streak != 0 {
+		t.Errorf("expected the week's 2 hits, got %+v", status)
+	}
+}
@@ -0,0 +1,144 @@
+package gui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/skratchdot/open-golang/open"
+
+	"iptw/internal/control"
+)
+
+// startControlServer listens on the control socket so a second launch can
+// hand over what it was asked to do, and the CLI can use the API without the
+// HTTP port or a token.
+func (a *App) startControlServer() {
+	path, err := control.DefaultSocketPath()
+	if err != nil {
+		slog.Warn("Control socket unavailable", "error", err)
+		return
+	}
+	ln, err := control.Listen(path)
+	if err != nil {
+		slog.Warn("Control socket unavailable - second launches will not reach this instance", "error", err)
+		return
+	}
+
+	server := a.newControlServer()
+	a.serverMu.Lock()
+	if a.stopped() {
+		a.serverMu.Unlock()
+		_ = ln.Close()
+		return
+	}
+	a.control = server
+	a.serverMu.Unlock()
+
+	slog.Debug("Listening on control socket", "path", path)
+	if err := server.Serve(ln); err != nil {
+		slog.Error("Control socket stopped", "error", err)
+	}
+}
+
+// newControlServer returns a control server with the methods of the engine.
+func (a *App) newControlServer() *control.Server {
+	server := control.NewServer()
+	server.Handle(control.MethodInstance, func(context.Context, json.RawMessage) (interface{}, error) {
+		a.serverMu.Lock()
+		defer a.serverMu.Unlock()
+		if a.instance.URL == "" {
+			return nil, errors.New("the local HTTP server is not ready yet")
+		}
+		return a.instance, nil
+	})
+	server.Handle(control.MethodShowMap, func(context.Context, json.RawMessage) (interface{}, error) {
+		return nil, a.OpenMap()
+	})
+	server.Handle(control.MethodReload, func(context.Context, json.RawMessage) (interface{}, error) {
+		return nil, a.Reload()
+	})
+	server.Handle(control.MethodQuit, func(context.Context, json.RawMessage) (interface{}, error) {
+		a.RequestQuit()
+		return nil, nil
+	})
+
+	// The API runs in-process with the session token: the socket is only
+	// accessible to the user, who could read the token file anyway
+	apiMux := http.NewServeMux()
+	a.registerAPI(apiMux)
+	server.Handle(control.MethodAPI, func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		var req control.APIRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, control.InvalidParams("expected {method, path, body}: %v", err)
+		}
+		if req.Method == "" {
+			req.Method = http.MethodGet
+		}
+		r, err := http.NewRequestWithContext(ctx, req.Method, req.Path, bytes.NewReader(req.Body))
+		if err != nil {
+			return nil, control.InvalidParams("invalid API request: %v", err)
+		}
+		r.Header.Set("X-Session-Token", a.sessionToken)
+		if len(req.Body) > 0 {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		w := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+		apiMux.ServeHTTP(w, r)
+		body := bytes.TrimSpace(w.body.Bytes())
+		if len(body) > 0 && !json.Valid(body) {
+			body, _ = json.Marshal(string(body))
+		}
+		return control.APIResponse{Status: w.status, Body: body}, nil
+	})
+	return server
+}
+
+// bufferedResponse collects an API response for the control socket.
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (w *bufferedResponse) Header() http.Header { return w.header }
+
+func (w *bufferedResponse) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+}
+
+func (w *bufferedResponse) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(p)
+}
+
+// OpenMap opens the web map in the default browser.
+func (a *App) OpenMap() error {
+	if a.headless {
+		return errors.New("iptw runs headless; open the map from another machine instead")
+	}
+	a.serverMu.Lock()
+	url := a.instance.URL
+	a.serverMu.Unlock()
+	if url == "" {
+		return errors.New("the local HTTP server is not ready yet")
+	}
+	if err := open.Run(url); err != nil {
+		return fmt.Errorf("failed to open browser: %w", err)
+	}
+	return nil
+}
+
+// RequestQuit ends RunHeadless or the tray as SIGTERM would. The caller of
+// those runs Shutdown.
+func (a *App) RequestQuit() {
+	a.quitOnce.Do(func() { close(a.quit) })
+}
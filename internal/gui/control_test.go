@@ -0,0 +1,74 @@
+package gui
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iptw/internal/control"
+	"iptw/internal/localapi"
+)
+
+func TestControlServer(t *testing.T) {
+	a := newTestApp(t)
+
+	// t.TempDir paths can exceed the socket path limit
+	dir, err := os.MkdirTemp("", "iptw")
+	if err != nil {
+		t.Fatalf("MkdirTemp failed: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	ln, err := net.Listen("unix", filepath.Join(dir, "control.sock"))
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := a.newControlServer()
+	go func() { _ = server.Serve(ln) }()
+	defer func() { _ = server.Close() }()
+
+	client, err := control.Dial(filepath.Join(dir, "control.sock"))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Call(ctx, control.MethodInstance, nil, nil); err == nil {
+		t.Error("expected no instance before the HTTP server is up")
+	}
+	a.instance = localapi.Instance{URL: "http://127.0.0.1:32819", PID: os.Getpid()}
+	var inst localapi.Instance
+	if err := client.Call(ctx, control.MethodInstance, nil, &inst); err != nil || inst.URL != a.instance.URL {
+		t.Errorf("expected the instance, got %+v (%v)", inst, err)
+	}
+
+	// API calls have write scope without a token
+	api := control.APIClient{Client: client}
+	var target targetResponse
+	if err := api.Do(ctx, "PUT", "/api/v1/target", targetRequest{Country: "Peru"}, &target); err != nil || target.Country != "Peru" {
+		t.Errorf("expected Peru as the target, got %+v (%v)", target, err)
+	}
+	var apiErr *localapi.APIError
+	if err := api.Get(ctx, "/api/v1/countries/Atlantis", nil); !errors.As(err, &apiErr) || apiErr.Code != "not_found" {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	a.headless = true
+	if err := client.Call(ctx, control.MethodShowMap, nil, nil); err == nil {
+		t.Error("expected show_map to fail headless")
+	}
+
+	if err := client.Call(ctx, control.MethodQuit, nil, nil); err != nil {
+		t.Fatalf("quit failed: %v", err)
+	}
+	select {
+	case <-a.quit:
+	default:
+		t.Error("expected a quit request")
+	}
+}
@@ -0,0 +1,403 @@
+package gui
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"iptw/internal/achievements"
+	"iptw/internal/factdb"
+	"iptw/internal/history"
+	"iptw/internal/resources"
+)
+
+// maxHostnames bounds the reverse DNS cache; it is emptied when full.
+const maxHostnames = 4096
+
+// hostnameCache remembers the reverse DNS names looked up for hit logging so
+// the country detail can show them without resolving again.
+type hostnameCache struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+// add stores the name of an IP.
+func (c *hostnameCache) add(ip, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.names == nil || len(c.names) >= maxHostnames {
+		c.names = make(map[string]string)
+	}
+	c.names[ip] = name
+}
+
+// get returns the name of an IP, or "" when it was not resolved.
+func (c *hostnameCache) get(ip string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.names[ip]
+}
+
+// countryList is returned by /api/v1/countries. Total counts the countries
+// matching the filters before limit and offset are applied.
+type countryList struct {
+	Total     int             `json:"total"`
+	Countries []countryStatus `json:"countries"`
+}
+
+// countryFilter holds the query parameters of /api/v1/countries.
+type countryFilter struct {
+	states map[string]bool
+	region string
+	query  string
+	sort   string
+	desc   bool
+	limit  int
+	offset int
+}
+
+// parseCountryFilter reads and validates the list query parameters.
+func parseCountryFilter(r *http.Request) (countryFilter, error) {
+	q := r.URL.Query()
+	f := countryFilter{
+		states: map[string]bool{resources.CountryVisited: true, resources.CountryPrison: true, resources.CountryLiberated: true},
+		region: strings.TrimSpace(q.Get("region")),
+		query:  strings.ToLower(strings.TrimSpace(q.Get("q"))),
+		sort:   "hits",
+	}
+
+	if param := q.Get("state"); param != "" {
+		f.states = make(map[string]bool)
+		for _, state := range strings.Split(param, ",") {
+			state = strings.ToLower(strings.TrimSpace(state))
+			switch state {
+			case resources.CountryUnvisited, resources.CountryVisited, resources.CountryPrison, resources.CountryLiberated:
+				f.states[state] = true
+			default:
+				return f, fmt.Errorf("unknown state %q", state)
+			}
+		}
+	}
+
+	if param := q.Get("sort"); param != "" {
+		switch param {
+		case "hits", "name", "last_hit":
+			f.sort = param
+		default:
+			return f, fmt.Errorf("unknown sort %q, expected hits, name or last_hit", param)
+		}
+	}
+	f.desc = f.sort != "name"
+	switch q.Get("order") {
+	case "":
+	case "asc":
+		f.desc = false
+	case "desc":
+		f.desc = true
+	default:
+		return f, fmt.Errorf("unknown order %q, expected asc or desc", q.Get("order"))
+	}
+
+	var err error
+	if f.limit, err = nonNegativeParam(q.Get("limit")); err != nil {
+		return f, fmt.Errorf("invalid limit: %v", err)
+	}
+	if f.offset, err = nonNegativeParam(q.Get("offset")); err != nil {
+		return f, fmt.Errorf("invalid offset: %v", err)
+	}
+	return f, nil
+}
+
+// nonNegativeParam parses an optional non-negative integer parameter.
+func nonNegativeParam(param string) (int, error) {
+	if param == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%d is negative", n)
+	}
+	return n, nil
+}
+
+// match reports whether a country passes the state, region and name filters.
+func (f countryFilter) match(status countryStatus) bool {
+	if !f.states[status.State] {
+		return false
+	}
+	if f.region != "" && !strings.EqualFold(status.Region, f.region) && !strings.EqualFold(status.SubRegion, f.region) {
+		return false
+	}
+	return f.query == "" || strings.Contains(strings.ToLower(status.Name), f.query)
+}
+
+// less orders two countries; ties are broken by name.
+func (f countryFilter) less(ci, cj countryStatus) bool {
+	switch f.sort {
+	case "hits":
+		if ci.Hits != cj.Hits {
+			return ci.Hits < cj.Hits != f.desc
+		}
+	case "last_hit":
+		ti, tj := lastHitTime(ci), lastHitTime(cj)
+		if !ti.Equal(tj) {
+			return ti.Before(tj) != f.desc
+		}
+	default:
+		if ci.Name != cj.Name {
+			return ci.Name < cj.Name != f.desc
+		}
+	}
+	return ci.Name < cj.Name
+}
+
+// lastHitTime returns the last hit of a country, zero when it has none.
+func lastHitTime(status countryStatus) time.Time {
+	if status.LastHit == nil {
+		return time.Time{}
+	}
+	return *status.LastHit
+}
+
+// handleAPICountries lists countries with hits, or every country on the map
+// when unvisited ones are asked for.
+func (a *App) handleAPICountries(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseCountryFilter(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	target, _ := a.gameState.GetTargetCountry()
+	states := a.gameState.GetCountries()
+	names := make(map[string]bool, len(states))
+	for name := range states {
+		names[name] = true
+	}
+	if filter.states[resources.CountryUnvisited] && a.naturalEarth != nil {
+		for _, country := range a.naturalEarth.Countries {
+			names[country.Name] = true
+		}
+	}
+
+	list := countryList{Countries: []countryStatus{}}
+	for name := range names {
+		if status := newCountryStatus(name, states[name], target); filter.match(status) {
+			list.Countries = append(list.Countries, status)
+		}
+	}
+	sort.Slice(list.Countries, func(i, j int) bool {
+		return filter.less(list.Countries[i], list.Countries[j])
+	})
+
+	list.Total = len(list.Countries)
+	if filter.offset >= len(list.Countries) {
+		list.Countries = []countryStatus{}
+	} else {
+		list.Countries = list.Countries[filter.offset:]
+	}
+	if filter.limit > 0 && filter.limit < len(list.Countries) {
+		list.Countries = list.Countries[:filter.limit]
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// defaultDetailDays and maxDetailDays bound the daily hit series.
+const (
+	defaultDetailDays = 30
+	maxDetailDays     = 366
+)
+
+// topDetailEntries is the number of cities and endpoints in a country detail.
+const topDetailEntries = 10
+
+// countryDetail is returned by /api/v1/countries/{country}. The history
+// fields are empty when the journal is unavailable.
+type countryDetail struct {
+	countryStatus
+	FirstVisit   *time.Time                  `json:"first_visit,omitempty"`
+	ImprisonedAt *time.Time                  `json:"imprisoned_at,omitempty"`
+	JournalHits  int                         `json:"journal_hits"` // hits recorded in the history journal
+	Daily        []dailyHits                 `json:"daily"`        // oldest day first, including days without hits
+	TopCities    []cityHits                  `json:"top_cities"`
+	TopEndpoints []endpointHits              `json:"top_endpoints"`
+	ASNs         []asnHits                   `json:"asns"`
+	Achievements []*achievements.Achievement `json:"achievements"` // achievements a visit counts towards
+	Fact         *factdb.Fact                `json:"fact,omitempty"`
+}
+
+// dailyHits is the hit count of one local calendar day.
+type dailyHits struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	Hits int    `json:"hits"`
+}
+
+// cityHits is a city and its hit count.
+type cityHits struct {
+	City string `json:"city"`
+	Hits int    `json:"hits"`
+}
+
+// endpointHits summarises the connections to one remote IP.
+type endpointHits struct {
+	IP        string    `json:"ip"`
+	Hostname  string    `json:"hostname,omitempty"` // reverse DNS name when it was resolved this session
+	Ports     []string  `json:"ports"`
+	Protocols []string  `json:"protocols"`
+	Hits      int       `json:"hits"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// asnHits is an autonomous system and its hit count.
+type asnHits struct {
+	ASN  uint   `json:"asn"`
+	Org  string `json:"org,omitempty"`
+	Hits int    `json:"hits"`
+}
+
+func (a *App) handleAPICountry(w http.ResponseWriter, r *http.Request) {
+	name, ok := a.resolveCountry(r.PathValue("country"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Unknown country %q", r.PathValue("country"))
+		return
+	}
+	days := defaultDetailDays
+	if param := r.URL.Query().Get("days"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxDetailDays {
+			writeAPIError(w, http.StatusBadRequest, "days must be between 1 and %d", maxDetailDays)
+			return
+		}
+		days = n
+	}
+
+	target, _ := a.gameState.GetTargetCountry()
+	detail := countryDetail{
+		countryStatus: newCountryStatus(name, a.gameState.GetCountryState(name), target),
+		Daily:         []dailyHits{},
+		TopCities:     []cityHits{},
+		TopEndpoints:  []endpointHits{},
+		ASNs:          []asnHits{},
+		Achievements:  []*achievements.Achievement{},
+	}
+	if a.achievements != nil {
+		detail.Achievements = append(detail.Achievements, a.achievements.GetCountryAchievements(name)...)
+	}
+	if a.factDB != nil {
+		if fact := a.factDB.GetCountryFact(name); !fact.IsZero() {
+			detail.Fact = &fact
+		}
+	}
+
+	var summary *history.CountrySummary
+	if a.history != nil {
+		var err error
+		if summary, err = history.SummarizeCountry(a.history, name); err != nil {
+			slog.Warn("Failed to read history journal", "country", name, "error", err)
+			summary = nil
+		}
+	}
+	if summary != nil {
+		a.addHistoryDetail(&detail, summary, days)
+	} else {
+		detail.Daily = dailySeries(nil, days, time.Now())
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// addHistoryDetail fills the journal-based fields of a country detail.
+func (a *App) addHistoryDetail(detail *countryDetail, s *history.CountrySummary, days int) {
+	if !s.FirstVisit.IsZero() {
+		firstVisit := s.FirstVisit
+		detail.FirstVisit = &firstVisit
+	}
+	if !s.Imprisoned.IsZero() {
+		imprisoned := s.Imprisoned
+		detail.ImprisonedAt = &imprisoned
+	}
+	detail.JournalHits = s.Hits
+	detail.Daily = dailySeries(s.Daily, days, time.Now())
+
+	for city, hits := range s.Cities {
+		if city != "" {
+			detail.TopCities = append(detail.TopCities, cityHits{City: city, Hits: hits})
+		}
+	}
+	sort.Slice(detail.TopCities, func(i, j int) bool {
+		ci, cj := detail.TopCities[i], detail.TopCities[j]
+		if ci.Hits != cj.Hits {
+			return ci.Hits > cj.Hits
+		}
+		return ci.City < cj.City
+	})
+	if len(detail.TopCities) > topDetailEntries {
+		detail.TopCities = detail.TopCities[:topDetailEntries]
+	}
+
+	for _, e := range s.Endpoints {
+		detail.TopEndpoints = append(detail.TopEndpoints, endpointHits{
+			IP:        e.IP,
+			Hostname:  a.hostnames.get(e.IP),
+			Ports:     keysByCount(e.Ports),
+			Protocols: keysByCount(e.Protocols),
+			Hits:      e.Hits,
+			LastSeen:  e.LastSeen,
+		})
+	}
+	sort.Slice(detail.TopEndpoints, func(i, j int) bool {
+		ei, ej := detail.TopEndpoints[i], detail.TopEndpoints[j]
+		if ei.Hits != ej.Hits {
+			return ei.Hits > ej.Hits
+		}
+		return ei.IP < ej.IP
+	})
+	if len(detail.TopEndpoints) > topDetailEntries {
+		detail.TopEndpoints = detail.TopEndpoints[:topDetailEntries]
+	}
+
+	for _, as := range s.ASNs {
+		detail.ASNs = append(detail.ASNs, asnHits{ASN: as.Number, Org: as.Org, Hits: as.Hits})
+	}
+	sort.Slice(detail.ASNs, func(i, j int) bool {
+		ai, aj := detail.ASNs[i], detail.ASNs[j]
+		if ai.Hits != aj.Hits {
+			return ai.Hits > aj.Hits
+		}
+		return ai.ASN < aj.ASN
+	})
+}
+
+// dailySeries returns the hits of the last days local calendar days up to
+// and including now, oldest first.
+func dailySeries(daily map[string]int, days int, now time.Time) []dailyHits {
+	series := make([]dailyHits, days)
+	now = now.Local()
+	for i := range series {
+		date := now.AddDate(0, 0, i-days+1).Format(history.DayFormat)
+		series[i] = dailyHits{Date: date, Hits: daily[date]}
+	}
+	return series
+}
+
+// keysByCount returns the keys of a counter, most frequent first.
+func keysByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
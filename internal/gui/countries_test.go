@@ -0,0 +1,119 @@
+package gui
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iptw/internal/history"
+	"iptw/internal/resources"
+)
+
+func TestAPICountryFilters(t *testing.T) {
+	a := newTestApp(t)
+	for i := 0; i < 3; i++ {
+		a.gameState.AddCountryHit("France")
+	}
+	a.gameState.AddCountryHit("Germany")
+	a.gameState.AddCountryHit("Kenya")
+	a.gameState.ImprisonCountry("Kenya")
+
+	tests := []struct {
+		query string
+		total int
+		names []string
+	}{
+		{"", 3, []string{"France", "Germany", "Kenya"}},
+		{"?sort=name&order=desc", 3, []string{"Kenya", "Germany", "France"}},
+		{"?state=prison", 1, []string{"Kenya"}},
+		{"?region=europe", 2, []string{"France", "Germany"}},
+		{"?region=sub-saharan%20africa", 1, []string{"Kenya"}},
+		{"?q=man", 1, []string{"Germany"}},
+		{"?sort=hits&order=asc&limit=1&offset=1", 3, []string{"Kenya"}},
+		{"?offset=5", 3, nil},
+	}
+	for _, tt := range tests {
+		var list countryList
+		decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/countries"+tt.query, "", nil), http.StatusOK, &list)
+		var names []string
+		for _, c := range list.Countries {
+			names = append(names, c.Name)
+		}
+		if list.Total != tt.total || len(names) != len(tt.names) {
+			t.Errorf("%q: expected %d of %v, got %d of %v", tt.query, tt.total, tt.names, list.Total, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.names[i] {
+				t.Errorf("%q: expected %v, got %v", tt.query, tt.names, names)
+				break
+			}
+		}
+	}
+
+	// Unvisited countries come from the map
+	var list countryList
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/countries?state=unvisited&q=peru", "", nil), http.StatusOK, &list)
+	if list.Total != 1 || list.Countries[0].Name != "Peru" || list.Countries[0].Region != "Americas" {
+		t.Errorf("expected unvisited Peru, got %+v", list.Countries)
+	}
+
+	for _, query := range []string{"?state=lost", "?sort=size", "?order=up", "?limit=-1", "?offset=x"} {
+		expectAPIError(t, serveAPI(t, a, http.MethodGet, "/api/v1/countries"+query, "", nil), http.StatusBadRequest, "bad_request")
+	}
+}
+
+func TestAPICountryDetail(t *testing.T) {
+	a := newTestApp(t)
+	journal, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = journal.Close() }()
+	a.history = journal
+
+	now := time.Now()
+	for _, e := range []history.Event{
+		{Time: now.AddDate(0, 0, -2), Type: history.EventVisit, Country: "Japan"},
+		{Time: now.AddDate(0, 0, -2), Type: history.EventHit, Country: "Japan", City: "Tokyo", RemoteIP: "192.0.2.1", RemotePort: "443", Protocol: "tcp", ASN: 64500, ASOrg: "Example Net"},
+		{Time: now, Type: history.EventHit, Country: "Japan", City: "Tokyo", RemoteIP: "192.0.2.1", RemotePort: "443", Protocol: "tcp", ASN: 64500},
+		{Time: now, Type: history.EventHit, Country: "Japan", City: "Osaka", RemoteIP: "192.0.2.2", RemotePort: "80", Protocol: "tcp"},
+	} {
+		if err := journal.Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	a.gameState.AddCountryHit("Japan")
+	a.hostnames.add("192.0.2.1", "edge.example.net")
+
+	var detail countryDetail
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/countries/JP?days=7", "", nil), http.StatusOK, &detail)
+	if detail.Name != "Japan" || detail.ISOA3 != "JPN" || detail.Region != "Asia" || detail.SubRegion != "Eastern Asia" || detail.State != resources.CountryVisited {
+		t.Errorf("unexpected status %+v", detail.countryStatus)
+	}
+	if detail.FirstVisit == nil || detail.JournalHits != 3 || detail.ImprisonedAt != nil {
+		t.Errorf("unexpected history %v %d %v", detail.FirstVisit, detail.JournalHits, detail.ImprisonedAt)
+	}
+	if len(detail.Daily) != 7 || detail.Daily[6].Hits != 2 || detail.Daily[4].Hits != 1 || detail.Daily[5].Hits != 0 {
+		t.Errorf("unexpected daily series %+v", detail.Daily)
+	}
+	if len(detail.TopCities) != 2 || detail.TopCities[0] != (cityHits{City: "Tokyo", Hits: 2}) {
+		t.Errorf("unexpected cities %+v", detail.TopCities)
+	}
+	if len(detail.TopEndpoints) != 2 || detail.TopEndpoints[0].Hostname != "edge.example.net" || detail.TopEndpoints[0].Ports[0] != "443" {
+		t.Errorf("unexpected endpoints %+v", detail.TopEndpoints)
+	}
+	if len(detail.ASNs) != 1 || detail.ASNs[0] != (asnHits{ASN: 64500, Org: "Example Net", Hits: 2}) {
+		t.Errorf("unexpected ASNs %+v", detail.ASNs)
+	}
+	found := false
+	for _, ach := range detail.Achievements {
+		found = found || ach.ID == "asia_adventurer"
+	}
+	if !found || detail.Fact == nil {
+		t.Errorf("expected the Asian Adventurer achievement and a fact, got %d achievements and %v", len(detail.Achievements), detail.Fact)
+	}
+
+	expectAPIError(t, serveAPI(t, a, http.MethodGet, "/api/v1/countries/JP?days=0", "", nil), http.StatusBadRequest, "bad_request")
+}
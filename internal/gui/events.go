@@ -0,0 +1,51 @@
+package gui
+
+import (
+	"iptw/internal/events"
+	"iptw/internal/factdb"
+	"iptw/internal/resources"
+)
+
+// publishCountryState announces the current state of a country after it was
+// visited for the first time, imprisoned or liberated.
+func (a *App) publishCountryState(country string) {
+	state := a.gameState.GetCountryState(country)
+	if state == nil {
+		return
+	}
+	a.events.Publish(events.TypeCountry, events.CountryChange{
+		Country: country,
+		State:   resources.CountryState(state.HitCount, state.MatrixPrison, state.Liberated),
+		Hits:    state.HitCount,
+	})
+}
+
+// publishTarget announces a new target country; an empty country means the
+// target was cleared.
+func (a *App) publishTarget(country, previous string) {
+	a.events.Publish(events.TypeTarget, events.TargetChange{Country: country, Previous: previous})
+}
+
+// publishAchievements announces newly unlocked achievements.
+func (a *App) publishAchievements(ids ...string) {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		e := events.Achievement{ID: id, Name: id}
+		if achievement := a.achievements.GetAchievement(id); achievement != nil {
+			e.Name, e.Description = achievement.Name, achievement.Description
+		}
+		a.events.Publish(events.TypeAchievement, e)
+	}
+}
+
+// publishFact announces a "Did you know?" fact about a newly discovered place.
+func (a *App) publishFact(country, city string, fact factdb.Fact) {
+	a.events.Publish(events.TypeFact, events.Fact{Country: country, City: city, Level: fact.Level, Place: fact.Place, Text: fact.Text})
+}
+
+// publishConfig announces a setting changed at runtime.
+func (a *App) publishConfig(key, value string) {
+	a.events.Publish(events.TypeConfig, events.ConfigChange{Key: key, Value: value})
+}
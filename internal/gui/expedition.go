@@ -0,0 +1,357 @@
+package gui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand"
+	"net/http"
+	"slices"
+	"time"
+
+	"iptw/internal/config"
+	"iptw/internal/events"
+	"iptw/internal/factdb"
+	"iptw/internal/history"
+)
+
+// Errors returned when an expedition cannot be started or abandoned.
+var (
+	errExpeditionRunning = errors.New("an expedition is already running")
+	errNoExpedition      = errors.New("no expedition is running")
+	errNoCandidates      = errors.New("no unvisited countries left")
+)
+
+// expedition is a set of target countries to reach before a deadline. A
+// country is reached by its first hit, or by being sent to Matrix Prison.
+type expedition struct {
+	id        string
+	countries []string             // targets in the order they were drawn
+	reached   map[string]time.Time // when each reached target was reached
+	hints     map[string]factdb.Fact
+	started   time.Time
+	deadline  time.Time
+	ended     time.Time
+	outcome   string // empty while running, then a history.Expedition* outcome
+}
+
+// running reports whether the expedition is still under way.
+func (e *expedition) running() bool {
+	return e != nil && e.outcome == ""
+}
+
+// reachedCountries returns the reached targets in the order they were drawn.
+func (e *expedition) reachedCountries() []string {
+	reached := []string{}
+	for _, country := range e.countries {
+		if _, ok := e.reached[country]; ok {
+			reached = append(reached, country)
+		}
+	}
+	return reached
+}
+
+// StartExpedition draws size unvisited countries from the target pool, in
+// the target_mode fashion, to be reached within duration. Fewer countries are
+// drawn when the pool runs short.
+func (a *App) StartExpedition(size int, duration time.Duration) (expeditionStatus, error) {
+	a.expeditionMu.Lock()
+	defer a.expeditionMu.Unlock()
+	if a.expedition.running() {
+		return expeditionStatus{}, errExpeditionRunning
+	}
+
+	var candidates []string
+	if a.naturalEarth != nil {
+		target, _ := a.gameState.GetTargetCountry()
+		candidates = slices.DeleteFunc(a.targetCandidates(), func(country string) bool { return country == target })
+	}
+	if len(candidates) == 0 {
+		return expeditionStatus{}, errNoCandidates
+	}
+
+	rng := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
+	var countries []string
+	for len(countries) < size && len(candidates) > 0 {
+		country := a.drawTarget(rng, candidates)
+		countries = append(countries, country)
+		candidates = slices.DeleteFunc(candidates, func(c string) bool { return c == country })
+	}
+
+	now := time.Now()
+	e := &expedition{
+		id:        now.UTC().Format("20060102-150405"),
+		countries: countries,
+		reached:   make(map[string]time.Time),
+		hints:     make(map[string]factdb.Fact),
+		started:   now,
+		deadline:  now.Add(duration),
+	}
+	if a.factDB != nil {
+		for _, country := range countries {
+			e.hints[country] = a.factDB.GetCountryFact(country)
+		}
+	}
+	a.expedition = e
+
+	deadline := e.deadline
+	a.recordEvent(history.Event{Type: history.EventExpedition, Expedition: e.id, Countries: countries, Deadline: &deadline, Outcome: history.ExpeditionStarted})
+	a.publishExpedition(e, history.ExpeditionStarted, "")
+	slog.Info("🧭 Expedition started", "countries", countries, "deadline", e.deadline.Format(time.RFC3339))
+	a.markMapDirty()
+	return e.status(now), nil
+}
+
+// AbandonExpedition gives up the running expedition.
+func (a *App) AbandonExpedition() (expeditionStatus, error) {
+	a.expeditionMu.Lock()
+	defer a.expeditionMu.Unlock()
+	if !a.expedition.running() {
+		return expeditionStatus{}, errNoExpedition
+	}
+	now := time.Now()
+	a.endExpedition(history.ExpeditionAbandoned, now)
+	return a.expedition.status(now), nil
+}
+
+// reachExpeditionCountry marks a country as reached when it is an
+// outstanding target of the running expedition, completing the expedition
+// once every target is reached.
+func (a *App) reachExpeditionCountry(country string) {
+	a.expeditionMu.Lock()
+	defer a.expeditionMu.Unlock()
+	e := a.expedition
+	if !e.running() || !slices.Contains(e.countries, country) {
+		return
+	}
+	if _, ok := e.reached[country]; ok {
+		return
+	}
+	now := time.Now()
+	if !now.Before(e.deadline) {
+		a.endExpedition(history.ExpeditionFailed, now)
+		return
+	}
+
+	e.reached[country] = now
+	a.recordEvent(history.Event{Type: history.EventExpedition, Expedition: e.id, Country: country, Outcome: history.ExpeditionReached})
+	a.publishExpedition(e, history.ExpeditionReached, country)
+	slog.Info("🧭 Expedition country reached", "country", country, "reached", len(e.reached), "of", len(e.countries))
+	a.markMapDirty()
+	if len(e.reached) == len(e.countries) {
+		a.endExpedition(history.ExpeditionSucceeded, now)
+	}
+}
+
+// checkExpeditionDeadline fails the running expedition once its deadline has
+// passed.
+func (a *App) checkExpeditionDeadline(now time.Time) {
+	a.expeditionMu.Lock()
+	defer a.expeditionMu.Unlock()
+	if a.expedition.running() && !now.Before(a.expedition.deadline) {
+		a.endExpedition(history.ExpeditionFailed, now)
+	}
+}
+
+// endExpedition records the outcome of the running expedition and awards the
+// expedition achievements on success. The caller holds expeditionMu.
+func (a *App) endExpedition(outcome string, now time.Time) {
+	e := a.expedition
+	e.outcome, e.ended = outcome, now
+	a.recordEvent(history.Event{Type: history.EventExpedition, Expedition: e.id, Outcome: outcome})
+	a.publishExpedition(e, outcome, "")
+	slog.Info("🧭 Expedition over", "outcome", outcome, "reached", len(e.reached), "of", len(e.countries))
+	a.markMapDirty()
+	if outcome == history.ExpeditionSucceeded {
+		a.publishAchievements(a.achievements.RecordExpedition(len(e.countries))...)
+	}
+}
+
+// expeditionTargets returns the outstanding targets of the running
+// expedition.
+func (a *App) expeditionTargets() map[string]bool {
+	a.expeditionMu.Lock()
+	defer a.expeditionMu.Unlock()
+	targets := make(map[string]bool)
+	if e := a.expedition; e.running() {
+		for _, country := range e.countries {
+			if _, ok := e.reached[country]; !ok {
+				targets[country] = true
+			}
+		}
+	}
+	return targets
+}
+
+// expeditionHints returns the research challenge facts of the outstanding
+// targets of the running expedition, in the order they were drawn.
+func (a *App) expeditionHints() []targetHint {
+	a.expeditionMu.Lock()
+	defer a.expeditionMu.Unlock()
+	var hints []targetHint
+	if e := a.expedition; e.running() {
+		for _, country := range e.countries {
+			if _, ok := e.reached[country]; !ok && !e.hints[country].IsZero() {
+				hints = append(hints, targetHint{Target: country, Fact: e.hints[country], Expedition: true})
+			}
+		}
+	}
+	return hints
+}
+
+// expeditionLine summarizes the running expedition for the game status
+// rectangle, or returns "" when there is none.
+func (a *App) expeditionLine() string {
+	a.expeditionMu.Lock()
+	defer a.expeditionMu.Unlock()
+	e := a.expedition
+	if !e.running() {
+		return ""
+	}
+	left := time.Until(e.deadline).Round(time.Minute)
+	return fmt.Sprintf("Expedition: %d/%d, %s left", len(e.reached), len(e.countries), formatRemaining(left))
+}
+
+// formatRemaining formats the time left on an expedition as hours and
+// minutes.
+func formatRemaining(d time.Duration) string {
+	d = max(d, 0)
+	if d >= time.Hour {
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
+
+// publishExpedition announces a change of an expedition.
+func (a *App) publishExpedition(e *expedition, outcome, country string) {
+	a.events.Publish(events.TypeExpedition, events.ExpeditionChange{
+		ID:        e.id,
+		Outcome:   outcome,
+		Country:   country,
+		Countries: e.countries,
+		Reached:   e.reachedCountries(),
+		Deadline:  e.deadline,
+	})
+}
+
+// expeditionTarget is one country of an expedition. Hint is its research
+// challenge fact while it has not been reached.
+type expeditionTarget struct {
+	Country string       `json:"country"`
+	Reached *time.Time   `json:"reached,omitempty"`
+	Hint    *factdb.Fact `json:"hint,omitempty"`
+}
+
+// expeditionStatus describes the running or the last expedition. ID is empty
+// when no expedition has been started since launch.
+type expeditionStatus struct {
+	ID               string             `json:"id,omitempty"`
+	Active           bool               `json:"active"`
+	Outcome          string             `json:"outcome,omitempty"` // succeeded, failed or abandoned once over
+	Started          *time.Time         `json:"started,omitempty"`
+	Deadline         *time.Time         `json:"deadline,omitempty"`
+	Ended            *time.Time         `json:"ended,omitempty"`
+	RemainingSeconds int64              `json:"remaining_seconds,omitempty"` // while active
+	Reached          int                `json:"reached"`
+	Targets          []expeditionTarget `json:"targets"`
+}
+
+// status describes the expedition at now; e may be nil.
+func (e *expedition) status(now time.Time) expeditionStatus {
+	status := expeditionStatus{Targets: []expeditionTarget{}}
+	if e == nil {
+		return status
+	}
+	started, deadline := e.started, e.deadline
+	status.ID, status.Active, status.Outcome = e.id, e.running(), e.outcome
+	status.Started, status.Deadline = &started, &deadline
+	status.Reached = len(e.reached)
+	if status.Active {
+		status.RemainingSeconds = int64(max(deadline.Sub(now), 0) / time.Second)
+	} else {
+		ended := e.ended
+		status.Ended = &ended
+	}
+	for _, country := range e.countries {
+		target := expeditionTarget{Country: country}
+		if at, ok := e.reached[country]; ok {
+			target.Reached = &at
+		} else if hint := e.hints[country]; !hint.IsZero() && status.Active {
+			target.Hint = &hint
+		}
+		status.Targets = append(status.Targets, target)
+	}
+	return status
+}
+
+// currentExpedition describes the running or the last expedition.
+func (a *App) currentExpedition() expeditionStatus {
+	a.expeditionMu.Lock()
+	defer a.expeditionMu.Unlock()
+	return a.expedition.status(time.Now())
+}
+
+// expeditionDefaults returns the size and duration of new expeditions from
+// the expedition_size and expedition_duration settings.
+func (a *App) expeditionDefaults() (int, time.Duration) {
+	a.configMu.RLock()
+	size, window := a.config.ExpeditionSize, a.config.ExpeditionDuration
+	a.configMu.RUnlock()
+	duration, err := config.ParseWindow(window)
+	if err != nil || duration == 0 {
+		duration = 24 * time.Hour
+	}
+	return size, duration
+}
+
+// expeditionRequest is the body of requests starting an expedition. Omitted
+// fields default to the expedition_size and expedition_duration settings.
+type expeditionRequest struct {
+	Size     int    `json:"size,omitempty"`
+	Duration string `json:"duration,omitempty"` // e.g. 24h or 3d
+}
+
+func (a *App) handleAPIExpedition(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.currentExpedition())
+}
+
+func (a *App) handleAPIStartExpedition(w http.ResponseWriter, r *http.Request) {
+	var req expeditionRequest
+	if err := decodeJSONBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	size, duration := a.expeditionDefaults()
+	if req.Size != 0 {
+		size = req.Size
+	}
+	if size < 1 || size > config.MaxExpeditionSize {
+		writeAPIError(w, http.StatusBadRequest, "The size must be between 1 and %d", config.MaxExpeditionSize)
+		return
+	}
+	if req.Duration != "" {
+		d, err := config.ParseWindow(req.Duration)
+		if err != nil || d == 0 {
+			writeAPIError(w, http.StatusBadRequest, "Invalid duration %q: expected a duration such as 24h or 7d", req.Duration)
+			return
+		}
+		duration = d
+	}
+
+	status, err := a.StartExpedition(size, duration)
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, "Cannot start an expedition: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (a *App) handleAPIAbandonExpedition(w http.ResponseWriter, r *http.Request) {
+	status, err := a.AbandonExpedition()
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, "Cannot abandon the expedition: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,119 @@
+package gui
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"iptw/internal/events"
+	"iptw/internal/history"
+)
+
+func TestExpedition(t *testing.T) {
+	a := newTestApp(t)
+	token := map[string]string{"X-Session-Token": "secret"}
+	a.SetTargetCountry("Peru")
+
+	var status expeditionStatus
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/expedition", "", nil), http.StatusOK, &status)
+	if status.ID != "" || status.Active || len(status.Targets) != 0 {
+		t.Fatalf("expected no expedition yet, got %+v", status)
+	}
+	expectAPIError(t, serveAPI(t, a, http.MethodDelete, "/api/v1/expedition", "", token), http.StatusConflict, "conflict")
+	expectAPIError(t, serveAPI(t, a, http.MethodPost, "/api/v1/expedition", `{"size": 50}`, token), http.StatusBadRequest, "bad_request")
+	expectAPIError(t, serveAPI(t, a, http.MethodPost, "/api/v1/expedition", `{"duration": "all"}`, token), http.StatusBadRequest, "bad_request")
+	expectAPIError(t, serveAPI(t, a, http.MethodPost, "/api/v1/expedition", "", nil), http.StatusForbidden, "forbidden")
+
+	decodeResponse(t, serveAPI(t, a, http.MethodPost, "/api/v1/expedition", `{"duration": "2h"}`, token), http.StatusOK, &status)
+	if !status.Active || len(status.Targets) != 3 || status.RemainingSeconds < 7190 {
+		t.Fatalf("expected a running expedition to 3 countries, got %+v", status)
+	}
+	expectAPIError(t, serveAPI(t, a, http.MethodPost, "/api/v1/expedition", "", token), http.StatusConflict, "conflict")
+
+	// Every outstanding country is a target on the map with its own hint
+	var countries, hinted []string
+	for _, target := range status.Targets {
+		countries = append(countries, target.Country)
+		if target.Country == "Peru" {
+			t.Errorf("expected the target to be left out of the expedition, got %v", status.Targets)
+		}
+		if target.Hint != nil {
+			hinted = append(hinted, target.Country)
+		}
+	}
+	if targets := a.snapshotMapState().targetCountries; len(targets) != 4 || !targets["Peru"] || !targets[countries[0]] {
+		t.Errorf("expected Peru and the expedition as targets, got %v", targets)
+	}
+	hints := a.challengeHints()
+	if len(hints) != 1+len(hinted) || hints[0].Target != "Peru" || hints[0].Expedition {
+		t.Fatalf("expected the target's hint followed by the expedition's, got %+v", hints)
+	}
+	for i, country := range hinted {
+		if hints[i+1].Target != country || !hints[i+1].Expedition {
+			t.Errorf("expected the hint for %s, got %+v", country, hints[i+1])
+		}
+	}
+
+	a.reachExpeditionCountry(countries[0])
+	a.reachExpeditionCountry("Peru")
+	status = expeditionStatus{}
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/expedition", "", nil), http.StatusOK, &status)
+	if status.Reached != 1 || status.Targets[0].Reached == nil || status.Targets[0].Hint != nil || status.Targets[1].Reached != nil {
+		t.Errorf("expected the first country reached, got %+v", status)
+	}
+	if targets := a.expeditionTargets(); len(targets) != 2 || targets[countries[0]] {
+		t.Errorf("expected 2 outstanding countries, got %v", targets)
+	}
+
+	// Reaching the rest completes the expedition
+	_, changes, cancel := a.events.Subscribe(0)
+	defer cancel()
+	a.imprisonCountry(countries[1])
+	a.reachExpeditionCountry(countries[2])
+	status = expeditionStatus{}
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/expedition", "", nil), http.StatusOK, &status)
+	if status.Active || status.Outcome != history.ExpeditionSucceeded || status.Reached != 3 {
+		t.Errorf("expected a completed expedition, got %+v", status)
+	}
+	if !a.achievements.GetAchievement("expedition_leader").Unlocked {
+		t.Error("expected the expedition achievement to be unlocked")
+	}
+	var outcomes []string
+	for len(changes) > 0 {
+		var change events.ExpeditionChange
+		if e := <-changes; e.Type == events.TypeExpedition && e.Decode(&change) == nil {
+			outcomes = append(outcomes, change.Outcome)
+		}
+	}
+	if !slices.Equal(outcomes, []string{history.ExpeditionReached, history.ExpeditionReached, history.ExpeditionSucceeded}) {
+		t.Errorf("expected two reached events and success, got %v", outcomes)
+	}
+}
+
+func TestExpeditionDeadline(t *testing.T) {
+	a := newTestApp(t)
+	token := map[string]string{"X-Session-Token": "secret"}
+
+	status, err := a.StartExpedition(2, time.Hour)
+	if err != nil {
+		t.Fatalf("StartExpedition failed: %v", err)
+	}
+	a.checkExpeditionDeadline(time.Now())
+	a.checkExpeditionDeadline(time.Now().Add(2 * time.Hour))
+	if status = a.currentExpedition(); status.Outcome != history.ExpeditionFailed || len(a.expeditionTargets()) != 0 || len(a.expeditionHints()) != 0 {
+		t.Errorf("expected a failed expedition without targets, got %+v", status)
+	}
+	if a.achievements.GetAchievement("expedition_leader").Unlocked {
+		t.Error("expected no achievement for a failed expedition")
+	}
+
+	// A new expedition can start once the last one is over, and be abandoned
+	if _, err := a.StartExpedition(1, time.Hour); err != nil {
+		t.Fatalf("StartExpedition failed: %v", err)
+	}
+	decodeResponse(t, serveAPI(t, a, http.MethodDelete, "/api/v1/expedition", "", token), http.StatusOK, &status)
+	if status.Active || status.Outcome != history.ExpeditionAbandoned || len(status.Targets) != 1 {
+		t.Errorf("expected an abandoned expedition, got %+v", status)
+	}
+}
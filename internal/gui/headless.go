@@ -0,0 +1,90 @@
+package gui
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"iptw/internal/config"
+)
+
+// RunHeadless runs the engine without the tray until SIGINT, SIGTERM or a quit
+// request on the control socket, for
+// servers and containers without a desktop session. The map is still written
+// to the output directory and served over HTTP, but the OS wallpaper is left
+// alone. SIGHUP reloads the config file. The caller calls Shutdown.
+func (a *App) RunHeadless() error {
+	a.headless = true
+	a.Start()
+	if sig := a.waitForSignals(); sig != nil {
+		slog.Info("Received signal, shutting down", "signal", sig.String())
+	} else {
+		slog.Info("Quit requested, shutting down")
+	}
+	return nil
+}
+
+// waitForSignals reloads the config on SIGHUP and returns the first SIGINT or
+// SIGTERM received, or nil once RequestQuit is called.
+func (a *App) waitForSignals() os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				return sig
+			}
+			if err := a.Reload(); err != nil {
+				slog.Error("Failed to reload config", "error", err)
+			}
+		case <-a.quit:
+			return nil
+		}
+	}
+}
+
+// Reload re-reads the config file and applies the settings that can change
+// while running, as the config API does. Settings that need a restart keep
+// their current values until then. The theme is always re-read so edits to a
+// user theme file show up.
+func (a *App) Reload() error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	a.configMu.RLock()
+	current := a.config.Values()
+	a.configMu.RUnlock()
+
+	patch := configPatch{"theme": cfg.Theme}
+	var changed, pending []string
+	for key, value := range cfg.Values() {
+		if value == current[key] {
+			continue
+		}
+		if config.NeedsRestart(key) {
+			pending = append(pending, key)
+			continue
+		}
+		patch[key] = value
+		changed = append(changed, key)
+	}
+	sort.Strings(changed)
+	sort.Strings(pending)
+	if _, err := a.applySettings(patch); err != nil {
+		return err
+	}
+
+	slog.Info("🔄 Config reloaded", "changed", changed)
+	if len(pending) > 0 {
+		slog.Warn("Some changed settings take effect after a restart", "settings", pending)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package gui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	a := newTestApp(t)
+	path := filepath.Join(os.Getenv("HOME"), ".config", "iptw", "iptwrc")
+	edited := *a.config
+	edited.Legend = "top-left"
+	edited.Theme = "dark"
+	edited.UpdateInterval = 99
+	if err := edited.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if a.config.Legend != "top-left" || a.themeName != "dark" {
+		t.Errorf("expected the legend and theme to change, got %q %q", a.config.Legend, a.themeName)
+	}
+	// Settings that need a restart keep their value until then
+	if a.config.UpdateInterval == 99 {
+		t.Error("expected update_interval to wait for a restart")
+	}
+}
+
+func TestShutdownEndsEventStreams(t *testing.T) {
+	a := newTestApp(t)
+	_, ch, cancel := a.events.Subscribe(0)
+	defer cancel()
+
+	a.Shutdown()
+	a.Shutdown() // only the first call does anything
+	if !a.stopped() {
+		t.Error("expected Shutdown to stop the loops")
+	}
+	if _, ok := <-ch; ok {
+		t.Error("expected Shutdown to close event streams")
+	}
+}
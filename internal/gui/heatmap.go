@@ -0,0 +1,215 @@
+package gui
+
+import (
+	"bytes"
+	"image/png"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"iptw/internal/config"
+	"iptw/internal/history"
+	"iptw/internal/logging"
+	"iptw/internal/resources"
+)
+
+// heatDetailWindow is how long hits are kept at full resolution. Older hits
+// are folded into heatBuckets so an all-time heatmap stays bounded in memory.
+const heatDetailWindow = 7 * 24 * time.Hour
+
+// heatBucketScale is the number of buckets per degree of latitude and
+// longitude (0.1° cells, roughly 11 km at the equator).
+const heatBucketScale = 10
+
+// heatSample is a compact in-memory copy of a journaled hit location.
+type heatSample struct {
+	at       int64 // Unix seconds
+	lat, lng float32
+}
+
+// heatBucket is one 0.1° cell on one UTC day.
+type heatBucket struct {
+	day      int32 // Days since the Unix epoch
+	lat, lng int16 // Cell index, in units of 1/heatBucketScale degrees
+}
+
+// heatCell is a heatBucket without its day, used to merge days when
+// building heat points.
+type heatCell struct {
+	lat, lng int16
+}
+
+// heatStore keeps journaled hit locations in memory so heatmaps for any
+// window can be rendered without re-reading the journal: hits of the last
+// heatDetailWindow as they are, older ones counted per cell and day. It also
+// counts the hits per country for weighted target draws.
+type heatStore struct {
+	mu        sync.RWMutex
+	samples   []heatSample         // in chronological order, within heatDetailWindow of the latest hit
+	buckets   map[heatBucket]int32 // older hits by day and cell
+	countries map[string]int       // journaled hits by country
+}
+
+func newHeatStore() *heatStore {
+	return &heatStore{buckets: make(map[heatBucket]int32), countries: make(map[string]int)}
+}
+
+// load replaces the hits with those of the journal.
+func (h *heatStore) load(journal *history.Journal) error {
+	h.mu.Lock()
+	h.samples, h.buckets, h.countries = nil, make(map[heatBucket]int32), make(map[string]int)
+	h.mu.Unlock()
+	return journal.Scan(time.Time{}, func(e history.Event) bool {
+		if e.Type == history.EventHit {
+			h.add(e.Time, e.Country, e.Lat, e.Lng)
+		}
+		return true
+	})
+}
+
+// add records a hit location and folds samples that fell out of
+// heatDetailWindow into their buckets.
+func (h *heatStore) add(at time.Time, country string, lat, lng float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples = append(h.samples, heatSample{at: at.Unix(), lat: float32(lat), lng: float32(lng)})
+	h.countries[country]++
+
+	cutoff := at.Add(-heatDetailWindow).Unix()
+	folded := 0
+	for folded < len(h.samples) && h.samples[folded].at < cutoff {
+		s := h.samples[folded]
+		h.buckets[heatBucket{
+			day: int32(s.at / 86400),
+			lat: int16(math.Floor(float64(s.lat) * heatBucketScale)),
+			lng: int16(math.Floor(float64(s.lng) * heatBucketScale)),
+		}]++
+		folded++
+	}
+	if folded > 0 {
+		h.samples = h.samples[folded:]
+	}
+}
+
+// countryHits returns the number of journaled hits in a country.
+func (h *heatStore) countryHits(country string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.countries[country]
+}
+
+// points returns the hit locations at or after since; a zero since returns all.
+// Bucketed hits are returned as one weighted point per cell at its centre and
+// count in full on any day that ends after since.
+func (h *heatStore) points(since time.Time) []resources.HeatPoint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	cutoff := int64(0)
+	if !since.IsZero() {
+		cutoff = since.Unix()
+	}
+	cells := make(map[heatCell]int)
+	for bucket, count := range h.buckets {
+		if (int64(bucket.day)+1)*86400 <= cutoff {
+			continue
+		}
+		cells[heatCell{lat: bucket.lat, lng: bucket.lng}] += int(count)
+	}
+
+	points := make([]resources.HeatPoint, 0, len(h.samples)+len(cells))
+	for cell, count := range cells {
+		points = append(points, resources.HeatPoint{
+			Lat:    (float64(cell.lat) + 0.5) / heatBucketScale,
+			Lng:    (float64(cell.lng) + 0.5) / heatBucketScale,
+			Weight: float64(count),
+		})
+	}
+	for _, s := range h.samples {
+		if s.at < cutoff {
+			continue
+		}
+		points = append(points, resources.HeatPoint{Lat: float64(s.lat), Lng: float64(s.lng), Weight: 1})
+	}
+	return points
+}
+
+// heatmapLayer builds the heatmap layer for hits within window of now (0 means
+// all time) using the configured radius and colormap.
+func (a *App) heatmapLayer(window time.Duration) *resources.Heatmap {
+	var since time.Time
+	if window > 0 {
+		since = time.Now().Add(-window)
+	}
+
+	a.configMu.RLock()
+	radius := a.config.HeatmapRadius
+	colormap := a.config.HeatmapColormap
+	a.configMu.RUnlock()
+
+	return &resources.Heatmap{
+		Points:   a.heat.points(since),
+		Radius:   radius,
+		Colormap: colormap,
+	}
+}
+
+// heatmapEnabled reports whether the heatmap is drawn on the live map.
+func (a *App) heatmapEnabled() bool {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config.Heatmap
+}
+
+// heatmapWindow parses the "window" query parameter, defaulting to
+// heatmap_window.
+func (a *App) heatmapWindow(r *http.Request) (time.Duration, error) {
+	windowParam := r.URL.Query().Get("window")
+	if windowParam == "" {
+		a.configMu.RLock()
+		windowParam = a.config.HeatmapWindow
+		a.configMu.RUnlock()
+	}
+	return config.ParseWindow(windowParam)
+}
+
+// serveHeatmapPNG renders the map with the heatmap layer for the window given
+// in the "window" query parameter (default heatmap_window) at the size of the
+// last live map.
+func (a *App) serveHeatmapPNG(w http.ResponseWriter, r *http.Request) {
+	window, err := a.heatmapWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mapPNGMu.RLock()
+	width, height := a.lastMapWidth, a.lastMapHeight
+	a.mapPNGMu.RUnlock()
+	if width == 0 || height == 0 {
+		http.Error(w, "Map not yet generated", http.StatusServiceUnavailable)
+		return
+	}
+
+	layers := resources.MapLayers{Ocean: true, Unvisited: true, Heat: a.heatmapLayer(window)}
+	img, err := a.renderMapImage(width, height, a.snapshotMapState(), nil, layers)
+	if err != nil {
+		logging.LogError("render heatmap", err)
+		http.Error(w, "Failed to render heatmap", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	encoder := &png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, img); err != nil {
+		http.Error(w, "Failed to encode heatmap", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		slog.Error("Failed to write heatmap PNG", "error", err)
+	}
+}
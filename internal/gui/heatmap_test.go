@@ -0,0 +1,50 @@
+package gui
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeatStoreFoldsOldHits(t *testing.T) {
+	h := newHeatStore()
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+	// A year of hourly hits around Frankfurt, then one fresh hit in Ashburn.
+	for at := now.AddDate(-1, 0, 0); at.Before(now); at = at.Add(time.Hour) {
+		h.add(at, "Germany", 50.11, 8.68)
+	}
+	h.add(now, "United States", 39.04, -77.49)
+
+	if got := len(h.samples); got > int(heatDetailWindow/time.Hour)+1 {
+		t.Errorf("expected at most %d samples at full resolution, got %d", int(heatDetailWindow/time.Hour)+1, got)
+	}
+	if got := len(h.buckets); got > 366 {
+		t.Errorf("expected one bucket per day for a single location, got %d", got)
+	}
+	if got := h.countryHits("Germany"); got != 365*24 {
+		t.Errorf("expected %d hits in Germany, got %d", 365*24, got)
+	}
+
+	total := 0.0
+	for _, p := range h.points(time.Time{}) {
+		total += p.Weight
+	}
+	if total != 365*24+1 {
+		t.Errorf("expected all-time points to weigh %d, got %v", 365*24+1, total)
+	}
+
+	recent := h.points(now.Add(-time.Hour))
+	if len(recent) != 2 {
+		t.Errorf("expected the last two hits within the hour, got %+v", recent)
+	}
+
+	month := 0.0
+	for _, p := range h.points(now.AddDate(0, 0, -30)) {
+		month += p.Weight
+		if p.Weight > 1 && (p.Lat < 50.1 || p.Lat > 50.2 || p.Lng < 8.6 || p.Lng > 8.7) {
+			t.Errorf("expected bucketed hits in the Frankfurt cell, got %+v", p)
+		}
+	}
+	if month < 30*24 || month > 31*24+1 {
+		t.Errorf("expected about 30 days of hits in the last month, got %v", month)
+	}
+}
@@ -0,0 +1,68 @@
+package gui
+
+import (
+	"log/slog"
+	"time"
+
+	"iptw/internal/events"
+	"iptw/internal/geoip"
+	"iptw/internal/history"
+	"iptw/internal/network"
+)
+
+// recordHit journals a newly observed connection, adds it to the heatmap and
+// the visited subdivisions and cities, and publishes it to the event stream.
+func (a *App) recordHit(conn network.Connection, location *geoip.Location, country string) {
+	now := time.Now()
+	a.heat.add(now, country, location.Latitude, location.Longitude)
+	if a.heatmapEnabled() {
+		a.markMapDirty()
+	}
+	subdivisionCode, subdivisionName := a.locateSubdivision(country, location)
+	a.recordEvent(history.Event{
+		Time:        now,
+		Type:        history.EventHit,
+		Country:     country,
+		City:        location.City,
+		Subdivision: subdivisionCode,
+		Lat:         location.Latitude,
+		Lng:         location.Longitude,
+		RemoteIP:    conn.RemoteIP,
+		RemotePort:  conn.RemotePort,
+		Protocol:    conn.Protocol,
+		ASN:         location.ASN,
+		ASOrg:       location.ASOrg,
+	})
+	a.visitPlace(country, location.City, subdivisionCode, subdivisionName)
+	a.metrics.countryHits.Inc(country)
+	a.metrics.protocolHits.Inc(conn.Protocol)
+	a.events.Publish(events.TypeHit, events.Hit{
+		Country:     country,
+		City:        location.City,
+		Subdivision: subdivisionCode,
+		Lat:         location.Latitude,
+		Lng:         location.Longitude,
+		IP:          conn.RemoteIP,
+		Port:        conn.RemotePort,
+		Protocol:    conn.Protocol,
+		ASN:         location.ASN,
+	})
+}
+
+// recordEvent appends an event to the history journal, if one is open, and
+// counts hits and first visits towards the challenges.
+func (a *App) recordEvent(e history.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Type == history.EventHit || e.Type == history.EventVisit {
+		a.observeChallenges(&e)
+	}
+	a.observeScore(e)
+	if a.history == nil {
+		return
+	}
+	if err := a.history.Append(e); err != nil {
+		slog.Warn("Failed to record event in history journal", "type", e.Type, "error", err)
+	}
+}
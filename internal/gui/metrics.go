@@ -0,0 +1,103 @@
+package gui
+
+import (
+	"time"
+
+	"iptw/internal/metrics"
+	"iptw/internal/resources"
+)
+
+// appMetrics are the instruments served at /metrics. Game state and GeoIP
+// figures are collected when scraped.
+type appMetrics struct {
+	registry       *metrics.Registry
+	countryHits    *metrics.Counter
+	protocolHits   *metrics.Counter
+	refreshSeconds *metrics.Histogram
+	refreshErrors  *metrics.Counter
+	renderSeconds  *metrics.Histogram
+	encodeSeconds  *metrics.Histogram
+}
+
+// newAppMetrics registers the metrics of an app.
+func newAppMetrics(a *App) *appMetrics {
+	r := metrics.NewRegistry()
+	m := &appMetrics{
+		registry:       r,
+		countryHits:    r.NewCounter("iptw_country_hits_total", "New connections by destination country.", "country"),
+		protocolHits:   r.NewCounter("iptw_protocol_hits_total", "New connections by protocol.", "protocol"),
+		refreshSeconds: r.NewHistogram("iptw_connection_refresh_duration_seconds", "Time taken to list the open connections.", metrics.DefaultBuckets),
+		refreshErrors:  r.NewCounter("iptw_connection_refresh_errors_total", "Failed attempts to list the open connections."),
+		renderSeconds:  r.NewHistogram("iptw_map_render_duration_seconds", "Time taken to render the map image.", metrics.DefaultBuckets),
+		encodeSeconds:  r.NewHistogram("iptw_map_encode_duration_seconds", "Time taken to encode a changed map image as PNG.", metrics.DefaultBuckets),
+	}
+
+	r.NewFunc("iptw_countries", "Visited countries, and those of them in Matrix Prison or liberated.", metrics.KindGauge, []string{"state"}, func(emit func(float64, ...string)) {
+		// Counted as in the web UI: prison excludes liberated countries
+		countries := a.gameState.GetCountries()
+		var prison, liberated int
+		for _, state := range countries {
+			if state.MatrixPrison && !state.Liberated {
+				prison++
+			}
+			if state.Liberated {
+				liberated++
+			}
+		}
+		emit(float64(len(countries)), resources.CountryVisited)
+		emit(float64(prison), resources.CountryPrison)
+		emit(float64(liberated), resources.CountryLiberated)
+	})
+	r.NewFunc("iptw_achievements", "Achievements by status.", metrics.KindGauge, []string{"status"}, func(emit func(float64, ...string)) {
+		if a.achievements == nil {
+			return
+		}
+		all := a.achievements.GetAllAchievements()
+		unlocked := len(a.achievements.GetUnlockedAchievements())
+		emit(float64(unlocked), "unlocked")
+		emit(float64(len(all)-unlocked), "locked")
+	})
+	r.NewFunc("iptw_score_points", "Points scored today, this week and of all time.", metrics.KindGauge, []string{"period"}, func(emit func(float64, ...string)) {
+		summary := a.scores.summary(time.Now())
+		emit(float64(summary.Today), "day")
+		emit(float64(summary.Week), "week")
+		emit(float64(summary.Total), "all")
+	})
+	r.NewFunc("iptw_target_country_info", "The current target country; absent when there is none.", metrics.KindGauge, []string{"country", "iso_a2"}, func(emit func(float64, ...string)) {
+		if target, _ := a.gameState.GetTargetCountry(); target != "" {
+			alpha2, _ := resources.GetAlpha2ByName(target)
+			emit(1, target, alpha2)
+		}
+	})
+	r.NewFunc("iptw_target_country_since_seconds", "Unix time the current target country was chosen.", metrics.KindGauge, nil, func(emit func(float64, ...string)) {
+		if target, setAt := a.gameState.GetTargetCountry(); target != "" && !setAt.IsZero() {
+			emit(float64(setAt.UnixNano()) / float64(time.Second))
+		}
+	})
+	r.NewGaugeFunc("iptw_connections", "Open connections seen in the last refresh.", func() float64 {
+		return float64(len(a.monitor.GetConnections()))
+	})
+
+	geoipCounter := func(name, help string, value func() uint64) {
+		r.NewFunc(name, help, metrics.KindCounter, nil, func(emit func(float64, ...string)) {
+			if a.geoip != nil {
+				emit(float64(value()))
+			}
+		})
+	}
+	geoipCounter("iptw_geoip_lookups_total", "GeoIP lookups, including those answered from the cache.", func() uint64 { return a.geoip.Stats().Lookups })
+	geoipCounter("iptw_geoip_lookup_errors_total", "GeoIP lookups that failed.", func() uint64 { return a.geoip.Stats().Errors })
+	geoipCounter("iptw_geoip_cache_hits_total", "GeoIP lookups answered from the cache.", func() uint64 { return a.geoip.Stats().CacheHits })
+	geoipCounter("iptw_geoip_cache_misses_total", "GeoIP lookups that read the database.", func() uint64 { return a.geoip.Stats().CacheMisses })
+	r.NewFunc("iptw_geoip_cache_entries", "IP addresses in the GeoIP cache.", metrics.KindGauge, nil, func(emit func(float64, ...string)) {
+		if a.geoip != nil {
+			emit(float64(a.geoip.Stats().CacheEntries))
+		}
+	})
+	return m
+}
+
+// observeSince records the seconds elapsed since start.
+func observeSince(h *metrics.Histogram, start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
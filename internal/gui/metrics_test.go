@@ -0,0 +1,45 @@
+package gui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"iptw/internal/geoip"
+	"iptw/internal/network"
+)
+
+func TestMetrics(t *testing.T) {
+	a := newTestApp(t)
+	a.gameState.AddCountryHit("France")
+	a.gameState.AddCountryHit("Kenya")
+	a.gameState.ImprisonCountry("Kenya")
+	a.gameState.SetTargetCountry("Peru")
+	a.recordHit(network.Connection{RemoteIP: "192.0.2.1", RemotePort: "443", Protocol: "tcp"}, &geoip.Location{}, "France")
+	a.recordHit(network.Connection{RemoteIP: "192.0.2.2", RemotePort: "53", Protocol: "udp"}, &geoip.Location{}, "France")
+	a.metrics.renderSeconds.Observe(0.2)
+
+	rec := httptest.NewRecorder()
+	a.metrics.registry.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`iptw_country_hits_total{country="France"} 2`,
+		`iptw_protocol_hits_total{protocol="udp"} 1`,
+		`iptw_countries{state="visited"} 2`,
+		`iptw_countries{state="prison"} 1`,
+		`iptw_countries{state="liberated"} 0`,
+		`iptw_target_country_info{country="Peru",iso_a2="PE"} 1`,
+		`iptw_map_render_duration_seconds_bucket{le="0.25"} 1`,
+		`iptw_connection_refresh_errors_total 0`,
+		"# TYPE iptw_achievements gauge",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in\n%s", line, body)
+		}
+	}
+	// Without a GeoIP database its metrics are left out
+	if strings.Contains(body, "iptw_geoip_lookups_total 0") {
+		t.Error("expected no GeoIP samples without a database")
+	}
+}
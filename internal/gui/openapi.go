@@ -0,0 +1,193 @@
+package gui
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// openAPIDocument generates the OpenAPI 3 description of routes. Schemas are
+// derived from the request and response types by reflection, using their JSON
+// tags; named structs become components.
+func openAPIDocument(routes []apiRoute) map[string]interface{} {
+	g := &schemaGenerator{components: make(map[string]interface{})}
+	errorSchema := g.schema(reflect.TypeOf(apiError{}))
+
+	paths := make(map[string]interface{})
+	for _, route := range routes {
+		op := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+		}
+
+		var params []interface{}
+		for _, p := range route.Params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"description": p.Description,
+				"required":    p.In == "path",
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if route.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(g.schema(reflect.TypeOf(route.Request))),
+			}
+		}
+		if route.Write {
+			op["security"] = []interface{}{
+				map[string]interface{}{"sessionToken": []string{}},
+				map[string]interface{}{"bearerToken": []string{}},
+			}
+		}
+		op["responses"] = map[string]interface{}{
+			"200":     map[string]interface{}{"description": "OK", "content": jsonContent(g.schema(reflect.TypeOf(route.Response)))},
+			"default": map[string]interface{}{"description": "Error", "content": jsonContent(errorSchema)},
+		}
+
+		path, ok := paths[route.Path].(map[string]interface{})
+		if !ok {
+			path = make(map[string]interface{})
+			paths[route.Path] = path
+		}
+		path[strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "IP Travel Wallpaper API",
+			"version":     "1",
+			"description": "Local REST API of a running iptw instance. Errors use the error envelope; write operations need a token with write scope, and requests from other machines need a token with read scope.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"sessionToken": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Session-Token"},
+				"bearerToken":  map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API token with write scope from ~/.config/iptw/api-tokens"},
+			},
+		},
+	}
+}
+
+// operationID names an operation after its method and path, e.g.
+// postCountriesCountryImprison.
+func operationID(route apiRoute) string {
+	id := strings.ToLower(route.Method)
+	for _, part := range strings.Split(strings.TrimPrefix(route.Path, apiPrefix), "/") {
+		part = strings.Trim(part, "{}")
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '.' || r == '-' || r == '_' }) {
+			id += exportName(word)
+		}
+	}
+	return id
+}
+
+// jsonContent wraps a schema as an application/json media type.
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// exportName upper-cases the first letter of name.
+func exportName(name string) string {
+	r := []rune(name)
+	if len(r) == 0 {
+		return name
+	}
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// schemaGenerator builds JSON schemas and collects named struct components.
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schema returns the schema of t, or a reference to it for named structs.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := exportName(t.Name())
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = nil // reserve the name for recursive types
+			g.components[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema describes the JSON encoding of a struct.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	g.addFields(t, properties, &required)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the JSON fields of a struct to properties. Fields of
+// untagged embedded structs are promoted, as encoding/json does.
+func (g *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.addFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
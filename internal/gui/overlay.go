@@ -0,0 +1,90 @@
+package gui
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"iptw/internal/background"
+	"iptw/internal/resources"
+)
+
+// overlayOutputName is the file the composited overlay wallpaper is written to.
+const overlayOutputName = background.OverlayFileName
+
+// loadOverlayBase returns the decoded original wallpaper used as the overlay
+// background. The decoded image is cached until the backup path changes.
+func (a *App) loadOverlayBase() (image.Image, error) {
+	if !a.HasWallpaperBackup() {
+		return nil, fmt.Errorf("no original wallpaper backup available")
+	}
+	if a.overlayBase != nil && a.overlayBasePath == a.originalWallpaper {
+		return a.overlayBase, nil
+	}
+
+	imagePath, err := background.BackupImage(a.originalWallpaper)
+	if err != nil {
+		return nil, err
+	}
+	img, err := resources.LoadImageFile(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	a.overlayBase = img
+	a.overlayBasePath = a.originalWallpaper
+	slog.Debug("Loaded original wallpaper for overlay", "path", imagePath, "size", img.Bounds().Size())
+	return img, nil
+}
+
+// writeOverlayWallpaper composites the travel map onto the backed-up original
+// wallpaper according to the overlay settings and returns the path of the
+// resulting image.
+func (a *App) writeOverlayWallpaper(state mapState, recentCountries map[string]bool, heat *resources.Heatmap) (string, error) {
+	base, err := a.loadOverlayBase()
+	if err != nil {
+		return "", err
+	}
+
+	a.configMu.RLock()
+	overlayCfg := resources.OverlayConfig{
+		Style:    a.config.OverlayStyle,
+		Opacity:  a.config.OverlayOpacity,
+		Scale:    a.config.OverlayScale,
+		Position: a.config.OverlayPosition,
+	}
+	a.configMu.RUnlock()
+
+	bounds := base.Bounds()
+	rect := resources.OverlayRect(bounds.Dx(), bounds.Dy(), overlayCfg)
+	width, height := rect.Dx(), rect.Dy()
+	if width <= 0 || height <= 0 {
+		return "", fmt.Errorf("wallpaper too small for overlay: %dx%d", bounds.Dx(), bounds.Dy())
+	}
+
+	// Transparent ocean; with the visited style unvisited countries stay clear too
+	layers := resources.MapLayers{Ocean: false, Unvisited: overlayCfg.Style != "visited", Heat: heat}
+	layer, err := a.renderMapImage(width, height, state, recentCountries, layers)
+	if err != nil {
+		return "", fmt.Errorf("failed to render overlay layer: %w", err)
+	}
+
+	composite := resources.CompositeOverlay(base, layer, rect, overlayCfg.Opacity)
+
+	outputPath := filepath.Join(a.outputDir, overlayOutputName)
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create overlay wallpaper: %w", err)
+	}
+	encoder := &png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(file, composite); err != nil {
+		_ = file.Close()
+		return "", fmt.Errorf("failed to encode overlay wallpaper: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to save overlay wallpaper: %w", err)
+	}
+	return outputPath, nil
+}
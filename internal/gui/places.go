@@ -0,0 +1,261 @@
+package gui
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"iptw/internal/geoip"
+)
+
+// SubdivisionGameState represents the game state for a first-level
+// subdivision of a country (state, province...), keyed by ISO 3166-2 code
+type SubdivisionGameState struct {
+	Code     string    `json:"code"`
+	Country  string    `json:"country"`
+	Name     string    `json:"name"`
+	HitCount int       `json:"hits"`
+	LastHit  time.Time `json:"last_hit"`
+}
+
+// CityGameState represents a city in the collection of visited cities. Unlike
+// countries, cities keep counting hits in Matrix Prison.
+type CityGameState struct {
+	Country     string    `json:"country"`
+	Name        string    `json:"name"`
+	Subdivision string    `json:"subdivision,omitempty"`
+	HitCount    int       `json:"hits"`
+	FirstVisit  time.Time `json:"first_visit"`
+	LastHit     time.Time `json:"last_hit"`
+}
+
+// AddSubdivisionHit adds a hit to a subdivision and returns whether it was the
+// first one
+func (gs *GameState) AddSubdivisionHit(code, country, name string) bool {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	if gs.subdivisions == nil {
+		gs.subdivisions = make(map[string]*SubdivisionGameState)
+	}
+	state, exists := gs.subdivisions[code]
+	if !exists {
+		state = &SubdivisionGameState{Code: code, Country: country, Name: name}
+		gs.subdivisions[code] = state
+	}
+	state.HitCount++
+	state.LastHit = time.Now()
+	return !exists
+}
+
+// AddCityHit adds a hit to a city and returns whether it was the first one,
+// with the number of cities visited in its country and in total
+func (gs *GameState) AddCityHit(country, city, subdivision string) (newCity bool, citiesInCountry, totalCities int) {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	if gs.cities == nil {
+		gs.cities = make(map[string]map[string]*CityGameState)
+	}
+	if gs.cities[country] == nil {
+		gs.cities[country] = make(map[string]*CityGameState)
+	}
+	now := time.Now()
+	state, exists := gs.cities[country][city]
+	if !exists {
+		state = &CityGameState{Country: country, Name: city, FirstVisit: now}
+		gs.cities[country][city] = state
+	}
+	if subdivision != "" {
+		state.Subdivision = subdivision
+	}
+	state.HitCount++
+	state.LastHit = now
+
+	for _, cities := range gs.cities {
+		totalCities += len(cities)
+	}
+	return !exists, len(gs.cities[country]), totalCities
+}
+
+// GetSubdivisions returns copies of the visited subdivisions of a country, or
+// of every country when country is empty, sorted by code
+func (gs *GameState) GetSubdivisions(country string) []SubdivisionGameState {
+	gs.mutex.RLock()
+	defer gs.mutex.RUnlock()
+
+	subdivisions := []SubdivisionGameState{}
+	for _, state := range gs.subdivisions {
+		if country == "" || state.Country == country {
+			subdivisions = append(subdivisions, *state)
+		}
+	}
+	sort.Slice(subdivisions, func(i, j int) bool { return subdivisions[i].Code < subdivisions[j].Code })
+	return subdivisions
+}
+
+// GetCities returns copies of the visited cities of a country, or of every
+// country when country is empty, sorted by country and name
+func (gs *GameState) GetCities(country string) []CityGameState {
+	gs.mutex.RLock()
+	defer gs.mutex.RUnlock()
+
+	cities := []CityGameState{}
+	for name, byName := range gs.cities {
+		if country != "" && name != country {
+			continue
+		}
+		for _, state := range byName {
+			cities = append(cities, *state)
+		}
+	}
+	sort.Slice(cities, func(i, j int) bool {
+		if cities[i].Country != cities[j].Country {
+			return cities[i].Country < cities[j].Country
+		}
+		return cities[i].Name < cities[j].Name
+	})
+	return cities
+}
+
+// locateSubdivision returns the ISO 3166-2 code and name of the subdivision
+// of a hit, or nothing when the subdivisions setting is off. The admin-1 data
+// is preferred, first by the GeoIP code and then by position; without it, or
+// when it does not cover the location, the GeoIP subdivision is used as long
+// as it belongs to the country found by Natural Earth.
+func (a *App) locateSubdivision(country string, location *geoip.Location) (code, name string) {
+	a.configMu.RLock()
+	enabled := a.config.Subdivisions
+	a.configMu.RUnlock()
+	alpha2 := countryAlpha2(country)
+	if !enabled || alpha2 == "" {
+		return "", ""
+	}
+
+	if a.subdivisions != nil {
+		if sub, ok := a.subdivisions.Get(location.SubdivisionCode); ok && sub.Alpha2 == alpha2 {
+			return sub.Code, sub.Name
+		}
+		if sub := a.subdivisions.FindAtPoint(alpha2, location.Latitude, location.Longitude); sub != nil {
+			return sub.Code, sub.Name
+		}
+	}
+	if strings.HasPrefix(location.SubdivisionCode, alpha2+"-") {
+		return location.SubdivisionCode, location.Subdivision
+	}
+	return "", ""
+}
+
+// visitPlace counts a hit towards its subdivision and city, and the city
+// achievements when the city is new.
+func (a *App) visitPlace(country, city, subdivisionCode, subdivisionName string) {
+	if subdivisionCode != "" && a.gameState.AddSubdivisionHit(subdivisionCode, country, subdivisionName) {
+		slog.Info("🗺️ New subdivision visited",
+			"country", country,
+			"subdivision", subdivisionName,
+			"code", subdivisionCode,
+		)
+	}
+	if city == "" {
+		return
+	}
+
+	newCity, citiesInCountry, totalCities := a.gameState.AddCityHit(country, city, subdivisionName)
+	if !newCity {
+		return
+	}
+	slog.Info("🏙️ New city visited",
+		"country", country,
+		"city", city,
+		"cities_in_country", citiesInCountry,
+		"cities", totalCities,
+	)
+	if a.achievements != nil {
+		newUnlocks := a.achievements.RecordCity(country, citiesInCountry, totalCities)
+		a.publishAchievements(newUnlocks...)
+		for _, achievementID := range newUnlocks {
+			slog.Info("🏆 Achievement unlocked!", "achievement_id", achievementID)
+		}
+	}
+}
+
+// cityList is returned by /api/v1/cities.
+type cityList struct {
+	Total  int             `json:"total"`
+	Cities []CityGameState `json:"cities"`
+}
+
+func (a *App) handleAPICities(w http.ResponseWriter, r *http.Request) {
+	country, ok := a.placesCountry(w, r)
+	if !ok {
+		return
+	}
+	cities := a.gameState.GetCities(country)
+	writeJSON(w, http.StatusOK, cityList{Total: len(cities), Cities: cities})
+}
+
+// subdivisionStatus is a subdivision in /api/v1/subdivisions.
+type subdivisionStatus struct {
+	SubdivisionGameState
+	Visited bool `json:"visited"`
+}
+
+// subdivisionList is returned by /api/v1/subdivisions. Known is the number of
+// subdivisions in the admin-1 data, for the country when one is given; zero
+// when the data is not loaded.
+type subdivisionList struct {
+	Enabled      bool                `json:"enabled"`
+	Visited      int                 `json:"visited"`
+	Known        int                 `json:"known"`
+	Subdivisions []subdivisionStatus `json:"subdivisions"`
+}
+
+func (a *App) handleAPISubdivisions(w http.ResponseWriter, r *http.Request) {
+	country, ok := a.placesCountry(w, r)
+	if !ok {
+		return
+	}
+	a.configMu.RLock()
+	list := subdivisionList{Enabled: a.config.Subdivisions, Subdivisions: []subdivisionStatus{}}
+	a.configMu.RUnlock()
+
+	visited := make(map[string]bool)
+	for _, state := range a.gameState.GetSubdivisions(country) {
+		visited[state.Code] = true
+		list.Subdivisions = append(list.Subdivisions, subdivisionStatus{SubdivisionGameState: state, Visited: true})
+	}
+	list.Visited = len(list.Subdivisions)
+
+	if a.subdivisions != nil {
+		if country == "" {
+			list.Known = len(a.subdivisions.Subdivisions)
+		} else {
+			// Also list the subdivisions of the country not visited yet
+			for _, sub := range a.subdivisions.Country(countryAlpha2(country)) {
+				list.Known++
+				if !visited[sub.Code] {
+					list.Subdivisions = append(list.Subdivisions, subdivisionStatus{SubdivisionGameState: SubdivisionGameState{Code: sub.Code, Country: country, Name: sub.Name}})
+				}
+			}
+			sort.Slice(list.Subdivisions, func(i, j int) bool { return list.Subdivisions[i].Code < list.Subdivisions[j].Code })
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// placesCountry resolves the optional country query parameter, writing an
+// error when it is unknown.
+func (a *App) placesCountry(w http.ResponseWriter, r *http.Request) (string, bool) {
+	param := r.URL.Query().Get("country")
+	if param == "" {
+		return "", true
+	}
+	country, ok := a.resolveCountry(param)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Unknown country %q", param)
+		return "", false
+	}
+	return country, true
+}
@@ -0,0 +1,99 @@
+package gui
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"iptw/internal/events"
+	"iptw/internal/geoip"
+	"iptw/internal/network"
+	"iptw/internal/resources"
+)
+
+// placesAdmin1 has made-up boxes inside Germany.
+const placesAdmin1 = `{"type": "FeatureCollection", "features": [
+	{"type": "Feature", "properties": {"name": "Bayern", "iso_3166_2": "DE-BY"},
+	 "geometry": {"type": "Polygon", "coordinates": [[[10, 47.5], [13.5, 47.5], [13.5, 50.3], [10, 50.3], [10, 47.5]]]}},
+	{"type": "Feature", "properties": {"name": "Nordrhein-Westfalen", "iso_3166_2": "DE-NW"},
+	 "geometry": {"type": "Polygon", "coordinates": [[[6.2, 50.5], [9, 50.5], [9, 52.3], [6.2, 52.3], [6.2, 50.5]]]}},
+	{"type": "Feature", "properties": {"name": "Saarland", "iso_3166_2": "DE-SL"},
+	 "geometry": {"type": "Polygon", "coordinates": [[[6.4, 49.1], [7.4, 49.1], [7.4, 49.6], [6.4, 49.6], [6.4, 49.1]]]}}
+]}`
+
+func TestPlaces(t *testing.T) {
+	a := newTestApp(t)
+	a.config.Subdivisions = true
+	sd, err := resources.ParseSubdivisions([]byte(placesAdmin1))
+	if err != nil {
+		t.Fatalf("ParseSubdivisions failed: %v", err)
+	}
+	a.subdivisions = sd
+	_, hits, cancel := a.events.Subscribe(0)
+	defer cancel()
+
+	for i, location := range []geoip.Location{
+		{City: "Munich", Latitude: 48.1, Longitude: 11.6, SubdivisionCode: "DE-BY", Subdivision: "Bavaria"},
+		{City: "Cologne", Latitude: 50.9, Longitude: 6.9},                                                  // found by position
+		{City: "Berlin", Latitude: 52.5, Longitude: 13.4, SubdivisionCode: "DE-BE", Subdivision: "Berlin"}, // not in the data
+		{City: "Hamburg", Latitude: 53.6, Longitude: 10, SubdivisionCode: "FR-IDF"},                        // not in Germany
+		{City: "Nuremberg", Latitude: 49.5, Longitude: 11.1},
+		{City: "Munich", Latitude: 48.1, Longitude: 11.6, SubdivisionCode: "DE-BY"},
+	} {
+		conn := network.Connection{RemoteIP: "192.0.2." + strconv.Itoa(i+1), RemotePort: "443", Protocol: "tcp"}
+		a.recordHit(conn, &location, "Germany")
+	}
+
+	var cities cityList
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/cities?country=DE", "", nil), http.StatusOK, &cities)
+	if cities.Total != 5 || cities.Cities[0].Name != "Berlin" || cities.Cities[3].Name != "Munich" {
+		t.Fatalf("unexpected cities %+v", cities)
+	}
+	if munich := cities.Cities[3]; munich.HitCount != 2 || munich.Subdivision != "Bayern" {
+		t.Errorf("expected 2 hits in Munich, Bayern, got %+v", munich)
+	}
+	expectAPIError(t, serveAPI(t, a, http.MethodGet, "/api/v1/cities?country=Atlantis", "", nil), http.StatusNotFound, "not_found")
+
+	var subs subdivisionList
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/subdivisions?country=Germany", "", nil), http.StatusOK, &subs)
+	if !subs.Enabled || subs.Visited != 3 || subs.Known != 3 || len(subs.Subdivisions) != 4 {
+		t.Fatalf("unexpected subdivisions %+v", subs)
+	}
+	for i, want := range []struct {
+		code    string
+		visited bool
+	}{{"DE-BE", true}, {"DE-BY", true}, {"DE-NW", true}, {"DE-SL", false}} {
+		if got := subs.Subdivisions[i]; got.Code != want.code || got.Visited != want.visited {
+			t.Errorf("expected %s visited %t, got %+v", want.code, want.visited, got)
+		}
+	}
+	if state := a.snapshotMapState(); state.visitedSubdivisions["DE-BY"] != 3 || state.visitedSubdivisions["DE-NW"] != 1 {
+		t.Errorf("unexpected visited subdivisions %v", state.visitedSubdivisions)
+	}
+
+	if achievement := a.achievements.GetAchievement("city_explorer_germany"); achievement == nil || !achievement.Unlocked {
+		t.Errorf("expected City Explorer: Germany to be unlocked, got %+v", achievement)
+	}
+	if achievement := a.achievements.GetAchievement("city_hopper"); achievement.Unlocked || achievement.Progress != 5 {
+		t.Errorf("unexpected City Hopper %+v", achievement)
+	}
+
+	var codes []string
+	for len(hits) > 0 {
+		e := <-hits
+		var hit events.Hit
+		if e.Type == events.TypeHit && e.Decode(&hit) == nil {
+			codes = append(codes, hit.Subdivision)
+		}
+	}
+	if len(codes) != 6 || codes[0] != "DE-BY" || codes[1] != "DE-NW" || codes[2] != "DE-BE" || codes[3] != "" {
+		t.Errorf("unexpected subdivisions of hit events %v", codes)
+	}
+
+	// Turned off, subdivisions are no longer tracked but cities are
+	a.config.Subdivisions = false
+	a.recordHit(network.Connection{RemoteIP: "192.0.2.99", RemotePort: "443", Protocol: "tcp"}, &geoip.Location{City: "Dresden", SubdivisionCode: "DE-SN"}, "Germany")
+	if len(a.gameState.GetSubdivisions("")) != 3 || len(a.gameState.GetCities("")) != 6 {
+		t.Error("expected only the city to be tracked with subdivisions off")
+	}
+}
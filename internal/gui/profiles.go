@@ -0,0 +1,387 @@
+package gui
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"iptw/internal/achievements"
+	"iptw/internal/factdb"
+	"iptw/internal/geoip"
+	"iptw/internal/history"
+	"iptw/internal/network"
+	"iptw/internal/profile"
+)
+
+// profileState is the game of a player profile while another one is active.
+// The active profile's game lives in the App fields; switching profiles
+// exchanges the two, so the App's objects never change hands.
+type profileState struct {
+	gameState    *GameState
+	achievements *achievements.AchievementManager
+	history      *history.Journal // nil when the App records no history
+	targetQueue  []string
+	expedition   *expedition
+	recentHits   []RecentHit
+}
+
+// record appends an event to the profile's journal.
+func (p *profileState) record(e history.Event) {
+	if p.history == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := p.history.Append(e); err != nil {
+		slog.Error("Failed to record profile history event", "type", e.Type, "error", err)
+	}
+}
+
+// exchange swaps the countries, places and target of two game states
+func (gs *GameState) exchange(other *GameState) {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	other.mutex.Lock()
+	defer other.mutex.Unlock()
+
+	gs.countries, other.countries = other.countries, gs.countries
+	gs.subdivisions, other.subdivisions = other.subdivisions, gs.subdivisions
+	gs.cities, other.cities = other.cities, gs.cities
+	gs.targetCountry, other.targetCountry = other.targetCountry, gs.targetCountry
+	gs.targetSetAt, other.targetSetAt = other.targetSetAt, gs.targetSetAt
+}
+
+// activeProfile returns the name of the profile being played.
+func (a *App) activeProfile() string {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config.Profile
+}
+
+// profileLine returns the status rectangle line naming the active profile,
+// or "" while the default profile is the only one.
+func (a *App) profileLine() string {
+	name := a.activeProfile()
+	if name == profile.Default && !a.multiProfile.Load() {
+		return ""
+	}
+	return "Profile: " + name
+}
+
+// loadProfile returns the state of an inactive profile, opening its journal
+// and rebuilding its game from it the first time. The caller holds profileMu.
+func (a *App) loadProfile(name string) (*profileState, error) {
+	if p := a.profiles[name]; p != nil {
+		return p, nil
+	}
+	p := &profileState{
+		gameState:    &GameState{countries: make(map[string]*CountryGameState)},
+		achievements: achievements.NewAchievementManager(),
+	}
+	if a.history != nil {
+		journalPath, err := profile.HistoryPath(name)
+		if err != nil {
+			return nil, err
+		}
+		if p.history, err = history.Open(journalPath); err != nil {
+			return nil, err
+		}
+		if err := replayProfile(p); err != nil {
+			slog.Warn("Failed to rebuild profile from its history journal", "profile", name, "error", err)
+		}
+	}
+	if a.profiles == nil {
+		a.profiles = make(map[string]*profileState)
+	}
+	a.profiles[name] = p
+	return p, nil
+}
+
+// replayProfile rebuilds the game of a profile from its journal: the visited
+// countries with their journaled hits, Matrix Prison until a release, the
+// target and the achievements of visits and expeditions.
+func replayProfile(p *profileState) error {
+	gs := p.gameState
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	expeditionSizes := make(map[string]int)
+	return p.history.Scan(time.Time{}, func(e history.Event) bool {
+		switch e.Type {
+		case history.EventHit, history.EventVisit, history.EventImprison:
+			if e.Country == "" {
+				break
+			}
+			state := gs.countries[e.Country]
+			if state == nil {
+				state = &CountryGameState{}
+				gs.countries[e.Country] = state
+			}
+			state.LastHit = e.Time
+			switch e.Type {
+			case history.EventHit:
+				state.HitCount++
+			case history.EventVisit:
+				p.achievements.UpdateProgress(e.Country, len(gs.countries))
+			case history.EventImprison:
+				state.MatrixPrison, state.Liberated = true, e.Liberated
+				if gs.targetCountry == e.Country {
+					gs.targetCountry, gs.targetSetAt = "", time.Time{}
+				}
+			}
+		case history.EventRelease:
+			for country, state := range gs.countries {
+				if e.Country == "" || e.Country == country {
+					state.HitCount, state.MatrixPrison, state.Liberated = 0, false, false
+				}
+			}
+		case history.EventTarget:
+			gs.targetCountry, gs.targetSetAt = e.Country, e.Time
+			if e.Country == "" {
+				gs.targetSetAt = time.Time{}
+			}
+		case history.EventExpedition:
+			switch e.Outcome {
+			case history.ExpeditionStarted:
+				expeditionSizes[e.Expedition] = len(e.Countries)
+			case history.ExpeditionSucceeded:
+				p.achievements.RecordExpedition(expeditionSizes[e.Expedition])
+			}
+		}
+		return true
+	})
+}
+
+// switchProfile makes another profile the active one, creating it if needed.
+// The game of the previous profile is kept for the rest of the session. The
+// caller saves the config.
+func (a *App) switchProfile(name string) error {
+	if !profile.ValidName(name) {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+	a.profileMu.Lock()
+	defer a.profileMu.Unlock()
+
+	current := a.activeProfile()
+	if name == current {
+		return nil
+	}
+	next, err := a.loadProfile(name)
+	if err != nil {
+		return fmt.Errorf("failed to load profile %s: %w", name, err)
+	}
+
+	// After the exchange, next holds the game of the current profile
+	a.gameState.exchange(next.gameState)
+	a.achievements.Exchange(next.achievements)
+	if a.history != nil {
+		a.history.Exchange(next.history)
+	}
+	a.targetQueueMu.Lock()
+	a.targetQueue, next.targetQueue = next.targetQueue, a.targetQueue
+	a.targetQueueMu.Unlock()
+	a.expeditionMu.Lock()
+	a.expedition, next.expedition = next.expedition, a.expedition
+	a.expeditionMu.Unlock()
+	a.recentHitsMu.Lock()
+	a.recentHits, next.recentHits = next.recentHits, a.recentHits
+	a.recentHitsMu.Unlock()
+	a.targetChallengeFactMu.Lock()
+	a.targetChallengeFact = factdb.Fact{}
+	a.targetChallengeFactMu.Unlock()
+	delete(a.profiles, name)
+	a.profiles[current] = next
+
+	a.configMu.Lock()
+	a.config.Profile = name
+	a.configMu.Unlock()
+
+	// The heatmap, challenges and score are views of the journal
+	if a.history != nil {
+		now := time.Now()
+		if err := a.heat.load(a.history); err != nil {
+			slog.Warn("Failed to read history journal", "error", err)
+		}
+		if err := a.challenges.load(a.history, now); err != nil {
+			slog.Warn("Failed to read challenges from history journal", "error", err)
+		}
+		if err := a.scores.load(a.history); err != nil {
+			slog.Warn("Failed to read score from history journal", "error", err)
+		}
+	}
+
+	a.multiProfile.Store(true)
+	a.markMapDirty()
+	a.publishConfig("profile", name)
+	slog.Info("👤 Switched profile", "from", current, "to", name)
+	return nil
+}
+
+// profileRoutes returns the routes of the profile_routes setting.
+func (a *App) profileRoutes() []profile.Route {
+	a.configMu.RLock()
+	value := a.config.ProfileRoutes
+	a.configMu.RUnlock()
+	routes, _ := profile.ParseRoutes(value) // validated by config.Set
+	return routes
+}
+
+// routeProfile returns the inactive profile a connection is routed to, or ""
+// when it counts towards the active profile.
+func (a *App) routeProfile(routes []profile.Route, conn network.Connection) string {
+	name := profile.Match(routes, conn.UID, conn.Process)
+	if name == a.activeProfile() {
+		return ""
+	}
+	return name
+}
+
+// playRoutedHit counts a connection towards an inactive profile: its
+// countries, achievements and travel history. Its score, challenges and
+// heatmap catch up from the history once it becomes active. counted tracks
+// the countries already counted in this update cycle, by profile. The caller
+// holds profileMu.
+func (a *App) playRoutedHit(name string, conn network.Connection, location *geoip.Location, country string, newFlow bool, counted map[string]bool) {
+	p, err := a.loadProfile(name)
+	if err != nil {
+		if newFlow {
+			slog.Warn("Failed to load profile - its hits are not counted", "profile", name, "error", err)
+		}
+		return
+	}
+	if newFlow {
+		p.record(history.Event{
+			Type:       history.EventHit,
+			Country:    country,
+			City:       location.City,
+			Lat:        location.Latitude,
+			Lng:        location.Longitude,
+			RemoteIP:   conn.RemoteIP,
+			RemotePort: conn.RemotePort,
+			Protocol:   conn.Protocol,
+			ASN:        location.ASN,
+			ASOrg:      location.ASOrg,
+		})
+	}
+
+	// Like the active profile, count a country once per update cycle
+	key := name + "/" + country
+	if counted[key] {
+		return
+	}
+	counted[key] = true
+	firstVisit := !p.gameState.HasCountry(country)
+	sentToPrison, wasTarget := p.gameState.AddCountryHitWithTargetCheck(country)
+	if firstVisit {
+		p.record(history.Event{Type: history.EventVisit, Country: country, City: location.City})
+		p.achievements.UpdateProgress(country, len(p.gameState.GetCountries()))
+	}
+	if sentToPrison {
+		p.record(history.Event{Type: history.EventImprison, Country: country, Liberated: wasTarget})
+	}
+	slog.Debug("Hit routed to profile",
+		"profile", name,
+		"country", country,
+		"uid", conn.UID,
+		"process", conn.Process,
+	)
+}
+
+// profileInfo is a profile in /api/v1/profiles. Visited counts the countries
+// visited this session; History is the journal of the profile.
+type profileInfo struct {
+	Name    string `json:"name"`
+	Active  bool   `json:"active"`
+	Visited int    `json:"visited"`
+	History string `json:"history,omitempty"`
+}
+
+// profileList is returned by /api/v1/profiles.
+type profileList struct {
+	Active   string        `json:"active"`
+	Profiles []profileInfo `json:"profiles"`
+	Routes   []string      `json:"routes"`
+}
+
+// profileRequest chooses the active profile.
+type profileRequest struct {
+	Name string `json:"name"`
+}
+
+// profileSummary lists the profiles on disk and those played this session.
+func (a *App) profileSummary() profileList {
+	names, err := profile.List()
+	if err != nil {
+		slog.Warn("Failed to list profiles", "error", err)
+		names = []string{profile.Default}
+	}
+
+	a.profileMu.Lock()
+	defer a.profileMu.Unlock()
+	active := a.activeProfile()
+	seen := make(map[string]bool)
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, name := range append([]string{active}, loadedProfileNames(a.profiles)...) {
+		if !seen[name] {
+			names, seen[name] = append(names, name), true
+		}
+	}
+
+	list := profileList{Active: active, Profiles: []profileInfo{}, Routes: []string{}}
+	for _, name := range names {
+		info := profileInfo{Name: name, Active: name == active}
+		if journalPath, err := profile.HistoryPath(name); err == nil {
+			info.History = journalPath
+		}
+		if info.Active {
+			info.Visited = len(a.gameState.GetCountries())
+		} else if p := a.profiles[name]; p != nil {
+			info.Visited = len(p.gameState.GetCountries())
+		}
+		list.Profiles = append(list.Profiles, info)
+	}
+	for _, route := range a.profileRoutes() {
+		list.Routes = append(list.Routes, route.String())
+	}
+	return list
+}
+
+// loadedProfileNames returns the names of the inactive profiles played this
+// session, sorted.
+func loadedProfileNames(profiles map[string]*profileState) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *App) handleAPIProfiles(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.profileSummary())
+}
+
+func (a *App) handleAPISetProfile(w http.ResponseWriter, r *http.Request) {
+	var req profileRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if !profile.ValidName(req.Name) {
+		writeAPIError(w, http.StatusBadRequest, "Invalid profile name %q: use lowercase letters, digits, - and _", req.Name)
+		return
+	}
+	if err := a.switchProfile(req.Name); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	if err := a.saveConfig(); err != nil {
+		slog.Error("Failed to save config after switching profile", "error", err)
+	}
+	writeJSON(w, http.StatusOK, a.profileSummary())
+}
@@ -0,0 +1,151 @@
+package gui
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"iptw/internal/geoip"
+	"iptw/internal/history"
+	"iptw/internal/network"
+	"iptw/internal/profile"
+)
+
+func TestProfiles(t *testing.T) {
+	a := newTestApp(t)
+	journalPath, err := profile.HistoryPath(profile.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.history, err = history.Open(journalPath); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = a.history.Close() }()
+
+	a.gameState.AddCountryHit("France")
+	if line := a.profileLine(); line != "" {
+		t.Errorf("expected no profile line with only the default profile, got %q", line)
+	}
+
+	token := map[string]string{"X-Session-Token": "secret"}
+	expectAPIError(t, serveAPI(t, a, http.MethodPut, "/api/v1/profiles/active", `{"name": "../alice"}`, token), http.StatusBadRequest, "bad_request")
+	var list profileList
+	decodeResponse(t, serveAPI(t, a, http.MethodPut, "/api/v1/profiles/active", `{"name": "alice"}`, token), http.StatusOK, &list)
+	if list.Active != "alice" || len(list.Profiles) != 2 || list.Profiles[0].Name != profile.Default || list.Profiles[0].Visited != 1 {
+		t.Fatalf("unexpected profiles %+v", list)
+	}
+	if a.gameState.HasCountry("France") || a.profileLine() != "Profile: alice" {
+		t.Error("expected alice to start a new game")
+	}
+
+	// Hits are recorded in the journal of the active profile
+	a.recordHit(network.Connection{RemoteIP: "192.0.2.1", RemotePort: "443", Protocol: "tcp"}, &geoip.Location{City: "Lima"}, "Peru")
+	alicePath, _ := profile.HistoryPath("alice")
+	if a.history.Path() != alicePath || countJournalHits(t, alicePath) != 1 || countJournalHits(t, journalPath) != 0 {
+		t.Errorf("expected the hit in %s", alicePath)
+	}
+
+	// Hits routed to an inactive profile count towards its game
+	routes, err := profile.ParseRoutes("uid:1000=" + profile.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := network.Connection{RemoteIP: "192.0.2.2", RemotePort: "443", Protocol: "tcp", UID: "1000"}
+	name := a.routeProfile(routes, conn)
+	if name != profile.Default {
+		t.Fatalf("expected the connection routed to the default profile, got %q", name)
+	}
+	a.profileMu.Lock()
+	a.playRoutedHit(name, conn, &geoip.Location{City: "Tokyo"}, "Japan", true, make(map[string]bool))
+	a.profileMu.Unlock()
+	if a.gameState.HasCountry("Japan") || countJournalHits(t, journalPath) != 1 {
+		t.Error("expected the routed hit in the default profile only")
+	}
+	if name := a.routeProfile(routes, network.Connection{UID: "0"}); name != "" {
+		t.Errorf("expected an unrouted connection to count for the active profile, got %q", name)
+	}
+
+	// Switching back restores the game
+	if _, err := a.applySettings(configPatch{"profile": profile.Default}); err != nil {
+		t.Fatalf("applySettings failed: %v", err)
+	}
+	if !a.gameState.HasCountry("France") || !a.gameState.HasCountry("Japan") || a.gameState.HasCountry("Peru") {
+		t.Errorf("expected the default game back, got %v", a.gameState.GetCountries())
+	}
+	if a.profileLine() != "Profile: default" {
+		t.Errorf("expected the profile line to stay once several profiles are played, got %q", a.profileLine())
+	}
+}
+
+func TestProfileReplay(t *testing.T) {
+	a := newTestApp(t)
+	journalPath, err := profile.HistoryPath(profile.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.history, err = history.Open(journalPath); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = a.history.Close() }()
+
+	// Bob played in an earlier session
+	bobPath, _ := profile.HistoryPath("bob")
+	bob, err := history.Open(bobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Hour)
+	for i, e := range []history.Event{
+		{Type: history.EventTarget, Country: "Chile"},
+		{Type: history.EventHit, Country: "Peru"},
+		{Type: history.EventVisit, Country: "Peru"},
+		{Type: history.EventHit, Country: "Chile"},
+		{Type: history.EventVisit, Country: "Chile"},
+		{Type: history.EventImprison, Country: "Chile", Liberated: true},
+		{Type: history.EventExpedition, Expedition: "e1", Countries: []string{"Peru", "Chile"}, Outcome: history.ExpeditionStarted},
+		{Type: history.EventExpedition, Expedition: "e1", Outcome: history.ExpeditionSucceeded},
+		{Type: history.EventTarget, Country: "Bolivia"},
+	} {
+		e.Time = start.Add(time.Duration(i) * time.Minute)
+		if err := bob.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = bob.Close()
+
+	if err := a.switchProfile("bob"); err != nil {
+		t.Fatalf("switchProfile failed: %v", err)
+	}
+	countries := a.gameState.GetCountries()
+	if len(countries) != 2 || countries["Peru"].HitCount != 1 || countries["Peru"].MatrixPrison {
+		t.Errorf("expected Peru and Chile visited, got %v", countries)
+	}
+	if chile := countries["Chile"]; chile == nil || !chile.MatrixPrison || !chile.Liberated {
+		t.Errorf("expected Chile liberated, got %+v", chile)
+	}
+	if target, _ := a.gameState.GetTargetCountry(); target != "Bolivia" {
+		t.Errorf("expected the Bolivia target back, got %q", target)
+	}
+	if progress := a.achievements.GetAchievement("world_traveler").Progress; progress != 2 {
+		t.Errorf("expected World Traveler progress 2, got %d", progress)
+	}
+	if progress := a.achievements.GetAchievement("expedition_leader").Progress; progress != 1 {
+		t.Errorf("expected one expedition completed, got %d", progress)
+	}
+}
+
+// countJournalHits counts the hit events of a journal file.
+func countJournalHits(t *testing.T, path string) int {
+	t.Helper()
+	hits := 0
+	err := history.OpenReadOnly(path).Scan(time.Time{}, func(e history.Event) bool {
+		if e.Type == history.EventHit {
+			hits++
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	return hits
+}
@@ -0,0 +1,96 @@
+package gui
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"iptw/internal/logging"
+	"iptw/internal/resources"
+)
+
+// maxRegionWidth bounds the width of on-demand region renders.
+const maxRegionWidth = 4096
+
+// regionFromQuery returns the region named by the "region" query parameter (a
+// preset region, a country name or an ISO alpha-2 code) or given by "bbox" as
+// west,south,east,north.
+func (a *App) regionFromQuery(r *http.Request) (resources.Region, error) {
+	query := r.URL.Query()
+	if bbox := query.Get("bbox"); bbox != "" {
+		return resources.ParseBBox(bbox)
+	}
+	return a.naturalEarth.LookupRegion(query.Get("region"))
+}
+
+// serveRegionPNG renders the map cropped to a region at the width given in the
+// "width" query parameter (default: the width of the live map). The heatmap
+// layer is included with layer=heat, as on the world map.
+func (a *App) serveRegionPNG(w http.ResponseWriter, r *http.Request) {
+	if a.naturalEarth == nil {
+		http.Error(w, "Map data not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	region, err := a.regionFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mapPNGMu.RLock()
+	width := a.lastMapWidth
+	a.mapPNGMu.RUnlock()
+	if param := r.URL.Query().Get("width"); param != "" {
+		width, err = strconv.Atoi(param)
+		if err != nil || width < 100 || width > maxRegionWidth {
+			http.Error(w, fmt.Sprintf("width must be between 100 and %d", maxRegionWidth), http.StatusBadRequest)
+			return
+		}
+	}
+	if width == 0 {
+		http.Error(w, "Map not yet generated", http.StatusServiceUnavailable)
+		return
+	}
+
+	layers := resources.MapLayers{Ocean: true, Unvisited: true}
+	switch layer := r.URL.Query().Get("layer"); layer {
+	case "":
+	case "heat":
+		window, err := a.heatmapWindow(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		heat := a.heatmapLayer(window)
+		for i, p := range heat.Points {
+			heat.Points[i].Lat, heat.Points[i].Lng = region.Project(p.Lat, p.Lng)
+		}
+		layers.Heat = heat
+	default:
+		http.Error(w, fmt.Sprintf("Unknown layer %q", layer), http.StatusBadRequest)
+		return
+	}
+
+	width, height := region.Size(width)
+	img, err := a.renderMap(a.naturalEarth.Crop(region), width, height, a.snapshotMapState(), nil, layers)
+	if err != nil {
+		logging.LogError("render region", err)
+		http.Error(w, "Failed to render region", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	encoder := &png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, img); err != nil {
+		http.Error(w, "Failed to encode region", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		slog.Error("Failed to write region PNG", "error", err)
+	}
+}
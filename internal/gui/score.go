@@ -0,0 +1,90 @@
+package gui
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"iptw/internal/events"
+	"iptw/internal/history"
+	"iptw/internal/resources"
+	"iptw/internal/score"
+)
+
+// countryAlpha2 returns the ISO 3166-1 alpha-2 code of a country, "" when
+// unknown.
+func countryAlpha2(country string) string {
+	alpha2, _ := resources.GetAlpha2ByName(country)
+	return alpha2
+}
+
+// scoreBoard keeps the score of the journaled events. It is safe for
+// concurrent use.
+type scoreBoard struct {
+	mu     sync.Mutex
+	scorer *score.Scorer
+}
+
+func newScoreBoard() *scoreBoard {
+	return &scoreBoard{scorer: score.New(countryAlpha2)}
+}
+
+// load recomputes the score from the journal.
+func (b *scoreBoard) load(journal *history.Journal) error {
+	scorer, err := score.Replay(journal, countryAlpha2)
+	if err != nil {
+		return fmt.Errorf("failed to compute score: %w", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.scorer = scorer
+	return nil
+}
+
+// add scores a journaled event and returns the points it earned, the
+// records it set and the score after it.
+func (b *scoreBoard) add(e history.Event) ([]score.Award, []score.Record, score.Summary) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	awards, records := b.scorer.Add(e)
+	if len(awards) == 0 {
+		return nil, nil, score.Summary{}
+	}
+	return awards, records, b.scorer.Summary(e.Time)
+}
+
+// summary returns the score of the day and week containing now.
+func (b *scoreBoard) summary(now time.Time) score.Summary {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.scorer.Summary(now)
+}
+
+// observeScore scores a journaled event, then announces the points and
+// records and journals the records.
+func (a *App) observeScore(e history.Event) {
+	awards, records, summary := a.scores.add(e)
+	for _, award := range awards {
+		a.events.Publish(events.TypeScore, events.ScoreChange{Points: award.Points, Reason: string(award.Reason), Country: award.Country, Today: summary.Today, Total: summary.Total})
+	}
+	for _, record := range records {
+		a.recordEvent(history.Event{Time: e.Time, Type: history.EventRecord, Record: record.Kind, Value: record.Value})
+		a.events.Publish(events.TypeRecord, events.ScoreRecord{Record: record.Kind, Day: record.Day, Value: record.Value})
+		slog.Info("🏆 New personal record", "record", record.Kind, "day", record.Day, "value", record.Value)
+	}
+	if len(awards) > 0 {
+		a.markMapDirty()
+	}
+}
+
+// scoreLine describes the score for the game status rectangle.
+func (a *App) scoreLine() string {
+	summary := a.scores.summary(time.Now())
+	return fmt.Sprintf("Score: %d (today %+d)", summary.Total, summary.Today)
+}
+
+func (a *App) handleAPIScore(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.scores.summary(time.Now()))
+}
@@ -0,0 +1,59 @@
+package gui
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"iptw/internal/events"
+	"iptw/internal/history"
+	"iptw/internal/score"
+)
+
+func TestScore(t *testing.T) {
+	a := newTestApp(t)
+	_, changes, cancel := a.events.Subscribe(0)
+	defer cancel()
+
+	now := time.Now()
+	a.recordEvent(history.Event{Time: now.AddDate(0, 0, -1), Type: history.EventVisit, Country: "United States of America"})
+	a.recordEvent(history.Event{Time: now, Type: history.EventVisit, Country: "Fiji"})
+	a.recordEvent(history.Event{Time: now, Type: history.EventHit, Country: "Fiji"})
+
+	var summary score.Summary
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/score", "", nil), http.StatusOK, &summary)
+	if summary.Today != 100 || summary.Total != 112 || summary.Streak != 2 || summary.LongestStreak != 2 || summary.Reasons[score.ReasonVisit] != 112 {
+		t.Errorf("unexpected score %+v", summary)
+	}
+	if len(summary.BestDays) != 2 || summary.BestDays[0].Points != 100 {
+		t.Errorf("expected today as the best day, got %+v", summary.BestDays)
+	}
+	var stats statsResponse
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/stats", "", nil), http.StatusOK, &stats)
+	if stats.Score != 112 || stats.ScoreToday != 100 {
+		t.Errorf("expected the score in the stats, got %d and %d today", stats.Score, stats.ScoreToday)
+	}
+	if line := a.scoreLine(); line != "Score: 112 (today +100)" {
+		t.Errorf("unexpected status line %q", line)
+	}
+
+	var scored []int
+	var records []string
+	for len(changes) > 0 {
+		e := <-changes
+		var change events.ScoreChange
+		var record events.ScoreRecord
+		switch {
+		case e.Type == events.TypeScore && e.Decode(&change) == nil:
+			scored = append(scored, change.Points)
+		case e.Type == events.TypeRecord && e.Decode(&record) == nil:
+			records = append(records, record.Record)
+		}
+	}
+	if len(scored) != 2 || scored[0] != 12 || scored[1] != 100 {
+		t.Errorf("expected two score events, got %v", scored)
+	}
+	if len(records) != 2 || records[0] != score.RecordBestDay || records[1] != score.RecordStreak {
+		t.Errorf("expected a best day and a streak record, got %v", records)
+	}
+}
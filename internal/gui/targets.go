@@ -0,0 +1,395 @@
+package gui
+
+import (
+	"log/slog"
+	mathrand "math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"iptw/internal/history"
+	"iptw/internal/logging"
+	"iptw/internal/resources"
+)
+
+// targetRegion is a region or sub-region of countries.csv that targets can be
+// drawn from.
+type targetRegion struct {
+	ID        string `json:"id"` // name in the target_pool setting
+	Name      string `json:"name"`
+	Parent    string `json:"parent,omitempty"` // ID of the region a sub-region belongs to
+	Countries int    `json:"countries"`
+	Unvisited int    `json:"unvisited"`
+}
+
+// regionID turns a region name from countries.csv into its name in the
+// target_pool setting: "Western Africa" becomes western-africa.
+func regionID(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), "-"))
+}
+
+// countryRegions returns the IDs of the region, sub-region and intermediate
+// region of a map country, or nil when it is not in countries.csv.
+func countryRegions(country string) []string {
+	alpha2, err := resources.GetAlpha2ByName(country)
+	if err != nil {
+		return nil
+	}
+	info, err := resources.GetCountryByAlpha2(alpha2)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, name := range []string{info.Region, info.SubRegion, info.IntermediateRegion} {
+		if name != "" {
+			ids = append(ids, regionID(name))
+		}
+	}
+	return ids
+}
+
+// targetRegions lists the regions and sub-regions of the map countries,
+// regions first, each followed by its sub-regions.
+func (a *App) targetRegions() []targetRegion {
+	byID := make(map[string]*targetRegion)
+	count := func(id, name, parent string, unvisited bool) {
+		region := byID[id]
+		if region == nil {
+			region = &targetRegion{ID: id, Name: name, Parent: parent}
+			byID[id] = region
+		}
+		region.Countries++
+		if unvisited {
+			region.Unvisited++
+		}
+	}
+	for _, country := range a.naturalEarth.Countries {
+		alpha2, err := resources.GetAlpha2ByName(country.Name)
+		if err != nil {
+			continue
+		}
+		info, err := resources.GetCountryByAlpha2(alpha2)
+		if err != nil || info.Region == "" {
+			continue
+		}
+		unvisited := !a.gameState.HasCountry(country.Name)
+		count(regionID(info.Region), info.Region, "", unvisited)
+		if info.SubRegion != "" {
+			count(regionID(info.SubRegion), info.SubRegion, regionID(info.Region), unvisited)
+		}
+		if info.IntermediateRegion != "" {
+			count(regionID(info.IntermediateRegion), info.IntermediateRegion, regionID(info.Region), unvisited)
+		}
+	}
+
+	regions := make([]targetRegion, 0, len(byID))
+	for _, region := range byID {
+		regions = append(regions, *region)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		pi, pj := regions[i].Parent, regions[j].Parent
+		if pi == "" {
+			pi = regions[i].ID
+		}
+		if pj == "" {
+			pj = regions[j].ID
+		}
+		if pi != pj {
+			return pi < pj
+		}
+		if (regions[i].Parent == "") != (regions[j].Parent == "") {
+			return regions[i].Parent == ""
+		}
+		return regions[i].ID < regions[j].ID
+	})
+	return regions
+}
+
+// parseTargetPool returns the region IDs of a target_pool setting, or nil for
+// all countries.
+func parseTargetPool(pool string) map[string]bool {
+	if pool == "" || pool == "all" {
+		return nil
+	}
+	ids := make(map[string]bool)
+	for _, id := range strings.Split(pool, ",") {
+		ids[id] = true
+	}
+	return ids
+}
+
+// unknownTargetRegions returns the region IDs of a target_pool setting that
+// no map country belongs to.
+func (a *App) unknownTargetRegions(pool string) []string {
+	wanted := parseTargetPool(pool)
+	if wanted == nil {
+		return nil
+	}
+	known := make(map[string]bool)
+	for _, region := range a.targetRegions() {
+		known[region.ID] = true
+	}
+	var unknown []string
+	for id := range wanted {
+		if !known[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// inTargetPool reports whether a country belongs to one of the pool regions;
+// every country does when pool is nil.
+func inTargetPool(country string, pool map[string]bool) bool {
+	if pool == nil {
+		return true
+	}
+	for _, id := range countryRegions(country) {
+		if pool[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// targetCandidates returns the unvisited countries in the target pool, or in
+// the whole world once the pool has been exhausted.
+func (a *App) targetCandidates() []string {
+	a.configMu.RLock()
+	poolSetting := a.config.TargetPool
+	a.configMu.RUnlock()
+	pool := parseTargetPool(poolSetting)
+
+	var inPool, unvisited []string
+	for _, country := range a.naturalEarth.Countries {
+		if a.gameState.HasCountry(country.Name) {
+			continue
+		}
+		unvisited = append(unvisited, country.Name)
+		if inTargetPool(country.Name, pool) {
+			inPool = append(inPool, country.Name)
+		}
+	}
+	if len(inPool) == 0 && len(unvisited) > 0 {
+		slog.Info("No unvisited countries left in the target pool, drawing from the whole world", "pool", poolSetting)
+		return unvisited
+	}
+	return inPool
+}
+
+// targetWeight favours countries that are rare in the travel history and
+// those that bring an unfinished regional achievement closest to completion.
+func (a *App) targetWeight(country string) float64 {
+	closest := 0.0
+	for _, achievement := range a.achievements.GetCountryAchievements(country) {
+		if achievement.Unlocked || achievement.Target == 0 || len(achievement.Countries) == 0 {
+			continue
+		}
+		closest = max(closest, min(float64(achievement.Progress)/float64(achievement.Target), 1))
+	}
+	return (1 + 3*closest) / float64(1+a.heat.countryHits(country))
+}
+
+// drawTarget picks one of candidates, uniformly or weighted by targetWeight
+// depending on the target_mode setting.
+func (a *App) drawTarget(rng *mathrand.Rand, candidates []string) string {
+	a.configMu.RLock()
+	weighted := a.config.TargetMode == "weighted"
+	a.configMu.RUnlock()
+	if !weighted {
+		return candidates[rng.Intn(len(candidates))]
+	}
+
+	weights := make([]float64, len(candidates))
+	total := 0.0
+	for i, country := range candidates {
+		weights[i] = a.targetWeight(country)
+		total += weights[i]
+	}
+	pick := rng.Float64() * total
+	for i, weight := range weights {
+		if pick < weight {
+			return candidates[i]
+		}
+		pick -= weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+// SelectNextTargetCountry makes the next queued country the target, or draws
+// an unvisited country from the target pool when the queue is empty.
+func (a *App) SelectNextTargetCountry() {
+	if a.naturalEarth == nil {
+		return
+	}
+	if country, ok := a.popQueuedTarget(); ok {
+		a.SetTargetCountry(country)
+		return
+	}
+
+	candidates := a.targetCandidates()
+	previousTarget, _ := a.gameState.GetTargetCountry()
+
+	// If no unhit countries remain, clear the target
+	if len(candidates) == 0 {
+		a.gameState.SetTargetCountry("")
+		a.recordEvent(history.Event{Type: history.EventTarget})
+		a.publishTarget("", previousTarget)
+		slog.Info("No more unhit countries available for targeting")
+		return
+	}
+
+	newTarget := a.drawTarget(mathrand.New(mathrand.NewSource(time.Now().UnixNano())), candidates)
+	a.gameState.SetTargetCountry(newTarget)
+	a.recordEvent(history.Event{Type: history.EventTarget, Country: newTarget})
+	a.publishTarget(newTarget, previousTarget)
+	logging.LogTarget(newTarget, len(candidates))
+	a.markMapDirty()
+	a.cacheTargetFact(newTarget)
+}
+
+// retargetOutsidePool draws a new target when the current one is not in the
+// target pool, so a changed pool takes effect at once.
+func (a *App) retargetOutsidePool() {
+	target, _ := a.gameState.GetTargetCountry()
+	a.configMu.RLock()
+	pool := parseTargetPool(a.config.TargetPool)
+	a.configMu.RUnlock()
+	if target != "" && !inTargetPool(target, pool) {
+		a.SelectNextTargetCountry()
+	}
+}
+
+// QueueTargets appends countries to the queue of upcoming targets. They
+// become the target in order as the current one is liberated, re-rolled or
+// times out.
+func (a *App) QueueTargets(countries ...string) {
+	a.targetQueueMu.Lock()
+	a.targetQueue = append(a.targetQueue, countries...)
+	a.targetQueueMu.Unlock()
+	slog.Info("🎯 Targets queued", "countries", countries)
+}
+
+// SetTargetQueue replaces the queue of upcoming targets.
+func (a *App) SetTargetQueue(countries []string) {
+	a.targetQueueMu.Lock()
+	a.targetQueue = append([]string(nil), countries...)
+	a.targetQueueMu.Unlock()
+	slog.Info("🎯 Target queue replaced", "countries", countries)
+}
+
+// queuedTargets returns the upcoming targets, dropping countries visited
+// since they were queued.
+func (a *App) queuedTargets() []string {
+	a.targetQueueMu.Lock()
+	defer a.targetQueueMu.Unlock()
+	pending := a.targetQueue[:0]
+	for _, country := range a.targetQueue {
+		if !a.gameState.HasCountry(country) {
+			pending = append(pending, country)
+		}
+	}
+	a.targetQueue = pending
+	return append([]string(nil), pending...)
+}
+
+// popQueuedTarget removes and returns the first queued country that has not
+// been visited yet.
+func (a *App) popQueuedTarget() (string, bool) {
+	a.targetQueueMu.Lock()
+	defer a.targetQueueMu.Unlock()
+	for len(a.targetQueue) > 0 {
+		country := a.targetQueue[0]
+		a.targetQueue = a.targetQueue[1:]
+		if !a.gameState.HasCountry(country) {
+			return country, true
+		}
+	}
+	return "", false
+}
+
+// resolveTargetCountry resolves a country name or ISO code that is to become
+// a target, writing an error when it is unknown or already visited.
+func (a *App) resolveTargetCountry(w http.ResponseWriter, param string) (string, bool) {
+	name, ok := a.resolveCountry(param)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Unknown country %q", param)
+		return "", false
+	}
+	if a.gameState.HasCountry(name) {
+		writeAPIError(w, http.StatusConflict, "%s has already been visited", name)
+		return "", false
+	}
+	return name, true
+}
+
+// targetQueue is the queue of upcoming targets, and the body of requests
+// changing it.
+type targetQueue struct {
+	Countries []string `json:"countries"` // names or ISO codes in requests
+}
+
+// targetRegionList is returned by /api/v1/target/regions.
+type targetRegionList struct {
+	Pool    string         `json:"pool"` // target_pool setting
+	Regions []targetRegion `json:"regions"`
+}
+
+func (a *App) handleAPITargetQueue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, targetQueue{Countries: a.queuedTargets()})
+}
+
+// decodeTargetQueue reads a targetQueue request and resolves its countries,
+// writing an error when one cannot become a target.
+func (a *App) decodeTargetQueue(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var req targetQueue
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "%v", err)
+		return nil, false
+	}
+	names := make([]string, 0, len(req.Countries))
+	for _, param := range req.Countries {
+		name, ok := a.resolveTargetCountry(w, param)
+		if !ok {
+			return nil, false
+		}
+		names = append(names, name)
+	}
+	return names, true
+}
+
+func (a *App) handleAPISetTargetQueue(w http.ResponseWriter, r *http.Request) {
+	names, ok := a.decodeTargetQueue(w, r)
+	if !ok {
+		return
+	}
+	a.SetTargetQueue(names)
+	writeJSON(w, http.StatusOK, targetQueue{Countries: a.queuedTargets()})
+}
+
+func (a *App) handleAPIQueueTargets(w http.ResponseWriter, r *http.Request) {
+	names, ok := a.decodeTargetQueue(w, r)
+	if !ok {
+		return
+	}
+	if len(names) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "No countries to queue")
+		return
+	}
+	a.QueueTargets(names...)
+	writeJSON(w, http.StatusOK, targetQueue{Countries: a.queuedTargets()})
+}
+
+func (a *App) handleAPIClearTargetQueue(w http.ResponseWriter, r *http.Request) {
+	a.SetTargetQueue(nil)
+	writeJSON(w, http.StatusOK, targetQueue{Countries: []string{}})
+}
+
+func (a *App) handleAPITargetRegions(w http.ResponseWriter, r *http.Request) {
+	a.configMu.RLock()
+	pool := a.config.TargetPool
+	a.configMu.RUnlock()
+	writeJSON(w, http.StatusOK, targetRegionList{Pool: pool, Regions: a.targetRegions()})
+}
@@ -0,0 +1,97 @@
+package gui
+
+import (
+	"math/rand"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTargetPool(t *testing.T) {
+	a := newTestApp(t)
+	token := map[string]string{"X-Session-Token": "secret"}
+
+	var regions targetRegionList
+	decodeResponse(t, serveAPI(t, a, http.MethodGet, "/api/v1/target/regions", "", nil), http.StatusOK, &regions)
+	ids := make(map[string]targetRegion)
+	for _, region := range regions.Regions {
+		ids[region.ID] = region
+	}
+	if regions.Pool != "all" || ids["africa"].Parent != "" || ids["western-africa"].Parent != "africa" || ids["western-africa"].Countries == 0 {
+		t.Fatalf("expected Africa and Western Africa among the regions, got %+v", regions)
+	}
+
+	expectAPIError(t, serveAPI(t, a, http.MethodPatch, "/api/v1/config", `{"target_pool": "atlantis"}`, token), http.StatusBadRequest, "bad_request")
+	a.SetTargetCountry("Peru")
+	serveAPI(t, a, http.MethodPatch, "/api/v1/config", `{"target_pool": "western-africa"}`, token)
+	for range 20 {
+		target, _ := a.gameState.GetTargetCountry()
+		if !slices.Contains(countryRegions(target), "western-africa") {
+			t.Fatalf("expected a target in Western Africa, got %q", target)
+		}
+		a.SelectNextTargetCountry()
+	}
+
+	// An exhausted pool falls back to the whole world
+	for _, country := range a.targetCandidates() {
+		a.gameState.AddCountryHit(country)
+	}
+	a.SelectNextTargetCountry()
+	if target, _ := a.gameState.GetTargetCountry(); target == "" || slices.Contains(countryRegions(target), "western-africa") {
+		t.Errorf("expected a target outside Western Africa, got %q", target)
+	}
+}
+
+func TestTargetQueue(t *testing.T) {
+	a := newTestApp(t)
+	token := map[string]string{"X-Session-Token": "secret"}
+
+	var queue targetQueue
+	decodeResponse(t, serveAPI(t, a, http.MethodPut, "/api/v1/target/queue", `{"countries": ["GH", "Senegal"]}`, token), http.StatusOK, &queue)
+	decodeResponse(t, serveAPI(t, a, http.MethodPost, "/api/v1/target/queue", `{"countries": ["mali"]}`, token), http.StatusOK, &queue)
+	if !slices.Equal(queue.Countries, []string{"Ghana", "Senegal", "Mali"}) {
+		t.Fatalf("expected Ghana, Senegal and Mali queued, got %v", queue.Countries)
+	}
+	a.gameState.AddCountryHit("France")
+	expectAPIError(t, serveAPI(t, a, http.MethodPost, "/api/v1/target/queue", `{"countries": ["France"]}`, token), http.StatusConflict, "conflict")
+	expectAPIError(t, serveAPI(t, a, http.MethodPost, "/api/v1/target/queue", `{"countries": ["Mali"]}`, nil), http.StatusForbidden, "forbidden")
+
+	// Countries visited while queued are skipped
+	a.gameState.AddCountryHit("Senegal")
+	var target targetResponse
+	decodeResponse(t, serveAPI(t, a, http.MethodPost, "/api/v1/target/reroll", "", token), http.StatusOK, &target)
+	if target.Country != "Ghana" || !slices.Equal(target.Queue, []string{"Mali"}) {
+		t.Errorf("expected Ghana as the target and Mali queued, got %+v", target)
+	}
+	a.SelectNextTargetCountry()
+	if target, _ := a.gameState.GetTargetCountry(); target != "Mali" {
+		t.Errorf("expected Mali as the target, got %q", target)
+	}
+
+	serveAPI(t, a, http.MethodPost, "/api/v1/target/queue", `{"countries": ["Chad"]}`, token)
+	decodeResponse(t, serveAPI(t, a, http.MethodDelete, "/api/v1/target/queue", "", token), http.StatusOK, &queue)
+	if len(a.queuedTargets()) != 0 {
+		t.Errorf("expected an empty queue, got %v", a.queuedTargets())
+	}
+}
+
+func TestWeightedTargets(t *testing.T) {
+	a := newTestApp(t)
+	for range 100 {
+		a.heat.add(time.Now(), "Chad", 0, 0)
+	}
+	if rare, common := a.targetWeight("Niger"), a.targetWeight("Chad"); rare <= common {
+		t.Errorf("expected a rare country to weigh more, got %v for Niger and %v for Chad", rare, common)
+	}
+
+	a.config.TargetMode = "weighted"
+	rng := rand.New(rand.NewSource(1))
+	picks := make(map[string]int)
+	for range 1000 {
+		picks[a.drawTarget(rng, []string{"Niger", "Chad"})]++
+	}
+	if picks["Niger"] < 900 {
+		t.Errorf("expected Niger to be drawn most of the time, got %v", picks)
+	}
+}
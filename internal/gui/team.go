@@ -0,0 +1,143 @@
+package gui
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"iptw/internal/profile"
+	"iptw/internal/team"
+)
+
+// teamPushTimeout bounds one push to the team server.
+const teamPushTimeout = 15 * time.Second
+
+// teamSyncLoop pushes a summary of the game to the team server every
+// team_interval minutes while team_server is set. A server that is down is
+// retried at the next interval; the game is never held up by it.
+func (a *App) teamSyncLoop() {
+	defer a.loops.Done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-a.done
+		cancel()
+	}()
+
+	client := &http.Client{Timeout: teamPushTimeout}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	var lastPush time.Time
+	failing := false
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+
+		a.configMu.RLock()
+		server, interval := a.config.TeamServer, time.Duration(a.config.TeamInterval)*time.Minute
+		a.configMu.RUnlock()
+		if server == "off" || time.Since(lastPush) < interval {
+			continue
+		}
+		lastPush = time.Now()
+
+		err := a.pushTeamSummary(ctx, client, server, lastPush)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return
+		case err != nil && !failing:
+			slog.Warn("Failed to push to the team server - retrying later", "server", server, "error", err)
+		case err != nil:
+			slog.Debug("Team server still unavailable", "server", server, "error", err)
+		case failing:
+			slog.Info("🤝 Team server reachable again", "server", server)
+		}
+		failing = err != nil
+	}
+}
+
+// pushTeamSummary sends the summary of the game to the team server.
+func (a *App) pushTeamSummary(ctx context.Context, client *http.Client, server string, now time.Time) error {
+	keyPath, err := team.DefaultKeyPath()
+	if err != nil {
+		return err
+	}
+	key, err := team.LoadKey(keyPath)
+	if err != nil {
+		return err
+	}
+	summary := a.teamSummary(now)
+	if err := team.Push(ctx, client, server, key, summary); err != nil {
+		return err
+	}
+	slog.Debug("Summary pushed to the team server", "player", summary.Player, "countries", len(summary.Countries))
+	return nil
+}
+
+// teamSummary returns what the team sees of the game: countries, unlocked
+// achievements and score, without any address.
+func (a *App) teamSummary(now time.Time) team.Summary {
+	summary := team.Summary{
+		Player:       a.teamPlayer(),
+		Time:         now,
+		Countries:    make(map[string]team.CountrySummary),
+		Achievements: []string{},
+	}
+	for country, state := range a.gameState.GetCountries() {
+		summary.Countries[country] = team.CountrySummary{Hits: state.HitCount, Prison: state.MatrixPrison}
+	}
+	for _, achievement := range a.achievements.GetUnlockedAchievements() {
+		summary.Achievements = append(summary.Achievements, achievement.ID)
+	}
+	sort.Strings(summary.Achievements)
+	scores := a.scores.summary(now)
+	summary.Score = team.ScoreSummary{Today: scores.Today, Week: scores.Week, Total: scores.Total}
+	return summary
+}
+
+// teamPlayer returns the name on the team leaderboard: the team_player
+// setting, or with auto the active profile, or the user name on the default
+// profile.
+func (a *App) teamPlayer() string {
+	a.configMu.RLock()
+	name, active := a.config.TeamPlayer, a.config.Profile
+	a.configMu.RUnlock()
+	if name != "auto" {
+		return name
+	}
+	if active != profile.Default {
+		return active
+	}
+	if u, err := user.Current(); err == nil {
+		return playerName(u.Username)
+	}
+	return "player"
+}
+
+// playerName turns a user name into a valid player name, dropping a Windows
+// domain and replacing other characters.
+func playerName(username string) string {
+	if i := strings.LastIndex(username, `\`); i >= 0 {
+		username = username[i+1:]
+	}
+	name := strings.Map(func(r rune) rune {
+		if team.ValidPlayer(string(r)) {
+			return r
+		}
+		return '_'
+	}, username)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	if !team.ValidPlayer(name) {
+		return "player"
+	}
+	return name
+}
@@ -0,0 +1,51 @@
+package gui
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"iptw/internal/team"
+)
+
+func TestTeamPush(t *testing.T) {
+	a := newTestApp(t)
+	a.config.TeamPlayer = "ada"
+	a.gameState.AddCountryHit("France")
+	for i := 0; i < 10; i++ {
+		a.gameState.AddCountryHit("Peru")
+	}
+
+	server, err := team.NewServer("secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(server.Handler())
+	defer srv.Close()
+
+	// Without a team key nothing is sent
+	if err := a.pushTeamSummary(context.Background(), srv.Client(), srv.URL, time.Now()); err == nil {
+		t.Fatal("expected an error without a team key")
+	}
+	keyPath, err := team.DefaultKeyPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := team.SaveKey(keyPath, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.pushTeamSummary(context.Background(), srv.Client(), srv.URL, time.Now()); err != nil {
+		t.Fatalf("pushTeamSummary failed: %v", err)
+	}
+	board := server.Leaderboard()
+	if board.Players != 1 || board.Standings[0].Player != "ada" || board.Standings[0].Visited != 2 || board.Standings[0].Prison != 1 {
+		t.Errorf("unexpected leaderboard %+v", board)
+	}
+
+	for username, want := range map[string]string{`CORP\ada`: "ada", "ada lovelace": "ada_lovelace", "": "player"} {
+		if got := playerName(username); got != want {
+			t.Errorf("playerName(%q) = %q, want %q", username, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package gui
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"iptw/internal/config"
+	"iptw/internal/resources"
+)
+
+// loadConfiguredTheme returns the configured theme, falling back to the
+// default when it cannot be loaded so a broken theme file never stops the app.
+func loadConfiguredTheme(cfg *config.Config) *resources.Theme {
+	theme, err := resources.ResolveTheme(cfg.Theme, cfg.Black)
+	if err != nil {
+		slog.Warn("Failed to load theme, using the default", "theme", cfg.Theme, "error", err)
+		return resources.DefaultTheme(cfg.Black)
+	}
+	return theme
+}
+
+// currentTheme returns the theme the map is painted with.
+func (a *App) currentTheme() *resources.Theme {
+	a.themeMu.RLock()
+	defer a.themeMu.RUnlock()
+	return a.theme
+}
+
+// setTheme switches to the named theme ("auto", a preset or a user theme),
+// saves the choice and repaints the map on the next tick.
+func (a *App) setTheme(name string) error {
+	if err := a.applyTheme(name); err != nil {
+		return err
+	}
+	if err := a.saveConfig(); err != nil {
+		slog.Error("Failed to save config after changing theme", "error", err)
+	}
+	return nil
+}
+
+// applyTheme switches to the named theme without saving the config.
+func (a *App) applyTheme(name string) error {
+	// User files are re-read, so selecting the current theme again picks up
+	// edits to it
+	a.configMu.RLock()
+	black := a.config.Black
+	a.configMu.RUnlock()
+	theme, err := resources.ResolveTheme(name, black)
+	if err != nil {
+		return err
+	}
+
+	a.themeMu.Lock()
+	a.theme = theme
+	a.themeName = name
+	a.themeMu.Unlock()
+
+	a.configMu.Lock()
+	a.config.Theme = name
+	a.configMu.Unlock()
+
+	slog.Info("🎨 Theme changed", "theme", name)
+	a.publishConfig("theme", name)
+	a.markMapDirty()
+	return nil
+}
+
+// themeResponse is returned by /api/theme.
+type themeResponse struct {
+	Current   string           `json:"current"`
+	Theme     *resources.Theme `json:"theme"`
+	Available []string         `json:"available"`
+}
+
+// handleTheme serves the current theme on GET and switches themes on POST
+// with a JSON body {"name": "..."}.
+func (a *App) handleTheme(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		a.requireSessionToken(a.handleSetTheme)(w, r)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	a.themeMu.RLock()
+	resp := themeResponse{Current: a.themeName, Theme: a.theme}
+	a.themeMu.RUnlock()
+	resp.Available = append([]string{resources.ThemeAuto}, resources.ThemeNames()...)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode theme response", "error", err)
+	}
+}
+
+// handleSetTheme switches the theme named in the request body.
+func (a *App) handleSetTheme(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, `Expected JSON body {"name": "<theme>"}`, http.StatusBadRequest)
+		return
+	}
+	if err := a.setTheme(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"current": req.Name,
+	}); err != nil {
+		slog.Error("Failed to encode theme response", "error", err)
+	}
+}
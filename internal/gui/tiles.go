@@ -0,0 +1,170 @@
+package gui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"iptw/internal/logging"
+	"iptw/internal/resources"
+)
+
+// maxCachedTiles bounds the tile cache; it is emptied when full.
+const maxCachedTiles = 1024
+
+// tileKey addresses one XYZ tile.
+type tileKey struct{ z, x, y int }
+
+// tileCache keeps encoded tiles for one map version. Tiles are dropped
+// wholesale when the version changes, i.e. when a state change would make any
+// tile render differently.
+type tileCache struct {
+	mu      sync.Mutex
+	version string
+	tiles   map[tileKey][]byte
+}
+
+// get returns a cached tile for the version, dropping the cache if it holds
+// another version.
+func (c *tileCache) get(version string, key tileKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != version {
+		c.version = version
+		c.tiles = nil
+		return nil, false
+	}
+	png, ok := c.tiles[key]
+	return png, ok
+}
+
+// put stores a tile rendered for version.
+func (c *tileCache) put(version string, key tileKey, png []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != version {
+		return
+	}
+	if c.tiles == nil || len(c.tiles) >= maxCachedTiles {
+		c.tiles = make(map[tileKey][]byte)
+	}
+	c.tiles[key] = png
+}
+
+// tileVersion fingerprints the current look of the tiles.
+func (a *App) tileVersion(state mapState) string {
+	return resources.TileVersion(a.currentTheme(), state.hitCountries, state.targetCountries, a.flagManager, state.matrixPrisonCountries, state.liberatedCountries, a.subdivisions, state.visitedSubdivisions)
+}
+
+// parseTilePath parses "{z}/{x}/{y}.png".
+func parseTilePath(path string) (tileKey, bool) {
+	parts := strings.Split(strings.TrimSuffix(path, ".png"), "/")
+	if len(parts) != 3 || !strings.HasSuffix(path, ".png") {
+		return tileKey{}, false
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return tileKey{}, false
+		}
+		v[i] = n
+	}
+	key := tileKey{z: v[0], x: v[1], y: v[2]}
+	return key, resources.ValidTile(key.z, key.x, key.y)
+}
+
+// handleTile serves /tiles/{z}/{x}/{y}.png, Web Mercator tiles of the current
+// map state. Tiles carry the map version as their ETag, so clients can
+// revalidate them cheaply.
+func (a *App) handleTile(w http.ResponseWriter, r *http.Request) {
+	if a.naturalEarth == nil {
+		http.Error(w, "Map data not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	key, ok := parseTilePath(strings.TrimPrefix(r.URL.Path, "/tiles/"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Tiles are /tiles/{z}/{x}/{y}.png with z from 0 to %d", resources.MaxTileZoom), http.StatusNotFound)
+		return
+	}
+
+	state := a.snapshotMapState()
+	version := a.tileVersion(state)
+	etag := `"` + version + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	pngBytes, ok := a.tiles.get(version, key)
+	if !ok {
+		img, err := resources.RenderTile(a.naturalEarth, key.z, key.x, key.y, a.currentTheme(), state.hitCountries, state.targetCountries, a.flagManager, state.matrixPrisonCountries, state.liberatedCountries, a.subdivisions, state.visitedSubdivisions)
+		if err != nil {
+			logging.LogError("render tile", err)
+			http.Error(w, "Failed to render tile", http.StatusInternalServerError)
+			return
+		}
+		var buf bytes.Buffer
+		encoder := &png.Encoder{CompressionLevel: png.BestSpeed}
+		if err := encoder.Encode(&buf, img); err != nil {
+			http.Error(w, "Failed to encode tile", http.StatusInternalServerError)
+			return
+		}
+		pngBytes = buf.Bytes()
+		a.tiles.put(version, key, pngBytes)
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	if _, err := w.Write(pngBytes); err != nil {
+		slog.Error("Failed to write tile", "error", err)
+	}
+}
+
+// handleMapVersion serves the current map version so clients know when to
+// refresh tiles and country states.
+func (a *App) handleMapVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"version":  a.tileVersion(a.snapshotMapState()),
+		"max_zoom": resources.MaxTileZoom,
+	}); err != nil {
+		slog.Error("Failed to encode map version", "error", err)
+	}
+}
+
+// handleCountriesGeoJSON serves every country with simplified outlines and its
+// state. The "tolerance" query parameter sets the simplification in degrees.
+func (a *App) handleCountriesGeoJSON(w http.ResponseWriter, r *http.Request) {
+	if a.naturalEarth == nil {
+		http.Error(w, "Map data not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	tolerance := resources.DefaultSimplifyTolerance
+	if param := r.URL.Query().Get("tolerance"); param != "" {
+		t, err := strconv.ParseFloat(param, 64)
+		if err != nil || t < 0 || t > 5 {
+			http.Error(w, "tolerance must be between 0 and 5 degrees", http.StatusBadRequest)
+			return
+		}
+		tolerance = t
+	}
+
+	state := a.snapshotMapState()
+	fc := resources.CountryFeatures(a.naturalEarth, tolerance, state.hitCountries, state.targetCountries, state.matrixPrisonCountries, state.liberatedCountries)
+	fc.ExtraMembers = map[string]interface{}{"version": a.tileVersion(state)}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(fc); err != nil {
+		slog.Error("Failed to encode countries GeoJSON", "error", err)
+	}
+}
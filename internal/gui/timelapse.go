@@ -0,0 +1,130 @@
+package gui
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"iptw/internal/history"
+	"iptw/internal/resources"
+	"iptw/internal/timelapse"
+)
+
+// defaultTimelapseWidth keeps on-demand timelapses quick to render.
+const defaultTimelapseWidth = 800
+
+// maxTimelapseDays and maxTimelapseWidth bound an on-demand timelapse, as its
+// frames, one per day, are all kept in memory until the GIF is encoded: about
+// 300 MB at the limits. iptw timelapse renders larger ones.
+const (
+	maxTimelapseDays  = 366
+	maxTimelapseWidth = 1280
+)
+
+// serveTimelapseGIF renders the travel history between the "from" and "to"
+// query parameters (YYYY-MM-DD, both optional) as an animated GIF. "fps" and
+// "width" override the frame rate and size. At most maxTimelapseDays days are
+// rendered, at most maxTimelapseWidth pixels wide.
+func (a *App) serveTimelapseGIF(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		http.Error(w, "Travel history is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	var from, to time.Time
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if value := query.Get(p.name); value != "" {
+			t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s date %q (want YYYY-MM-DD)", p.name, value), http.StatusBadRequest)
+				return
+			}
+			*p.dst = t
+		}
+	}
+	a.configMu.RLock()
+	opts := timelapse.Options{
+		FPS:    timelapse.DefaultFPS,
+		Width:  defaultTimelapseWidth,
+		Theme:  a.currentTheme(),
+		Insets: resources.NewInsetOptions(a.config.InsetMinArea),
+		Labels: resources.NewLabelOptions(a.config.Labels, a.config.LabelCountries != "all", a.config.LabelMinArea),
+		Legend: resources.NewLegendOptions(a.config.Legend),
+	}
+	a.configMu.RUnlock()
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"fps", &opts.FPS}, {"width", &opts.Width}} {
+		if value := query.Get(p.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, fmt.Sprintf("Invalid %s %q", p.name, value), http.StatusBadRequest)
+				return
+			}
+			*p.dst = n
+		}
+	}
+	if opts.Width > maxTimelapseWidth {
+		http.Error(w, fmt.Sprintf("A timelapse is at most %d pixels wide; use iptw timelapse for larger ones", maxTimelapseWidth), http.StatusBadRequest)
+		return
+	}
+
+	// Resolve the range as Replay would, so its length is known up front
+	if from.IsZero() {
+		err := a.history.Scan(time.Time{}, func(e history.Event) bool {
+			from = e.Time
+			return false
+		})
+		if err != nil {
+			slog.Error("Failed to read travel history", "error", err)
+			http.Error(w, "Failed to read travel history", http.StatusInternalServerError)
+			return
+		}
+		if from.IsZero() {
+			http.Error(w, "Travel history is empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if timelapse.DayCount(from, to) > maxTimelapseDays {
+		http.Error(w, fmt.Sprintf("A timelapse covers at most %d days; narrow it with from and to", maxTimelapseDays), http.StatusBadRequest)
+		return
+	}
+
+	days, err := timelapse.Replay(a.history, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renderer := &timelapse.Renderer{
+		NaturalEarth: a.naturalEarth,
+		Flags:        a.flagManager,
+		Fonts:        a.fontManager,
+		Options:      opts,
+	}
+	var buf bytes.Buffer
+	if err := renderer.WriteGIF(r.Context(), &buf, days); err != nil {
+		if r.Context().Err() == nil {
+			slog.Error("Failed to render timelapse", "error", err)
+			http.Error(w, "Failed to render timelapse", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Content-Disposition", `inline; filename="iptw-timelapse.gif"`)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		slog.Error("Failed to write timelapse GIF", "error", err)
+	}
+}
@@ -0,0 +1,49 @@
+package gui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iptw/internal/history"
+)
+
+func TestTimelapseRange(t *testing.T) {
+	a := newTestApp(t)
+	journal, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = journal.Close() }()
+	a.history = journal
+	if err := journal.Append(history.Event{Time: time.Now().AddDate(-2, 0, 0), Type: history.EventHit, Country: "Chile"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{
+		"from=0001-01-01",
+		"", // from the first event, two years ago
+		"from=2026-01-01&to=9999-12-31",
+	} {
+		rec := httptest.NewRecorder()
+		a.serveTimelapseGIF(rec, httptest.NewRequest(http.MethodGet, "/api/timelapse.gif?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400 for more than %d days, got %d", query, maxTimelapseDays, rec.Code)
+		}
+	}
+
+	from := time.Now().AddDate(0, 0, -2).Format(time.DateOnly)
+	rec := httptest.NewRecorder()
+	a.serveTimelapseGIF(rec, httptest.NewRequest(http.MethodGet, "/api/timelapse.gif?width=3840&from="+from, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a width over %d, got %d", maxTimelapseWidth, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	a.serveTimelapseGIF(rec, httptest.NewRequest(http.MethodGet, "/api/timelapse.gif?width=200&from="+from, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/gif" {
+		t.Errorf("expected a GIF of 3 days, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,360 @@
+package gui
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+
+	"fyne.io/systray"
+
+	"iptw/internal/events"
+	"iptw/internal/profile"
+	"iptw/internal/resources"
+)
+
+// Tray is the system tray front-end of an App. It needs a desktop session;
+// use App.RunHeadless where there is none.
+type Tray struct {
+	app              *App
+	wallpaperItem    *systray.MenuItem            // "Update OS Wallpaper" checkbox
+	startOnLoginItem *systray.MenuItem            // "Start on Login" checkbox
+	themeItems       map[string]*systray.MenuItem // Theme entries by name
+	poolItems        map[string]*systray.MenuItem // Target pool entries by target_pool value
+	weightedItem     *systray.MenuItem            // "Weighted Draw" checkbox
+	profileMenu      *systray.MenuItem            // "Profile" submenu
+	profileItems     map[string]*systray.MenuItem // Profile entries by name
+}
+
+// NewTray returns a tray front-end for app.
+func NewTray(app *App) *Tray {
+	return &Tray{app: app}
+}
+
+// Run shows the tray icon and starts the engine. It blocks until Quit is
+// chosen, SIGINT or SIGTERM is received or another launch asks to quit, then
+// shuts the engine down.
+func (t *Tray) Run() error {
+	// Start systray lifecycle. This blocks until systray quits.
+	systray.Run(t.onReady, t.onExit)
+	return nil
+}
+
+func (t *Tray) onReady() {
+	// Catch any panic inside onReady so it appears in the log file rather than
+	// silently terminating the systray message pump.
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic in onReady", "recover", r)
+		}
+	}()
+	a := t.app
+	slog.Info("onReady called – systray pump is live")
+
+	// Setup Systray
+	setTrayIcon()
+	setTrayTitleAndTooltip("IPTW", "IP Travel Map")
+
+	a.configMu.RLock()
+	updateWallpaper, startOnLogin := a.config.UpdateWallpaper, a.config.StartOnLogin
+	a.configMu.RUnlock()
+	mShowMap := systray.AddMenuItem("Show Map", "Open the interactive travel map")
+	t.wallpaperItem = systray.AddMenuItemCheckbox("Update OS Wallpaper", "Automatically update desktop wallpaper", updateWallpaper)
+	t.startOnLoginItem = systray.AddMenuItemCheckbox("Start on Login", "Automatically start IP Travel Map on system login", startOnLogin)
+	t.addThemeMenu()
+	t.addTargetMenu()
+	t.addProfileMenu()
+	systray.AddSeparator()
+	mQuit := systray.AddMenuItem("Quit", "Quit the whole app")
+
+	// Keep the checkboxes in step with changes made elsewhere, then start
+	// the engine so no change is missed
+	_, changes, cancel := a.events.Subscribe(0)
+	go t.followSettings(changes, cancel)
+	a.Start()
+
+	// Quit the tray on SIGINT, SIGTERM and quit requests so shutdown runs as
+	// from the menu
+	go func() {
+		a.waitForSignals()
+		systray.Quit()
+	}()
+
+	// Handle Menu events
+	go func() {
+		for {
+			select {
+			case <-mShowMap.ClickedCh:
+				if err := a.OpenMap(); err != nil {
+					slog.Error("Failed to open map", "error", err)
+				}
+			case <-t.wallpaperItem.ClickedCh:
+				a.configMu.RLock()
+				newVal := !a.config.UpdateWallpaper
+				a.configMu.RUnlock()
+				a.setUpdateWallpaper(newVal)
+				if err := a.saveConfig(); err != nil {
+					slog.Error("Failed to save config after toggling wallpaper", "error", err)
+				}
+			case <-t.startOnLoginItem.ClickedCh:
+				a.configMu.RLock()
+				newVal := !a.config.StartOnLogin
+				a.configMu.RUnlock()
+				a.setStartOnLogin(newVal)
+				if err := a.saveConfig(); err != nil {
+					slog.Error("Failed to save config after toggling start-on-login", "error", err)
+				}
+			case <-mQuit.ClickedCh:
+				systray.Quit()
+				return
+			}
+		}
+	}()
+}
+
+func (t *Tray) onExit() {
+	slog.Info("Received shutdown signal from systray, cleaning up...")
+	t.app.Shutdown()
+}
+
+// addThemeMenu adds a submenu listing the available themes.
+func (t *Tray) addThemeMenu() {
+	a := t.app
+	a.themeMu.RLock()
+	current := a.themeName
+	a.themeMu.RUnlock()
+
+	menu := systray.AddMenuItem("Theme", "Choose the map colours")
+	t.themeItems = make(map[string]*systray.MenuItem)
+	for _, name := range append([]string{resources.ThemeAuto}, resources.ThemeNames()...) {
+		item := menu.AddSubMenuItemCheckbox(name, fmt.Sprintf("Paint the map with the %s theme", name), name == current)
+		t.themeItems[name] = item
+		go func() {
+			for range item.ClickedCh {
+				if err := a.setTheme(name); err != nil {
+					slog.Error("Failed to change theme", "theme", name, "error", err)
+				}
+			}
+		}()
+	}
+}
+
+// addProfileMenu adds a submenu listing the player profiles.
+func (t *Tray) addProfileMenu() {
+	names, err := profile.List()
+	if err != nil {
+		slog.Warn("Failed to list profiles", "error", err)
+	}
+	current := t.app.activeProfile()
+	t.profileMenu = systray.AddMenuItem("Profile", "Choose the player whose game is played")
+	t.profileItems = make(map[string]*systray.MenuItem)
+	for _, name := range append(names, current) {
+		t.addProfileItem(name, name == current)
+	}
+}
+
+// addProfileItem adds a profile to the Profile submenu unless it is listed.
+func (t *Tray) addProfileItem(name string, checked bool) {
+	if t.profileItems[name] != nil {
+		return
+	}
+	item := t.profileMenu.AddSubMenuItemCheckbox(name, fmt.Sprintf("Play as %s", name), checked)
+	t.profileItems[name] = item
+	go func() {
+		for range item.ClickedCh {
+			t.changeSetting("profile", name)
+		}
+	}()
+}
+
+// addTargetMenu adds a submenu to draw a new target, choose one, start or
+// abandon an expedition, and pick the pool and mode of the draws.
+func (t *Tray) addTargetMenu() {
+	a := t.app
+	if a.naturalEarth == nil {
+		return
+	}
+	a.configMu.RLock()
+	pool, mode := a.config.TargetPool, a.config.TargetMode
+	a.configMu.RUnlock()
+
+	menu := systray.AddMenuItem("Target", "Choose the target country")
+	next := menu.AddSubMenuItem("Next Target", "Make the next queued country the target, or draw one")
+	go func() {
+		for range next.ClickedCh {
+			a.SelectNextTargetCountry()
+		}
+	}()
+	start := menu.AddSubMenuItem("Start Expedition", "Draw several targets to reach before a deadline")
+	go func() {
+		for range start.ClickedCh {
+			if _, err := a.StartExpedition(a.expeditionDefaults()); err != nil {
+				slog.Warn("Cannot start an expedition", "error", err)
+			}
+		}
+	}()
+	abandon := menu.AddSubMenuItem("Abandon Expedition", "Give up the running expedition")
+	go func() {
+		for range abandon.ClickedCh {
+			if _, err := a.AbandonExpedition(); err != nil {
+				slog.Warn("Cannot abandon the expedition", "error", err)
+			}
+		}
+	}()
+	t.weightedItem = menu.AddSubMenuItemCheckbox("Weighted Draw", "Favour rare countries and nearly finished regions", mode == "weighted")
+	go func() {
+		for range t.weightedItem.ClickedCh {
+			a.configMu.RLock()
+			newMode := "weighted"
+			if a.config.TargetMode == "weighted" {
+				newMode = "random"
+			}
+			a.configMu.RUnlock()
+			t.changeSetting("target_mode", newMode)
+		}
+	}()
+
+	// Pools: every country, a region, or one of its sub-regions
+	regions := a.targetRegions()
+	poolMenu := menu.AddSubMenuItem("Pool", "Draw targets from a region only")
+	t.poolItems = make(map[string]*systray.MenuItem)
+	addPool := func(parent *systray.MenuItem, value, title string) {
+		item := parent.AddSubMenuItemCheckbox(title, fmt.Sprintf("Draw targets from %s", title), value == pool)
+		t.poolItems[value] = item
+		go func() {
+			for range item.ClickedCh {
+				t.changeSetting("target_pool", value)
+			}
+		}()
+	}
+	addPool(poolMenu, "all", "All Countries")
+	regionMenus := make(map[string]*systray.MenuItem)
+	for _, region := range regions {
+		if region.Parent == "" {
+			regionMenus[region.ID] = poolMenu.AddSubMenuItem(region.Name, "")
+			addPool(regionMenus[region.ID], region.ID, "All of "+region.Name)
+		} else if parent := regionMenus[region.Parent]; parent != nil {
+			addPool(parent, region.ID, region.Name)
+		}
+	}
+
+	// Countries to choose from, by region
+	chooseMenu := menu.AddSubMenuItem("Choose", "Make a country the target")
+	byRegion := make(map[string][]string)
+	for _, country := range a.naturalEarth.Countries {
+		if ids := countryRegions(country.Name); len(ids) > 0 {
+			byRegion[ids[0]] = append(byRegion[ids[0]], country.Name)
+		}
+	}
+	for _, region := range regions {
+		if region.Parent != "" {
+			continue
+		}
+		regionMenu := chooseMenu.AddSubMenuItem(region.Name, "")
+		countries := byRegion[region.ID]
+		sort.Strings(countries)
+		for _, country := range countries {
+			item := regionMenu.AddSubMenuItem(country, "")
+			go func() {
+				for range item.ClickedCh {
+					if a.gameState.HasCountry(country) {
+						slog.Warn("Cannot target a visited country", "country", country)
+						continue
+					}
+					a.SetTargetCountry(country)
+				}
+			}()
+		}
+	}
+}
+
+// changeSetting applies and saves a setting chosen from the menu.
+func (t *Tray) changeSetting(key, value string) {
+	if _, err := t.app.applySettings(configPatch{key: value}); err != nil {
+		slog.Error("Failed to change setting", "setting", key, "error", err)
+		return
+	}
+	if err := t.app.saveConfig(); err != nil {
+		slog.Error("Failed to save config", "setting", key, "error", err)
+	}
+}
+
+// followSettings updates the menu from config events, whether a setting was
+// changed from the menu, the API or a reload. It resubscribes when it falls
+// behind and returns once the engine stops.
+func (t *Tray) followSettings(changes <-chan events.Event, cancel func()) {
+	var lastID uint64
+	for {
+		for e := range changes {
+			lastID = e.ID
+			if e.Type != events.TypeConfig {
+				continue
+			}
+			var change events.ConfigChange
+			if err := e.Decode(&change); err == nil {
+				t.showSetting(change.Key, change.Value)
+			}
+		}
+		cancel()
+		if t.app.stopped() {
+			return
+		}
+
+		var replay []events.Event
+		replay, changes, cancel = t.app.events.Subscribe(lastID)
+		for _, e := range replay {
+			var change events.ConfigChange
+			if e.Type == events.TypeConfig && e.Decode(&change) == nil {
+				t.showSetting(change.Key, change.Value)
+			}
+			lastID = e.ID
+		}
+	}
+}
+
+// showSetting checks or unchecks the menu items for a setting.
+func (t *Tray) showSetting(key, value string) {
+	switch key {
+	case "update_wallpaper", "start_on_login":
+		item := t.wallpaperItem
+		if key == "start_on_login" {
+			item = t.startOnLoginItem
+		}
+		if enabled, _ := strconv.ParseBool(value); enabled {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+	case "target_mode":
+		if value == "weighted" {
+			t.weightedItem.Check()
+		} else {
+			t.weightedItem.Uncheck()
+		}
+	case "target_pool":
+		for pool, item := range t.poolItems {
+			if pool == value {
+				item.Check()
+			} else {
+				item.Uncheck()
+			}
+		}
+	case "profile":
+		t.addProfileItem(value, true)
+		for name, item := range t.profileItems {
+			if name == value {
+				item.Check()
+			} else {
+				item.Uncheck()
+			}
+		}
+	case "theme":
+		for name, item := range t.themeItems {
+			if name == value {
+				item.Check()
+			} else {
+				item.Uncheck()
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Package history persists an append-only journal of travel events.
+//
+// Every event is stored as one JSON object per line in
+// ~/.config/iptw/history.jsonl. The journal is the long-term memory of the
+// application: it outlives restarts and is read back to build views over time
+// (heatmaps, per-country history, timelapses). Appends are serialized and
+// written straight to disk so a crash loses at most the event being written.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// EventType identifies the kind of a journal entry.
+type EventType string
+
+const (
+	// EventHit is recorded when a new connection (remote IP and port) to a
+	// foreign country is first observed. Subdivision is the ISO 3166-2 code
+	// of its state or province when the subdivisions setting is on.
+	EventHit EventType = "hit"
+	// EventVisit is recorded when a country receives its first hit.
+	EventVisit EventType = "visit"
+	// EventImprison is recorded when a country is sent to Matrix Prison,
+	// either by reaching 10 hits or manually. Liberated is set when it was the
+	// active target at the time.
+	EventImprison EventType = "imprison"
+	// EventRelease is recorded when prisoners leave Matrix Prison. An empty
+	// Country releases every prisoner, as a new game does when the
+	// application starts.
+	EventRelease EventType = "release"
+	// EventTarget is recorded when a new target country is selected. An empty
+	// Country means the target was cleared.
+	EventTarget EventType = "target"
+	// EventExpedition is recorded when an expedition starts, when one of its
+	// countries is reached and when it ends. Outcome tells which.
+	EventExpedition EventType = "expedition"
+	// EventChallenge is recorded when a daily or weekly challenge is
+	// completed. Challenge is its period, e.g. daily-2026-10-18.
+	EventChallenge EventType = "challenge"
+	// EventRecord is recorded when a personal score record is set. Record is
+	// its kind (best_day or streak) and Value the points of the day or the
+	// number of days of the streak.
+	EventRecord EventType = "record"
+)
+
+// Expedition outcomes recorded with EventExpedition.
+const (
+	ExpeditionStarted   = "started"   // Countries and Deadline are set
+	ExpeditionReached   = "reached"   // Country is the target that was reached
+	ExpeditionSucceeded = "succeeded" // every target was reached in time
+	ExpeditionFailed    = "failed"    // the deadline passed first
+	ExpeditionAbandoned = "abandoned" // given up by the user
+)
+
+// Event is a single journal entry. Fields that do not apply to an event type
+// are omitted from the JSON encoding.
+type Event struct {
+	Time        time.Time  `json:"time"`
+	Type        EventType  `json:"type"`
+	Country     string     `json:"country,omitempty"`
+	City        string     `json:"city,omitempty"`
+	Subdivision string     `json:"subdivision,omitempty"`
+	Lat         float64    `json:"lat,omitempty"`
+	Lng         float64    `json:"lng,omitempty"`
+	RemoteIP    string     `json:"ip,omitempty"`
+	RemotePort  string     `json:"port,omitempty"`
+	Protocol    string     `json:"proto,omitempty"`
+	ASN         uint       `json:"asn,omitempty"`
+	ASOrg       string     `json:"as_org,omitempty"`
+	Liberated   bool       `json:"liberated,omitempty"`
+	Expedition  string     `json:"expedition,omitempty"`
+	Countries   []string   `json:"countries,omitempty"`
+	Deadline    *time.Time `json:"deadline,omitempty"`
+	Outcome     string     `json:"outcome,omitempty"`
+	Challenge   string     `json:"challenge,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	Record      string     `json:"record,omitempty"`
+	Value       int        `json:"value,omitempty"`
+}
+
+// Journal is an append-only event log backed by a JSON-lines file. It is safe
+// for concurrent use.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// DefaultPath returns the location of the journal in the user's config directory.
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw", "history.jsonl"), nil
+}
+
+// Open opens (creating if necessary) the journal at path for appending.
+func Open(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history journal: %w", err)
+	}
+	return &Journal{path: path, file: file}, nil
+}
+
+// OpenReadOnly returns a journal for scanning only, for example from a CLI
+// command while the application is running. The file is not created and
+// appends fail.
+func OpenReadOnly(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Exchange swaps the files backing two journals, so that each appends to and
+// scans the other's file from then on. Holders of a journal follow a switch
+// to another player profile this way.
+func (j *Journal) Exchange(other *Journal) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	j.path, other.path = other.path, j.path
+	j.file, other.file = other.file, j.file
+}
+
+// Path returns the file backing the journal.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Append writes an event to the journal. A zero Time is set to now.
+func (j *Journal) Append(e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode history event: %w", err)
+	}
+	data = append(data, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return fmt.Errorf("history journal is closed")
+	}
+	if _, err := j.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write history event: %w", err)
+	}
+	return nil
+}
+
+// Scan calls fn for every event at or after since, in journal order, until fn
+// returns false. A zero since scans the whole journal. Malformed lines (for
+// example a partially written last line after a crash) are skipped.
+func (j *Journal) Scan(since time.Time, fn func(Event) bool) error {
+	file, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open history journal: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	skipped := 0
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			skipped++
+			continue
+		}
+		if !since.IsZero() && e.Time.Before(since) {
+			continue
+		}
+		if !fn(e) {
+			break
+		}
+	}
+	if skipped > 0 {
+		slog.Warn("Skipped malformed history lines", "count", skipped, "path", j.path)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read history journal: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal file. Further appends fail.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
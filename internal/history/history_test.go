@@ -0,0 +1,66 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalAppendAndScan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	journal, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = journal.Close() }()
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Time: start, Type: EventHit, Country: "Germany", Lat: 50.11, Lng: 8.68},
+		{Time: start.Add(time.Hour), Type: EventHit, Country: "Japan", Lat: 35.68, Lng: 139.69},
+		{Time: start.Add(2 * time.Hour), Type: EventHit, Country: "Brazil", Lat: -23.55, Lng: -46.63},
+	}
+	for _, e := range events {
+		if err := journal.Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	// Simulate a torn write after a crash
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.WriteString(`{"time":"2026-01-01T15:00:00Z","ty`)
+	_ = file.Close()
+
+	var countries []string
+	if err := journal.Scan(start.Add(30*time.Minute), func(e Event) bool {
+		countries = append(countries, e.Country)
+		return true
+	}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(countries) != 2 || countries[0] != "Japan" || countries[1] != "Brazil" {
+		t.Errorf("expected [Japan Brazil], got %v", countries)
+	}
+
+	count := 0
+	if err := journal.Scan(time.Time{}, func(Event) bool {
+		count++
+		return count < 2
+	}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected scan to stop after 2 events, got %d", count)
+	}
+}
+
+func TestJournalScanMissingFile(t *testing.T) {
+	journal := &Journal{path: filepath.Join(t.TempDir(), "missing.jsonl")}
+	if err := journal.Scan(time.Time{}, func(Event) bool { return true }); err != nil {
+		t.Errorf("expected no error for missing journal, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package history
+
+import (
+	"strings"
+	"time"
+)
+
+// DayFormat is the layout of the calendar days in CountrySummary.Daily.
+const DayFormat = "2006-01-02"
+
+// CountrySummary aggregates the journal entries of one country.
+type CountrySummary struct {
+	Country    string
+	FirstVisit time.Time // zero when the journal holds no visit event
+	Imprisoned time.Time // zero unless the country was sent to Matrix Prison
+	Liberated  bool
+	Hits       int // journaled connections, which may exceed the game's hit count
+	LastHit    time.Time
+	Daily      map[string]int       // hits per local calendar day in DayFormat
+	Cities     map[string]int       // hits per city; "" for unknown cities
+	Endpoints  map[string]*Endpoint // by remote IP
+	ASNs       map[uint]*AS         // by autonomous system number
+}
+
+// Endpoint aggregates the hits to one remote IP.
+type Endpoint struct {
+	IP        string
+	Ports     map[string]int
+	Protocols map[string]int
+	Hits      int
+	LastSeen  time.Time
+}
+
+// AS aggregates the hits to one autonomous system.
+type AS struct {
+	Number uint
+	Org    string
+	Hits   int
+}
+
+// SummarizeCountry scans the journal for the events of a country. Names are
+// compared case-insensitively.
+func SummarizeCountry(j *Journal, country string) (*CountrySummary, error) {
+	s := &CountrySummary{
+		Country:   country,
+		Daily:     make(map[string]int),
+		Cities:    make(map[string]int),
+		Endpoints: make(map[string]*Endpoint),
+		ASNs:      make(map[uint]*AS),
+	}
+	err := j.Scan(time.Time{}, func(e Event) bool {
+		if !strings.EqualFold(e.Country, country) {
+			return true
+		}
+		switch e.Type {
+		case EventVisit:
+			if s.FirstVisit.IsZero() {
+				s.FirstVisit = e.Time
+			}
+		case EventImprison:
+			if s.Imprisoned.IsZero() {
+				s.Imprisoned = e.Time
+			}
+			s.Liberated = s.Liberated || e.Liberated
+		case EventHit:
+			s.addHit(e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// addHit counts a hit event.
+func (s *CountrySummary) addHit(e Event) {
+	s.Hits++
+	if e.Time.After(s.LastHit) {
+		s.LastHit = e.Time
+	}
+	s.Daily[e.Time.Local().Format(DayFormat)]++
+	s.Cities[e.City]++
+
+	if e.RemoteIP != "" {
+		endpoint := s.Endpoints[e.RemoteIP]
+		if endpoint == nil {
+			endpoint = &Endpoint{IP: e.RemoteIP, Ports: make(map[string]int), Protocols: make(map[string]int)}
+			s.Endpoints[e.RemoteIP] = endpoint
+		}
+		endpoint.Hits++
+		if e.RemotePort != "" {
+			endpoint.Ports[e.RemotePort]++
+		}
+		if e.Protocol != "" {
+			endpoint.Protocols[e.Protocol]++
+		}
+		if e.Time.After(endpoint.LastSeen) {
+			endpoint.LastSeen = e.Time
+		}
+	}
+
+	if e.ASN != 0 {
+		as := s.ASNs[e.ASN]
+		if as == nil {
+			as = &AS{Number: e.ASN}
+			s.ASNs[e.ASN] = as
+		}
+		as.Hits++
+		if e.ASOrg != "" {
+			as.Org = e.ASOrg
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSummarizeCountry(t *testing.T) {
+	journal, err := Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = journal.Close() }()
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	events := []Event{
+		{Time: start, Type: EventVisit, Country: "Germany"},
+		{Time: start, Type: EventHit, Country: "Germany", City: "Berlin", RemoteIP: "192.0.2.1", RemotePort: "443", Protocol: "tcp", ASN: 64500, ASOrg: "Example Net"},
+		{Time: start.Add(time.Hour), Type: EventHit, Country: "Japan", City: "Tokyo", RemoteIP: "192.0.2.9"},
+		{Time: start.Add(24 * time.Hour), Type: EventHit, Country: "germany", City: "Berlin", RemoteIP: "192.0.2.1", RemotePort: "80", Protocol: "tcp", ASN: 64500},
+		{Time: start.Add(25 * time.Hour), Type: EventHit, Country: "Germany", RemoteIP: "192.0.2.2", Protocol: "udp"},
+		{Time: start.Add(26 * time.Hour), Type: EventImprison, Country: "Germany", Liberated: true},
+	}
+	for _, e := range events {
+		if err := journal.Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	s, err := SummarizeCountry(journal, "GERMANY")
+	if err != nil {
+		t.Fatalf("SummarizeCountry failed: %v", err)
+	}
+	if s.Hits != 3 || !s.FirstVisit.Equal(start) || !s.LastHit.Equal(start.Add(25*time.Hour)) {
+		t.Errorf("unexpected totals: %d hits, first visit %v, last hit %v", s.Hits, s.FirstVisit, s.LastHit)
+	}
+	if !s.Imprisoned.Equal(start.Add(26*time.Hour)) || !s.Liberated {
+		t.Errorf("expected a liberation, got %v %v", s.Imprisoned, s.Liberated)
+	}
+	if s.Daily["2026-03-01"] != 1 || s.Daily["2026-03-02"] != 2 {
+		t.Errorf("unexpected daily hits %v", s.Daily)
+	}
+	if s.Cities["Berlin"] != 2 || s.Cities[""] != 1 {
+		t.Errorf("unexpected cities %v", s.Cities)
+	}
+	endpoint := s.Endpoints["192.0.2.1"]
+	if len(s.Endpoints) != 2 || endpoint == nil || endpoint.Hits != 2 || endpoint.Ports["443"] != 1 || endpoint.Protocols["tcp"] != 2 {
+		t.Errorf("unexpected endpoints %+v", s.Endpoints)
+	}
+	if as := s.ASNs[64500]; len(s.ASNs) != 1 || as == nil || as.Hits != 2 || as.Org != "Example Net" {
+		t.Errorf("unexpected ASNs %+v", s.ASNs)
+	}
+}
@@ -0,0 +1,133 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Export writes the events at or after since to w in the journal format, one
+// JSON object per line, and returns how many were written.
+func Export(j *Journal, w io.Writer, since time.Time) (int, error) {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	n := 0
+	var writeErr error
+	err := j.Scan(since, func(e Event) bool {
+		if writeErr = encoder.Encode(e); writeErr != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err != nil {
+		return n, err
+	}
+	if writeErr != nil {
+		return n, fmt.Errorf("failed to write history event: %w", writeErr)
+	}
+	if err := bw.Flush(); err != nil {
+		return n, fmt.Errorf("failed to write history events: %w", err)
+	}
+	return n, nil
+}
+
+// Import merges the events read from r, in the journal format, into the
+// journal file at path and returns how many were new. Events already in the
+// journal are skipped and the result is sorted by time. The file is replaced
+// atomically, so it must not be open for appending by a running instance.
+func Import(path string, r io.Reader) (int, error) {
+	var incoming []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return 0, fmt.Errorf("invalid history event on line %d: %w", line, err)
+		}
+		if e.Time.IsZero() || e.Type == "" {
+			return 0, fmt.Errorf("invalid history event on line %d: time and type are required", line)
+		}
+		incoming = append(incoming, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read history events: %w", err)
+	}
+
+	var merged []Event
+	seen := make(map[string]bool)
+	add := func(e Event) bool {
+		key := eventKey(e)
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+		merged = append(merged, e)
+		return true
+	}
+	if err := OpenReadOnly(path).Scan(time.Time{}, func(e Event) bool {
+		add(e)
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, e := range incoming {
+		if add(e) {
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	sort.SliceStable(merged, func(i, k int) bool { return merged[i].Time.Before(merged[k].Time) })
+	return added, writeEvents(path, merged)
+}
+
+// eventKey identifies an event regardless of the time zone it was written in.
+func eventKey(e Event) string {
+	e.Time = e.Time.UTC()
+	if e.Deadline != nil {
+		deadline := e.Deadline.UTC()
+		e.Deadline = &deadline
+	}
+	data, _ := json.Marshal(e)
+	return string(data)
+}
+
+// writeEvents replaces the journal file at path with events.
+func writeEvents(path string, events []Event) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create history journal: %w", err)
+	}
+	bw := bufio.NewWriter(file)
+	encoder := json.NewEncoder(bw)
+	for _, e := range events {
+		if err = encoder.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write history journal: %w", err)
+	}
+	return nil
+}
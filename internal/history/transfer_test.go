@@ -0,0 +1,57 @@
+package history
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	dir := t.TempDir()
+	source, err := Open(filepath.Join(dir, "source.jsonl"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, country := range []string{"Chile", "Peru", "Kenya"} {
+		if err := source.Append(Event{Time: start.Add(time.Duration(i) * time.Hour), Type: EventVisit, Country: country}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = source.Close()
+
+	var exported bytes.Buffer
+	if n, err := Export(source, &exported, start.Add(30*time.Minute)); err != nil || n != 2 {
+		t.Fatalf("expected 2 exported events, got %d (%v)", n, err)
+	}
+
+	// The target already has Peru, in another time zone, and an older event
+	target := filepath.Join(dir, "history.jsonl")
+	journal, err := Open(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lima := time.FixedZone("PET", -5*3600)
+	_ = journal.Append(Event{Time: start.Add(time.Hour).In(lima), Type: EventVisit, Country: "Peru"})
+	_ = journal.Append(Event{Time: start.Add(-time.Hour), Type: EventVisit, Country: "Japan"})
+	_ = journal.Close()
+
+	added, err := Import(target, &exported)
+	if err != nil || added != 1 {
+		t.Fatalf("expected 1 new event, got %d (%v)", added, err)
+	}
+	var countries []string
+	_ = OpenReadOnly(target).Scan(time.Time{}, func(e Event) bool {
+		countries = append(countries, e.Country)
+		return true
+	})
+	if strings.Join(countries, ",") != "Japan,Peru,Kenya" {
+		t.Errorf("expected the merged journal sorted by time, got %v", countries)
+	}
+
+	if _, err := Import(target, strings.NewReader("{\"type\":\"visit\"}\n")); err == nil {
+		t.Error("expected an event without a time to be rejected")
+	}
+}
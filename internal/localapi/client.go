@@ -0,0 +1,114 @@
+package localapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// clientTimeout bounds a single API call from the CLI.
+const clientTimeout = 30 * time.Second
+
+// Client calls the REST API of a running instance with a token.
+type Client struct {
+	URL        string // base URL of the instance, without a trailing slash
+	Token      string
+	HTTPClient *http.Client
+}
+
+// APIError is an error response from the API.
+type APIError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.Code)
+}
+
+// NewClient returns a client for inst. For https URLs only the instance's
+// own certificate is trusted.
+func NewClient(inst Instance, token string) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if strings.HasPrefix(inst.URL, "https://") {
+		pem, err := os.ReadFile(inst.CertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read instance certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", inst.CertFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &Client{
+		URL:        strings.TrimSuffix(inst.URL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Transport: transport, Timeout: clientTimeout},
+	}, nil
+}
+
+// Do sends a request to path, e.g. /api/v1/stats, with body encoded as JSON
+// when it is not nil, and decodes a JSON response into out when it is not
+// nil. Error responses are returned as *APIError.
+func (c *Client) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach iptw at %s: %w", c.URL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 400 {
+		var envelope struct {
+			Error *APIError `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&envelope) == nil && envelope.Error != nil {
+			return envelope.Error
+		}
+		return &APIError{Status: resp.StatusCode, Code: "http_error", Message: http.StatusText(resp.StatusCode)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// Get decodes the JSON response to a GET of path into out.
+func (c *Client) Get(ctx context.Context, path string, out interface{}) error {
+	return c.Do(ctx, http.MethodGet, path, nil, out)
+}
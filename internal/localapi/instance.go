@@ -0,0 +1,83 @@
+package localapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotRunning is returned by ReadInstance when no instance file exists.
+var ErrNotRunning = errors.New("iptw is not running")
+
+// Instance describes the local server of a running instance. It is written
+// when the server starts and removed when it stops.
+type Instance struct {
+	URL      string    `json:"url"`
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	CertFile string    `json:"cert_file,omitempty"` // certificate to trust for https URLs
+}
+
+// DefaultInstancePath returns the path of the instance file,
+// ~/.config/iptw/instance.json.
+func DefaultInstancePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw", "instance.json"), nil
+}
+
+// WriteInstance records a running instance. The file is replaced atomically
+// so readers never see a partial write.
+func WriteInstance(path string, inst Instance) error {
+	data, err := json.MarshalIndent(inst, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode instance: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create instance directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write instance file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write instance file: %w", err)
+	}
+	return nil
+}
+
+// ReadInstance returns the running instance recorded at path. A crashed
+// instance can leave a stale file behind, so callers should expect the URL
+// to be unreachable.
+func ReadInstance(path string) (Instance, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Instance{}, ErrNotRunning
+	} else if err != nil {
+		return Instance{}, fmt.Errorf("failed to read instance file: %w", err)
+	}
+	var inst Instance
+	if err := json.Unmarshal(data, &inst); err != nil {
+		return Instance{}, fmt.Errorf("failed to decode instance file: %w", err)
+	}
+	return inst, nil
+}
+
+// RemoveInstance removes the instance file if it still belongs to pid, so a
+// second instance started with --force keeps its own record.
+func RemoveInstance(path string, pid int) error {
+	inst, err := ReadInstance(path)
+	if errors.Is(err, ErrNotRunning) || (err == nil && inst.PID != pid) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove instance file: %w", err)
+	}
+	return nil
+}
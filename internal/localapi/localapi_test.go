@@ -0,0 +1,162 @@
+package localapi
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-tokens")
+	tokens, err := LoadTokens(path)
+	if err != nil {
+		t.Fatalf("LoadTokens failed: %v", err)
+	}
+	list := tokens.List()
+	if len(list) != 1 || list[0].Name != DefaultTokenName || list[0].Scope != ScopeWrite {
+		t.Fatalf("expected a default write token, got %+v", list)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected a private token file, got %v (%v)", info.Mode(), err)
+	}
+
+	read, err := tokens.Create("grafana", ScopeRead)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := tokens.Create("grafana", ScopeWrite); err == nil {
+		t.Error("expected duplicate names to be rejected")
+	}
+	if _, err := tokens.Create("two words", ScopeRead); err == nil {
+		t.Error("expected names with spaces to be rejected")
+	}
+
+	// A second instance, like the CLI and the app, sees the same tokens
+	other, err := LoadTokens(path)
+	if err != nil {
+		t.Fatalf("LoadTokens failed: %v", err)
+	}
+	token, ok := other.Lookup(read.Value)
+	if !ok || token.Name != "grafana" || !token.Scope.Allows(ScopeRead) || token.Scope.Allows(ScopeWrite) {
+		t.Errorf("expected a read-only token, got %+v %v", token, ok)
+	}
+	if got, _ := other.ForScope(ScopeRead); got.Value != read.Value {
+		t.Errorf("expected the read token for read scope, got %+v", got)
+	}
+
+	if err := other.Revoke("grafana"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	// Make the change visible even on file systems with coarse timestamps
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tokens.Lookup(read.Value); ok {
+		t.Error("expected a revoked token to be rejected by a running instance")
+	}
+	if _, ok := tokens.Lookup(""); ok {
+		t.Error("expected the empty token to be rejected")
+	}
+}
+
+func TestLoadOrCreateCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls", "cert.pem"), filepath.Join(dir, "tls", "key.pem")
+	cert, err := LoadOrCreateCertificate(certFile, keyFile, []string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("LoadOrCreateCertificate failed: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.VerifyHostname("127.0.0.1") != nil || leaf.VerifyHostname("localhost") != nil {
+		t.Errorf("expected the certificate to cover the loopback names, got %v %v", leaf.DNSNames, leaf.IPAddresses)
+	}
+
+	again, err := LoadOrCreateCertificate(certFile, keyFile, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again.Certificate[0]) != string(cert.Certificate[0]) {
+		t.Error("expected the existing certificate to be reused")
+	}
+	lan, err := LoadOrCreateCertificate(certFile, keyFile, []string{"127.0.0.1", "192.168.1.20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(lan.Certificate[0]) == string(cert.Certificate[0]) {
+		t.Error("expected a new certificate for a new host")
+	}
+}
+
+func TestInstance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instance.json")
+	if _, err := ReadInstance(path); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("expected ErrNotRunning, got %v", err)
+	}
+
+	inst := Instance{URL: "http://127.0.0.1:32782", PID: 42, Started: time.Now().UTC().Truncate(time.Second)}
+	if err := WriteInstance(path, inst); err != nil {
+		t.Fatalf("WriteInstance failed: %v", err)
+	}
+	got, err := ReadInstance(path)
+	if err != nil || got != inst {
+		t.Fatalf("expected %+v, got %+v (%v)", inst, got, err)
+	}
+
+	// Another process's record is left alone
+	if err := RemoveInstance(path, 7); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadInstance(path); err != nil {
+		t.Errorf("expected the record to remain, got %v", err)
+	}
+	if err := RemoveInstance(path, 42); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadInstance(path); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("expected the record to be removed, got %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"status":401,"code":"unauthorized","message":"A token is required"}}`))
+			return
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_ = json.NewEncoder(w).Encode(map[string]string{"method": r.Method, "path": r.URL.Path, "country": body["country"]})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(Instance{URL: server.URL + "/"}, "s3cret")
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	var out map[string]string
+	if err := client.Do(context.Background(), http.MethodPut, "/api/v1/target", map[string]string{"country": "Peru"}, &out); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if out["method"] != http.MethodPut || out["path"] != "/api/v1/target" || out["country"] != "Peru" {
+		t.Errorf("unexpected request %v", out)
+	}
+
+	client.Token = "wrong"
+	var apiErr *APIError
+	if err := client.Get(context.Background(), "/api/v1/stats", &out); !errors.As(err, &apiErr) || apiErr.Code != "unauthorized" {
+		t.Errorf("expected an unauthorized APIError, got %v", err)
+	}
+}
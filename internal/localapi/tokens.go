@@ -0,0 +1,259 @@
+// Package localapi manages access to the local web UI and API: persistent API
+// tokens with read and write scopes, the self-signed TLS certificate, and the
+// instance file that tells the CLI where a running instance listens.
+package localapi
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope is the access level of an API token.
+type Scope string
+
+const (
+	// ScopeRead allows GET requests.
+	ScopeRead Scope = "read"
+	// ScopeWrite allows every request, including those that change state.
+	ScopeWrite Scope = "write"
+)
+
+// ParseScope validates a scope name.
+func ParseScope(value string) (Scope, error) {
+	switch s := Scope(value); s {
+	case ScopeRead, ScopeWrite:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown scope %q, expected read or write", value)
+}
+
+// Allows reports whether a token of scope s may be used where need is
+// required. Write tokens can also read.
+func (s Scope) Allows(need Scope) bool {
+	return s == ScopeWrite || s == need
+}
+
+// Token is a named API token.
+type Token struct {
+	Name  string
+	Scope Scope
+	Value string
+}
+
+// DefaultTokenName is the write token created with a new token file.
+const DefaultTokenName = "default"
+
+// Tokens is the set of API tokens stored in a file, one "name scope value"
+// line per token. The file is re-read when it changes, so tokens created or
+// revoked by the CLI apply to a running instance. It is safe for concurrent
+// use.
+type Tokens struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	tokens  []Token
+}
+
+// DefaultTokensPath returns the path of the token file,
+// ~/.config/iptw/api-tokens.
+func DefaultTokensPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw", "api-tokens"), nil
+}
+
+// LoadTokens reads the token file at path, creating it with a write token
+// named DefaultTokenName when it does not exist.
+func LoadTokens(path string) (*Tokens, error) {
+	t := &Tokens{path: path}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		value, err := newTokenValue()
+		if err != nil {
+			return nil, err
+		}
+		t.tokens = []Token{{Name: DefaultTokenName, Scope: ScopeWrite, Value: value}}
+		if err := t.save(); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// newTokenValue returns a random token.
+func newTokenValue() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// load reads the token file. Malformed lines are skipped.
+func (t *Tokens) load() error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open token file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	var tokens []Token
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 3 {
+			continue
+		}
+		scope, err := ParseScope(parts[1])
+		if err != nil {
+			continue
+		}
+		tokens = append(tokens, Token{Name: parts[0], Scope: scope, Value: parts[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read token file: %w", err)
+	}
+	t.tokens, t.modTime = tokens, info.ModTime()
+	return nil
+}
+
+// save writes the token file, readable only by the user.
+func (t *Tokens) save() error {
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+	var b strings.Builder
+	b.WriteString("# iptw API tokens: name scope token\n")
+	for _, token := range t.tokens {
+		fmt.Fprintf(&b, "%s %s %s\n", token.Name, token.Scope, token.Value)
+	}
+	if err := os.WriteFile(t.path, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if info, err := os.Stat(t.path); err == nil {
+		t.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// refresh re-reads the file when it changed since it was last read.
+func (t *Tokens) refresh() {
+	info, err := os.Stat(t.path)
+	if err != nil || info.ModTime().Equal(t.modTime) {
+		return
+	}
+	_ = t.load()
+}
+
+// Lookup returns the token with the given value.
+func (t *Tokens) Lookup(value string) (Token, bool) {
+	if value == "" {
+		return Token{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refresh()
+	for _, token := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Value), []byte(value)) == 1 {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
+
+// List returns every token.
+func (t *Tokens) List() []Token {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refresh()
+	return append([]Token(nil), t.tokens...)
+}
+
+// ForScope returns a token of exactly the given scope, or a write token when
+// there is none.
+func (t *Tokens) ForScope(scope Scope) (Token, bool) {
+	var fallback *Token
+	for _, token := range t.List() {
+		if token.Scope == scope {
+			return token, true
+		}
+		if token.Scope == ScopeWrite && fallback == nil {
+			token := token
+			fallback = &token
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return Token{}, false
+}
+
+// Create adds a token with a new random value and saves the file.
+func (t *Tokens) Create(name string, scope Scope) (Token, error) {
+	if name == "" || strings.ContainsAny(name, " \t\r\n#") {
+		return Token{}, fmt.Errorf("invalid token name %q", name)
+	}
+	if _, err := ParseScope(string(scope)); err != nil {
+		return Token{}, err
+	}
+	value, err := newTokenValue()
+	if err != nil {
+		return Token{}, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refresh()
+	for _, token := range t.tokens {
+		if token.Name == name {
+			return Token{}, fmt.Errorf("a token named %q already exists", name)
+		}
+	}
+	token := Token{Name: name, Scope: scope, Value: value}
+	t.tokens = append(t.tokens, token)
+	if err := t.save(); err != nil {
+		t.tokens = t.tokens[:len(t.tokens)-1]
+		return Token{}, err
+	}
+	return token, nil
+}
+
+// Revoke removes the token with the given name and saves the file.
+func (t *Tokens) Revoke(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refresh()
+	for i, token := range t.tokens {
+		if token.Name == name {
+			previous := t.tokens
+			t.tokens = append(append([]Token(nil), t.tokens[:i]...), t.tokens[i+1:]...)
+			if err := t.save(); err != nil {
+				t.tokens = previous
+				return err
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no token named %q", name)
+}
@@ -0,0 +1,315 @@
+// Package metrics collects counters, gauges and histograms and serves them in
+// the Prometheus text exposition format. It covers what iptw exports without
+// pulling in the Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kind is the Prometheus type of a metric family.
+type Kind string
+
+// Kinds of metric families.
+const (
+	KindCounter   Kind = "counter"
+	KindGauge     Kind = "gauge"
+	KindHistogram Kind = "histogram"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds suited to operations
+// that take milliseconds to seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// family is a named metric with its help text and samples.
+type family interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and writes them sorted by name. It is safe
+// for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// register adds a family; names must be unique.
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.families[f.name()]; exists {
+		panic(fmt.Sprintf("metrics: %s registered twice", f.name()))
+	}
+	r.families[f.name()] = f
+}
+
+// WriteTo writes every family in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	if _, err := r.WriteTo(w); err != nil {
+		slog.Debug("Failed to write metrics", "error", err)
+	}
+}
+
+// countingWriter counts the bytes written for WriteTo.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeHeader writes the HELP and TYPE lines of a family.
+func writeHeader(w *bufio.Writer, name, help string, kind Kind) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes one sample line.
+func writeSample(w *bufio.Writer, name string, labelNames, labelValues []string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 {
+		w.WriteByte('{')
+		for i, label := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, label, escapeLabel(labelValues[i]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatValue(value))
+	w.WriteByte('\n')
+}
+
+// escapeLabel escapes a label value.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatValue formats a sample value, spelling infinities as Prometheus does.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// labelKey joins label values into a map key.
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// Counter is a monotonically increasing value per combination of label
+// values.
+type Counter struct {
+	metricName string
+	help       string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	value  float64
+}
+
+// NewCounter registers a counter with the given label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{metricName: name, help: help, labels: labels, series: make(map[string]*counterSeries)}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series of the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series of the label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if len(labelValues) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", c.metricName, len(c.labels), len(labelValues)))
+	}
+	if v < 0 {
+		return
+	}
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.series[key]
+	if s == nil {
+		s = &counterSeries{values: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+// Value returns the current value of the series of the label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.series[labelKey(labelValues)]; s != nil {
+		return s.value
+	}
+	return 0
+}
+
+func (c *Counter) name() string { return c.metricName }
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.metricName, c.help, KindCounter)
+	if len(c.labels) == 0 && len(c.series) == 0 {
+		writeSample(w, c.metricName, nil, nil, 0)
+		return
+	}
+	keys := make([]string, 0, len(c.series))
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeSample(w, c.metricName, c.labels, c.series[key].values, c.series[key].value)
+	}
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	metricName string
+	help       string
+	buckets    []float64 // upper bounds, ascending
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds.
+// The +Inf bucket is implicit.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &Histogram{metricName: name, help: help, buckets: sorted, counts: make([]uint64, len(sorted))}
+	r.register(h)
+	return h
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) name() string { return h.metricName }
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.metricName, h.help, KindHistogram)
+	le := []string{"le"}
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		writeSample(w, h.metricName+"_bucket", le, []string{formatValue(bound)}, float64(cumulative))
+	}
+	writeSample(w, h.metricName+"_bucket", le, []string{"+Inf"}, float64(h.count))
+	writeSample(w, h.metricName+"_sum", nil, nil, h.sum)
+	writeSample(w, h.metricName+"_count", nil, nil, float64(h.count))
+}
+
+// Func is a metric whose samples are collected when the metrics are
+// written, for values that already live elsewhere such as game state.
+type Func struct {
+	metricName string
+	help       string
+	kind       Kind
+	labels     []string
+	collect    func(emit func(value float64, labelValues ...string))
+}
+
+// NewFunc registers a counter or gauge collected at scrape time. collect
+// calls emit once per series.
+func (r *Registry) NewFunc(name, help string, kind Kind, labels []string, collect func(emit func(value float64, labelValues ...string))) {
+	r.register(&Func{metricName: name, help: help, kind: kind, labels: labels, collect: collect})
+}
+
+// NewGaugeFunc registers an unlabeled gauge collected at scrape time.
+func (r *Registry) NewGaugeFunc(name, help string, value func() float64) {
+	r.NewFunc(name, help, KindGauge, nil, func(emit func(float64, ...string)) { emit(value()) })
+}
+
+func (f *Func) name() string { return f.metricName }
+
+func (f *Func) write(w *bufio.Writer) {
+	type sample struct {
+		values []string
+		value  float64
+	}
+	var samples []sample
+	f.collect(func(value float64, labelValues ...string) {
+		if len(labelValues) == len(f.labels) {
+			samples = append(samples, sample{append([]string(nil), labelValues...), value})
+		}
+	})
+	sort.Slice(samples, func(i, j int) bool { return labelKey(samples[i].values) < labelKey(samples[j].values) })
+
+	writeHeader(w, f.metricName, f.help, f.kind)
+	for _, s := range samples {
+		writeSample(w, f.metricName, f.labels, s.values, s.value)
+	}
+}
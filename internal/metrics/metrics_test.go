@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	hits := r.NewCounter("test_hits_total", "Hits by country.", "country")
+	errors := r.NewCounter("test_errors_total", "Errors.")
+	duration := r.NewHistogram("test_duration_seconds", "Durations.", []float64{1, 0.1})
+	r.NewGaugeFunc("test_up", "Always up.", func() float64 { return 1 })
+	r.NewFunc("test_info", "Info with\nescapes.", KindGauge, []string{"name"}, func(emit func(float64, ...string)) {
+		emit(1, `say "hi"\`)
+	})
+
+	hits.Inc("Japan")
+	hits.Add(2, "Chile")
+	hits.Add(-1, "Chile") // counters never go down
+	duration.Observe(0.05)
+	duration.Observe(0.5)
+	duration.Observe(3)
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	want := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 3.55
+test_duration_seconds_count 3
+# HELP test_errors_total Errors.
+# TYPE test_errors_total counter
+test_errors_total 0
+# HELP test_hits_total Hits by country.
+# TYPE test_hits_total counter
+test_hits_total{country="Chile"} 2
+test_hits_total{country="Japan"} 1
+# HELP test_info Info with\nescapes.
+# TYPE test_info gauge
+test_info{name="say \"hi\"\\"} 1
+# HELP test_up Always up.
+# TYPE test_up gauge
+test_up 1
+`
+	if b.String() != want {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if errors.Value() != 0 || hits.Value("Chile") != 2 {
+		t.Errorf("unexpected values %v %v", errors.Value(), hits.Value("Chile"))
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Header().Get("Content-Type") != ContentType || rec.Body.String() != want {
+		t.Errorf("unexpected response %q", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestRegistryDuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "A counter.")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a name twice to panic")
+		}
+	}()
+	r.NewGaugeFunc("test_total", "A gauge.", func() float64 { return 0 })
+}
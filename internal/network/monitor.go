@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,11 +20,14 @@ type Connection struct {
 	LocalIP    string
 	LocalPort  string
 	Protocol   string
+	UID        string // Numeric ID of the user owning the socket; Linux with owner lookup only, empty when unknown
+	Process    string // Name of the process owning the socket; Linux with owner lookup only, empty when unknown
 }
 
 // Monitor monitors network connections
 type Monitor struct {
 	connections []Connection
+	ownerLookup atomic.Bool // fill in Connection.UID and Process
 }
 
 // NewMonitor creates a new network monitor
@@ -33,6 +37,13 @@ func NewMonitor() *Monitor {
 	}
 }
 
+// SetOwnerLookup turns the lookup of the user and process owning each
+// connection on or off. It is off by default as it makes ss scan the open
+// files of every process on each refresh.
+func (m *Monitor) SetOwnerLookup(enabled bool) {
+	m.ownerLookup.Store(enabled)
+}
+
 // GetConnections returns current network connections
 func (m *Monitor) GetConnections() []Connection {
 	return m.connections
@@ -109,9 +120,15 @@ func (m *Monitor) getConnectionsMacOS(ctx context.Context) ([]Connection, error)
 // getConnectionsLinux gets connections using ss on Linux
 func (m *Monitor) getConnectionsLinux(ctx context.Context) ([]Connection, error) {
 	// Try ss first (preferred on modern Linux).
-	// Flags: -t TCP, -u UDP, -n numeric (no DNS). No -l so we get connected
-	// sockets, not listening ones. The ESTAB regex below filters the output.
-	cmd := exec.CommandContext(ctx, "ss", "-tun")
+	// Flags: -t TCP, -u UDP, -n numeric (no DNS), and with owner lookup -e
+	// socket owner and -p owning process (only for our own processes unless
+	// run as root). No -l so we get connected sockets, not listening ones.
+	// The ESTAB regex below filters the output.
+	args := "-tun"
+	if m.ownerLookup.Load() {
+		args = "-tunep"
+	}
+	cmd := exec.CommandContext(ctx, "ss", args)
 	output, err := cmd.Output()
 	if err != nil {
 		// Fall back to netstat if ss is not available
@@ -122,9 +139,12 @@ func (m *Monitor) getConnectionsLinux(ctx context.Context) ([]Connection, error)
 	scanner := bufio.NewScanner(strings.NewReader(string(output)))
 
 	// Regex to parse ss output.
-	// With -tun (no state filter) the State column is present:
-	// tcp   ESTAB  0  0  192.168.1.100:50123  93.184.216.34:80
+	// Without a state filter the State column is present; with -ep the
+	// owner follows the addresses:
+	// tcp   ESTAB  0  0  192.168.1.100:50123  93.184.216.34:80  users:(("firefox",pid=4242,fd=87)) uid:1000 ino:...
 	connRegex := regexp.MustCompile(`^(tcp|udp)\s+ESTAB\s+\d+\s+\d+\s+(\S+):(\d+)\s+(\S+):(\d+)`)
+	processRegex := regexp.MustCompile(`users:\(\("([^"]+)"`)
+	uidRegex := regexp.MustCompile(`\suid:(\d+)`)
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -138,13 +158,23 @@ func (m *Monitor) getConnectionsLinux(ctx context.Context) ([]Connection, error)
 			remotePort := matches[5]
 
 			if m.shouldIncludeConnection(remoteIP) {
-				connections = append(connections, Connection{
+				conn := Connection{
 					RemoteIP:   remoteIP,
 					RemotePort: remotePort,
 					LocalIP:    localIP,
 					LocalPort:  localPort,
 					Protocol:   protocol,
-				})
+				}
+				if owner := uidRegex.FindStringSubmatch(line); owner != nil {
+					conn.UID = owner[1]
+				} else if strings.Contains(line, " ino:") {
+					// -e prints ino: for every socket but leaves out uid:0
+					conn.UID = "0"
+				}
+				if owner := processRegex.FindStringSubmatch(line); owner != nil {
+					conn.Process = owner[1]
+				}
+				connections = append(connections, conn)
 			}
 		}
 	}
@@ -0,0 +1,152 @@
+// Package profile locates named player profiles and routes connections to
+// them.
+//
+// Every profile has its own travel history. The default profile keeps the
+// journal in ~/.config/iptw it had before profiles existed; the others keep
+// theirs in ~/.config/iptw/profiles/<name>, created the first time they are
+// played.
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the profile played until another one is chosen.
+const Default = "default"
+
+// maxNameLength bounds profile names, which are also directory names.
+const maxNameLength = 32
+
+// ValidName reports whether name can name a profile: lowercase letters,
+// digits, - and _, not starting with - or _.
+func ValidName(name string) bool {
+	if name == "" || len(name) > maxNameLength {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case (r == '-' || r == '_') && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// configDir returns ~/.config/iptw.
+func configDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw"), nil
+}
+
+// Dir returns the directory holding the files of a profile.
+func Dir(name string) (string, error) {
+	if !ValidName(name) {
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	if name == Default {
+		return dir, nil
+	}
+	return filepath.Join(dir, "profiles", name), nil
+}
+
+// HistoryPath returns the travel history journal of a profile.
+func HistoryPath(name string) (string, error) {
+	dir, err := Dir(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// List returns the default profile followed by the others, by name.
+func List() ([]string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "profiles"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list profiles: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && ValidName(entry.Name()) && entry.Name() != Default {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return append([]string{Default}, names...), nil
+}
+
+// Route sends the connections of a user or a process to a profile. Exactly
+// one of UID and Process is set.
+type Route struct {
+	UID     string // numeric user ID owning the socket
+	Process string // process name as the OS reports it, e.g. firefox
+	Profile string
+}
+
+// String returns the route as written in the profile_routes setting.
+func (r Route) String() string {
+	if r.UID != "" {
+		return "uid:" + r.UID + "=" + r.Profile
+	}
+	return "process:" + r.Process + "=" + r.Profile
+}
+
+// ParseRoutes parses the profile_routes setting: off, or comma-separated
+// routes such as uid:1001=alice or process:firefox=bob.
+func ParseRoutes(value string) ([]Route, error) {
+	if value == "off" {
+		return nil, nil
+	}
+	var routes []Route
+	for _, part := range strings.Split(value, ",") {
+		match, name, ok := strings.Cut(part, "=")
+		if !ok || !ValidName(name) {
+			return nil, fmt.Errorf("invalid profile route %q: expected uid:N=profile or process:NAME=profile", part)
+		}
+		kind, key, _ := strings.Cut(match, ":")
+		switch {
+		case kind == "uid" && isUID(key):
+			routes = append(routes, Route{UID: key, Profile: name})
+		case kind == "process" && key != "":
+			routes = append(routes, Route{Process: key, Profile: name})
+		default:
+			return nil, fmt.Errorf("invalid profile route %q: expected uid:N=profile or process:NAME=profile", part)
+		}
+	}
+	return routes, nil
+}
+
+// isUID reports whether s is a numeric user ID.
+func isUID(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 32)
+	return err == nil
+}
+
+// Match returns the profile of the first route matching the owner of a
+// connection, or "" when none does. Unknown owners are empty and match
+// nothing.
+func Match(routes []Route, uid, process string) string {
+	for _, r := range routes {
+		if (r.UID != "" && r.UID == uid) || (r.Process != "" && r.Process == process) {
+			return r.Profile
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"default": true, "alice": true, "kid-2": true, "a_b": true,
+		"": false, "Alice": false, "-x": false, "../etc": false, "a b": false,
+		"abcdefghijklmnopqrstuvwxyz0123456": false,
+	} {
+		if got := ValidName(name); got != want {
+			t.Errorf("ValidName(%q) = %t, expected %t", name, got, want)
+		}
+	}
+}
+
+func TestPaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	if path, err := HistoryPath(Default); err != nil || path != filepath.Join(home, ".config", "iptw", "history.jsonl") {
+		t.Errorf("unexpected default history %q, %v", path, err)
+	}
+	if path, err := HistoryPath("alice"); err != nil || path != filepath.Join(home, ".config", "iptw", "profiles", "alice", "history.jsonl") {
+		t.Errorf("unexpected history of alice %q, %v", path, err)
+	}
+	if _, err := Dir("../x"); err == nil {
+		t.Error("expected an error for an invalid name")
+	}
+
+	if names, err := List(); err != nil || !reflect.DeepEqual(names, []string{Default}) {
+		t.Errorf("expected only the default profile, got %v, %v", names, err)
+	}
+	for _, name := range []string{"bob", "alice", "Not-A-Profile"} {
+		if err := os.MkdirAll(filepath.Join(home, ".config", "iptw", "profiles", name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names, err := List(); err != nil || !reflect.DeepEqual(names, []string{Default, "alice", "bob"}) {
+		t.Errorf("unexpected profiles %v, %v", names, err)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	routes, err := ParseRoutes("uid:1001=alice,process:firefox=bob")
+	if err != nil {
+		t.Fatalf("ParseRoutes failed: %v", err)
+	}
+	want := []Route{{UID: "1001", Profile: "alice"}, {Process: "firefox", Profile: "bob"}}
+	if !reflect.DeepEqual(routes, want) {
+		t.Fatalf("expected %v, got %v", want, routes)
+	}
+	if routes[0].String() != "uid:1001=alice" || routes[1].String() != "process:firefox=bob" {
+		t.Errorf("unexpected strings %s and %s", routes[0], routes[1])
+	}
+
+	for _, tc := range []struct{ uid, process, want string }{
+		{"1001", "curl", "alice"},
+		{"1000", "firefox", "bob"},
+		{"1000", "curl", ""},
+		{"", "", ""},
+	} {
+		if got := Match(routes, tc.uid, tc.process); got != tc.want {
+			t.Errorf("Match(%q, %q) = %q, expected %q", tc.uid, tc.process, got, tc.want)
+		}
+	}
+
+	if routes, err := ParseRoutes("off"); err != nil || routes != nil {
+		t.Errorf("expected no routes for off, got %v, %v", routes, err)
+	}
+	for _, value := range []string{"", "uid:x=alice", "uid:1=Alice", "process:=bob", "gid:1=bob", "alice"} {
+		if _, err := ParseRoutes(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package resources
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/paulmach/orb"
+)
+
+// GreatCirclePath returns the great-circle route between two points as one or
+// more polylines of [lng, lat] points. The route is split wherever it crosses
+// the antimeridian so that no segment spans the whole map: the first polyline
+// ends exactly on ±180° and the next one starts on the opposite edge at the
+// same latitude.
+func GreatCirclePath(lat1, lng1, lat2, lng2 float64, segments int) []orb.LineString {
+	if segments < 1 {
+		segments = 1
+	}
+
+	phi1, lambda1 := lat1*math.Pi/180, lng1*math.Pi/180
+	phi2, lambda2 := lat2*math.Pi/180, lng2*math.Pi/180
+	ax, ay, az := math.Cos(phi1)*math.Cos(lambda1), math.Cos(phi1)*math.Sin(lambda1), math.Sin(phi1)
+	bx, by, bz := math.Cos(phi2)*math.Cos(lambda2), math.Cos(phi2)*math.Sin(lambda2), math.Sin(phi2)
+
+	// Angular distance between the endpoints
+	dot := math.Max(-1, math.Min(1, ax*bx+ay*by+az*bz))
+	omega := math.Acos(dot)
+
+	points := make([]orb.Point, 0, segments+1)
+	for i := 0; i <= segments; i++ {
+		t := float64(i) / float64(segments)
+		var x, y, z float64
+		if omega < 1e-9 {
+			x, y, z = ax, ay, az
+		} else {
+			// Spherical linear interpolation between the two unit vectors
+			s1 := math.Sin((1-t)*omega) / math.Sin(omega)
+			s2 := math.Sin(t*omega) / math.Sin(omega)
+			x, y, z = s1*ax+s2*bx, s1*ay+s2*by, s1*az+s2*bz
+		}
+		lat := math.Atan2(z, math.Hypot(x, y)) * 180 / math.Pi
+		lng := math.Atan2(y, x) * 180 / math.Pi
+		points = append(points, orb.Point{lng, lat})
+	}
+
+	return splitAtAntimeridian(points)
+}
+
+// splitAtAntimeridian breaks a polyline into parts wherever consecutive points
+// jump by more than 180° of longitude, inserting the interpolated crossing
+// point on both sides of the antimeridian.
+func splitAtAntimeridian(points []orb.Point) []orb.LineString {
+	if len(points) == 0 {
+		return nil
+	}
+
+	var parts []orb.LineString
+	current := orb.LineString{points[0]}
+	for i := 1; i < len(points); i++ {
+		prev, next := points[i-1], points[i]
+		if math.Abs(next[0]-prev[0]) > 180 {
+			// Unwrap the next longitude so the segment is continuous, then find
+			// where it meets the ±180° meridian.
+			edge := 180.0
+			unwrapped := next[0] + 360
+			if prev[0] < 0 {
+				edge = -180.0
+				unwrapped = next[0] - 360
+			}
+			t := (edge - prev[0]) / (unwrapped - prev[0])
+			crossLat := prev[1] + t*(next[1]-prev[1])
+
+			current = append(current, orb.Point{edge, crossLat})
+			parts = append(parts, current)
+			current = orb.LineString{{-edge, crossLat}}
+		}
+		current = append(current, next)
+	}
+	return append(parts, current)
+}
+
+// DrawArc draws a geographic polyline set (as returned by GreatCirclePath) onto
+// an equirectangular map image, blending col over the existing pixels.
+func DrawArc(img *image.RGBA, path []orb.LineString, col color.RGBA, thickness int, width, height int) {
+	for _, line := range path {
+		for i := 0; i+1 < len(line); i++ {
+			x1, y1 := geoToPixel(line[i][1], line[i][0], width, height)
+			x2, y2 := geoToPixel(line[i+1][1], line[i+1][0], width, height)
+			// Skip the shared start vertex of every segment but the first so it
+			// is not blended twice.
+			drawBlendedLine(img, x1, y1, x2, y2, col, thickness, i > 0)
+		}
+	}
+}
+
+// drawBlendedLine draws a line of the given thickness, compositing col over the
+// destination with its alpha. With skipStart the first point is not drawn.
+func drawBlendedLine(img *image.RGBA, x1, y1, x2, y2 float64, col color.RGBA, thickness int, skipStart bool) {
+	if thickness < 1 {
+		thickness = 1
+	}
+	steps := int(math.Ceil(math.Max(math.Abs(x2-x1), math.Abs(y2-y1))))
+	if steps < 1 {
+		steps = 1
+	}
+	half := thickness / 2
+	bounds := img.Bounds()
+	lastX, lastY := math.MinInt, math.MinInt
+	if skipStart {
+		lastX, lastY = int(math.Round(x1)), int(math.Round(y1))
+	}
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		cx := int(math.Round(x1 + t*(x2-x1)))
+		cy := int(math.Round(y1 + t*(y2-y1)))
+		if cx == lastX && cy == lastY {
+			continue
+		}
+		lastX, lastY = cx, cy
+		for dy := -half; dy <= thickness-1-half; dy++ {
+			for dx := -half; dx <= thickness-1-half; dx++ {
+				px, py := cx+dx, cy+dy
+				if !(image.Point{px, py}.In(bounds)) {
+					continue
+				}
+				blendPixel(img, px, py, col)
+			}
+		}
+	}
+}
+
+// blendPixel composites a non-premultiplied colour over one pixel.
+func blendPixel(img *image.RGBA, x, y int, col color.RGBA) {
+	off := img.PixOffset(x, y)
+	a := uint32(col.A)
+	inv := 255 - a
+	pix := img.Pix[off : off+4 : off+4]
+	pix[0] = uint8((uint32(col.R)*a + uint32(pix[0])*inv) / 255)
+	pix[1] = uint8((uint32(col.G)*a + uint32(pix[1])*inv) / 255)
+	pix[2] = uint8((uint32(col.B)*a + uint32(pix[2])*inv) / 255)
+	pix[3] = uint8(a + uint32(pix[3])*inv/255)
+}
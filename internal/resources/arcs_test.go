@@ -0,0 +1,79 @@
+package resources
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestGreatCirclePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		lat1, lng1 float64
+		lat2, lng2 float64
+		parts      int
+	}{
+		{name: "Berlin to Paris", lat1: 52.52, lng1: 13.40, lat2: 48.86, lng2: 2.35, parts: 1},
+		{name: "Tokyo to San Francisco", lat1: 35.68, lng1: 139.69, lat2: 37.77, lng2: -122.42, parts: 2},
+		{name: "San Francisco to Tokyo", lat1: 37.77, lng1: -122.42, lat2: 35.68, lng2: 139.69, parts: 2},
+		{name: "Auckland to Honolulu", lat1: -36.85, lng1: 174.76, lat2: 21.31, lng2: -157.86, parts: 2},
+		{name: "Same point", lat1: 10, lng1: 20, lat2: 10, lng2: 20, parts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := GreatCirclePath(tt.lat1, tt.lng1, tt.lat2, tt.lng2, 64)
+			if len(path) != tt.parts {
+				t.Fatalf("expected %d parts, got %d", tt.parts, len(path))
+			}
+
+			first := path[0][0]
+			last := path[len(path)-1][len(path[len(path)-1])-1]
+			if math.Abs(first[1]-tt.lat1) > 1e-6 || math.Abs(first[0]-tt.lng1) > 1e-6 {
+				t.Errorf("path starts at %v, expected (%v, %v)", first, tt.lng1, tt.lat1)
+			}
+			if math.Abs(last[1]-tt.lat2) > 1e-6 || math.Abs(last[0]-tt.lng2) > 1e-6 {
+				t.Errorf("path ends at %v, expected (%v, %v)", last, tt.lng2, tt.lat2)
+			}
+
+			for p, line := range path {
+				for i := 1; i < len(line); i++ {
+					if math.Abs(line[i][0]-line[i-1][0]) > 180 {
+						t.Errorf("part %d jumps across the map between %v and %v", p, line[i-1], line[i])
+					}
+				}
+			}
+
+			// Consecutive parts must meet on opposite edges at the same latitude.
+			for p := 1; p < len(path); p++ {
+				end := path[p-1][len(path[p-1])-1]
+				start := path[p][0]
+				if math.Abs(math.Abs(end[0])-180) > 1e-9 || end[0] != -start[0] || end[1] != start[1] {
+					t.Errorf("parts %d and %d do not meet at the antimeridian: %v / %v", p-1, p, end, start)
+				}
+			}
+		})
+	}
+}
+
+func TestDrawArcBlends(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 360, 180))
+	for i := range img.Pix {
+		img.Pix[i] = 0
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+
+	path := GreatCirclePath(0, -10, 0, 10, 8) // along the equator
+	DrawArc(img, path, color.RGBA{255, 255, 255, 128}, 1, 360, 180)
+
+	got := img.RGBAAt(180, 90)
+	if got.R < 120 || got.R > 135 || got.A != 255 {
+		t.Errorf("expected half-blended pixel on the arc, got %v", got)
+	}
+	if got := img.RGBAAt(180, 60); got.R != 0 {
+		t.Errorf("pixel off the arc was modified: %v", got)
+	}
+}
@@ -637,7 +637,7 @@ func TestFillOceanBackground(t *testing.T) {
 
 	// Test light theme
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	fillOceanBackground(img, width, height, false)
+	fillOceanBackground(img, width, height, DefaultTheme(false).Ocean)
 
 	// Check that pixels are set and have valid ocean-like colors
 	centerColor := img.RGBAAt(width/2, height/2)
@@ -652,7 +652,7 @@ func TestFillOceanBackground(t *testing.T) {
 
 	// Test dark theme
 	img2 := image.NewRGBA(image.Rect(0, 0, width, height))
-	fillOceanBackground(img2, width, height, true)
+	fillOceanBackground(img2, width, height, DefaultTheme(true).Ocean)
 
 	centerColorDark := img2.RGBAAt(width/2, height/2)
 	if centerColorDark.A == 0 {
@@ -672,11 +672,12 @@ func TestSandRocksGradient(t *testing.T) {
 	// Test that the sand/rocks gradient function produces valid colors
 	width, height := 100, 100
 	hitCount := 15 // Boring country
+	sand := DefaultTheme(false).Prison.Sand
 
 	// Test different positions to ensure variety
-	color1 := getSandRocksGradientColor(hitCount, 10, 10, width, height)
-	color2 := getSandRocksGradientColor(hitCount, 50, 50, width, height)
-	color3 := getSandRocksGradientColor(hitCount, 90, 90, width, height)
+	color1 := getSandRocksGradientColor(sand, hitCount, 10, 10, width, height)
+	color2 := getSandRocksGradientColor(sand, hitCount, 50, 50, width, height)
+	color3 := getSandRocksGradientColor(sand, hitCount, 90, 90, width, height)
 
 	// Colors should not be transparent
 	if color1.A == 0 || color2.A == 0 || color3.A == 0 {
@@ -695,8 +696,8 @@ func TestSandRocksGradient(t *testing.T) {
 	}
 
 	// Test that higher hit counts produce slightly darker colors
-	color10 := getSandRocksGradientColor(10, 50, 50, width, height)
-	color30 := getSandRocksGradientColor(30, 50, 50, width, height)
+	color10 := getSandRocksGradientColor(sand, 10, 50, 50, width, height)
+	color30 := getSandRocksGradientColor(sand, 30, 50, 50, width, height)
 
 	// color30 should be darker (lower values) than color10
 	sum10 := int(color10.R) + int(color10.G) + int(color10.B)
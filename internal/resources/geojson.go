@@ -0,0 +1,68 @@
+package resources
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/simplify"
+)
+
+// DefaultSimplifyTolerance is the Douglas-Peucker tolerance in degrees used for
+// country outlines served to the web UI.
+const DefaultSimplifyTolerance = 0.05
+
+// Country states reported in GeoJSON properties.
+const (
+	CountryUnvisited = "unvisited"
+	CountryVisited   = "visited"
+	CountryPrison    = "prison"
+	CountryLiberated = "liberated"
+)
+
+// CountryState names the state of a country for clients.
+func CountryState(hits int, prison, liberated bool) string {
+	switch {
+	case liberated:
+		return CountryLiberated
+	case prison:
+		return CountryPrison
+	case hits > 0:
+		return CountryVisited
+	}
+	return CountryUnvisited
+}
+
+// CountryFeatures returns every country as a GeoJSON feature with outlines
+// simplified to tolerance degrees (0 keeps them as they are) and properties
+// describing its state: name, iso_a2, iso_a3, region, hits, state and target.
+func CountryFeatures(ne *NaturalEarthData, tolerance float64, hitCountries map[string]int, targetCountries map[string]bool, matrixPrisonCountries map[string]bool, liberatedCountries map[string]bool) *geojson.FeatureCollection {
+	fc := geojson.NewFeatureCollection()
+	for _, country := range ne.Countries {
+		geom := country.Geometry.Clone()
+		if tolerance > 0 {
+			geom = simplify.DouglasPeucker(tolerance).MultiPolygon(geom)
+		}
+		if len(geom) == 0 {
+			continue
+		}
+
+		var g orb.Geometry = geom
+		if len(geom) == 1 {
+			g = geom[0]
+		}
+		feature := geojson.NewFeature(g)
+		hits := hitCountries[country.Name]
+		feature.Properties["name"] = country.Name
+		feature.Properties["hits"] = hits
+		feature.Properties["state"] = CountryState(hits, matrixPrisonCountries[country.Name], liberatedCountries[country.Name])
+		feature.Properties["target"] = targetCountries[country.Name]
+		if alpha2, err := GetAlpha2ByName(country.Name); err == nil {
+			feature.Properties["iso_a2"] = alpha2
+			if info, err := GetCountryByAlpha2(alpha2); err == nil {
+				feature.Properties["iso_a3"] = info.Alpha3
+				feature.Properties["region"] = info.Region
+			}
+		}
+		fc.Append(feature)
+	}
+	return fc
+}
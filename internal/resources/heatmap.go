@@ -0,0 +1,182 @@
+package resources
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// HeatPoint is a single weighted location contributing to a heatmap.
+type HeatPoint struct {
+	Lat, Lng float64
+	Weight   float64
+}
+
+// Heatmap is a kernel density layer drawn above the country fills and below
+// the borders of a rendered map.
+type Heatmap struct {
+	Points   []HeatPoint
+	Radius   int    // Kernel radius in pixels at a 1000px wide map; scaled with the map width
+	Colormap string // One of HeatmapColormaps
+}
+
+// heatmapColormaps maps a colormap name to evenly spaced colour stops from
+// low to high density.
+var heatmapColormaps = map[string][]color.RGBA{
+	"inferno": {{0, 0, 4, 255}, {87, 16, 110, 255}, {188, 55, 84, 255}, {249, 142, 9, 255}, {252, 255, 164, 255}},
+	"viridis": {{68, 1, 84, 255}, {59, 82, 139, 255}, {33, 145, 140, 255}, {94, 201, 98, 255}, {253, 231, 37, 255}},
+	"hot":     {{64, 0, 0, 255}, {200, 0, 0, 255}, {255, 120, 0, 255}, {255, 230, 0, 255}, {255, 255, 255, 255}},
+	"blues":   {{8, 48, 107, 255}, {33, 113, 181, 255}, {107, 174, 214, 255}, {198, 219, 239, 255}, {247, 251, 255, 255}},
+}
+
+// HeatmapColormaps returns the names of the available heatmap colormaps.
+func HeatmapColormaps() []string {
+	return []string{"inferno", "viridis", "hot", "blues"}
+}
+
+// IsHeatmapColormap reports whether name is a known colormap.
+func IsHeatmapColormap(name string) bool {
+	_, ok := heatmapColormaps[strings.ToLower(name)]
+	return ok
+}
+
+// DrawHeatmap estimates the density of heat.Points with a Gaussian kernel and
+// blends the colour-mapped result onto img. Density is normalised to the
+// densest pixel; areas with negligible density stay untouched and opacity
+// grows with density so sparse hits read as faint glows.
+func DrawHeatmap(img *image.RGBA, heat *Heatmap, width, height int) {
+	if heat == nil || len(heat.Points) == 0 || width <= 0 || height <= 0 {
+		return
+	}
+	stops, ok := heatmapColormaps[strings.ToLower(heat.Colormap)]
+	if !ok {
+		stops = heatmapColormaps["inferno"]
+	}
+
+	radius := heat.Radius
+	if radius <= 0 {
+		radius = 12
+	}
+
+	// Estimate density on a grid of at most ~1000px width and sample it back
+	// up; the kernel is smooth so this is visually lossless and keeps 4K
+	// renders cheap.
+	scale := (width + 999) / 1000
+	gw, gh := (width+scale-1)/scale, (height+scale-1)/scale
+	gridRadius := int(math.Max(1, math.Round(float64(radius)*float64(gw)/1000)))
+
+	density := make([]float32, gw*gh)
+	for _, p := range heat.Points {
+		x, y := geoToPixel(p.Lat, p.Lng, gw, gh)
+		xi, yi := int(x), int(y)
+		if xi < 0 || xi >= gw || yi < 0 || yi >= gh {
+			continue
+		}
+		w := p.Weight
+		if w <= 0 {
+			w = 1
+		}
+		density[yi*gw+xi] += float32(w)
+	}
+
+	blurGaussian(density, gw, gh, gridRadius)
+
+	var maxDensity float32
+	for _, d := range density {
+		if d > maxDensity {
+			maxDensity = d
+		}
+	}
+	if maxDensity <= 0 {
+		return
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			t := float64(sampleGrid(density, gw, gh, x, y, scale) / maxDensity)
+			if t < 0.02 {
+				continue
+			}
+			// Square-root scaling keeps secondary hot spots visible next to a
+			// dominant one (e.g. Frankfurt next to Ashburn).
+			t = math.Sqrt(t)
+			col := sampleColormap(stops, t)
+			col.A = uint8(math.Min(220, 40+t*200))
+			blendPixel(img, x, y, col)
+		}
+	}
+}
+
+// sampleGrid bilinearly samples a density grid that is scale times smaller
+// than the image at image pixel (x, y).
+func sampleGrid(grid []float32, gw, gh, x, y, scale int) float32 {
+	if scale == 1 {
+		return grid[y*gw+x]
+	}
+	fx := (float64(x)+0.5)/float64(scale) - 0.5
+	fy := (float64(y)+0.5)/float64(scale) - 0.5
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := float32(fx-float64(x0)), float32(fy-float64(y0))
+	at := func(gx, gy int) float32 {
+		gx = (gx%gw + gw) % gw
+		if gy < 0 {
+			gy = 0
+		}
+		if gy >= gh {
+			gy = gh - 1
+		}
+		return grid[gy*gw+gx]
+	}
+	top := at(x0, y0)*(1-tx) + at(x0+1, y0)*tx
+	bottom := at(x0, y0+1)*(1-tx) + at(x0+1, y0+1)*tx
+	return top*(1-ty) + bottom*ty
+}
+
+// blurGaussian applies a separable Gaussian blur (sigma = radius/2) in place.
+// Rows wrap around horizontally because the map's left and right edges meet
+// at the antimeridian; columns are clamped at the poles.
+func blurGaussian(grid []float32, width, height, radius int) {
+	sigma := float64(radius) / 2
+	kernel := make([]float32, 2*radius+1)
+	for i := -radius; i <= radius; i++ {
+		kernel[i+radius] = float32(math.Exp(-float64(i*i) / (2 * sigma * sigma)))
+	}
+
+	tmp := make([]float32, len(grid))
+	for y := 0; y < height; y++ {
+		row := grid[y*width : (y+1)*width]
+		for x := 0; x < width; x++ {
+			var sum float32
+			for k := -radius; k <= radius; k++ {
+				sx := ((x+k)%width + width) % width
+				sum += row[sx] * kernel[k+radius]
+			}
+			tmp[y*width+x] = sum
+		}
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			var sum float32
+			for k := -radius; k <= radius; k++ {
+				sy := y + k
+				if sy < 0 || sy >= height {
+					continue
+				}
+				sum += tmp[sy*width+x] * kernel[k+radius]
+			}
+			grid[y*width+x] = sum
+		}
+	}
+}
+
+// sampleColormap interpolates the colour at t (0-1) between evenly spaced stops.
+func sampleColormap(stops []color.RGBA, t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t))
+	pos := t * float64(len(stops)-1)
+	i := int(pos)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	return interpolateColor(stops[i], stops[i+1], pos-float64(i))
+}
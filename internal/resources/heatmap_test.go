@@ -0,0 +1,66 @@
+package resources
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDrawHeatmap(t *testing.T) {
+	width, height := 400, 200
+	background := color.RGBA{10, 20, 30, 255}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = background.R, background.G, background.B, background.A
+	}
+
+	// Two hits in Frankfurt, one in Ashburn
+	heat := &Heatmap{
+		Points: []HeatPoint{
+			{Lat: 50.11, Lng: 8.68, Weight: 1},
+			{Lat: 50.11, Lng: 8.68, Weight: 1},
+			{Lat: 39.04, Lng: -77.49, Weight: 1},
+		},
+		Radius:   20,
+		Colormap: "viridis",
+	}
+	DrawHeatmap(img, heat, width, height)
+
+	fx, fy := geoToPixel(50.11, 8.68, width, height)
+	if got := img.RGBAAt(int(fx), int(fy)); got == background {
+		t.Errorf("expected heat at Frankfurt, got background %v", got)
+	}
+	ax, ay := geoToPixel(39.04, -77.49, width, height)
+	if got := img.RGBAAt(int(ax), int(ay)); got == background {
+		t.Errorf("expected heat at Ashburn, got background %v", got)
+	}
+	// Far away from any hit (South Pacific) nothing is drawn
+	px, py := geoToPixel(-40, -130, width, height)
+	if got := img.RGBAAt(int(px), int(py)); got != background {
+		t.Errorf("expected background in the South Pacific, got %v", got)
+	}
+}
+
+func TestDrawHeatmapEmpty(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	DrawHeatmap(img, nil, 100, 50)
+	DrawHeatmap(img, &Heatmap{}, 100, 50)
+	for i, v := range img.Pix {
+		if v != 0 {
+			t.Fatalf("expected untouched image, got %d at byte %d", v, i)
+		}
+	}
+}
+
+func TestSampleColormap(t *testing.T) {
+	stops := heatmapColormaps["hot"]
+	if got := sampleColormap(stops, 0); got != stops[0] {
+		t.Errorf("expected %v, got %v", stops[0], got)
+	}
+	if got := sampleColormap(stops, 1); got != stops[len(stops)-1] {
+		t.Errorf("expected %v, got %v", stops[len(stops)-1], got)
+	}
+	if got := sampleColormap(stops, 2); got != stops[len(stops)-1] {
+		t.Errorf("expected clamp to %v, got %v", stops[len(stops)-1], got)
+	}
+}
@@ -0,0 +1,281 @@
+package resources
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+)
+
+// smallCountryPoints locates countries, by ISO alpha-2 code, that are too small
+// to be part of the embedded Natural Earth geometry, so they can still get a
+// callout when they have a state.
+var smallCountryPoints = map[string]orb.Point{
+	"AD": {1.52, 42.51},     // Andorra
+	"AG": {-61.85, 17.12},   // Antigua and Barbuda
+	"BB": {-59.54, 13.19},   // Barbados
+	"BH": {50.56, 26.07},    // Bahrain
+	"CV": {-23.61, 15.12},   // Cabo Verde
+	"DM": {-61.37, 15.41},   // Dominica
+	"FM": {158.16, 6.92},    // Micronesia
+	"GD": {-61.68, 12.12},   // Grenada
+	"HK": {114.17, 22.32},   // Hong Kong
+	"KI": {173.00, 1.45},    // Kiribati
+	"KM": {43.26, -11.70},   // Comoros
+	"KN": {-62.72, 17.30},   // Saint Kitts and Nevis
+	"LC": {-60.98, 13.91},   // Saint Lucia
+	"LI": {9.55, 47.16},     // Liechtenstein
+	"MC": {7.42, 43.73},     // Monaco
+	"MH": {171.38, 7.10},    // Marshall Islands
+	"MO": {113.54, 22.20},   // Macao
+	"MT": {14.45, 35.90},    // Malta
+	"MU": {57.55, -20.25},   // Mauritius
+	"MV": {73.51, 4.18},     // Maldives
+	"NR": {166.93, -0.53},   // Nauru
+	"PW": {134.62, 7.50},    // Palau
+	"SC": {55.45, -4.62},    // Seychelles
+	"SG": {103.82, 1.35},    // Singapore
+	"SM": {12.46, 43.94},    // San Marino
+	"ST": {6.61, 0.19},      // Sao Tome and Principe
+	"TO": {-175.20, -21.18}, // Tonga
+	"TV": {179.20, -8.52},   // Tuvalu
+	"VA": {12.45, 41.90},    // Holy See
+	"VC": {-61.20, 13.25},   // Saint Vincent and the Grenadines
+	"WS": {-172.10, -13.76}, // Samoa
+}
+
+// smallCountryPoint returns the location of a country missing from the map
+// geometry, looked up by name.
+func smallCountryPoint(name string) (orb.Point, bool) {
+	alpha2, err := GetAlpha2ByName(name)
+	if err != nil {
+		return orb.Point{}, false
+	}
+	point, ok := smallCountryPoints[alpha2]
+	return point, ok
+}
+
+// InsetOptions enables callout markers for countries too small to see.
+type InsetOptions struct {
+	MinArea int // countries covering fewer pixels get a marker
+}
+
+// NewInsetOptions returns inset options for an "inset_min_area" setting, or
+// nil when insets are off.
+func NewInsetOptions(minArea int) *InsetOptions {
+	if minArea <= 0 {
+		return nil
+	}
+	return &InsetOptions{MinArea: minArea}
+}
+
+// Inset is a circular callout showing the state of one small country.
+type Inset struct {
+	Country string
+	Anchor  image.Point     // the country's location on the map
+	Center  image.Point     // marker center; offset from Anchor when crowded
+	Radius  int             // fill radius, not counting the outline
+	Rect    image.Rectangle // area covered by the marker and its outline
+
+	hits      int
+	target    bool
+	prison    bool
+	liberated bool
+}
+
+// insetOffsets are the directions tried, in order, when a marker would cover
+// another one.
+var insetOffsets = [][2]float64{{1, -1}, {-1, -1}, {1, 1}, {-1, 1}, {0, -1.4}, {1.4, 0}, {0, 1.4}, {-1.4, 0}}
+
+// PlaceInsets chooses callout markers for countries that are visited, the
+// target or in Matrix Prison but cover fewer than opts.MinArea pixels, including
+// countries too small to be in the map geometry at all. Markers sit on the
+// country when there is room and are pushed outwards along a leader line when
+// crowded; markers that cannot be placed clear of the others and the obstacles
+// are dropped. Targets are placed first, then Matrix Prison countries, then
+// the most visited.
+func PlaceInsets(ne *NaturalEarthData, width, height int, theme *Theme, opts *InsetOptions, hitCountries map[string]int, targetCountries map[string]bool, matrixPrisonCountries map[string]bool, liberatedCountries map[string]bool, obstacles []image.Rectangle) []Inset {
+	if opts == nil || ne == nil {
+		return nil
+	}
+
+	states := make(map[string]bool, len(hitCountries)+len(matrixPrisonCountries)+1)
+	for name, hits := range hitCountries {
+		if hits > 0 {
+			states[name] = true
+		}
+	}
+	for name, prison := range matrixPrisonCountries {
+		if prison {
+			states[name] = true
+		}
+	}
+	for name, target := range targetCountries {
+		if target {
+			states[name] = true
+		}
+	}
+
+	var candidates []Inset
+	inGeometry := make(map[string]bool, len(ne.Countries))
+	for _, country := range ne.Countries {
+		inGeometry[country.Name] = true
+		if !states[country.Name] {
+			continue
+		}
+		mask := getCountryMask(country, width, height)
+		area := 0
+		for _, s := range mask.spans {
+			area += s.x2 - s.x1 + 1
+		}
+		if area >= opts.MinArea {
+			continue
+		}
+		center := country.Geometry.Bound().Center()
+		x, y := geoToPixel(center[1], center[0], width, height)
+		candidates = append(candidates, Inset{Country: country.Name, Anchor: image.Pt(int(x), int(y))})
+	}
+	for name := range states {
+		if inGeometry[name] {
+			continue
+		}
+		point, ok := smallCountryPoint(name)
+		if !ok {
+			continue
+		}
+		lat, lng := ne.project(point[1], point[0])
+		x, y := geoToPixel(lat, lng, width, height)
+		candidates = append(candidates, Inset{Country: name, Anchor: image.Pt(int(x), int(y))})
+	}
+
+	for i := range candidates {
+		c := &candidates[i]
+		c.hits = hitCountries[c.Country]
+		c.target = targetCountries[c.Country]
+		c.prison = matrixPrisonCountries[c.Country]
+		c.liberated = liberatedCountries[c.Country]
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.target != b.target {
+			return a.target
+		}
+		if a.prison != b.prison {
+			return a.prison
+		}
+		if a.hits != b.hits {
+			return a.hits > b.hits
+		}
+		return a.Country < b.Country
+	})
+
+	radius := max(5, int(math.Round(float64(height)*0.008)))
+	bounds := image.Rect(0, 0, width, height)
+	placed := append([]image.Rectangle(nil), obstacles...)
+	var insets []Inset
+	for _, c := range candidates {
+		if !c.Anchor.In(bounds) {
+			continue
+		}
+		outline := 1
+		if c.target {
+			outline = theme.Target.Width
+		}
+		extent := radius + outline
+		c.Radius = radius
+
+		found := false
+		for ring := 0; ring <= 3 && !found; ring++ {
+			offsets := insetOffsets
+			if ring == 0 {
+				offsets = [][2]float64{{0, 0}}
+			}
+			dist := float64(extent) * (1.5 + 1.5*float64(ring))
+			for _, o := range offsets {
+				center := c.Anchor.Add(image.Pt(int(o[0]*dist), int(o[1]*dist)))
+				rect := image.Rect(center.X-extent, center.Y-extent, center.X+extent+1, center.Y+extent+1)
+				if !rect.In(bounds) || overlapsAny(rect, placed) {
+					continue
+				}
+				c.Center, c.Rect = center, rect
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		placed = append(placed, c.Rect)
+		insets = append(insets, c)
+	}
+	return insets
+}
+
+// DrawInsets draws placed callout markers, filled with a sample of each
+// country's style: its flag, its Matrix Prison rain or its hit color, ringed in
+// the target color for the target.
+func DrawInsets(img *image.RGBA, insets []Inset, flagManager *FlagManager, theme *Theme) {
+	leader := color.RGBA(theme.Status.Border)
+	leader.A = 255
+	for _, inset := range insets {
+		if inset.Center != inset.Anchor {
+			drawLine(img, inset.Anchor.X, inset.Anchor.Y, inset.Center.X, inset.Center.Y, leader)
+			draw.Draw(img, image.Rect(inset.Anchor.X-1, inset.Anchor.Y-1, inset.Anchor.X+2, inset.Anchor.Y+2), image.NewUniform(leader), image.Point{}, draw.Src)
+		}
+
+		r := inset.Radius
+		square := image.Rect(inset.Center.X-r, inset.Center.Y-r, inset.Center.X+r+1, inset.Center.Y+r+1)
+		sample := image.NewRGBA(square)
+		drawInsetSample(sample, inset, flagManager, theme)
+
+		outline, ring := color.RGBA(theme.Status.Border), 1
+		if inset.target {
+			outline, ring = color.RGBA(theme.Target.Color), theme.Target.Width
+		}
+		for dy := -r - ring; dy <= r+ring; dy++ {
+			for dx := -r - ring; dx <= r+ring; dx++ {
+				x, y := inset.Center.X+dx, inset.Center.Y+dy
+				if !(image.Point{x, y}).In(img.Rect) {
+					continue
+				}
+				d := math.Hypot(float64(dx), float64(dy))
+				switch {
+				case d <= float64(r):
+					img.SetRGBA(x, y, sample.RGBAAt(x, y))
+				case d <= float64(r+ring):
+					img.SetRGBA(x, y, outline)
+				}
+			}
+		}
+	}
+}
+
+// drawInsetSample paints a country's style into the marker's square.
+func drawInsetSample(img *image.RGBA, inset Inset, flagManager *FlagManager, theme *Theme) {
+	r := img.Bounds()
+	var flag image.Image
+	if flagManager != nil && theme.Flags {
+		if alpha2, err := GetAlpha2ByName(inset.Country); err == nil {
+			flag = flagManager.GetFlag(alpha2)
+		}
+	}
+
+	switch {
+	case inset.prison && inset.liberated && flag != nil:
+		drawScaled(img, r, flag)
+		drawRainSample(img, r, theme.Prison.Rain, 160)
+	case inset.prison:
+		draw.Draw(img, r, image.NewUniform(color.RGBA(theme.Prison.Background)), image.Point{}, draw.Src)
+		drawRainSample(img, r, theme.Prison.Rain, 255)
+	case inset.hits > 0 && flag != nil:
+		drawScaled(img, r, flag)
+	case inset.hits > 0:
+		draw.Draw(img, r, image.NewUniform(color.RGBA(theme.Land)), image.Point{}, draw.Src)
+		draw.Draw(img, r, image.NewUniform(nrgba(Color(theme.hitColor(inset.hits)))), image.Point{}, draw.Over)
+	default:
+		draw.Draw(img, r, image.NewUniform(color.RGBA(theme.Land)), image.Point{}, draw.Src)
+	}
+}
@@ -0,0 +1,50 @@
+package resources
+
+import (
+	"image"
+	"testing"
+)
+
+func TestPlaceInsets(t *testing.T) {
+	ne, _, _ := loadRenderFixtures(t)
+	theme := DefaultTheme(false)
+	width, height := 1000, 500
+	hits := map[string]int{"France": 3, "Luxembourg": 2, "Monaco": 1, "San Marino": 1, "Holy See": 2, "Atlantis": 4}
+
+	insets := PlaceInsets(ne, width, height, theme, NewInsetOptions(30), hits, map[string]bool{"Nauru": true}, map[string]bool{"San Marino": true}, nil, nil)
+	byCountry := make(map[string]Inset)
+	for i, inset := range insets {
+		byCountry[inset.Country] = inset
+		if !inset.Rect.In(image.Rect(0, 0, width, height)) {
+			t.Errorf("inset for %s is outside the map: %v", inset.Country, inset.Rect)
+		}
+		for _, other := range insets[:i] {
+			if inset.Rect.Overlaps(other.Rect) {
+				t.Errorf("insets for %s and %s overlap", inset.Country, other.Country)
+			}
+		}
+	}
+	for _, name := range []string{"Luxembourg", "Monaco", "San Marino", "Holy See", "Nauru"} {
+		if _, ok := byCountry[name]; !ok {
+			t.Errorf("expected an inset for %s, got %v", name, insets)
+		}
+	}
+	if _, ok := byCountry["France"]; ok {
+		t.Error("expected no inset for a large country")
+	}
+	if _, ok := byCountry["Atlantis"]; ok {
+		t.Error("expected no inset for a country without a location")
+	}
+	if insets[0].Country != "Nauru" || insets[1].Country != "San Marino" {
+		t.Errorf("expected the target then the prison country first, got %s, %s", insets[0].Country, insets[1].Country)
+	}
+
+	// Crowded markers are pushed off their country along a leader line
+	if vatican := byCountry["Holy See"]; vatican.Center == vatican.Anchor {
+		t.Error("expected the Holy See marker to be pushed clear of San Marino")
+	}
+
+	if NewInsetOptions(0) != nil {
+		t.Error("expected nil inset options for a zero minimum area")
+	}
+}
@@ -0,0 +1,402 @@
+package resources
+
+import (
+	"container/heap"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"github.com/paulmach/orb"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Label modes.
+const (
+	LabelNames = "names" // country names, falling back to ISO codes where a name does not fit
+	LabelISO   = "iso"   // ISO 3166-1 alpha-3 codes
+)
+
+// labelPrecision is the polylabel search precision in pixels.
+const labelPrecision = 0.5
+
+// LabelOptions enables country labels on a rendered map.
+type LabelOptions struct {
+	Mode        string  // LabelNames or LabelISO
+	VisitedOnly bool    // label only countries with hits
+	MinArea     int     // countries smaller than this many pixels are not labelled
+	FontSize    float64 // 0 picks a size from the map height
+}
+
+// NewLabelOptions returns label options for a "labels" setting, or nil when
+// labels are off.
+func NewLabelOptions(mode string, visitedOnly bool, minArea int) *LabelOptions {
+	if mode != LabelNames && mode != LabelISO {
+		return nil
+	}
+	return &LabelOptions{Mode: mode, VisitedOnly: visitedOnly, MinArea: minArea}
+}
+
+// Label is a placed country label in map pixel coordinates. Placement is
+// separate from drawing so vector outputs can reuse it.
+type Label struct {
+	Country string
+	Text    string
+	X, Y    float64         // center of the text
+	Rect    image.Rectangle // text bounds including the halo
+}
+
+// labelAnchor is a country's pole of inaccessibility at one map size.
+type labelAnchor struct {
+	x, y   float64 // most interior point of the largest polygon
+	radius float64 // distance from there to the nearest edge, in pixels
+	area   int     // painted pixels of the whole country
+}
+
+// countryLabelAnchor returns the cached label anchor for a country.
+func countryLabelAnchor(country CountryData, width, height int) labelAnchor {
+	entry := getCountryMask(country, width, height)
+	entry.anchorOnce.Do(func() {
+		for _, s := range entry.spans {
+			entry.anchor.area += s.x2 - s.x1 + 1
+		}
+		var largest orb.Polygon
+		largestArea := -1.0
+		for _, polygon := range country.Geometry {
+			projected := projectPolygon(polygon, width, height)
+			if a := math.Abs(ringArea(projected[0])); a > largestArea {
+				largest, largestArea = projected, a
+			}
+		}
+		if largest != nil {
+			p, d := poleOfInaccessibility(largest, labelPrecision)
+			entry.anchor.x, entry.anchor.y, entry.anchor.radius = p[0], p[1], d
+		}
+	})
+	return entry.anchor
+}
+
+// projectPolygon converts a polygon to map pixel coordinates.
+func projectPolygon(polygon orb.Polygon, width, height int) orb.Polygon {
+	projected := make(orb.Polygon, len(polygon))
+	for i, ring := range polygon {
+		projected[i] = make(orb.Ring, len(ring))
+		for j, pt := range ring {
+			x, y := geoToPixel(pt[1], pt[0], width, height)
+			projected[i][j] = orb.Point{x, y}
+		}
+	}
+	return projected
+}
+
+// ringArea returns the signed shoelace area of a ring.
+func ringArea(ring orb.Ring) float64 {
+	area := 0.0
+	for i := 0; i+1 < len(ring); i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return area / 2
+}
+
+// poleCell is a square of the polylabel search grid.
+type poleCell struct {
+	x, y float64 // center
+	h    float64 // half size
+	d    float64 // signed distance from the center to the polygon
+	max  float64 // best possible distance inside the cell
+}
+
+func newPoleCell(x, y, h float64, polygon orb.Polygon) poleCell {
+	d := pointToPolygonDistance(x, y, polygon)
+	return poleCell{x: x, y: y, h: h, d: d, max: d + h*math.Sqrt2}
+}
+
+// poleQueue is a max-heap of cells by potential distance.
+type poleQueue []poleCell
+
+func (q poleQueue) Len() int            { return len(q) }
+func (q poleQueue) Less(i, j int) bool  { return q[i].max > q[j].max }
+func (q poleQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *poleQueue) Push(x interface{}) { *q = append(*q, x.(poleCell)) }
+func (q *poleQueue) Pop() interface{} {
+	old := *q
+	cell := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return cell
+}
+
+// poleOfInaccessibility finds the point inside polygon farthest from its
+// edges (the "polylabel" algorithm): a quadtree search that discards cells
+// which cannot beat the best distance found so far by more than precision.
+// It returns the point and its distance to the nearest edge.
+func poleOfInaccessibility(polygon orb.Polygon, precision float64) (orb.Point, float64) {
+	if len(polygon) == 0 || len(polygon[0]) < 4 {
+		if len(polygon) > 0 && len(polygon[0]) > 0 {
+			return polygon[0][0], 0
+		}
+		return orb.Point{}, 0
+	}
+	bound := polygon[0].Bound()
+	w, h := bound.Max[0]-bound.Min[0], bound.Max[1]-bound.Min[1]
+	cellSize := math.Min(w, h)
+	if cellSize == 0 {
+		return bound.Min, 0
+	}
+
+	queue := &poleQueue{}
+	half := cellSize / 2
+	for x := bound.Min[0]; x < bound.Max[0]; x += cellSize {
+		for y := bound.Min[1]; y < bound.Max[1]; y += cellSize {
+			heap.Push(queue, newPoleCell(x+half, y+half, half, polygon))
+		}
+	}
+
+	// Start from the centroid, which is often a good guess
+	best := newPoleCell(bound.Center()[0], bound.Center()[1], 0, polygon)
+	centroid := ringCentroid(polygon[0])
+	if c := newPoleCell(centroid[0], centroid[1], 0, polygon); c.d > best.d {
+		best = c
+	}
+
+	for queue.Len() > 0 {
+		cell := heap.Pop(queue).(poleCell)
+		if cell.d > best.d {
+			best = cell
+		}
+		if cell.max-best.d <= precision {
+			continue
+		}
+		h := cell.h / 2
+		heap.Push(queue, newPoleCell(cell.x-h, cell.y-h, h, polygon))
+		heap.Push(queue, newPoleCell(cell.x+h, cell.y-h, h, polygon))
+		heap.Push(queue, newPoleCell(cell.x-h, cell.y+h, h, polygon))
+		heap.Push(queue, newPoleCell(cell.x+h, cell.y+h, h, polygon))
+	}
+	return orb.Point{best.x, best.y}, math.Max(0, best.d)
+}
+
+// ringCentroid returns the area centroid of a ring, or its first point when
+// the ring is degenerate.
+func ringCentroid(ring orb.Ring) orb.Point {
+	var cx, cy, area float64
+	for i := 0; i+1 < len(ring); i++ {
+		f := ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+		cx += (ring[i][0] + ring[i+1][0]) * f
+		cy += (ring[i][1] + ring[i+1][1]) * f
+		area += f * 3
+	}
+	if area == 0 {
+		return ring[0]
+	}
+	return orb.Point{cx / area, cy / area}
+}
+
+// pointToPolygonDistance returns the distance from (x, y) to the polygon
+// outline: positive inside, negative outside (holes count as outside).
+func pointToPolygonDistance(x, y float64, polygon orb.Polygon) float64 {
+	inside := false
+	minDist := math.Inf(1)
+	for _, ring := range polygon {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			a, b := ring[i], ring[j]
+			if (a[1] > y) != (b[1] > y) && x < (b[0]-a[0])*(y-a[1])/(b[1]-a[1])+a[0] {
+				inside = !inside
+			}
+			minDist = math.Min(minDist, segmentDistance(x, y, a, b))
+		}
+	}
+	if inside {
+		return minDist
+	}
+	return -minDist
+}
+
+// segmentDistance returns the distance from (x, y) to segment ab.
+func segmentDistance(x, y float64, a, b orb.Point) float64 {
+	px, py := a[0], a[1]
+	dx, dy := b[0]-px, b[1]-py
+	if dx != 0 || dy != 0 {
+		t := ((x-px)*dx + (y-py)*dy) / (dx*dx + dy*dy)
+		if t > 1 {
+			px, py = b[0], b[1]
+		} else if t > 0 {
+			px += dx * t
+			py += dy * t
+		}
+	}
+	return math.Hypot(x-px, y-py)
+}
+
+// labelFontSize returns the label text size for a map height.
+func (o *LabelOptions) labelFontSize(height int) float64 {
+	if o.FontSize > 0 {
+		return o.FontSize
+	}
+	return math.Max(9, math.Round(float64(height)*0.016))
+}
+
+// labelCandidate is a country that may get a label.
+type labelCandidate struct {
+	country  CountryData
+	anchor   labelAnchor
+	priority int
+}
+
+// PlaceLabels chooses label positions for the countries on a map. Countries
+// below the minimum area are skipped; the rest are placed at their pole of
+// inaccessibility in priority order (target, Matrix Prison, visited by hits,
+// then by size) and dropped when they would overlap an already placed label
+// or one of the obstacles (e.g. the legend).
+func PlaceLabels(ne *NaturalEarthData, width, height int, fm *FontManager, theme *Theme, opts *LabelOptions, hitCountries map[string]int, targetCountries map[string]bool, matrixPrisonCountries map[string]bool, obstacles []image.Rectangle) []Label {
+	if opts == nil || ne == nil {
+		return nil
+	}
+	ttf := theme.labelFont(fm)
+	if ttf == nil {
+		return nil
+	}
+	size := opts.labelFontSize(height)
+	face := truetype.NewFace(ttf, &truetype.Options{Size: size, DPI: 72, Hinting: font.HintingFull})
+	defer func() { _ = face.Close() }()
+
+	var candidates []labelCandidate
+	for _, country := range ne.Countries {
+		hits := hitCountries[country.Name]
+		isTarget := targetCountries[country.Name]
+		if opts.VisitedOnly && hits == 0 && !isTarget {
+			continue
+		}
+		anchor := countryLabelAnchor(country, width, height)
+		if anchor.area < max(opts.MinArea, 1) {
+			continue
+		}
+		priority := min(hits, 10)
+		switch {
+		case isTarget:
+			priority = 100
+		case matrixPrisonCountries[country.Name]:
+			priority = 50
+		}
+		candidates = append(candidates, labelCandidate{country: country, anchor: anchor, priority: priority})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority > candidates[j].priority
+		}
+		return candidates[i].anchor.area > candidates[j].anchor.area
+	})
+
+	bounds := image.Rect(0, 0, width, height)
+	halo := int(math.Ceil(size / 8))
+	placed := append([]image.Rectangle(nil), obstacles...)
+	var labels []Label
+	for _, c := range candidates {
+		text := labelText(c.country.Name, opts.Mode)
+		textWidth := font.MeasureString(face, text).Ceil()
+		if opts.Mode == LabelNames && float64(textWidth) > 4*c.anchor.radius+size {
+			// Long names on narrow countries read better as codes
+			if code := labelText(c.country.Name, LabelISO); code != "" {
+				text, textWidth = code, font.MeasureString(face, code).Ceil()
+			}
+		}
+		if text == "" {
+			continue
+		}
+		textHeight := int(math.Ceil(size))
+		rect := image.Rect(
+			int(c.anchor.x)-textWidth/2-halo, int(c.anchor.y)-textHeight/2-halo,
+			int(c.anchor.x)+(textWidth+1)/2+halo, int(c.anchor.y)+(textHeight+1)/2+halo,
+		)
+		if !rect.In(bounds) || overlapsAny(rect, placed) {
+			continue
+		}
+		placed = append(placed, rect)
+		labels = append(labels, Label{Country: c.country.Name, Text: text, X: c.anchor.x, Y: c.anchor.y, Rect: rect})
+	}
+	return labels
+}
+
+// labelText returns the label for a country in the given mode.
+func labelText(name, mode string) string {
+	if mode != LabelISO {
+		return name
+	}
+	alpha2, err := GetAlpha2ByName(name)
+	if err != nil {
+		return ""
+	}
+	country, err := GetCountryByAlpha2(alpha2)
+	if err != nil {
+		return ""
+	}
+	return country.Alpha3
+}
+
+// overlapsAny reports whether r overlaps any of rects.
+func overlapsAny(r image.Rectangle, rects []image.Rectangle) bool {
+	for _, other := range rects {
+		if r.Overlaps(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// DrawLabels draws placed labels with a halo so they read on any fill.
+func DrawLabels(img *image.RGBA, labels []Label, fm *FontManager, theme *Theme, opts *LabelOptions) {
+	if len(labels) == 0 || opts == nil {
+		return
+	}
+	ttf := theme.labelFont(fm)
+	if ttf == nil {
+		return
+	}
+	size := opts.labelFontSize(img.Bounds().Dy())
+	face := truetype.NewFace(ttf, &truetype.Options{Size: size, DPI: 72})
+	defer func() { _ = face.Close() }()
+	ascent := face.Metrics().Ascent.Ceil()
+
+	c := freetype.NewContext()
+	c.SetDPI(72)
+	c.SetFont(ttf)
+	c.SetFontSize(size)
+	c.SetClip(img.Bounds())
+	c.SetDst(img)
+	halo := image.NewUniform(nrgba(theme.Labels.Halo))
+	text := image.NewUniform(nrgba(theme.Labels.Text))
+	offset := math.Max(1, math.Round(size/12))
+
+	for _, label := range labels {
+		width := font.MeasureString(face, label.Text)
+		x := label.X - float64(width)/64/2
+		y := label.Y + float64(ascent)/2 - 1
+		if theme.Labels.Halo.A > 0 {
+			c.SetSrc(halo)
+			for _, d := range [][2]float64{{-1, 0}, {1, 0}, {0, -1}, {0, 1}, {-1, -1}, {1, 1}, {-1, 1}, {1, -1}} {
+				_, _ = c.DrawString(label.Text, labelPoint(x+d[0]*offset, y+d[1]*offset))
+			}
+		}
+		c.SetSrc(text)
+		_, _ = c.DrawString(label.Text, labelPoint(x, y))
+	}
+}
+
+// labelPoint converts pixel coordinates to a freetype point.
+func labelPoint(x, y float64) fixed.Point26_6 {
+	return fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)}
+}
+
+// nrgba converts a theme color for use as a drawing source.
+func nrgba(c Color) color.NRGBA {
+	return color.NRGBA{c.R, c.G, c.B, c.A}
+}
+
+// anchorCache guards the lazily computed label anchor of a mask entry.
+type anchorCache struct {
+	anchorOnce sync.Once
+	anchor     labelAnchor
+}
@@ -0,0 +1,136 @@
+package resources
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+func TestPoleOfInaccessibility(t *testing.T) {
+	tests := []struct {
+		name     string
+		polygon  orb.Polygon
+		expected orb.Point
+		radius   float64
+	}{
+		{
+			name:     "square",
+			polygon:  orb.Polygon{{{0, 0}, {100, 0}, {100, 100}, {0, 100}, {0, 0}}},
+			expected: orb.Point{50, 50},
+			radius:   50,
+		},
+		{
+			// The pole sits in the corner where both arms meet, as far from
+			// the outer edges as from the inner corner at (40, 40)
+			name:     "L-shape",
+			polygon:  orb.Polygon{{{0, 0}, {100, 0}, {100, 40}, {40, 40}, {40, 100}, {0, 100}, {0, 0}}},
+			expected: orb.Point{23.4, 23.4},
+			radius:   23.4,
+		},
+		{
+			name: "square with hole",
+			polygon: orb.Polygon{
+				{{0, 0}, {100, 0}, {100, 100}, {0, 100}, {0, 0}},
+				{{20, 20}, {100, 20}, {100, 100}, {20, 100}, {20, 20}},
+			},
+			expected: orb.Point{11.7, 11.7},
+			radius:   11.7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pole, radius := poleOfInaccessibility(tt.polygon, labelPrecision)
+			if math.Abs(radius-tt.radius) > 1 {
+				t.Errorf("expected radius %.1f, got %.1f", tt.radius, radius)
+			}
+			if math.Abs(pole[0]-tt.expected[0]) > 1 || math.Abs(pole[1]-tt.expected[1]) > 1 {
+				t.Errorf("expected pole near %v, got %v", tt.expected, pole)
+			}
+		})
+	}
+}
+
+func TestPlaceLabels(t *testing.T) {
+	ne, fm, _ := loadRenderFixtures(t)
+	theme := DefaultTheme(false)
+	width, height := 1600, 800
+	hits := map[string]int{"Russia": 3, "Brazil": 1, "Luxembourg": 2, "Germany": 12}
+
+	opts := NewLabelOptions(LabelNames, true, 150)
+	labels := PlaceLabels(ne, width, height, fm, theme, opts, hits, map[string]bool{"Australia": true}, map[string]bool{"Germany": true}, nil)
+
+	byCountry := make(map[string]Label)
+	for i, l := range labels {
+		byCountry[l.Country] = l
+		if !l.Rect.In(image.Rect(0, 0, width, height)) {
+			t.Errorf("label %q is outside the map: %v", l.Text, l.Rect)
+		}
+		for _, other := range labels[:i] {
+			if l.Rect.Overlaps(other.Rect) {
+				t.Errorf("labels %q and %q overlap", l.Text, other.Text)
+			}
+		}
+	}
+	for _, name := range []string{"Russia", "Brazil", "Australia"} {
+		if _, ok := byCountry[name]; !ok {
+			t.Errorf("expected a label for %s, got %v", name, labels)
+		}
+	}
+	if _, ok := byCountry["Luxembourg"]; ok {
+		t.Error("expected Luxembourg to be below the minimum area")
+	}
+	if _, ok := byCountry["France"]; ok {
+		t.Error("expected unvisited France to be skipped when labelling visited countries only")
+	}
+	if labels[0].Country != "Australia" {
+		t.Errorf("expected the target to be placed first, got %s", labels[0].Country)
+	}
+
+	// ISO mode uses alpha-3 codes
+	iso := PlaceLabels(ne, width, height, fm, theme, NewLabelOptions(LabelISO, true, 150), hits, nil, nil, nil)
+	for _, l := range iso {
+		if l.Country == "Russia" && l.Text != "RUS" {
+			t.Errorf("expected RUS, got %q", l.Text)
+		}
+	}
+
+	// Obstacles keep labels out of the way
+	all := image.Rect(0, 0, width, height)
+	if got := PlaceLabels(ne, width, height, fm, theme, opts, hits, nil, nil, []image.Rectangle{all}); len(got) != 0 {
+		t.Errorf("expected no labels under a full-map obstacle, got %d", len(got))
+	}
+}
+
+func TestLabelAndLegendOptions(t *testing.T) {
+	if NewLabelOptions("off", true, 0) != nil {
+		t.Error("expected nil label options when labels are off")
+	}
+	if opts := NewLabelOptions(LabelISO, false, 42); opts == nil || opts.Mode != LabelISO || opts.VisitedOnly || opts.MinArea != 42 {
+		t.Errorf("unexpected label options %+v", opts)
+	}
+	if NewLegendOptions("off") != nil || NewLegendOptions("middle") != nil {
+		t.Error("expected nil legend options for unknown positions")
+	}
+
+	_, fm, _ := loadRenderFixtures(t)
+	theme := DefaultTheme(false)
+	width, height := 1600, 800
+	for _, position := range LegendPositions {
+		r := LegendRect(width, height, fm, theme, NewLegendOptions(position))
+		if r.Empty() || !r.In(image.Rect(0, 0, width, height)) {
+			t.Errorf("%s: legend rect %v is not inside the map", position, r)
+			continue
+		}
+		left := r.Min.X < width/2
+		top := r.Min.Y < height/2
+		if wantLeft, wantTop := position[len(position)-4:] == "left", position[:3] == "top"; left != wantLeft || top != wantTop {
+			t.Errorf("%s: legend placed at %v", position, r)
+		}
+	}
+	if !LegendRect(width, height, fm, theme, nil).Empty() {
+		t.Error("expected an empty rect without a legend")
+	}
+}
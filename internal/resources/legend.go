@@ -0,0 +1,240 @@
+package resources
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+// LegendPositions are the corners the legend can be placed in.
+var LegendPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right"}
+
+// LegendOptions enables the legend box explaining the country styles.
+type LegendOptions struct {
+	Position string      // one of LegendPositions
+	FontSize float64     // 0 picks a size from the map height
+	Flag     image.Image // example flag for the visited and liberated swatches; optional
+}
+
+// NewLegendOptions returns legend options for a "legend" setting, or nil when
+// the legend is off.
+func NewLegendOptions(position string) *LegendOptions {
+	for _, p := range LegendPositions {
+		if p == position {
+			return &LegendOptions{Position: position}
+		}
+	}
+	return nil
+}
+
+// legendSwatch identifies how a legend entry's sample is painted.
+type legendSwatch int
+
+const (
+	swatchVisited legendSwatch = iota
+	swatchPrison
+	swatchLiberated
+	swatchTarget
+)
+
+// legendEntry is one row of the legend.
+type legendEntry struct {
+	swatch legendSwatch
+	text   string
+}
+
+// legendEntries returns the rows of the legend for a theme.
+func legendEntries(theme *Theme) []legendEntry {
+	visited := "Visited: national flag"
+	if !theme.Flags {
+		visited = "Visited: 1-9 hits"
+	}
+	return []legendEntry{
+		{swatchVisited, visited},
+		{swatchPrison, "Matrix Prison: 10+ hits"},
+		{swatchLiberated, "Liberated: imprisoned as target"},
+		{swatchTarget, "Target: visit next"},
+	}
+}
+
+// legendLayout is the computed geometry of the legend box.
+type legendLayout struct {
+	rect       image.Rectangle
+	fontSize   float64
+	padding    int
+	lineHeight int
+	swatch     image.Point // swatch size
+}
+
+// layoutLegend sizes and positions the legend box on a width×height map.
+func layoutLegend(width, height int, ttf *truetype.Font, theme *Theme, opts *LegendOptions) legendLayout {
+	size := opts.FontSize
+	if size <= 0 {
+		size = math.Max(11, math.Round(float64(height)*0.02))
+	}
+	l := legendLayout{
+		fontSize:   size,
+		padding:    int(math.Ceil(size * 0.6)),
+		lineHeight: int(size * 1.5),
+		swatch:     image.Pt(int(size*1.6), int(size*1.0)),
+	}
+
+	face := truetype.NewFace(ttf, &truetype.Options{Size: size, DPI: 72})
+	defer func() { _ = face.Close() }()
+	textWidth := 0
+	entries := legendEntries(theme)
+	for _, e := range entries {
+		textWidth = max(textWidth, font.MeasureString(face, e.text).Ceil())
+	}
+	w := l.padding*3 + l.swatch.X + textWidth
+	h := l.padding*2 + len(entries)*l.lineHeight
+
+	margin := int(float64(width) * 0.02)
+	x, y := margin, margin
+	switch opts.Position {
+	case "top-right":
+		x = width - margin - w
+	case "bottom-left":
+		y = height - margin - h
+	case "bottom-right":
+		x, y = width-margin-w, height-margin-h
+	}
+	l.rect = image.Rect(x, y, x+w, y+h)
+	return l
+}
+
+// LegendRect returns where DrawLegend will draw, so labels can avoid it. It
+// is empty when the legend cannot be drawn.
+func LegendRect(width, height int, fm *FontManager, theme *Theme, opts *LegendOptions) image.Rectangle {
+	if opts == nil {
+		return image.Rectangle{}
+	}
+	ttf := theme.legendFont(fm)
+	if ttf == nil {
+		return image.Rectangle{}
+	}
+	return layoutLegend(width, height, ttf, theme, opts).rect
+}
+
+// DrawLegend draws a box explaining the flag, Matrix Prison, liberated and
+// target styles, styled like the status box.
+func DrawLegend(img *image.RGBA, fm *FontManager, theme *Theme, opts *LegendOptions) {
+	if opts == nil {
+		return
+	}
+	ttf := theme.legendFont(fm)
+	if ttf == nil {
+		return
+	}
+	bounds := img.Bounds()
+	l := layoutLegend(bounds.Dx(), bounds.Dy(), ttf, theme, opts)
+
+	draw.Draw(img, l.rect, image.NewUniform(nrgba(theme.Status.Background)), image.Point{}, draw.Over)
+	strokeRect(img, l.rect, nrgba(theme.Status.Border), theme.Status.BorderWidth)
+
+	entries := legendEntries(theme)
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = e.text
+		baseline := l.rect.Min.Y + l.padding + int(l.fontSize) + i*l.lineHeight
+		top := baseline - int(l.fontSize*0.85)
+		swatch := image.Rect(l.rect.Min.X+l.padding, top, l.rect.Min.X+l.padding+l.swatch.X, top+l.swatch.Y)
+		drawLegendSwatch(img, swatch, e.swatch, theme, opts.Flag)
+	}
+
+	cfg := theme.GameInfoConfig(fm, l.fontSize, l.padding)
+	cfg.Font = ttf
+	textX := l.rect.Min.X + l.padding + l.swatch.X
+	_ = drawTextWithFreetype(img, ttf, textX, l.rect.Min.Y, l.rect.Dy(), lines, cfg)
+}
+
+// legendFont returns the status box font, which the legend shares.
+func (t *Theme) legendFont(fm *FontManager) *truetype.Font {
+	if font := t.StatusFont(fm); font != nil {
+		return font
+	}
+	return fm.GetUIFont()
+}
+
+// drawLegendSwatch paints a sample of a country style into r.
+func drawLegendSwatch(img *image.RGBA, r image.Rectangle, kind legendSwatch, theme *Theme, flag image.Image) {
+	visited := func() {
+		if flag != nil && theme.Flags {
+			drawScaled(img, r, flag)
+		} else {
+			draw.Draw(img, r, image.NewUniform(color.RGBA(theme.Visited.High)), image.Point{}, draw.Src)
+		}
+	}
+
+	switch kind {
+	case swatchVisited:
+		visited()
+	case swatchPrison:
+		draw.Draw(img, r, image.NewUniform(color.RGBA(theme.Prison.Background)), image.Point{}, draw.Src)
+		drawRainSample(img, r, theme.Prison.Rain, 255)
+	case swatchLiberated:
+		if flag != nil && theme.Flags {
+			drawScaled(img, r, flag)
+		} else {
+			draw.Draw(img, r, image.NewUniform(color.RGBA(theme.Prison.Background)), image.Point{}, draw.Src)
+		}
+		drawRainSample(img, r, theme.Prison.Rain, 160)
+	case swatchTarget:
+		draw.Draw(img, r, image.NewUniform(color.RGBA(theme.Land)), image.Point{}, draw.Src)
+		strokeRect(img, r, nrgba(theme.Target.Color), theme.Target.Width)
+		return
+	}
+	strokeRect(img, r, nrgba(theme.Status.Border), 1)
+}
+
+// drawRainSample draws a few short rain streaks into r.
+func drawRainSample(img *image.RGBA, r image.Rectangle, palette RainPalette, alpha uint8) {
+	dot := max(1, r.Dy()/6)
+	for col, head := range []int{r.Dy() * 3 / 4, r.Dy() / 2, r.Dy() * 5 / 6} {
+		x := r.Min.X + (2*col+1)*r.Dx()/6 - dot/2
+		for i := 0; i*dot*3/2 <= head; i++ {
+			c := color.RGBA(palette.Head)
+			if i > 0 {
+				c = interpolateColor(color.RGBA(palette.TailDim), color.RGBA(palette.TailBright), 1-float64(i*dot*3/2)/float64(head+1))
+			}
+			c.A = alpha
+			y := r.Min.Y + head - i*dot*3/2
+			cell := image.Rect(x, y, x+dot, y+dot).Intersect(r)
+			draw.Draw(img, cell, image.NewUniform(color.NRGBA{c.R, c.G, c.B, c.A}), image.Point{}, draw.Over)
+		}
+	}
+}
+
+// drawScaled draws src into r with nearest-neighbour scaling.
+func drawScaled(img *image.RGBA, r image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sy := sb.Min.Y + (y-r.Min.Y)*sb.Dy()/r.Dy()
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sx := sb.Min.X + (x-r.Min.X)*sb.Dx()/r.Dx()
+			if (image.Point{x, y}).In(img.Rect) {
+				img.Set(x, y, src.At(sx, sy))
+			}
+		}
+	}
+}
+
+// strokeRect draws a border of the given width inside r.
+func strokeRect(img *image.RGBA, r image.Rectangle, c color.NRGBA, width int) {
+	if width <= 0 || c.A == 0 {
+		return
+	}
+	src := image.NewUniform(c)
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+width),
+		image.Rect(r.Min.X, r.Max.Y-width, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y+width, r.Min.X+width, r.Max.Y-width),
+		image.Rect(r.Max.X-width, r.Min.Y+width, r.Max.X, r.Max.Y-width),
+	} {
+		draw.Draw(img, edge, src, image.Point{}, draw.Over)
+	}
+}
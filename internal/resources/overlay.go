@@ -0,0 +1,108 @@
+package resources
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"  // register GIF decoder for wallpaper backups
+	_ "image/jpeg" // register JPEG decoder for wallpaper backups
+	_ "image/png"  // register PNG decoder for wallpaper backups
+	"os"
+
+	_ "golang.org/x/image/bmp"  // register BMP decoder (common on Windows)
+	_ "golang.org/x/image/webp" // register WebP decoder (common on Linux desktops)
+)
+
+// OverlayConfig describes how the travel map is composited onto a wallpaper.
+type OverlayConfig struct {
+	Style    string // "full", "inset" or "visited"
+	Opacity  int    // Map opacity in percent (0-100)
+	Scale    int    // Inset width as a percentage of the wallpaper width
+	Position string // "top-left", "top-right", "bottom-left", "bottom-right" or "center"
+}
+
+// LoadImageFile decodes an image file in any of the formats commonly used for
+// desktop wallpapers (PNG, JPEG, GIF, BMP, WebP).
+func LoadImageFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// OverlayRect returns where the map layer is placed on a wallpaper of the given
+// size. Full and visited styles fit the 2:1 map into the wallpaper and centre it;
+// the inset style scales it to cfg.Scale percent of the wallpaper width and
+// anchors it at cfg.Position with a small margin.
+func OverlayRect(wallpaperWidth, wallpaperHeight int, cfg OverlayConfig) image.Rectangle {
+	if cfg.Style != "inset" {
+		width, height := wallpaperWidth, wallpaperWidth/2
+		if height > wallpaperHeight {
+			height = wallpaperHeight
+			width = height * 2
+		}
+		x := (wallpaperWidth - width) / 2
+		y := (wallpaperHeight - height) / 2
+		return image.Rect(x, y, x+width, y+height)
+	}
+
+	scale := cfg.Scale
+	if scale <= 0 || scale > 100 {
+		scale = 35
+	}
+	width := wallpaperWidth * scale / 100
+	height := width / 2
+	if height > wallpaperHeight {
+		height = wallpaperHeight
+		width = height * 2
+	}
+	margin := wallpaperWidth / 50 // 2% of the wallpaper width
+
+	var x, y int
+	switch cfg.Position {
+	case "top-left":
+		x, y = margin, margin
+	case "top-right":
+		x, y = wallpaperWidth-width-margin, margin
+	case "bottom-left":
+		x, y = margin, wallpaperHeight-height-margin
+	case "center":
+		x, y = (wallpaperWidth-width)/2, (wallpaperHeight-height)/2
+	default: // bottom-right
+		x, y = wallpaperWidth-width-margin, wallpaperHeight-height-margin
+	}
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+	return image.Rect(x, y, x+width, y+height)
+}
+
+// CompositeOverlay blends layer onto a copy of wallpaper at rect with the
+// configured opacity. The layer is expected to already be rendered at the size
+// of rect (see OverlayRect); the result has the wallpaper's dimensions.
+func CompositeOverlay(wallpaper image.Image, layer image.Image, rect image.Rectangle, opacity int) *image.RGBA {
+	bounds := wallpaper.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), wallpaper, bounds.Min, draw.Src)
+
+	if opacity < 0 {
+		opacity = 0
+	}
+	if opacity > 100 {
+		opacity = 100
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity * 255 / 100)})
+	draw.DrawMask(out, rect, layer, layer.Bounds().Min, mask, image.Point{}, draw.Over)
+	return out
+}
@@ -0,0 +1,77 @@
+package resources
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOverlayRect(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		height   int
+		cfg      OverlayConfig
+		expected image.Rectangle
+	}{
+		{
+			name:     "Full on 16:9 fits height",
+			width:    1920,
+			height:   1080,
+			cfg:      OverlayConfig{Style: "full"},
+			expected: image.Rect(0, 60, 1920, 1020),
+		},
+		{
+			name:     "Full on ultrawide fits width",
+			width:    3440,
+			height:   1440,
+			cfg:      OverlayConfig{Style: "visited"},
+			expected: image.Rect(280, 0, 3160, 1440),
+		},
+		{
+			name:     "Inset bottom-right",
+			width:    2000,
+			height:   1000,
+			cfg:      OverlayConfig{Style: "inset", Scale: 30, Position: "bottom-right"},
+			expected: image.Rect(1360, 660, 1960, 960),
+		},
+		{
+			name:     "Inset top-left",
+			width:    2000,
+			height:   1000,
+			cfg:      OverlayConfig{Style: "inset", Scale: 30, Position: "top-left"},
+			expected: image.Rect(40, 40, 640, 340),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OverlayRect(tt.width, tt.height, tt.cfg); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompositeOverlay(t *testing.T) {
+	wallpaper := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := range wallpaper.Pix {
+		wallpaper.Pix[i] = 255 // opaque white
+	}
+
+	layer := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	layer.SetRGBA(0, 0, color.RGBA{0, 0, 0, 255}) // opaque black
+	// (1, 0) stays transparent, like the ocean of an overlay layer
+
+	out := CompositeOverlay(wallpaper, layer, image.Rect(2, 1, 4, 2), 50)
+
+	if got := out.RGBAAt(0, 0); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("pixel outside overlay changed: %v", got)
+	}
+	if got := out.RGBAAt(2, 1); got.R < 120 || got.R > 135 || got.A != 255 {
+		t.Errorf("expected half-blended grey at overlay pixel, got %v", got)
+	}
+	if got := out.RGBAAt(3, 1); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("transparent overlay pixel should keep wallpaper, got %v", got)
+	}
+}
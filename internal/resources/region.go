@@ -0,0 +1,212 @@
+package resources
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+)
+
+// maxCrops bounds how many cropped copies of the map data are kept.
+const maxCrops = 8
+
+// Region is a longitude/latitude window of the world map.
+type Region struct {
+	Name  string
+	Bound orb.Bound // Min is (west, south), Max is (east, north)
+}
+
+// Regions are the named windows accepted by LookupRegion besides country names.
+var Regions = []Region{
+	{"Europe", orb.Bound{Min: orb.Point{-25, 34}, Max: orb.Point{45, 72}}},
+	{"Africa", orb.Bound{Min: orb.Point{-20, -36}, Max: orb.Point{55, 38}}},
+	{"Asia", orb.Bound{Min: orb.Point{25, -12}, Max: orb.Point{150, 56}}},
+	{"Middle East", orb.Bound{Min: orb.Point{25, 12}, Max: orb.Point{63, 42}}},
+	{"Southeast Asia", orb.Bound{Min: orb.Point{92, -11}, Max: orb.Point{141, 29}}},
+	{"North America", orb.Bound{Min: orb.Point{-170, 7}, Max: orb.Point{-50, 75}}},
+	{"Central America", orb.Bound{Min: orb.Point{-118, 5}, Max: orb.Point{-59, 33}}},
+	{"South America", orb.Bound{Min: orb.Point{-82, -56}, Max: orb.Point{-34, 13}}},
+	{"Oceania", orb.Bound{Min: orb.Point{110, -48}, Max: orb.Point{180, 0}}},
+}
+
+// LookupRegion finds a named region or, failing that, a window around the
+// country with that name or ISO alpha-2 code. Names are case-insensitive.
+func (ne *NaturalEarthData) LookupRegion(name string) (Region, error) {
+	for _, r := range Regions {
+		if strings.EqualFold(r.Name, name) {
+			return r.fit(), nil
+		}
+	}
+
+	countryName := name
+	if len(name) == 2 {
+		if n, err := GetNameByAlpha2(name); err == nil {
+			countryName = n
+		}
+	}
+	for _, country := range ne.Countries {
+		if !strings.EqualFold(country.Name, countryName) {
+			continue
+		}
+		// Pad the country so its neighbours give it context
+		b := country.Geometry.Bound()
+		pad := math.Max(2, 0.25*math.Max(b.Max[0]-b.Min[0], b.Max[1]-b.Min[1]))
+		return Region{Name: country.Name, Bound: b.Pad(pad)}.fit(), nil
+	}
+	if point, ok := smallCountryPoint(countryName); ok {
+		return Region{Name: countryName, Bound: orb.Bound{Min: point, Max: point}.Pad(3)}.fit(), nil
+	}
+	return Region{}, fmt.Errorf("unknown region %q", name)
+}
+
+// ParseBBox parses a "west,south,east,north" bounding box in degrees.
+func ParseBBox(s string) (Region, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return Region{}, fmt.Errorf("bbox must be west,south,east,north, got %q", s)
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return Region{}, fmt.Errorf("invalid bbox coordinate %q", p)
+		}
+		v[i] = f
+	}
+	b := orb.Bound{Min: orb.Point{v[0], v[1]}, Max: orb.Point{v[2], v[3]}}
+	if b.Min[0] < -180 || b.Max[0] > 180 || b.Min[1] < -90 || b.Max[1] > 90 {
+		return Region{}, fmt.Errorf("bbox %q is outside -180,-90,180,90", s)
+	}
+	if b.Max[0]-b.Min[0] < 0.1 || b.Max[1]-b.Min[1] < 0.1 {
+		return Region{}, fmt.Errorf("bbox %q must span at least 0.1 degrees west to east and south to north", s)
+	}
+	return Region{Name: "bbox", Bound: b}.fit(), nil
+}
+
+// fit widens the shorter side of the region so rendered maps stay between
+// 3:1 and 3:4, and clamps it to the world.
+func (r Region) fit() Region {
+	b := r.Bound
+	lngSpan, latSpan := b.Max[0]-b.Min[0], b.Max[1]-b.Min[1]
+	if lngSpan < 0.75*latSpan {
+		lngSpan = 0.75 * latSpan
+	}
+	if latSpan < lngSpan/3 {
+		latSpan = lngSpan / 3
+	}
+	center := b.Center()
+	b = orb.Bound{
+		Min: orb.Point{center[0] - lngSpan/2, center[1] - latSpan/2},
+		Max: orb.Point{center[0] + lngSpan/2, center[1] + latSpan/2},
+	}
+	b = shiftInto(b, 0, -180, 180)
+	b = shiftInto(b, 1, -90, 90)
+	r.Bound = b
+	return r
+}
+
+// shiftInto moves b along one axis so it lies within lo..hi, shrinking it
+// when it is wider than the range.
+func shiftInto(b orb.Bound, axis int, lo, hi float64) orb.Bound {
+	if b.Max[axis]-b.Min[axis] >= hi-lo {
+		b.Min[axis], b.Max[axis] = lo, hi
+		return b
+	}
+	if d := lo - b.Min[axis]; d > 0 {
+		b.Min[axis] += d
+		b.Max[axis] += d
+	}
+	if d := b.Max[axis] - hi; d > 0 {
+		b.Min[axis] -= d
+		b.Max[axis] -= d
+	}
+	return b
+}
+
+// Size returns the pixel size of a region rendered width pixels wide, keeping
+// the proportions of the world map.
+func (r Region) Size(width int) (int, int) {
+	lngSpan, latSpan := r.Bound.Max[0]-r.Bound.Min[0], r.Bound.Max[1]-r.Bound.Min[1]
+	return width, max(1, int(math.Round(float64(width)*latSpan/lngSpan)))
+}
+
+// Project maps a location inside the region to the whole-world coordinates of
+// the cropped map data, so points can be drawn on a region render with the
+// same helpers as on the world map.
+func (r Region) Project(lat, lng float64) (float64, float64) {
+	b := r.Bound
+	x := (lng-b.Min[0])/(b.Max[0]-b.Min[0])*360 - 180
+	y := 90 - (b.Max[1]-lat)/(b.Max[1]-b.Min[1])*180
+	return y, x
+}
+
+// key identifies the region in render caches.
+func (r Region) key() string {
+	b := r.Bound
+	return fmt.Sprintf("%.4f,%.4f,%.4f,%.4f", b.Min[0], b.Min[1], b.Max[0], b.Max[1])
+}
+
+// Crop returns the map data clipped to a region and stretched over the whole
+// world, so rendering it at Region.Size fills the image with the region.
+// Crops are cached, and country masks and layers rendered from them are cached
+// separately from the world map's.
+func (ne *NaturalEarthData) Crop(r Region) *NaturalEarthData {
+	key := r.key()
+	ne.cropMu.Lock()
+	if c, ok := ne.crops[key]; ok {
+		ne.cropMu.Unlock()
+		return c
+	}
+	ne.cropMu.Unlock()
+
+	// Clip slightly outside the window so the clip edges fall off the image
+	b := r.Bound
+	window := b.Pad(0.02 * math.Max(b.Max[0]-b.Min[0], b.Max[1]-b.Min[1]))
+	crop := &NaturalEarthData{region: &r}
+	for _, country := range ne.Countries {
+		if !country.Geometry.Bound().Intersects(window) {
+			continue
+		}
+		geom := clip.MultiPolygon(window, country.Geometry.Clone())
+		if len(geom) == 0 {
+			continue
+		}
+		for _, polygon := range geom {
+			for _, ring := range polygon {
+				for i, pt := range ring {
+					lat, lng := r.Project(pt[1], pt[0])
+					ring[i] = orb.Point{lng, lat}
+				}
+			}
+		}
+		crop.Countries = append(crop.Countries, CountryData{Name: country.Name, Geometry: geom, view: key})
+	}
+
+	ne.cropMu.Lock()
+	defer ne.cropMu.Unlock()
+	if len(ne.crops) >= maxCrops || ne.crops == nil {
+		ne.crops = make(map[string]*NaturalEarthData)
+	}
+	ne.crops[key] = crop
+	return crop
+}
+
+// projection names the projection of the map data for the layer cache.
+func (ne *NaturalEarthData) projection() string {
+	if ne.region == nil {
+		return ProjectionEquirectangular
+	}
+	return ProjectionEquirectangular + ":" + ne.region.key()
+}
+
+// project maps a location to the coordinates of the map data, which differ
+// from the input only for cropped data.
+func (ne *NaturalEarthData) project(lat, lng float64) (float64, float64) {
+	if ne.region == nil {
+		return lat, lng
+	}
+	return ne.region.Project(lat, lng)
+}
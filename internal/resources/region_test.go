@@ -0,0 +1,110 @@
+package resources
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+func TestParseBBox(t *testing.T) {
+	r, err := ParseBBox("5, 45, 15, 55")
+	if err != nil {
+		t.Fatalf("ParseBBox failed: %v", err)
+	}
+	expected := orb.Bound{Min: orb.Point{5, 45}, Max: orb.Point{15, 55}}
+	if r.Bound != expected {
+		t.Errorf("expected %v, got %v", expected, r.Bound)
+	}
+
+	for _, bad := range []string{"", "1,2,3", "a,b,c,d", "-190,0,10,10", "0,0,0.01,10", "10,10,0,0"} {
+		if _, err := ParseBBox(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRegionFit(t *testing.T) {
+	tests := []struct {
+		name  string
+		bound orb.Bound
+	}{
+		{"tall", orb.Bound{Min: orb.Point{-75, -56}, Max: orb.Point{-66, -17}}},
+		{"wide", orb.Bound{Min: orb.Point{-170, 10}, Max: orb.Point{170, 20}}},
+		{"edge", orb.Bound{Min: orb.Point{170, 80}, Max: orb.Point{180, 90}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Region{Bound: tt.bound}.fit()
+			b := r.Bound
+			if b.Min[0] < -180 || b.Max[0] > 180 || b.Min[1] < -90 || b.Max[1] > 90 {
+				t.Errorf("region %v leaves the world", b)
+			}
+			if !b.Contains(tt.bound.Min) || !b.Contains(tt.bound.Max) {
+				t.Errorf("region %v no longer covers %v", b, tt.bound)
+			}
+			w, h := r.Size(900)
+			if ratio := float64(w) / float64(h); ratio < 0.74 || ratio > 3.01 {
+				t.Errorf("expected an aspect between 3:4 and 3:1, got %dx%d", w, h)
+			}
+		})
+	}
+}
+
+func TestLookupRegion(t *testing.T) {
+	ne, _, _ := loadRenderFixtures(t)
+
+	europe, err := ne.LookupRegion("EUROPE")
+	if err != nil || europe.Name != "Europe" {
+		t.Errorf("expected the Europe preset, got %v (%v)", europe, err)
+	}
+
+	// Countries by name or alpha-2 code, and microstates missing from the geometry
+	for _, name := range []string{"France", "fr", "Monaco"} {
+		r, err := ne.LookupRegion(name)
+		if err != nil {
+			t.Errorf("LookupRegion(%q) failed: %v", name, err)
+			continue
+		}
+		if !r.Bound.Contains(orb.Point{7.42, 43.73}) {
+			t.Errorf("expected the %s region %v to contain Monaco", name, r.Bound)
+		}
+	}
+
+	if _, err := ne.LookupRegion("Atlantis"); err == nil {
+		t.Error("expected error for an unknown region")
+	}
+}
+
+func TestCrop(t *testing.T) {
+	ne, _, _ := loadRenderFixtures(t)
+	r, err := ParseBBox("-10,35,30,60")
+	if err != nil {
+		t.Fatalf("ParseBBox failed: %v", err)
+	}
+	crop := ne.Crop(r)
+	if crop != ne.Crop(r) {
+		t.Error("expected the crop to be cached")
+	}
+
+	names := make(map[string]bool)
+	for _, country := range crop.Countries {
+		names[country.Name] = true
+	}
+	if !names["France"] || !names["Poland"] {
+		t.Errorf("expected France and Poland in the crop, got %v", names)
+	}
+	if names["Australia"] || names["Brazil"] {
+		t.Error("expected countries outside the region to be dropped")
+	}
+
+	// The region corners map to the corners of the world
+	lat, lng := r.Project(r.Bound.Max[1], r.Bound.Min[0])
+	if math.Abs(lat-90) > 1e-9 || math.Abs(lng+180) > 1e-9 {
+		t.Errorf("expected the north-west corner at 90,-180, got %v,%v", lat, lng)
+	}
+	lat, lng = r.Project(r.Bound.Min[1], r.Bound.Max[0])
+	if math.Abs(lat+90) > 1e-9 || math.Abs(lng-180) > 1e-9 {
+		t.Errorf("expected the south-east corner at -90,180, got %v,%v", lat, lng)
+	}
+}
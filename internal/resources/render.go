@@ -0,0 +1,462 @@
+package resources
+
+import (
+	"image"
+	"image/color"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ProjectionEquirectangular is the plate carrée projection used by geoToPixel.
+const ProjectionEquirectangular = "equirectangular"
+
+// maxLayerCaches bounds how many base layers are kept. A 4K layer cache holds
+// two full frames (~66 MB), so only the handful of sizes in active use are kept.
+const maxLayerCaches = 4
+
+// rainTileMargin is how far Matrix rain glyphs may extend past a country's
+// pixel bounds (column padding plus one glyph).
+const rainTileMargin = 32
+
+// layerKey identifies a cached base layer.
+type layerKey struct {
+	width, height int
+	theme         Theme
+	projection    string
+	ocean         bool
+	unvisited     bool
+}
+
+// staticKind is the part of a country's look that does not change between
+// frames and can therefore be kept in the cached static layer.
+type staticKind uint8
+
+const (
+	staticNone      staticKind = iota // not painted
+	staticUnvisited                   // theme land color
+	staticHitColor                    // yellow-to-orange fill by hit count (no flag available)
+	staticFlag                        // national flag
+	staticPrison                      // Matrix Prison background
+	staticSandRocks                   // Matrix Prison fallback without fonts
+)
+
+// staticStyle is compared between frames to find countries that changed.
+type staticStyle struct {
+	kind staticKind
+	hits int // only meaningful for staticHitColor and staticSandRocks
+}
+
+// countryPlan is how one country is drawn this frame: a static part kept in the
+// layer cache plus optional per-frame animation.
+type countryPlan struct {
+	index     int // position in NaturalEarthData.Countries (draw order)
+	static    staticStyle
+	flag      image.Image
+	gamma     bool  // flag flickers because the country was hit this cycle
+	rainAlpha uint8 // Matrix rain opacity; 0 for no rain
+}
+
+// layerCache holds the pre-rendered layers for one layerKey.
+type layerCache struct {
+	mu       sync.Mutex
+	base     []uint8                // ocean plus every country in its unvisited style
+	static   *image.RGBA            // base plus the static part of every visited country
+	styles   map[string]staticStyle // static style painted into static, by country
+	lastUsed time.Time
+}
+
+var (
+	layerCachesMu sync.Mutex
+	layerCaches   map[layerKey]*layerCache
+)
+
+// getLayerCache returns the cache entry for key, evicting the least recently
+// used entry when the cache is full.
+func getLayerCache(key layerKey) *layerCache {
+	layerCachesMu.Lock()
+	defer layerCachesMu.Unlock()
+
+	if layerCaches == nil {
+		layerCaches = make(map[layerKey]*layerCache)
+	}
+	if c, ok := layerCaches[key]; ok {
+		c.lastUsed = time.Now()
+		return c
+	}
+	if len(layerCaches) >= maxLayerCaches {
+		var oldestKey layerKey
+		var oldest time.Time
+		for k, c := range layerCaches {
+			if oldest.IsZero() || c.lastUsed.Before(oldest) {
+				oldestKey, oldest = k, c.lastUsed
+			}
+		}
+		delete(layerCaches, oldestKey)
+	}
+	c := &layerCache{lastUsed: time.Now()}
+	layerCaches[key] = c
+	return c
+}
+
+// resetLayerCaches drops all cached layers.
+func resetLayerCaches() {
+	layerCachesMu.Lock()
+	layerCaches = nil
+	layerCachesMu.Unlock()
+}
+
+// RenderNaturalEarthMapLayers is RenderNaturalEarthMap with explicit control
+// over the painted layers.
+//
+// Rendering is incremental. The ocean and unvisited countries form a base
+// layer cached per (size, theme, projection, layers); the static look of
+// visited countries (flags, fills, prison backgrounds) is kept on top of it and
+// only countries whose state changed since the previous frame are repainted.
+// Per-frame animation — Matrix rain and the flicker of recently hit flags — is
+// rendered into per-country tiles by parallel workers and composited in draw
+// order.
+func RenderNaturalEarthMapLayers(ne *NaturalEarthData, width, height int, theme *Theme, hitCountries map[string]int, targetCountries map[string]bool, flagManager *FlagManager, fontManager *FontManager, matrixPrisonCountries map[string]bool, recentHitCountries map[string]bool, liberatedCountries map[string]bool, layers MapLayers) (image.Image, error) {
+	// Debug: show Matrix Prison countries
+	if matrixPrisonCountries != nil {
+		slog.Debug("Matrix Prison countries", "countries", matrixPrisonCountries)
+	}
+
+	if theme == nil {
+		theme = DefaultTheme(false)
+	}
+	if !theme.Flags {
+		flagManager = nil
+	}
+
+	plans := planCountries(ne, hitCountries, flagManager, fontManager, matrixPrisonCountries, recentHitCountries, liberatedCountries, layers)
+
+	key := layerKey{width: width, height: height, theme: *theme, projection: ne.projection(), ocean: layers.Ocean, unvisited: layers.Unvisited}
+	cache := getLayerCache(key)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	cache.mu.Lock()
+	if cache.static == nil {
+		cache.build(ne, width, height, theme, layers)
+	}
+	cache.update(ne, plans, width, height, theme)
+	copy(img.Pix, cache.static.Pix)
+	cache.mu.Unlock()
+
+	drawAnimatedCountries(img, ne, plans, fontManager, theme.Prison.Rain, width, height, time.Now())
+
+	// Density layer sits above the fills so it reads on any country style
+	DrawHeatmap(img, layers.Heat, width, height)
+
+	// Outline the target countries on top of everything else
+	for _, country := range ne.Countries {
+		if targetCountries[country.Name] {
+			drawCountryBorder(img, country.Geometry, color.RGBA(theme.Target.Color), width, height, theme.Target.Width)
+		}
+	}
+
+	// Insets and labels avoid the legend, which is drawn last, and labels
+	// avoid the insets
+	var obstacles []image.Rectangle
+	if r := LegendRect(width, height, fontManager, theme, layers.Legend); !r.Empty() {
+		obstacles = append(obstacles, r)
+	}
+	insets := PlaceInsets(ne, width, height, theme, layers.Insets, hitCountries, targetCountries, matrixPrisonCountries, liberatedCountries, obstacles)
+	DrawInsets(img, insets, flagManager, theme)
+	for _, inset := range insets {
+		obstacles = append(obstacles, inset.Rect)
+	}
+	labels := PlaceLabels(ne, width, height, fontManager, theme, layers.Labels, hitCountries, targetCountries, matrixPrisonCountries, obstacles)
+	DrawLabels(img, labels, fontManager, theme, layers.Labels)
+	if layers.Legend != nil {
+		legend := *layers.Legend
+		if legend.Flag == nil {
+			legend.Flag = exampleFlag(ne, plans)
+		}
+		DrawLegend(img, fontManager, theme, &legend)
+	}
+
+	return img, nil
+}
+
+// planCountries decides how every country is drawn this frame.
+func planCountries(ne *NaturalEarthData, hitCountries map[string]int, flagManager *FlagManager, fontManager *FontManager, matrixPrisonCountries map[string]bool, recentHitCountries map[string]bool, liberatedCountries map[string]bool, layers MapLayers) map[string]countryPlan {
+	plans := make(map[string]countryPlan, len(ne.Countries))
+	for i, country := range ne.Countries {
+		plan := countryPlan{index: i}
+
+		// Get hit count for this country
+		hitCount := hitCountries[country.Name]
+
+		// Check if this country is in Matrix Prison (>=10 hits)
+		isMatrixPrison := matrixPrisonCountries != nil && matrixPrisonCountries[country.Name]
+
+		var flag image.Image
+		if flagManager != nil && country.getAlpha2Code() != "" {
+			flag = flagManager.GetFlag(country.getAlpha2Code())
+		}
+
+		// After first hit, show flag. In Matrix Prison, show Matrix rain.
+		switch {
+		case hitCount >= 1 && hitCount < 10 && flagManager != nil && country.getAlpha2Code() != "":
+			if flag != nil {
+				// Recently hit countries flicker with random gamma correction
+				plan.static = staticStyle{kind: staticFlag}
+				plan.flag = flag
+				plan.gamma = recentHitCountries != nil && recentHitCountries[country.Name]
+			} else {
+				// Fallback to regular color if no flag found
+				plan.static = staticStyle{kind: staticHitColor, hits: hitCount}
+			}
+		case isMatrixPrison && hitCount >= 10:
+			if fontManager == nil {
+				// Fallback to sand/rocks gradient if font manager not available
+				plan.static = staticStyle{kind: staticSandRocks, hits: hitCount}
+				break
+			}
+			isLiberated := liberatedCountries != nil && liberatedCountries[country.Name]
+			if isLiberated && flag != nil {
+				// Liberated country: conquered while it was an active target.
+				// Show the national flag as background so the country glows with
+				// its true identity, then overlay semi-transparent Matrix rain
+				// (alpha ≈ 63%) to show the Matrix has been weakened but not fully
+				// erased.
+				plan.static = staticStyle{kind: staticFlag}
+				plan.flag = flag
+				plan.rainAlpha = 160
+			} else if isLiberated {
+				// No flag available — fall back to the prison background so the rain is still visible
+				plan.static = staticStyle{kind: staticPrison}
+				plan.rainAlpha = 160
+			} else {
+				// Matrix Prison country: prison background + fully opaque rain
+				plan.static = staticStyle{kind: staticPrison}
+				plan.rainAlpha = 255
+			}
+		case hitCount > 0:
+			plan.static = staticStyle{kind: staticHitColor, hits: hitCount}
+		case layers.Unvisited:
+			plan.static = staticStyle{kind: staticUnvisited}
+		}
+		plans[country.Name] = plan
+	}
+	return plans
+}
+
+// build renders the base layer (ocean and unvisited countries) and resets the
+// static layer to it.
+func (c *layerCache) build(ne *NaturalEarthData, width, height int, theme *Theme, layers MapLayers) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// Fill background with ocean gradient waves
+	if layers.Ocean {
+		fillOceanBackground(img, width, height, theme.Ocean)
+	}
+
+	c.styles = make(map[string]staticStyle, len(ne.Countries))
+	for _, country := range ne.Countries {
+		style := staticStyle{kind: staticNone}
+		if layers.Unvisited {
+			style.kind = staticUnvisited
+			drawCountryGeometry(img, country, color.RGBA(theme.Land), width, height)
+		}
+		c.styles[country.Name] = style
+	}
+
+	c.base = make([]uint8, len(img.Pix))
+	copy(c.base, img.Pix)
+	c.static = img
+}
+
+// update repaints the static layer for every country whose static style
+// differs from the one already painted. Each changed country's bounding box is
+// restored from the base layer and every country overlapping it is redrawn,
+// clipped to the box and in draw order, so the result is identical to a full
+// repaint.
+func (c *layerCache) update(ne *NaturalEarthData, plans map[string]countryPlan, width, height int, theme *Theme) {
+	var dirty []image.Rectangle
+	for _, country := range ne.Countries {
+		plan := plans[country.Name]
+		if c.styles[country.Name] == plan.static {
+			continue
+		}
+		c.styles[country.Name] = plan.static
+		if bounds := getCountryPixelBounds(country, width, height); !bounds.Empty() {
+			dirty = append(dirty, bounds)
+		}
+	}
+	if len(dirty) == 0 {
+		return
+	}
+	slog.Debug("Repainting changed countries", "count", len(dirty))
+
+	for _, rect := range dirty {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			start := c.static.PixOffset(rect.Min.X, y)
+			end := c.static.PixOffset(rect.Max.X, y)
+			copy(c.static.Pix[start:end], c.base[start:end])
+		}
+		for _, country := range ne.Countries {
+			mask := getCountryMask(country, width, height)
+			if !mask.bounds.Overlaps(rect) {
+				continue
+			}
+			spans := clipSpans(mask.spans, rect)
+			plan := plans[country.Name]
+			switch plan.static.kind {
+			case staticUnvisited:
+				fillSpans(c.static, spans, color.RGBA(theme.Land))
+			case staticHitColor:
+				fillSpans(c.static, spans, theme.hitColor(plan.static.hits))
+			case staticFlag:
+				flagSpans(c.static, spans, country.Geometry, plan.flag, width, height, false)
+			case staticPrison:
+				fillSpans(c.static, spans, color.RGBA(theme.Prison.Background))
+			case staticSandRocks:
+				sandRocksSpans(c.static, spans, theme.Prison.Sand, plan.static.hits, width, height)
+			}
+		}
+	}
+}
+
+// countryTile is the per-frame animation of one country.
+type countryTile struct {
+	index int         // draw order
+	img   *image.RGBA // tile in map coordinates
+	spans []spanRun   // for flag flicker: pixels copied as-is; nil for rain, which is blended
+}
+
+// drawAnimatedCountries renders Matrix rain and flag flicker for all animated
+// countries in parallel and composites the tiles onto img in draw order.
+func drawAnimatedCountries(img *image.RGBA, ne *NaturalEarthData, plans map[string]countryPlan, fontManager *FontManager, rain RainPalette, width, height int, now time.Time) {
+	var jobs []countryPlan
+	for _, plan := range plans {
+		if plan.gamma || plan.rainAlpha > 0 {
+			jobs = append(jobs, plan)
+		}
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	tiles := make([]countryTile, len(jobs))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				tiles[i] = renderCountryTile(ne, jobs[i], fontManager, rain, width, height, now)
+			}
+		}()
+	}
+	for i := range jobs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	// Composite in draw order so overlapping rain matches a serial render
+	sortTiles(tiles)
+	for _, tile := range tiles {
+		if tile.img == nil {
+			continue
+		}
+		if tile.spans != nil {
+			copySpans(img, tile.img, tile.spans)
+		} else {
+			blendTile(img, tile.img)
+		}
+	}
+}
+
+// renderCountryTile renders the animation of a single country into its own tile.
+func renderCountryTile(ne *NaturalEarthData, plan countryPlan, fontManager *FontManager, rain RainPalette, width, height int, now time.Time) countryTile {
+	country := ne.Countries[plan.index]
+	mask := getCountryMask(country, width, height)
+	tile := countryTile{index: plan.index}
+
+	if plan.gamma {
+		tile.img = image.NewRGBA(mask.bounds)
+		tile.spans = mask.spans
+		flagSpans(tile.img, mask.spans, country.Geometry, plan.flag, width, height, true)
+		return tile
+	}
+
+	rect := mask.bounds.Inset(-rainTileMargin).Intersect(image.Rect(0, 0, width, height))
+	if rect.Empty() {
+		return tile
+	}
+	tile.img = image.NewRGBA(rect)
+	countrySeed := int64(0)
+	for _, char := range country.Name {
+		countrySeed += int64(char)
+	}
+	seed := now.UnixNano()/50000000 + countrySeed
+	DrawMatrixRain(tile.img, country, fontManager, width, height, seed, plan.rainAlpha, rain)
+	return tile
+}
+
+// sortTiles orders tiles by draw order (insertion sort; there are few tiles).
+func sortTiles(tiles []countryTile) {
+	for i := 1; i < len(tiles); i++ {
+		for j := i; j > 0 && tiles[j].index < tiles[j-1].index; j-- {
+			tiles[j], tiles[j-1] = tiles[j-1], tiles[j]
+		}
+	}
+}
+
+// clipSpans returns the parts of spans inside rect.
+func clipSpans(spans []spanRun, rect image.Rectangle) []spanRun {
+	var clipped []spanRun
+	for _, s := range spans {
+		if s.y < rect.Min.Y || s.y >= rect.Max.Y || s.x2 < rect.Min.X || s.x1 >= rect.Max.X {
+			continue
+		}
+		clipped = append(clipped, spanRun{s.y, max(s.x1, rect.Min.X), min(s.x2, rect.Max.X-1)})
+	}
+	return clipped
+}
+
+// blendTile composites a mostly transparent tile over dst (premultiplied
+// "over"). Rain tiles are sparse, so skipping transparent pixels makes this
+// much cheaper than draw.Draw.
+func blendTile(dst, tile *image.RGBA) {
+	rect := tile.Rect.Intersect(dst.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		src := tile.Pix[tile.PixOffset(rect.Min.X, y):tile.PixOffset(rect.Max.X, y)]
+		out := dst.Pix[dst.PixOffset(rect.Min.X, y):]
+		for i := 0; i < len(src); i += 4 {
+			a := uint32(src[i+3])
+			if a == 0 {
+				continue
+			}
+			inv := 255 - a
+			out[i] = uint8(uint32(src[i]) + (uint32(out[i])*inv+127)/255)
+			out[i+1] = uint8(uint32(src[i+1]) + (uint32(out[i+1])*inv+127)/255)
+			out[i+2] = uint8(uint32(src[i+2]) + (uint32(out[i+2])*inv+127)/255)
+			out[i+3] = uint8(a + (uint32(out[i+3])*inv+127)/255)
+		}
+	}
+}
+
+// copySpans copies the pixels covered by spans from src to dst.
+func copySpans(dst, src *image.RGBA, spans []spanRun) {
+	for _, s := range spans {
+		n := (s.x2 - s.x1 + 1) * 4
+		copy(dst.Pix[dst.PixOffset(s.x1, s.y):][:n], src.Pix[src.PixOffset(s.x1, s.y):][:n])
+	}
+}
+
+// exampleFlag returns the flag of the first visited country in draw order, as
+// a sample for the legend.
+func exampleFlag(ne *NaturalEarthData, plans map[string]countryPlan) image.Image {
+	for _, country := range ne.Countries {
+		if plan := plans[country.Name]; plan.flag != nil {
+			return plan.flag
+		}
+	}
+	return nil
+}
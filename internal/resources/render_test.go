@@ -0,0 +1,154 @@
+package resources
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+// loadRenderFixtures loads the embedded map data, fonts and flags once per test.
+func loadRenderFixtures(tb testing.TB) (*NaturalEarthData, *FontManager, *FlagManager) {
+	tb.Helper()
+	ne, err := LoadNaturalEarthData()
+	if err != nil {
+		tb.Fatalf("LoadNaturalEarthData failed: %v", err)
+	}
+	fm, err := LoadFonts()
+	if err != nil {
+		tb.Fatalf("LoadFonts failed: %v", err)
+	}
+	flags, err := LoadFlags()
+	if err != nil {
+		tb.Fatalf("LoadFlags failed: %v", err)
+	}
+	return ne, fm, flags
+}
+
+func TestIncrementalRenderMatchesFullRender(t *testing.T) {
+	ne, fm, flags := loadRenderFixtures(t)
+	width, height := 800, 400
+
+	render := func(hits map[string]int) []byte {
+		img, err := RenderNaturalEarthMap(ne, width, height, DefaultTheme(false), hits, map[string]bool{"France": true}, flags, fm, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("RenderNaturalEarthMap failed: %v", err)
+		}
+		return img.(*image.RGBA).Pix
+	}
+
+	frames := []map[string]int{
+		{"Germany": 1, "France": 3},
+		{"Germany": 2, "France": 3, "Belgium": 1, "Russia": 5},
+		{"Germany": 2, "Belgium": 1, "Russia": 5, "Kazakhstan": 12},
+	}
+
+	resetLayerCaches()
+	for i, hits := range frames {
+		incremental := append([]byte(nil), render(hits)...)
+
+		// Render the same state from scratch, keeping the incremental cache
+		layerCachesMu.Lock()
+		saved := layerCaches
+		layerCaches = nil
+		layerCachesMu.Unlock()
+		full := render(hits)
+		layerCachesMu.Lock()
+		layerCaches = saved
+		layerCachesMu.Unlock()
+
+		if !bytes.Equal(incremental, full) {
+			t.Errorf("frame %d: incremental render differs from full render", i)
+		}
+	}
+}
+
+func TestClipSpans(t *testing.T) {
+	spans := []spanRun{{y: 0, x1: 0, x2: 9}, {y: 5, x1: 2, x2: 3}, {y: 6, x1: 8, x2: 20}}
+	got := clipSpans(spans, image.Rect(3, 0, 10, 6))
+	expected := []spanRun{{y: 0, x1: 3, x2: 9}, {y: 5, x1: 3, x2: 3}}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], got[i])
+		}
+	}
+}
+
+// benchmarkState is a mid-game state: a few dozen flags, several Matrix
+// Prison countries (one liberated) and one flickering recent hit.
+func benchmarkState() (hits map[string]int, prison, recent, liberated map[string]bool) {
+	hits = map[string]int{
+		"Germany": 4, "France": 2, "United Kingdom": 6, "Netherlands": 3, "Spain": 1,
+		"Italy": 2, "Poland": 1, "Sweden": 5, "Japan": 3, "Brazil": 2, "Canada": 7,
+		"Australia": 1, "India": 2, "South Africa": 1, "Mexico": 1,
+		"United States of America": 10, "Ireland": 10, "China": 10, "Russia": 10,
+	}
+	prison = map[string]bool{"United States of America": true, "Ireland": true, "China": true, "Russia": true}
+	liberated = map[string]bool{"Ireland": true}
+	recent = map[string]bool{"Germany": true}
+	return hits, prison, recent, liberated
+}
+
+func benchmarkRender(b *testing.B, width, height int) {
+	ne, fm, flags := loadRenderFixtures(b)
+	hits, prison, recent, liberated := benchmarkState()
+
+	// Warm the span, ocean and layer caches as the display loop would
+	if _, err := RenderNaturalEarthMap(ne, width, height, DefaultTheme(true), hits, map[string]bool{"Japan": true}, flags, fm, prison, recent, liberated); err != nil {
+		b.Fatalf("RenderNaturalEarthMap failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := RenderNaturalEarthMap(ne, width, height, DefaultTheme(true), hits, map[string]bool{"Japan": true}, flags, fm, prison, recent, liberated); err != nil {
+			b.Fatalf("RenderNaturalEarthMap failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkRenderNaturalEarthMap1080p(b *testing.B) { benchmarkRender(b, 1920, 1080) }
+
+func BenchmarkRenderNaturalEarthMap4K(b *testing.B) { benchmarkRender(b, 3840, 2160) }
+
+// BenchmarkRenderNaturalEarthMap4KStateChange measures a frame in which one
+// country changes state and has to be repainted.
+func BenchmarkRenderNaturalEarthMap4KStateChange(b *testing.B) {
+	ne, fm, flags := loadRenderFixtures(b)
+	hits, prison, recent, liberated := benchmarkState()
+	width, height := 3840, 2160
+
+	if _, err := RenderNaturalEarthMap(ne, width, height, DefaultTheme(true), hits, map[string]bool{"Japan": true}, flags, fm, prison, recent, liberated); err != nil {
+		b.Fatalf("RenderNaturalEarthMap failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hits["France"] = 1 + i%9
+		if _, err := RenderNaturalEarthMap(ne, width, height, DefaultTheme(true), hits, map[string]bool{"Japan": true}, flags, fm, prison, recent, liberated); err != nil {
+			b.Fatalf("RenderNaturalEarthMap failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkRenderNaturalEarthMap4KCold measures a full repaint with no cached
+// base layer, i.e. the cost of every frame before incremental rendering.
+func BenchmarkRenderNaturalEarthMap4KCold(b *testing.B) {
+	ne, fm, flags := loadRenderFixtures(b)
+	hits, prison, recent, liberated := benchmarkState()
+	width, height := 3840, 2160
+
+	// Rasterise country spans once; they were cached before as well
+	if _, err := RenderNaturalEarthMap(ne, width, height, DefaultTheme(true), hits, map[string]bool{"Japan": true}, flags, fm, prison, recent, liberated); err != nil {
+		b.Fatalf("RenderNaturalEarthMap failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resetLayerCaches()
+		if _, err := RenderNaturalEarthMap(ne, width, height, DefaultTheme(true), hits, map[string]bool{"Japan": true}, flags, fm, prison, recent, liberated); err != nil {
+			b.Fatalf("RenderNaturalEarthMap failed: %v", err)
+		}
+	}
+}
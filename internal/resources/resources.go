@@ -26,15 +26,15 @@ import (
 	"github.com/paulmach/orb/planar"
 )
 
-//go:embed *.json *.zip *.csv Matrix-Code.ttf
+//go:embed *.json *.zip *.csv Matrix-Code.ttf themes/*.json
 var files embed.FS
 
 // oceanCacheEntry holds a pre-rendered ocean background pixel buffer.
 type oceanCacheEntry struct {
-	pix    []uint8
-	width  int
-	height int
-	dark   bool
+	pix     []uint8
+	width   int
+	height  int
+	palette OceanPalette
 }
 
 var (
@@ -47,19 +47,34 @@ type spanRun struct{ y, x1, x2 int }
 
 // countryMaskEntry caches the rasterized pixel spans for one country at a specific resolution.
 type countryMaskEntry struct {
-	spans         []spanRun
-	width, height int
+	spans  []spanRun
+	bounds image.Rectangle // pixel bounding box of spans
+	anchorCache
 }
 
+// maxMaskResolutions bounds how many map sizes and region views keep rasterized country spans.
+// The live map, the overlay layer and on-demand HTTP renders typically use
+// different sizes; keeping a few avoids re-rasterising on every switch.
+const maxMaskResolutions = 4
+
 var (
 	countryMaskCacheMu sync.Mutex
-	countryMaskCache   map[string]*countryMaskEntry
+	countryMaskCache   map[maskView]map[string]*countryMaskEntry // keyed by map size and view, then country
+	countryMaskSizes   []maskView                                // views in countryMaskCache, oldest first
 )
 
+// maskView identifies one rasterization of the map: its size and the region
+// the geometry was cropped to.
+type maskView struct {
+	size image.Point
+	view string
+}
+
 // CountryData represents a country with its geometry and metadata
 type CountryData struct {
 	Name     string
 	Geometry orb.MultiPolygon
+	view     string // region the geometry was cropped to; empty for the whole world
 }
 
 // Country represents country information from the CSV
@@ -87,6 +102,10 @@ type CountryLookup struct {
 // NaturalEarthData holds all country data
 type NaturalEarthData struct {
 	Countries []CountryData
+	region    *Region // region the data was cropped to; nil for the whole world
+
+	cropMu sync.Mutex
+	crops  map[string]*NaturalEarthData // cropped copies by region key
 }
 
 func (c *CountryData) getAlpha2Code() string {
@@ -129,6 +148,7 @@ type GameInfoConfig struct {
 	FontSize        float64
 	Padding         int
 	BorderWidth     int
+	Font            *truetype.Font // optional; defaults to the UI font
 }
 
 // loadCountryData loads and parses the countries CSV data
@@ -505,8 +525,11 @@ func DrawGameInfoRectangle(img *image.RGBA, fm *FontManager, x, y, width, height
 		return fmt.Errorf("font manager is nil")
 	}
 
-	// Always try to use UI-suitable fonts for the status rectangle
-	ttfFont := fm.GetUIFont()
+	// Use the theme's font, else a UI-suitable font for the status rectangle
+	ttfFont := config.Font
+	if ttfFont == nil {
+		ttfFont = fm.GetUIFont()
+	}
 	if ttfFont == nil {
 		return fmt.Errorf("no suitable UI fonts available")
 	}
@@ -602,131 +625,67 @@ func (ne *NaturalEarthData) GetCountryBounds(countryName string) (minLat, maxLat
 	return 0, 0, 0, 0, false
 }
 
-// RenderNaturalEarthMap creates a map image with country boundaries from Natural Earth data
-func RenderNaturalEarthMap(ne *NaturalEarthData, width, height int, black bool, hitCountries map[string]int, targetCountry string, flagManager *FlagManager, fontManager *FontManager, matrixPrisonCountries map[string]bool, recentHitCountries map[string]bool, liberatedCountries map[string]bool) (image.Image, error) {
-	// Debug: show available flags
-	if flagManager != nil {
-		availableFlags := flagManager.ListFlags()
-		slog.Debug("Available flags", "flags", availableFlags)
-	}
-
-	// Debug: show Matrix Prison countries
-	if matrixPrisonCountries != nil {
-		slog.Debug("Matrix Prison countries", "countries", matrixPrisonCountries)
-	}
-
-	// Create the image
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-
-	// Fill background with ocean gradient waves
-	fillOceanBackground(img, width, height, black)
-
-	// Draw each country
-	for _, country := range ne.Countries {
-		// Get hit count for this country
-		hitCount := 0
-		if count, exists := hitCountries[country.Name]; exists {
-			hitCount = count
-		}
+// MapLayers selects which parts of the world map are painted. Layers left out
+// stay fully transparent so the map can be composited onto another image.
+type MapLayers struct {
+	Ocean     bool           // paint the ocean gradient background
+	Unvisited bool           // paint countries that have no hits yet
+	Heat      *Heatmap       // optional density layer between country fills and borders
+	Insets    *InsetOptions  // optional callout markers for stateful countries too small to see
+	Labels    *LabelOptions  // optional country labels above everything but the legend
+	Legend    *LegendOptions // optional legend box explaining the country styles
+}
 
-		// Check if this country is in Matrix Prison (>=10 hits)
-		isMatrixPrison := matrixPrisonCountries != nil && matrixPrisonCountries[country.Name]
+// RenderNaturalEarthMap creates a map image with country boundaries from Natural Earth data
+func RenderNaturalEarthMap(ne *NaturalEarthData, width, height int, theme *Theme, hitCountries map[string]int, targetCountries map[string]bool, flagManager *FlagManager, fontManager *FontManager, matrixPrisonCountries map[string]bool, recentHitCountries map[string]bool, liberatedCountries map[string]bool) (image.Image, error) {
+	return RenderNaturalEarthMapLayers(ne, width, height, theme, hitCountries, targetCountries, flagManager, fontManager, matrixPrisonCountries, recentHitCountries, liberatedCountries, MapLayers{Ocean: true, Unvisited: true})
+}
 
-		// After first hit, show flag. In Matrix Prison, show Matrix rain.
-		if hitCount >= 1 && hitCount < 10 && flagManager != nil && country.getAlpha2Code() != "" {
-			// Show flag for countries with 1-9 hits
-			alpha2 := country.getAlpha2Code()
-			flag := flagManager.GetFlag(alpha2)
-			if flag != nil {
-				// Check if this country was recently hit to apply gamma correction
-				applyGammaCorrection := recentHitCountries != nil && recentHitCountries[country.Name]
+// getCountrySpans returns the cached rasterized span list for a country, computing it on the
+// first call for a given (country, width, height). The spans exclude interior ring holes and
+// are safe for concurrent readers once stored in the cache.
+func getCountrySpans(country CountryData, width, height int) []spanRun {
+	return getCountryMask(country, width, height).spans
+}
 
-				// Draw country with flag background
-				drawCountryWithFlagBackground(img, country.Name, country.Geometry, flag, width, height, applyGammaCorrection)
-			} else {
-				// Fallback to regular color if no flag found
-				fillColor := getCountryHitColor(hitCount)
-				drawCountryGeometry(img, country.Name, country.Geometry, fillColor, width, height)
-			}
-		} else if isMatrixPrison && hitCount >= 10 {
-			// Show Matrix rain for Matrix Prison countries (10+ hits)
-			if fontManager != nil {
-				isLiberated := liberatedCountries != nil && liberatedCountries[country.Name]
-
-				if isLiberated && flagManager != nil && country.getAlpha2Code() != "" {
-					// Liberated country: conquered while it was an active target.
-					// Show the national flag as background so the country glows with
-					// its true identity, then overlay semi-transparent Matrix rain to
-					// show the Matrix has been weakened but not fully erased.
-					alpha2 := country.getAlpha2Code()
-					flag := flagManager.GetFlag(alpha2)
-					if flag != nil {
-						drawCountryWithFlagBackground(img, country.Name, country.Geometry, flag, width, height, false)
-					} else {
-						// No flag available — fall back to black so the rain is still visible
-						drawCountryGeometry(img, country.Name, country.Geometry, color.RGBA{0, 0, 0, 255}, width, height)
-					}
-					countrySeed := int64(0)
-					for _, char := range country.Name {
-						countrySeed += int64(char)
-					}
-					seed := time.Now().UnixNano()/50000000 + countrySeed
-					// Semi-transparent rain (alpha ≈ 160/255 ≈ 63%) so the flag shines through
-					DrawMatrixRain(img, country.Name, country.Geometry, fontManager, width, height, seed, 160)
-				} else {
-					// Matrix Prison country: black background + fully opaque rain
-					drawCountryGeometry(img, country.Name, country.Geometry, color.RGBA{0, 0, 0, 255}, width, height)
-
-					countrySeed := int64(0)
-					for _, char := range country.Name {
-						countrySeed += int64(char)
-					}
-					seed := time.Now().UnixNano()/50000000 + countrySeed
-					DrawMatrixRain(img, country.Name, country.Geometry, fontManager, width, height, seed, 255)
-				}
-			} else {
-				// Fallback to sand/rocks gradient if font manager not available
-				drawCountryWithSandRocksGradient(img, country.Name, country.Geometry, hitCount, width, height)
-			}
-		} else {
-			// Regular country drawing logic for unvisited countries or as fallback
-			var fillColor color.RGBA
-			if hitCount > 0 {
-				fillColor = getCountryHitColor(hitCount)
-			} else {
-				// Default country color for unvisited countries
-				if black {
-					fillColor = color.RGBA{60, 60, 60, 255} // Dark gray for dark theme
-				} else {
-					fillColor = color.RGBA{200, 200, 200, 255} // Light gray for light theme
-				}
-			}
-			drawCountryGeometry(img, country.Name, country.Geometry, fillColor, width, height)
-		}
+// getCountryPixelBounds returns the pixel bounding box of a country's rasterized shape.
+func getCountryPixelBounds(country CountryData, width, height int) image.Rectangle {
+	return getCountryMask(country, width, height).bounds
+}
 
-		// Draw red border if this is the target country
-		if targetCountry != "" && country.Name == targetCountry {
-			drawCountryBorder(img, country.Geometry, color.RGBA{255, 0, 0, 255}, width, height, 2) // Red border, 2px thick
-		}
+// getCountryMask returns the cached mask entry for a country at the given size.
+func getCountryMask(country CountryData, width, height int) *countryMaskEntry {
+	size := maskView{size: image.Point{X: width, Y: height}, view: country.view}
+	name, geom := country.Name, country.Geometry
+	countryMaskCacheMu.Lock()
+	if e, ok := countryMaskCache[size][name]; ok {
+		countryMaskCacheMu.Unlock()
+		return e
 	}
+	countryMaskCacheMu.Unlock()
 
-	return img, nil
-}
-
-// getCountrySpans returns the cached rasterized span list for a country, computing it on the
-// first call for a given (name, width, height). The spans exclude interior ring holes and
-// are safe for concurrent readers once stored in the cache.
-func getCountrySpans(name string, geom orb.MultiPolygon, width, height int) []spanRun {
+	// Compute mask via the existing scanline algorithm (runs once per country per resolution).
+	entry := rasterizeCountry(geom, width, height)
 	countryMaskCacheMu.Lock()
-	if countryMaskCache != nil {
-		if e, ok := countryMaskCache[name]; ok && e.width == width && e.height == height {
-			countryMaskCacheMu.Unlock()
-			return e.spans
+	if countryMaskCache == nil {
+		countryMaskCache = make(map[maskView]map[string]*countryMaskEntry)
+	}
+	if countryMaskCache[size] == nil {
+		countryMaskCache[size] = make(map[string]*countryMaskEntry)
+		countryMaskSizes = append(countryMaskSizes, size)
+		if len(countryMaskSizes) > maxMaskResolutions {
+			delete(countryMaskCache, countryMaskSizes[0])
+			countryMaskSizes = countryMaskSizes[1:]
 		}
 	}
+	countryMaskCache[size][name] = entry
 	countryMaskCacheMu.Unlock()
+	return entry
+}
 
-	// Compute mask via the existing scanline algorithm (runs once per country per resolution).
+// rasterizeCountry computes the pixel spans of a country's shape on a
+// width×height map.
+func rasterizeCountry(geom orb.MultiPolygon, width, height int) *countryMaskEntry {
 	mask := image.NewAlpha(image.Rect(0, 0, width, height))
 	for _, polygon := range geom {
 		if len(polygon) > 0 {
@@ -739,6 +698,7 @@ func getCountrySpans(name string, geom orb.MultiPolygon, width, height int) []sp
 
 	// Extract compact horizontal span runs directly from the alpha pixel buffer.
 	var spans []spanRun
+	var bounds image.Rectangle
 	pix := mask.Pix
 	for y := 0; y < height; y++ {
 		row := pix[y*mask.Stride : y*mask.Stride+width]
@@ -755,61 +715,44 @@ func getCountrySpans(name string, geom orb.MultiPolygon, width, height int) []sp
 				x++
 			}
 			spans = append(spans, spanRun{y, x1, x - 1})
+			bounds = bounds.Union(image.Rect(x1, y, x, y+1))
 		}
 	}
-
-	entry := &countryMaskEntry{spans: spans, width: width, height: height}
-	countryMaskCacheMu.Lock()
-	if countryMaskCache == nil {
-		countryMaskCache = make(map[string]*countryMaskEntry)
-	}
-	countryMaskCache[name] = entry
-	countryMaskCacheMu.Unlock()
-	return spans
+	return &countryMaskEntry{spans: spans, bounds: bounds}
 }
 
-// spansToAlpha reconstructs an *image.Alpha from cached spans without re-running the
-// scanline algorithm. Used by DrawMatrixRain which needs an alpha mask for character clipping.
-func spansToAlpha(spans []spanRun, width, height int) *image.Alpha {
-	mask := image.NewAlpha(image.Rect(0, 0, width, height))
-	for _, s := range spans {
-		row := mask.Pix[s.y*mask.Stride:]
-		for x := s.x1; x <= s.x2; x++ {
-			row[x] = 255
+// spansToAlpha reconstructs an *image.Alpha covering rect from cached spans without
+// re-running the scanline algorithm. Used by DrawMatrixRain which needs an alpha mask
+// for character clipping; limiting it to the country's bounds keeps it small.
+func spansToAlpha(spans []spanRun, rect image.Rectangle) *image.Alpha {
+	mask := image.NewAlpha(rect)
+	for _, s := range clipSpans(spans, rect) {
+		row := mask.Pix[mask.PixOffset(s.x1, s.y):]
+		for i := 0; i <= s.x2-s.x1; i++ {
+			row[i] = 255
 		}
 	}
 	return mask
 }
 
 // fillOceanBackground fills the background with ocean gradient waves.
-// The computed pixel buffer is cached and reused when the dimensions and theme
+// The computed pixel buffer is cached and reused when the dimensions and palette
 // are unchanged, avoiding O(width×height) math.Sin calls on every frame.
-func fillOceanBackground(img *image.RGBA, width, height int, dark bool) {
+func fillOceanBackground(img *image.RGBA, width, height int, palette OceanPalette) {
 	oceanCacheMu.Lock()
 	if oceanCached != nil &&
 		oceanCached.width == width &&
 		oceanCached.height == height &&
-		oceanCached.dark == dark {
+		oceanCached.palette == palette {
 		copy(img.Pix, oceanCached.pix)
 		oceanCacheMu.Unlock()
 		return
 	}
 	oceanCacheMu.Unlock()
 
-	// Define ocean colors based on theme
-	var deepOcean, shallowOcean, waveHighlight color.RGBA
-
-	if dark {
-		// Dark theme ocean colors
-		deepOcean = color.RGBA{15, 25, 45, 255}     // Deep dark blue
-		shallowOcean = color.RGBA{25, 40, 70, 255}  // Medium dark blue
-		waveHighlight = color.RGBA{35, 55, 95, 255} // Lighter dark blue
-	} else {
-		// Light theme ocean colors
-		deepOcean = color.RGBA{65, 105, 180, 255}      // Deep ocean blue
-		shallowOcean = color.RGBA{100, 140, 210, 255}  // Medium ocean blue
-		waveHighlight = color.RGBA{135, 175, 235, 255} // Light ocean blue
-	}
+	deepOcean := color.RGBA(palette.Deep)
+	shallowOcean := color.RGBA(palette.Shallow)
+	waveHighlight := color.RGBA(palette.Highlight)
 
 	// Create wave pattern using multiple sine waves
 	for y := 0; y < height; y++ {
@@ -858,7 +801,7 @@ func fillOceanBackground(img *image.RGBA, width, height int, dark bool) {
 	oceanCacheMu.Lock()
 	cached := make([]uint8, len(img.Pix))
 	copy(cached, img.Pix)
-	oceanCached = &oceanCacheEntry{pix: cached, width: width, height: height, dark: dark}
+	oceanCached = &oceanCacheEntry{pix: cached, width: width, height: height, palette: palette}
 	oceanCacheMu.Unlock()
 }
 
@@ -875,33 +818,13 @@ func interpolateColor(c1, c2 color.RGBA, t float64) color.RGBA {
 	}
 }
 
-// getCountryHitColor returns the color for a country based on hit count
-func getCountryHitColor(hitCount int) color.RGBA {
-	// This function is no longer used in the new logic, keeping for compatibility
-	if hitCount >= 10 {
-		// Bright red for occupied countries (conquered)
-		return color.RGBA{255, 50, 50, 200}
-	}
-
-	// Progressive color intensity based on hit count (1-9)
-	intensity := float64(hitCount) / 9.0 // Normalize to 0-1 for hits 1-9
-
-	// Color progression: Light Yellow -> Orange -> Dark Orange
-	red := uint8(255)
-	green := uint8(255 - intensity*150) // Fade from 255 to 105
-	blue := uint8(50 * (1 - intensity)) // Fade from 50 to 0
-	alpha := uint8(80 + intensity*100)  // Alpha from 80 to 180
-
-	return color.RGBA{red, green, blue, alpha}
-}
-
 // getSandRocksGradientColor returns a gradient color representing sand and rocks (fallback for Matrix Prison countries)
-func getSandRocksGradientColor(hitCount int, x, y, width, height int) color.RGBA {
-	// Define sand and rock colors
-	lightSand := color.RGBA{210, 180, 140, 200} // Light sandy beige
-	darkSand := color.RGBA{160, 130, 90, 200}   // Darker sand
-	lightRock := color.RGBA{120, 100, 80, 220}  // Light gray-brown rock
-	darkRock := color.RGBA{80, 65, 50, 240}     // Dark brownish rock
+func getSandRocksGradientColor(sand [4]Color, hitCount int, x, y, width, height int) color.RGBA {
+	// Sand and rock colors from the theme, lightest first
+	lightSand := color.RGBA(sand[0])
+	darkSand := color.RGBA(sand[1])
+	lightRock := color.RGBA(sand[2])
+	darkRock := color.RGBA(sand[3])
 
 	// Create spatial variation using position
 	normalizedX := float64(x) / float64(width)
@@ -943,12 +866,16 @@ func getSandRocksGradientColor(hitCount int, x, y, width, height int) color.RGBA
 
 // drawCountryGeometry draws a country's geometry on the image with solid fill.
 // It uses the cached span list for the country, avoiding repeated scanline rasterisation.
-func drawCountryGeometry(img *image.RGBA, name string, geom orb.MultiPolygon, fillColor color.RGBA, width, height int) {
-	spans := getCountrySpans(name, geom, width, height)
+func drawCountryGeometry(img *image.RGBA, country CountryData, fillColor color.RGBA, width, height int) {
+	fillSpans(img, getCountrySpans(country, width, height), fillColor)
+}
+
+// fillSpans overwrites the pixels covered by spans with fillColor.
+func fillSpans(img *image.RGBA, spans []spanRun, fillColor color.RGBA) {
 	for _, s := range spans {
-		row := img.Pix[s.y*img.Stride:]
-		for x := s.x1; x <= s.x2; x++ {
-			off := x * 4
+		row := img.Pix[img.PixOffset(s.x1, s.y):]
+		for i := 0; i <= s.x2-s.x1; i++ {
+			off := i * 4
 			row[off] = fillColor.R
 			row[off+1] = fillColor.G
 			row[off+2] = fillColor.B
@@ -959,25 +886,32 @@ func drawCountryGeometry(img *image.RGBA, name string, geom orb.MultiPolygon, fi
 
 // drawCountryWithSandRocksGradient draws a country's geometry with sand/rocks gradient pattern.
 // Uses the cached span list to avoid repeated scanline rasterisation.
-func drawCountryWithSandRocksGradient(img *image.RGBA, name string, geom orb.MultiPolygon, hitCount, width, height int) {
-	spans := getCountrySpans(name, geom, width, height)
+func drawCountryWithSandRocksGradient(img *image.RGBA, country CountryData, sand [4]Color, hitCount, width, height int) {
+	sandRocksSpans(img, getCountrySpans(country, width, height), sand, hitCount, width, height)
+}
+
+// sandRocksSpans paints the sand/rocks gradient over the pixels covered by spans.
+func sandRocksSpans(img *image.RGBA, spans []spanRun, sand [4]Color, hitCount, width, height int) {
 	for _, s := range spans {
 		for x := s.x1; x <= s.x2; x++ {
-			gradientColor := getSandRocksGradientColor(hitCount, x, s.y, width, height)
+			gradientColor := getSandRocksGradientColor(sand, hitCount, x, s.y, width, height)
 			img.SetRGBA(x, s.y, gradientColor)
 		}
 	}
 }
 
-// applyRandomGammaCorrection applies random gamma correction to a color to indicate recent activity
-func applyRandomGammaCorrection(c color.Color) color.Color {
+// gammaCorrect applies a pseudo-random gamma between 0.7 and 1.4 derived from
+// seed and the color itself.
+func gammaCorrect(c color.Color, seed int64) color.RGBA {
 	r, g, b, a := c.RGBA()
 
-	// Generate random gamma value between 0.7 and 1.4 for subtle but noticeable effect
-	// Use current time with pixel color for pseudo-randomness that changes per frame
-	seed := (time.Now().UnixNano() / 1000000) + int64(r+g+b) // Changes every millisecond
-	rng := rand.New(rand.NewSource(seed))
-	gamma := 0.7 + rng.Float64()*0.7 // Random gamma between 0.7 and 1.4 (more subtle range)
+	// splitmix64 of the seed: as random as math/rand for this purpose, without
+	// allocating and seeding a generator for every pixel
+	z := uint64(seed+int64(r+g+b)) + 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	gamma := 0.7 + float64(z>>11)/(1<<53)*0.7 // Random gamma between 0.7 and 1.4 (more subtle range)
 
 	// Apply gamma correction
 	// Convert from 16-bit to 8-bit, apply gamma, convert back
@@ -1001,9 +935,13 @@ func applyRandomGammaCorrection(c color.Color) color.Color {
 // drawCountryWithFlagBackground draws a country's geometry with a flag image as background.
 // If applyGammaCorrection is true, applies random gamma correction to indicate recent activity.
 // Uses the cached span list to avoid repeated scanline rasterisation.
-func drawCountryWithFlagBackground(img *image.RGBA, name string, geom orb.MultiPolygon, flag image.Image, width, height int, applyGammaCorrection bool) {
-	spans := getCountrySpans(name, geom, width, height)
+func drawCountryWithFlagBackground(img *image.RGBA, country CountryData, flag image.Image, width, height int, applyGammaCorrection bool) {
+	flagSpans(img, getCountrySpans(country, width, height), country.Geometry, flag, width, height, applyGammaCorrection)
+}
 
+// flagSpans tiles the flag, scaled to the country's height, over the pixels
+// covered by spans.
+func flagSpans(img *image.RGBA, spans []spanRun, geom orb.MultiPolygon, flag image.Image, width, height int, applyGammaCorrection bool) {
 	// Get flag dimensions
 	flagBounds := flag.Bounds()
 	originalFlagWidth := flagBounds.Dx()
@@ -1030,6 +968,10 @@ func drawCountryWithFlagBackground(img *image.RGBA, name string, geom orb.MultiP
 		return
 	}
 
+	// Flags have few distinct colors; correct each one once per draw
+	seed := time.Now().UnixNano() / 1000000
+	corrected := make(map[color.Color]color.RGBA)
+
 	minXi := int(minX)
 	minYi := int(minY)
 	for _, s := range spans {
@@ -1052,7 +994,12 @@ func drawCountryWithFlagBackground(img *image.RGBA, name string, geom orb.MultiP
 			}
 			flagColor := flag.At(flagX, flagY)
 			if applyGammaCorrection {
-				flagColor = applyRandomGammaCorrection(flagColor)
+				c, ok := corrected[flagColor]
+				if !ok {
+					c = gammaCorrect(flagColor, seed)
+					corrected[flagColor] = c
+				}
+				flagColor = c
 			}
 			img.Set(x, s.y, flagColor)
 		}
@@ -1231,7 +1178,7 @@ func drawLine(img *image.RGBA, x1, y1, x2, y2 int, col color.RGBA) {
 }
 
 // DrawMatrixRain draws a Matrix-style falling code effect within a country's geometry
-func DrawMatrixRain(img *image.RGBA, name string, geom orb.MultiPolygon, fm *FontManager, width, height int, seed int64, rainAlpha uint8) {
+func DrawMatrixRain(img *image.RGBA, country CountryData, fm *FontManager, width, height int, seed int64, rainAlpha uint8, palette RainPalette) {
 	if fm == nil {
 		return
 	}
@@ -1246,7 +1193,9 @@ func DrawMatrixRain(img *image.RGBA, name string, geom orb.MultiPolygon, fm *Fon
 	}
 
 	// Build the clipping mask from cached spans (avoids re-running the scanline algorithm).
-	mask := spansToAlpha(getCountrySpans(name, geom, width, height), width, height)
+	entry := getCountryMask(country, width, height)
+	geom := country.Geometry
+	mask := spansToAlpha(entry.spans, entry.bounds)
 
 	// Calculate country bounds to limit the area we process
 	bound := geom.Bound()
@@ -1334,13 +1283,13 @@ func DrawMatrixRain(img *image.RGBA, name string, geom orb.MultiPolygon, fm *Fon
 			brightness := 1.0 - (float64(i) / float64(streakLen))
 			var charColor color.RGBA
 			if i == 0 {
-				// Head is white or very light green
-				charColor = color.RGBA{200, 255, 200, rainAlpha}
+				// Head stands out from the tail
+				charColor = color.RGBA(palette.Head)
 			} else {
-				// Tail is varying shades of green
-				green := uint8(50 + brightness*205)
-				charColor = color.RGBA{0, green, 0, rainAlpha}
+				// Tail fades towards its end
+				charColor = interpolateColor(color.RGBA(palette.TailDim), color.RGBA(palette.TailBright), brightness)
 			}
+			charColor.A = rainAlpha
 
 			// Pick a random character
 			char := chars[rng.Intn(len(chars))]
@@ -0,0 +1,218 @@
+package resources
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+)
+
+// Admin-1 boundaries are embedded from admin1.zip, a simplified Natural Earth
+// "Admin 1 – States, Provinces" GeoJSON written by cmd/get-admin1. A build
+// without it reads the same GeoJSON from ~/.config/iptw/resources instead.
+const (
+	admin1JSON = "admin1.json"
+	admin1Zip  = "admin1.zip"
+)
+
+// SubdivisionMinZoom is the first tile zoom level showing subdivisions; below
+// it they are too small to tell apart.
+const SubdivisionMinZoom = 3
+
+// Subdivision is a first-level administrative division of a country: a state,
+// province, region...
+type Subdivision struct {
+	Code     string // ISO 3166-2 code, e.g. US-CA
+	Name     string
+	Alpha2   string // ISO 3166-1 alpha-2 code of the country
+	Geometry orb.MultiPolygon
+	bound    orb.Bound
+}
+
+// SubdivisionData holds the subdivisions of the countries covered by the
+// admin-1 data set, which may not be all of them.
+type SubdivisionData struct {
+	Subdivisions []Subdivision
+	byCode       map[string]int   // index by code
+	byCountry    map[string][]int // indices by country alpha-2 code, sorted by name
+}
+
+// DefaultAdmin1Path returns where the admin-1 data is looked for when it is
+// not embedded.
+func DefaultAdmin1Path() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw", "resources", admin1JSON), nil
+}
+
+// LoadSubdivisions loads the admin-1 data embedded in the binary or, when
+// there is none, from path (GeoJSON, or a zip archive holding it).
+func LoadSubdivisions(path string) (*SubdivisionData, error) {
+	if data, err := files.ReadFile(admin1Zip); err == nil {
+		return parseAdmin1Zip(data)
+	}
+	if data, err := files.ReadFile(admin1JSON); err == nil {
+		return ParseSubdivisions(data)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin-1 data: %w", err)
+	}
+	if bytes.HasPrefix(data, []byte("PK")) {
+		return parseAdmin1Zip(data)
+	}
+	return ParseSubdivisions(data)
+}
+
+// parseAdmin1Zip parses the first GeoJSON file of a zip archive.
+func parseAdmin1Zip(data []byte) (*SubdivisionData, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zip reader: %w", err)
+	}
+	for _, file := range zipReader.File {
+		name := strings.ToLower(file.Name)
+		if !strings.HasSuffix(name, ".json") && !strings.HasSuffix(name, ".geojson") {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", file.Name, err)
+		}
+		jsonData, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+		return ParseSubdivisions(jsonData)
+	}
+	return nil, fmt.Errorf("no GeoJSON file found in admin-1 zip")
+}
+
+// ParseSubdivisions parses Natural Earth admin-1 GeoJSON. Features are keyed
+// by their iso_3166_2 property; those without a usable code are skipped.
+func ParseSubdivisions(data []byte) (*SubdivisionData, error) {
+	fc, err := geojson.UnmarshalFeatureCollection(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse admin-1 GeoJSON: %w", err)
+	}
+
+	sd := &SubdivisionData{byCode: make(map[string]int), byCountry: make(map[string][]int)}
+	for _, feature := range fc.Features {
+		code := strings.ToUpper(feature.Properties.MustString("iso_3166_2", ""))
+		alpha2, _, ok := strings.Cut(code, "-")
+		if !ok || len(alpha2) != 2 || strings.HasSuffix(code, "-") {
+			continue
+		}
+		name := feature.Properties.MustString("name", code)
+
+		var geom orb.MultiPolygon
+		switch g := feature.Geometry.(type) {
+		case orb.Polygon:
+			geom = orb.MultiPolygon{g}
+		case orb.MultiPolygon:
+			geom = g
+		default:
+			continue
+		}
+
+		// Some data sets split a subdivision into several features
+		if i, ok := sd.byCode[code]; ok {
+			sd.Subdivisions[i].Geometry = append(sd.Subdivisions[i].Geometry, geom...)
+			sd.Subdivisions[i].bound = sd.Subdivisions[i].Geometry.Bound()
+			continue
+		}
+		sd.byCode[code] = len(sd.Subdivisions)
+		sd.Subdivisions = append(sd.Subdivisions, Subdivision{Code: code, Name: name, Alpha2: alpha2, Geometry: geom, bound: geom.Bound()})
+	}
+	if len(sd.Subdivisions) == 0 {
+		return nil, fmt.Errorf("no subdivisions with ISO 3166-2 codes in admin-1 data")
+	}
+
+	for i, sub := range sd.Subdivisions {
+		sd.byCountry[sub.Alpha2] = append(sd.byCountry[sub.Alpha2], i)
+	}
+	for _, indices := range sd.byCountry {
+		sort.Slice(indices, func(i, j int) bool { return sd.Subdivisions[indices[i]].Name < sd.Subdivisions[indices[j]].Name })
+	}
+	return sd, nil
+}
+
+// Get returns the subdivision with an ISO 3166-2 code.
+func (sd *SubdivisionData) Get(code string) (*Subdivision, bool) {
+	i, ok := sd.byCode[strings.ToUpper(code)]
+	if !ok {
+		return nil, false
+	}
+	return &sd.Subdivisions[i], true
+}
+
+// Country returns the subdivisions of a country by its ISO 3166-1 alpha-2
+// code, none when the data set does not cover it.
+func (sd *SubdivisionData) Country(alpha2 string) []*Subdivision {
+	indices := sd.byCountry[strings.ToUpper(alpha2)]
+	subs := make([]*Subdivision, len(indices))
+	for i, index := range indices {
+		subs[i] = &sd.Subdivisions[index]
+	}
+	return subs
+}
+
+// FindAtPoint returns the subdivision of a country containing a location, or
+// nil.
+func (sd *SubdivisionData) FindAtPoint(alpha2 string, lat, lng float64) *Subdivision {
+	point := orb.Point{lng, lat} // orb uses [lng, lat] order
+	for _, sub := range sd.Country(alpha2) {
+		if sub.bound.Contains(point) && planar.MultiPolygonContains(sub.Geometry, point) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// drawTileSubdivisions draws the subdivisions of a visited country on a tile:
+// a thin outline around each, and the land color dimming those not visited
+// yet so the visited ones stand out. Drawing is limited to the spans of the
+// country, since admin-1 and country boundaries do not quite match.
+func drawTileSubdivisions(img *image.RGBA, frame tileFrame, window orb.Bound, subs []*Subdivision, visited map[string]int, spans []spanRun, theme *Theme) {
+	layer := image.NewRGBA(img.Bounds())
+	land := color.RGBA(theme.Land)
+	dim := color.RGBA{land.R, land.G, land.B, 190}
+	drawn := false
+	for _, sub := range subs {
+		if !sub.bound.Intersects(window) {
+			continue
+		}
+		geom := clip.MultiPolygon(window, sub.Geometry.Clone())
+		if len(geom) == 0 {
+			continue
+		}
+		frame.projectGeometry(geom)
+		if visited[sub.Code] == 0 {
+			blendSpans(layer, rasterizeCountry(geom, TileSize, TileSize).spans, dim)
+		}
+		drawCountryBorder(layer, geom, land, TileSize, TileSize, 1)
+		drawn = true
+	}
+	if !drawn {
+		return
+	}
+	for _, s := range spans {
+		r := image.Rect(s.x1, s.y, s.x2+1, s.y+1)
+		draw.Draw(img, r, layer, r.Min, draw.Over)
+	}
+}
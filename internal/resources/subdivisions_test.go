@@ -0,0 +1,108 @@
+package resources
+
+import (
+	"testing"
+)
+
+// testAdmin1 has two made-up boxes inside Germany, and a feature without a
+// code that is skipped.
+const testAdmin1 = `{"type": "FeatureCollection", "features": [
+	{"type": "Feature", "properties": {"name": "Bayern", "iso_3166_2": "DE-BY"},
+	 "geometry": {"type": "Polygon", "coordinates": [[[10, 47.5], [13.5, 47.5], [13.5, 50.3], [10, 50.3], [10, 47.5]]]}},
+	{"type": "Feature", "properties": {"name": "Nordrhein-Westfalen", "iso_3166_2": "DE-NW"},
+	 "geometry": {"type": "Polygon", "coordinates": [[[6.2, 50.5], [9, 50.5], [9, 52.3], [6.2, 52.3], [6.2, 50.5]]]}},
+	{"type": "Feature", "properties": {"name": "Nowhere", "iso_3166_2": "-99"},
+	 "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}}
+]}`
+
+func TestParseSubdivisions(t *testing.T) {
+	sd, err := ParseSubdivisions([]byte(testAdmin1))
+	if err != nil {
+		t.Fatalf("ParseSubdivisions failed: %v", err)
+	}
+	if len(sd.Subdivisions) != 2 {
+		t.Fatalf("expected 2 subdivisions, got %d", len(sd.Subdivisions))
+	}
+	if sub, ok := sd.Get("de-by"); !ok || sub.Name != "Bayern" || sub.Alpha2 != "DE" {
+		t.Errorf("unexpected DE-BY %+v", sub)
+	}
+	if subs := sd.Country("DE"); len(subs) != 2 || subs[0].Code != "DE-BY" || subs[1].Code != "DE-NW" {
+		t.Errorf("expected the subdivisions of Germany by name, got %v", subs)
+	}
+	if sub := sd.FindAtPoint("DE", 51, 7); sub == nil || sub.Code != "DE-NW" {
+		t.Errorf("expected Nordrhein-Westfalen, got %v", sub)
+	}
+	if sub := sd.FindAtPoint("DE", 53, 7); sub != nil {
+		t.Errorf("expected no subdivision, got %v", sub)
+	}
+	if _, err := ParseSubdivisions([]byte(`{"type": "FeatureCollection", "features": []}`)); err == nil {
+		t.Error("expected an error for data without subdivisions")
+	}
+}
+
+func TestRenderTileSubdivisions(t *testing.T) {
+	ne, _, _ := loadRenderFixtures(t)
+	sd, err := ParseSubdivisions([]byte(testAdmin1))
+	if err != nil {
+		t.Fatalf("ParseSubdivisions failed: %v", err)
+	}
+	theme := DefaultTheme(false)
+	theme.Flags = false
+	hits := map[string]int{"Germany": 5}
+	visited := map[string]int{"DE-BY": 3}
+
+	frame := newTileFrame(4, 8, 5)
+	pixel := func(lat, lng float64) (int, int) {
+		lat, lng = frame.project(lat, lng)
+		x, y := geoToPixel(lat, lng, TileSize, TileSize)
+		return int(x), int(y)
+	}
+	plain, err := RenderTile(ne, 4, 8, 5, theme, hits, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("RenderTile failed: %v", err)
+	}
+	img, err := RenderTile(ne, 4, 8, 5, theme, hits, nil, nil, nil, nil, sd, visited)
+	if err != nil {
+		t.Fatalf("RenderTile failed: %v", err)
+	}
+	if x, y := pixel(49, 11.5); img.RGBAAt(x, y) != plain.RGBAAt(x, y) {
+		t.Errorf("expected the visited subdivision to keep the country's look, got %v instead of %v", img.RGBAAt(x, y), plain.RGBAAt(x, y))
+	}
+	if x, y := pixel(51.4, 7.6); img.RGBAAt(x, y) == plain.RGBAAt(x, y) {
+		t.Error("expected the unvisited subdivision to be dimmed")
+	}
+
+	// Zoomed out, subdivisions are left out
+	far, _ := RenderTile(ne, 2, 2, 1, theme, hits, nil, nil, nil, nil, sd, visited)
+	farPlain, _ := RenderTile(ne, 2, 2, 1, theme, hits, nil, nil, nil, nil, nil, nil)
+	if string(far.Pix) != string(farPlain.Pix) {
+		t.Error("expected no subdivisions below SubdivisionMinZoom")
+	}
+
+	if TileVersion(theme, hits, nil, nil, nil, nil, sd, visited) == TileVersion(theme, hits, nil, nil, nil, nil, sd, nil) {
+		t.Error("expected visited subdivisions to change the tile version")
+	}
+}
+
+func TestEmbeddedSubdivisions(t *testing.T) {
+	sd, err := LoadSubdivisions("")
+	if err != nil {
+		t.Fatalf("LoadSubdivisions failed: %v", err)
+	}
+	if len(sd.Subdivisions) < 4000 {
+		t.Errorf("expected the Natural Earth subdivisions, got %d", len(sd.Subdivisions))
+	}
+	for _, tc := range []struct {
+		alpha2   string
+		lat, lng float64
+		code     string
+	}{
+		{"US", 34.05, -118.24, "US-CA"},
+		{"DE", 48.14, 11.58, "DE-BY"},
+		{"AU", -33.87, 151.21, "AU-NSW"},
+	} {
+		if sub := sd.FindAtPoint(tc.alpha2, tc.lat, tc.lng); sub == nil || sub.Code != tc.code {
+			t.Errorf("expected %s at %v,%v, got %v", tc.code, tc.lat, tc.lng, sub)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// Built-in theme names.
+const (
+	ThemeLight          = "light"
+	ThemeDark           = "dark"
+	ThemeHighContrast   = "high-contrast"
+	ThemeColorblindSafe = "colorblind-safe"
+	ThemeEInk           = "e-ink"
+
+	// ThemeAuto selects the light or dark preset from the legacy "black" setting.
+	ThemeAuto = "auto"
+)
+
+// maxThemeDepth bounds "extends" chains so a cycle cannot recurse forever.
+const maxThemeDepth = 8
+
+// themeNamePattern restricts theme names to plain file names.
+var themeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Color is a non-premultiplied color written as "#rrggbb" or "#rrggbbaa" in
+// theme files.
+type Color color.RGBA
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Color) MarshalText() ([]byte, error) {
+	if c.A == 255 {
+		return []byte(fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)), nil
+	}
+	return []byte(fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *Color) UnmarshalText(text []byte) error {
+	s := string(text)
+	if !strings.HasPrefix(s, "#") || (len(s) != 7 && len(s) != 9) {
+		return fmt.Errorf("invalid color %q: expected #rrggbb or #rrggbbaa", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	if len(s) == 7 {
+		v = v<<8 | 0xff
+	}
+	*c = Color{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}
+	return nil
+}
+
+// OceanPalette is the three-stop gradient of the animated-looking ocean waves.
+type OceanPalette struct {
+	Deep      Color `json:"deep"`
+	Shallow   Color `json:"shallow"`
+	Highlight Color `json:"highlight"`
+}
+
+// VisitedPalette is the fill of visited countries that show no flag, from one
+// hit (Low) to nine hits (High).
+type VisitedPalette struct {
+	Low  Color `json:"low"`
+	High Color `json:"high"`
+}
+
+// RainPalette colors the Matrix rain glyphs. The tail fades from TailBright
+// right behind the head to TailDim at its end.
+type RainPalette struct {
+	Head       Color `json:"head"`
+	TailBright Color `json:"tail_bright"`
+	TailDim    Color `json:"tail_dim"`
+}
+
+// PrisonPalette styles Matrix Prison countries.
+type PrisonPalette struct {
+	Background Color       `json:"background"`
+	Sand       [4]Color    `json:"sand"` // light sand, dark sand, light rock, dark rock; used without fonts
+	Rain       RainPalette `json:"rain"`
+}
+
+// BorderStyle is the outline of the target country.
+type BorderStyle struct {
+	Color Color `json:"color"`
+	Width int   `json:"width"`
+}
+
+// ConnectionPalette colors live connections and the arcs to them.
+type ConnectionPalette struct {
+	Dot        Color `json:"dot"`
+	Arc        Color `json:"arc"`
+	Home       Color `json:"home"`
+	HomeCenter Color `json:"home_center"`
+}
+
+// LabelStyle styles country labels. The halo outlines the text so it reads
+// on any fill; a transparent halo disables it.
+type LabelStyle struct {
+	Text Color  `json:"text"`
+	Halo Color  `json:"halo"`
+	Font string `json:"font,omitempty"` // embedded font name or .ttf path; empty for the UI font
+}
+
+// StatusStyle styles the game status box, the legend and timelapse captions.
+type StatusStyle struct {
+	Background  Color  `json:"background"`
+	Text        Color  `json:"text"`
+	Border      Color  `json:"border"`
+	BorderWidth int    `json:"border_width"`
+	Font        string `json:"font,omitempty"` // embedded font name or .ttf path; empty for the UI font
+}
+
+// Theme holds every color and font the map renderer paints with.
+//
+// Themes are JSON files. A theme may name another theme in "extends" and only
+// list what it changes; themes without "extends" build on the light preset.
+// Theme is comparable, so it can key render caches directly.
+type Theme struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Ocean       OceanPalette      `json:"ocean"`
+	Land        Color             `json:"land"` // countries without hits
+	Flags       bool              `json:"flags"`
+	Visited     VisitedPalette    `json:"visited"`
+	Overvisited Color             `json:"overvisited"` // 10+ hits outside Matrix Prison
+	Prison      PrisonPalette     `json:"prison"`
+	Target      BorderStyle       `json:"target"`
+	Connections ConnectionPalette `json:"connections"`
+	Labels      LabelStyle        `json:"labels"`
+	Status      StatusStyle       `json:"status"`
+}
+
+var (
+	presetsOnce sync.Once
+	presets     map[string]Theme
+
+	themeFontsMu sync.Mutex
+	themeFonts   = make(map[string]*truetype.Font) // font files by absolute path
+)
+
+// presetThemes parses the embedded presets once.
+func presetThemes() map[string]Theme {
+	presetsOnce.Do(func() {
+		presets = make(map[string]Theme)
+		// light first: every other preset builds on it
+		names := []string{ThemeLight, ThemeDark, ThemeHighContrast, ThemeColorblindSafe, ThemeEInk}
+		for _, name := range names {
+			data, err := files.ReadFile(path.Join("themes", name+".json"))
+			if err != nil {
+				panic(fmt.Sprintf("missing embedded theme %s: %v", name, err))
+			}
+			theme, err := parseTheme(data, "", name, func(extends string) (Theme, error) {
+				if name == ThemeLight {
+					return Theme{}, nil
+				}
+				if extends == "" {
+					extends = ThemeLight
+				}
+				base, ok := presets[extends]
+				if !ok {
+					return Theme{}, fmt.Errorf("unknown theme %q", extends)
+				}
+				return base, nil
+			})
+			if err != nil {
+				panic(fmt.Sprintf("invalid embedded theme %s: %v", name, err))
+			}
+			presets[name] = *theme
+		}
+	})
+	return presets
+}
+
+// DefaultTheme returns the light or dark preset, matching the legacy "black"
+// setting.
+func DefaultTheme(black bool) *Theme {
+	name := ThemeLight
+	if black {
+		name = ThemeDark
+	}
+	theme := presetThemes()[name]
+	return &theme
+}
+
+// ResolveTheme loads a theme setting: ThemeAuto (or empty) picks the light or
+// dark preset by black, anything else is passed to LoadTheme.
+func ResolveTheme(name string, black bool) (*Theme, error) {
+	if name == "" || name == ThemeAuto {
+		return DefaultTheme(black), nil
+	}
+	return LoadTheme(name)
+}
+
+// ThemeDir returns the directory holding user themes (~/.config/iptw/themes).
+func ThemeDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw", "themes"), nil
+}
+
+// ThemeNames lists the built-in presets and the user themes, sorted.
+func ThemeNames() []string {
+	seen := make(map[string]bool)
+	for name := range presetThemes() {
+		seen[name] = true
+	}
+	if dir, err := ThemeDir(); err == nil {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), ".json")
+			if ok && !entry.IsDir() && themeNamePattern.MatchString(name) {
+				seen[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTheme loads a theme by name. A user file in ThemeDir takes precedence
+// over a preset of the same name, so presets can be customised in place.
+// User files are read on every call, so edits apply on the next load.
+func LoadTheme(name string) (*Theme, error) {
+	return loadTheme(name, 0)
+}
+
+func loadTheme(name string, depth int) (*Theme, error) {
+	if !themeNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid theme name %q", name)
+	}
+	if depth > maxThemeDepth {
+		return nil, fmt.Errorf("theme %q: extends chain too deep", name)
+	}
+
+	if dir, err := ThemeDir(); err == nil {
+		file := filepath.Join(dir, name+".json")
+		data, err := os.ReadFile(file)
+		switch {
+		case err == nil:
+			theme, err := parseTheme(data, dir, name, userThemeBase(name, depth))
+			if err != nil {
+				return nil, fmt.Errorf("theme %s: %w", file, err)
+			}
+			return theme, nil
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("failed to read theme: %w", err)
+		}
+	}
+
+	theme, ok := presetThemes()[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q", name)
+	}
+	return &theme, nil
+}
+
+// ParseTheme parses a theme file. Relative font paths are resolved against dir.
+func ParseTheme(data []byte, dir string) (*Theme, error) {
+	return parseTheme(data, dir, "", userThemeBase("", 0))
+}
+
+// userThemeBase returns the base lookup for a user theme file called name.
+// Without "extends" a user theme builds on the light preset; a file that
+// extends its own name customises the preset it shadows.
+func userThemeBase(name string, depth int) func(extends string) (Theme, error) {
+	return func(extends string) (Theme, error) {
+		if extends == "" || extends == name {
+			if extends == "" {
+				extends = ThemeLight
+			}
+			base, ok := presetThemes()[extends]
+			if !ok {
+				return Theme{}, fmt.Errorf("unknown theme %q", extends)
+			}
+			return base, nil
+		}
+		parent, err := loadTheme(extends, depth+1)
+		if err != nil {
+			return Theme{}, err
+		}
+		return *parent, nil
+	}
+}
+
+// parseTheme decodes data on top of the theme returned by base for its
+// "extends" setting. name is the file's own name, used when the file does not
+// set one.
+func parseTheme(data []byte, dir, name string, base func(extends string) (Theme, error)) (*Theme, error) {
+	var header struct {
+		Extends string `json:"extends"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("invalid theme JSON: %w", err)
+	}
+	parent, err := base(header.Extends)
+	if err != nil {
+		return nil, err
+	}
+
+	theme := parent
+	theme.Name, theme.Description = name, ""
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	var file struct {
+		Extends string `json:"extends"`
+		*Theme
+	}
+	file.Theme = &theme
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid theme: %w", err)
+	}
+	if theme.Name == "" {
+		theme.Name = "custom"
+	}
+	for _, f := range []struct{ font, inherited *string }{
+		{&theme.Status.Font, &parent.Status.Font},
+		{&theme.Labels.Font, &parent.Labels.Font},
+	} {
+		if *f.font == "" || *f.font == *f.inherited || !isFontPath(*f.font) {
+			continue
+		}
+		if !filepath.IsAbs(*f.font) {
+			*f.font = filepath.Join(dir, *f.font)
+		}
+		if _, err := loadThemeFont(*f.font); err != nil {
+			return nil, err
+		}
+	}
+	if err := theme.validate(); err != nil {
+		return nil, err
+	}
+	return &theme, nil
+}
+
+// validate checks the values a theme file could get wrong.
+func (t *Theme) validate() error {
+	if t.Target.Width < 1 || t.Target.Width > 10 {
+		return fmt.Errorf("target width must be between 1 and 10, got %d", t.Target.Width)
+	}
+	if t.Status.BorderWidth < 0 || t.Status.BorderWidth > 10 {
+		return fmt.Errorf("status border_width must be between 0 and 10, got %d", t.Status.BorderWidth)
+	}
+	if t.Status.Text.A == 0 {
+		return fmt.Errorf("status text color is fully transparent")
+	}
+	return nil
+}
+
+// isFontPath reports whether a font setting names a file rather than one of
+// the embedded fonts.
+func isFontPath(font string) bool {
+	return strings.ContainsRune(font, '/') || strings.ContainsRune(font, filepath.Separator)
+}
+
+// loadThemeFont parses a font file, caching it by path.
+func loadThemeFont(file string) (*truetype.Font, error) {
+	themeFontsMu.Lock()
+	defer themeFontsMu.Unlock()
+	if font, ok := themeFonts[file]; ok {
+		return font, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font: %w", err)
+	}
+	font, err := truetype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", file, err)
+	}
+	themeFonts[file] = font
+	return font, nil
+}
+
+// themeFont resolves a theme font setting, or returns nil to use the UI font.
+func themeFont(name string, fm *FontManager) *truetype.Font {
+	switch {
+	case name == "":
+		return nil
+	case isFontPath(name):
+		font, err := loadThemeFont(name)
+		if err != nil {
+			slog.Warn("Theme font unavailable, using the UI font", "font", name, "error", err)
+			return nil
+		}
+		return font
+	case fm != nil:
+		if font, ok := fm.fonts[name]; ok {
+			return font
+		}
+		slog.Debug("Theme font not embedded, using the UI font", "font", name)
+	}
+	return nil
+}
+
+// StatusFont returns the font for the status box, or nil to use the UI font.
+func (t *Theme) StatusFont(fm *FontManager) *truetype.Font {
+	return themeFont(t.Status.Font, fm)
+}
+
+// labelFont returns the font for country labels, falling back to the UI font.
+func (t *Theme) labelFont(fm *FontManager) *truetype.Font {
+	if font := themeFont(t.Labels.Font, fm); font != nil {
+		return font
+	}
+	return fm.GetUIFont()
+}
+
+// GameInfoConfig returns the status box style for the given text size.
+func (t *Theme) GameInfoConfig(fm *FontManager, fontSize float64, padding int) GameInfoConfig {
+	return GameInfoConfig{
+		BackgroundColor: color.RGBA(t.Status.Background),
+		TextColor:       color.RGBA(t.Status.Text),
+		BorderColor:     color.RGBA(t.Status.Border),
+		FontSize:        fontSize,
+		Padding:         padding,
+		BorderWidth:     t.Status.BorderWidth,
+		Font:            t.StatusFont(fm),
+	}
+}
+
+// hitColor returns the fill of a visited country without a flag.
+func (t *Theme) hitColor(hitCount int) color.RGBA {
+	if hitCount >= 10 {
+		return color.RGBA(t.Overvisited)
+	}
+	// Progressive intensity from the first to the ninth hit
+	return interpolateColor(color.RGBA(t.Visited.Low), color.RGBA(t.Visited.High), float64(hitCount)/9.0)
+}
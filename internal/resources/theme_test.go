@@ -0,0 +1,151 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeUserTheme writes a theme file into a fresh ~/.config/iptw/themes.
+func writeUserTheme(t *testing.T, name, content string) {
+	t.Helper()
+	dir, err := ThemeDir()
+	if err != nil {
+		t.Fatalf("ThemeDir failed: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func TestPresetThemes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, name := range []string{ThemeLight, ThemeDark, ThemeHighContrast, ThemeColorblindSafe, ThemeEInk} {
+		theme, err := LoadTheme(name)
+		if err != nil {
+			t.Errorf("LoadTheme(%q) failed: %v", name, err)
+			continue
+		}
+		if theme.Name != name {
+			t.Errorf("expected name %q, got %q", name, theme.Name)
+		}
+		if err := theme.validate(); err != nil {
+			t.Errorf("preset %q is invalid: %v", name, err)
+		}
+	}
+
+	light, dark := DefaultTheme(false), DefaultTheme(true)
+	if light.Land == dark.Land || light.Ocean == dark.Ocean {
+		t.Error("dark preset should override land and ocean")
+	}
+	if light.Prison != dark.Prison || light.Target != dark.Target {
+		t.Error("dark preset should inherit prison and target styles from light")
+	}
+	if eink, _ := LoadTheme(ThemeEInk); eink.Flags {
+		t.Error("e-ink preset should disable flags")
+	}
+}
+
+func TestColorText(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected Color
+	}{
+		{"#ff8000", Color{255, 128, 0, 255}},
+		{"#00000080", Color{0, 0, 0, 128}},
+		{"#ABCDEF", Color{0xab, 0xcd, 0xef, 255}},
+	}
+	for _, tt := range tests {
+		var c Color
+		if err := c.UnmarshalText([]byte(tt.text)); err != nil {
+			t.Errorf("UnmarshalText(%q) failed: %v", tt.text, err)
+			continue
+		}
+		if c != tt.expected {
+			t.Errorf("expected %v, got %v", tt.expected, c)
+		}
+		text, _ := c.MarshalText()
+		var back Color
+		if err := back.UnmarshalText(text); err != nil || back != c {
+			t.Errorf("round trip of %q gave %q", tt.text, text)
+		}
+	}
+
+	for _, bad := range []string{"", "ff8000", "#ff80", "#gg8000", "#ff800000ff"} {
+		var c Color
+		if err := c.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestUserTheme(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeUserTheme(t, "mine", `{"extends": "dark", "land": "#102030", "target": {"color": "#00ff00", "width": 3}}`)
+
+	theme, err := LoadTheme("mine")
+	if err != nil {
+		t.Fatalf("LoadTheme failed: %v", err)
+	}
+	dark := DefaultTheme(true)
+	if theme.Name != "mine" {
+		t.Errorf("expected name mine, got %q", theme.Name)
+	}
+	if theme.Land != (Color{0x10, 0x20, 0x30, 255}) {
+		t.Errorf("expected overridden land, got %v", theme.Land)
+	}
+	if theme.Ocean != dark.Ocean || theme.Status != dark.Status {
+		t.Error("expected ocean and status inherited from dark")
+	}
+	if theme.Target.Width != 3 {
+		t.Errorf("expected target width 3, got %d", theme.Target.Width)
+	}
+	if !slices.Contains(ThemeNames(), "mine") {
+		t.Errorf("expected mine in %v", ThemeNames())
+	}
+
+	// A user file shadows the preset of the same name and may extend it
+	writeUserTheme(t, "dark", `{"extends": "dark", "land": "#000000"}`)
+	shadowed, err := LoadTheme("dark")
+	if err != nil {
+		t.Fatalf("LoadTheme failed: %v", err)
+	}
+	if shadowed.Land != (Color{0, 0, 0, 255}) || shadowed.Ocean != dark.Ocean {
+		t.Errorf("expected customised dark preset, got %+v", shadowed)
+	}
+}
+
+func TestUserThemeErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeUserTheme(t, "unknown-field", `{"lnad": "#000000"}`)
+	writeUserTheme(t, "bad-color", `{"land": "grey"}`)
+	writeUserTheme(t, "bad-width", `{"target": {"color": "#ff0000", "width": 0}}`)
+	writeUserTheme(t, "loop-a", `{"extends": "loop-b"}`)
+	writeUserTheme(t, "loop-b", `{"extends": "loop-a"}`)
+	writeUserTheme(t, "missing-font", `{"status": {"font": "fonts/missing.ttf"}}`)
+
+	for _, name := range []string{"unknown-field", "bad-color", "bad-width", "loop-a", "missing-font", "no-such-theme", "../escape"} {
+		if _, err := LoadTheme(name); err == nil {
+			t.Errorf("expected error loading %q", name)
+		}
+	}
+}
+
+func TestThemeHitColor(t *testing.T) {
+	theme := DefaultTheme(false)
+	if c := theme.hitColor(12); Color(c) != theme.Overvisited {
+		t.Errorf("expected overvisited color, got %v", c)
+	}
+	low, high := theme.hitColor(1), theme.hitColor(9)
+	if Color(high) != theme.Visited.High {
+		t.Errorf("expected %v at nine hits, got %v", theme.Visited.High, high)
+	}
+	if low.A >= high.A {
+		t.Error("more hits should give a more opaque fill")
+	}
+}
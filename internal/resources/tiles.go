@@ -0,0 +1,214 @@
+package resources
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+)
+
+// TileSize is the width and height of a map tile in pixels.
+const TileSize = 256
+
+// MaxTileZoom is the deepest zoom level served; the embedded 1:110m geometry
+// has no more detail to show beyond it.
+const MaxTileZoom = 10
+
+// maxMercatorLat is the latitude at which Web Mercator tiles end.
+const maxMercatorLat = 85.0511287798066
+
+// ValidTile reports whether z/x/y addresses an existing tile.
+func ValidTile(z, x, y int) bool {
+	if z < 0 || z > MaxTileZoom {
+		return false
+	}
+	n := 1 << z
+	return x >= 0 && x < n && y >= 0 && y < n
+}
+
+// TileBound returns the longitude/latitude bounds of a Web Mercator tile.
+func TileBound(z, x, y int) orb.Bound {
+	n := float64(int(1) << z)
+	lng := func(x float64) float64 { return x/n*360 - 180 }
+	lat := func(y float64) float64 { return math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180 / math.Pi }
+	return orb.Bound{
+		Min: orb.Point{lng(float64(x)), lat(float64(y + 1))},
+		Max: orb.Point{lng(float64(x + 1)), lat(float64(y))},
+	}
+}
+
+// tileFrame maps locations into the pixel space of one tile. Like cropped map
+// data, the tile is expressed as whole-world coordinates so the equirectangular
+// rasterizer draws it unchanged at TileSize×TileSize.
+type tileFrame struct {
+	scale  float64 // world size in pixels at this zoom
+	x0, y0 float64 // tile origin in world pixels
+}
+
+func newTileFrame(z, x, y int) tileFrame {
+	return tileFrame{scale: float64(int(TileSize) << z), x0: float64(x * TileSize), y0: float64(y * TileSize)}
+}
+
+// project returns the Web Mercator position of a location as the lat/lng that
+// geoToPixel maps to the same pixel of a TileSize×TileSize image.
+func (f tileFrame) project(lat, lng float64) (float64, float64) {
+	lat = math.Max(-maxMercatorLat, math.Min(maxMercatorLat, lat))
+	sin := math.Sin(lat * math.Pi / 180)
+	px := (lng+180)/360*f.scale - f.x0
+	py := (0.5-math.Log((1+sin)/(1-sin))/(4*math.Pi))*f.scale - f.y0
+	return 90 - py/TileSize*180, px/TileSize*360 - 180
+}
+
+// projectGeometry projects geometry in place.
+func (f tileFrame) projectGeometry(geom orb.MultiPolygon) {
+	for _, polygon := range geom {
+		for _, ring := range polygon {
+			for i, pt := range ring {
+				lat, lng := f.project(pt[1], pt[0])
+				ring[i] = orb.Point{lng, lat}
+			}
+		}
+	}
+}
+
+// RenderTile renders one Web Mercator tile of the map with the static look of
+// every country: flags or hit colors for visited countries, the prison
+// background for Matrix Prison, flags for liberated countries and the target
+// outline. From SubdivisionMinZoom on, visited countries covered by
+// subdivisions (nil for none) show their states and provinces, with hits by
+// ISO 3166-2 code in visitedSubdivisions. Tiles have no animation and are not
+// drawn from the layer caches, so serving them never evicts the live map's
+// layers.
+func RenderTile(ne *NaturalEarthData, z, x, y int, theme *Theme, hitCountries map[string]int, targetCountries map[string]bool, flagManager *FlagManager, matrixPrisonCountries map[string]bool, liberatedCountries map[string]bool, subdivisions *SubdivisionData, visitedSubdivisions map[string]int) (*image.RGBA, error) {
+	if !ValidTile(z, x, y) {
+		return nil, fmt.Errorf("no tile %d/%d/%d", z, x, y)
+	}
+	if theme == nil {
+		theme = DefaultTheme(false)
+	}
+	if !theme.Flags {
+		flagManager = nil
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, TileSize, TileSize))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA(theme.Ocean.Shallow)), image.Point{}, draw.Src)
+
+	frame := newTileFrame(z, x, y)
+	bound := TileBound(z, x, y)
+	// Clip slightly outside the tile so clip edges and outlines fall off it
+	window := bound.Pad(0.02 * math.Max(bound.Max[0]-bound.Min[0], bound.Max[1]-bound.Min[1]))
+
+	for _, country := range ne.Countries {
+		countryBound := country.Geometry.Bound()
+		if !countryBound.Intersects(window) {
+			continue
+		}
+		geom := clip.MultiPolygon(window, country.Geometry.Clone())
+		if len(geom) == 0 {
+			continue
+		}
+		frame.projectGeometry(geom)
+		spans := rasterizeCountry(geom, TileSize, TileSize).spans
+
+		hits := hitCountries[country.Name]
+		var flag image.Image
+		if flagManager != nil && (hits > 0 || liberatedCountries[country.Name]) {
+			if alpha2, err := GetAlpha2ByName(country.Name); err == nil {
+				flag = flagManager.GetFlag(alpha2)
+			}
+		}
+
+		switch {
+		case matrixPrisonCountries[country.Name] && (!liberatedCountries[country.Name] || flag == nil):
+			fillSpans(img, spans, color.RGBA(theme.Prison.Background))
+		case flag != nil:
+			// Scale the flag to the whole country so it lines up across tiles
+			flagGeom := orb.MultiPolygon{{countryBound.ToRing()}}
+			frame.projectGeometry(flagGeom)
+			flagSpans(img, spans, flagGeom, flag, TileSize, TileSize, false)
+		case hits > 0:
+			fillSpans(img, spans, color.RGBA(theme.Land))
+			blendSpans(img, spans, theme.hitColor(hits))
+		default:
+			fillSpans(img, spans, color.RGBA(theme.Land))
+		}
+
+		if subdivisions != nil && z >= SubdivisionMinZoom && hits > 0 && !matrixPrisonCountries[country.Name] {
+			if alpha2, err := GetAlpha2ByName(country.Name); err == nil {
+				if subs := subdivisions.Country(alpha2); len(subs) > 0 {
+					drawTileSubdivisions(img, frame, window, subs, visitedSubdivisions, spans, theme)
+				}
+			}
+		}
+
+		if targetCountries[country.Name] {
+			drawCountryBorder(img, geom, color.RGBA(theme.Target.Color), TileSize, TileSize, theme.Target.Width)
+		}
+	}
+	return img, nil
+}
+
+// blendSpans composites a translucent color over the pixels of spans.
+func blendSpans(img *image.RGBA, spans []spanRun, c color.RGBA) {
+	src := image.NewUniform(color.NRGBA(c))
+	for _, s := range spans {
+		draw.Draw(img, image.Rect(s.x1, s.y, s.x2+1, s.y+1), src, image.Point{}, draw.Over)
+	}
+}
+
+// TileVersion fingerprints everything that changes how tiles look, so cached
+// tiles can be dropped exactly when one of them would render differently.
+// Hit counts only matter for themes without flags, and for countries without a
+// flag, where they pick the fill color; subdivisions only whether they were
+// visited.
+func TileVersion(theme *Theme, hitCountries map[string]int, targetCountries map[string]bool, flagManager *FlagManager, matrixPrisonCountries map[string]bool, liberatedCountries map[string]bool, subdivisions *SubdivisionData, visitedSubdivisions map[string]int) string {
+	names := make([]string, 0, len(hitCountries)+len(matrixPrisonCountries))
+	seen := make(map[string]bool)
+	for name := range hitCountries {
+		names, seen[name] = append(names, name), true
+	}
+	for name := range matrixPrisonCountries {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	targets := make([]string, 0, len(targetCountries))
+	for name, target := range targetCountries {
+		if target {
+			targets = append(targets, name)
+		}
+	}
+	sort.Strings(targets)
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%+v|%s|", *theme, strings.Join(targets, ","))
+	for _, name := range names {
+		hits := hitCountries[name]
+		if hits > 0 && theme.Flags && flagManager != nil {
+			if alpha2, err := GetAlpha2ByName(name); err == nil && flagManager.GetFlag(alpha2) != nil {
+				hits = 1
+			}
+		}
+		fmt.Fprintf(h, "%s:%d:%t:%t|", name, hits, matrixPrisonCountries[name], liberatedCountries[name])
+	}
+	if subdivisions != nil {
+		codes := make([]string, 0, len(visitedSubdivisions))
+		for code, hits := range visitedSubdivisions {
+			if hits > 0 {
+				codes = append(codes, code)
+			}
+		}
+		sort.Strings(codes)
+		fmt.Fprintf(h, "subdivisions:%s", strings.Join(codes, ","))
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,97 @@
+package resources
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestTileBound(t *testing.T) {
+	b := TileBound(0, 0, 0)
+	if b.Min[0] != -180 || b.Max[0] != 180 || math.Abs(b.Max[1]-maxMercatorLat) > 1e-9 {
+		t.Errorf("unexpected world tile bound %v", b)
+	}
+	b = TileBound(1, 1, 0)
+	if b.Min[0] != 0 || b.Max[0] != 180 || math.Abs(b.Min[1]) > 1e-9 {
+		t.Errorf("unexpected north-east tile bound %v", b)
+	}
+
+	for _, tile := range [][3]int{{-1, 0, 0}, {0, 1, 0}, {2, 0, 4}, {MaxTileZoom + 1, 0, 0}} {
+		if ValidTile(tile[0], tile[1], tile[2]) {
+			t.Errorf("expected %v to be invalid", tile)
+		}
+	}
+}
+
+func TestRenderTile(t *testing.T) {
+	ne, _, _ := loadRenderFixtures(t)
+	theme := DefaultTheme(false)
+	theme.Flags = false
+
+	// Tile 4/8/5 lies over central Europe, mostly land
+	img, err := RenderTile(ne, 4, 8, 5, theme, map[string]int{"Germany": 5}, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("RenderTile failed: %v", err)
+	}
+	if img.Bounds().Dx() != TileSize || img.Bounds().Dy() != TileSize {
+		t.Fatalf("unexpected tile size %v", img.Bounds())
+	}
+	land, ocean := color.RGBA(theme.Land), color.RGBA(theme.Ocean.Shallow)
+	counts := make(map[color.RGBA]int)
+	for y := 0; y < TileSize; y++ {
+		for x := 0; x < TileSize; x++ {
+			counts[img.RGBAAt(x, y)]++
+		}
+	}
+	if counts[land] == 0 || counts[ocean] == 0 {
+		t.Errorf("expected both land and ocean in the tile, got %d land and %d ocean pixels", counts[land], counts[ocean])
+	}
+	if len(counts) < 3 {
+		t.Error("expected the visited country to be tinted")
+	}
+
+	if _, err := RenderTile(ne, 1, 2, 0, theme, nil, nil, nil, nil, nil, nil, nil); err == nil {
+		t.Error("expected an error for a tile outside the world")
+	}
+}
+
+func TestTileVersion(t *testing.T) {
+	theme := DefaultTheme(false)
+	base := TileVersion(theme, map[string]int{"France": 1}, map[string]bool{"Spain": true}, nil, nil, nil, nil, nil)
+	if base != TileVersion(theme, map[string]int{"France": 1}, map[string]bool{"Spain": true}, nil, nil, nil, nil, nil) {
+		t.Error("expected the same state to give the same version")
+	}
+	changed := []string{
+		TileVersion(theme, map[string]int{"France": 2}, map[string]bool{"Spain": true}, nil, nil, nil, nil, nil),
+		TileVersion(theme, map[string]int{"France": 1}, map[string]bool{"Italy": true}, nil, nil, nil, nil, nil),
+		TileVersion(theme, map[string]int{"France": 1}, map[string]bool{"Spain": true, "Italy": true}, nil, nil, nil, nil, nil),
+		TileVersion(theme, map[string]int{"France": 1}, map[string]bool{"Spain": true}, nil, map[string]bool{"France": true}, nil, nil, nil),
+		TileVersion(DefaultTheme(true), map[string]int{"France": 1}, map[string]bool{"Spain": true}, nil, nil, nil, nil, nil),
+	}
+	for i, v := range changed {
+		if v == base {
+			t.Errorf("expected change %d to give a new version", i)
+		}
+	}
+}
+
+func TestCountryFeatures(t *testing.T) {
+	ne, _, _ := loadRenderFixtures(t)
+	fc := CountryFeatures(ne, DefaultSimplifyTolerance, map[string]int{"France": 2}, map[string]bool{"Spain": true}, map[string]bool{"Italy": true}, nil)
+	if len(fc.Features) < 150 {
+		t.Fatalf("expected most countries, got %d features", len(fc.Features))
+	}
+	byName := make(map[string]map[string]interface{})
+	for _, f := range fc.Features {
+		byName[f.Properties.MustString("name")] = f.Properties
+	}
+	if p := byName["France"]; p["state"] != CountryVisited || p["hits"] != 2 || p["iso_a2"] != "FR" {
+		t.Errorf("unexpected France properties %v", p)
+	}
+	if p := byName["Italy"]; p["state"] != CountryPrison {
+		t.Errorf("expected Italy in prison, got %v", p["state"])
+	}
+	if p := byName["Spain"]; p["target"] != true || p["state"] != CountryUnvisited {
+		t.Errorf("unexpected Spain properties %v", p)
+	}
+}
@@ -0,0 +1,51 @@
+package score
+
+// HostingShare is the approximate percentage of the web servers of the
+// Internet hosted in a country, by ISO 3166-1 alpha-2 code. Countries not
+// listed host a negligible share. The figures only need to rank countries
+// roughly: common destinations are worth little, rare ones a lot.
+var HostingShare = map[string]float64{
+	"US": 40,
+	"DE": 7,
+	"NL": 4,
+	"FR": 4,
+	"GB": 3,
+	"JP": 3,
+	"RU": 3,
+	"CN": 3,
+	"SG": 2,
+	"CA": 2,
+	"IE": 1.5,
+	"KR": 1,
+	"HK": 1,
+	"BR": 1,
+	"AU": 1,
+	"IN": 1,
+	"PL": 1,
+	"SE": 0.7,
+	"FI": 0.7,
+	"IT": 0.7,
+	"ES": 0.6,
+	"CH": 0.6,
+	"CZ": 0.5,
+	"UA": 0.5,
+	"TR": 0.4,
+	"VN": 0.4,
+	"IR": 0.4,
+	"ID": 0.3,
+	"TW": 0.3,
+	"AT": 0.3,
+	"BE": 0.3,
+	"DK": 0.3,
+	"NO": 0.3,
+	"RO": 0.3,
+	"LT": 0.3,
+	"BG": 0.2,
+	"HU": 0.2,
+	"ZA": 0.2,
+	"AR": 0.2,
+	"MX": 0.2,
+	"IL": 0.2,
+	"TH": 0.2,
+	"LU": 0.2,
+}
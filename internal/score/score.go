@@ -0,0 +1,303 @@
+// Package score turns the travel history into points.
+//
+// The score is never stored: it is derived from the journal events alone, in
+// journal order, so it can be recomputed at any time, after an import or when
+// the weights change. Points are earned by:
+//
+//   - a first visit, worth more for rare countries (see VisitPoints)
+//   - every connection to the target country while it is the target
+//   - liberating the target, by sending it to Matrix Prison, once per country
+//
+// and lost for every hour during which a country in Matrix Prison is
+// connected to, until a release event frees it as the game does. Points count towards the local calendar day they were earned
+// on, which gives the daily and weekly scores, the best days and the streaks
+// of consecutive days scoring points.
+package score
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"iptw/internal/history"
+)
+
+// Reason tells why points were awarded.
+type Reason string
+
+const (
+	ReasonVisit      Reason = "visit"      // first visit to a country
+	ReasonTarget     Reason = "target"     // connection to the target country
+	ReasonLiberation Reason = "liberation" // the target was sent to Matrix Prison
+	ReasonPrison     Reason = "prison"     // an hour connected to a country in Matrix Prison
+)
+
+// Reasons lists the reasons in display order.
+var Reasons = []Reason{ReasonVisit, ReasonTarget, ReasonLiberation, ReasonPrison}
+
+const (
+	// TargetPoints are earned for every connection to the target country.
+	TargetPoints = 25
+	// LiberationPoints are earned for liberating the target country.
+	LiberationPoints = 250
+	// PrisonPenalty is lost for every hour a prisoner is connected to.
+	PrisonPenalty = 10
+)
+
+// Record kinds reported by Add and recorded in the journal.
+const (
+	RecordBestDay = "best_day" // a day scored more than any day before
+	RecordStreak  = "streak"   // the longest streak of days scoring points
+)
+
+// BestDaysCount is the number of best days listed by Summary.
+const BestDaysCount = 5
+
+// Award is the points earned (or lost, when negative) by one event.
+type Award struct {
+	Time    time.Time `json:"time"`
+	Reason  Reason    `json:"reason"`
+	Country string    `json:"country"`
+	Points  int       `json:"points"`
+}
+
+// Record is a personal record set by an event. Value is the points of the day
+// for RecordBestDay and the number of days for RecordStreak.
+type Record struct {
+	Kind  string `json:"kind"`
+	Day   string `json:"day"`
+	Value int    `json:"value"`
+}
+
+// Scorer adds up the points of journal events. It is not safe for concurrent
+// use.
+type Scorer struct {
+	alpha2Of func(country string) string
+
+	visited    map[string]bool
+	prison     map[string]bool   // imprisoned, not liberated and not released
+	liberated  map[string]bool   // countries whose liberation was awarded
+	prisonHour map[string]string // last hour penalized, by prisoner
+	target     string
+
+	total   int
+	reasons map[Reason]int
+	days    map[string]int // points by local day in history.DayFormat
+	best    Day            // best day so far, for records
+	longest int            // longest streak so far, for records
+}
+
+// New returns a scorer with no points. alpha2Of returns the ISO 3166-1
+// alpha-2 code of a country name, "" when unknown, to look up its rarity.
+func New(alpha2Of func(country string) string) *Scorer {
+	return &Scorer{
+		alpha2Of:   alpha2Of,
+		visited:    make(map[string]bool),
+		prison:     make(map[string]bool),
+		liberated:  make(map[string]bool),
+		prisonHour: make(map[string]string),
+		reasons:    make(map[Reason]int),
+		days:       make(map[string]int),
+	}
+}
+
+// Replay scores every event of the journal.
+func Replay(j *history.Journal, alpha2Of func(country string) string) (*Scorer, error) {
+	s := New(alpha2Of)
+	err := j.Scan(time.Time{}, func(e history.Event) bool {
+		s.Add(e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add scores an event and returns the points it earned and the personal
+// records it set. Events must be added in journal order.
+func (s *Scorer) Add(e history.Event) ([]Award, []Record) {
+	var awards []Award
+	award := func(reason Reason, points int) {
+		awards = append(awards, Award{Time: e.Time, Reason: reason, Country: e.Country, Points: points})
+	}
+
+	switch e.Type {
+	case history.EventVisit:
+		if e.Country != "" && !s.visited[e.Country] {
+			s.visited[e.Country] = true
+			award(ReasonVisit, VisitPoints(s.alpha2Of(e.Country)))
+		}
+	case history.EventHit:
+		if e.Country == "" {
+			break
+		}
+		if e.Country == s.target {
+			award(ReasonTarget, TargetPoints)
+		}
+		// Penalize each hour once, however many connections it saw
+		if hour := e.Time.Local().Format("2006-01-02T15"); s.prison[e.Country] && s.prisonHour[e.Country] != hour {
+			s.prisonHour[e.Country] = hour
+			award(ReasonPrison, -PrisonPenalty)
+		}
+	case history.EventImprison:
+		if !e.Liberated {
+			s.prison[e.Country] = true
+		} else if !s.liberated[e.Country] {
+			s.liberated[e.Country] = true
+			award(ReasonLiberation, LiberationPoints)
+		}
+	case history.EventRelease:
+		if e.Country == "" {
+			clear(s.prison)
+			clear(s.prisonHour)
+		} else {
+			delete(s.prison, e.Country)
+			delete(s.prisonHour, e.Country)
+		}
+	case history.EventTarget:
+		s.target = e.Country
+	}
+
+	var records []Record
+	for _, a := range awards {
+		records = append(records, s.apply(a)...)
+	}
+	return awards, records
+}
+
+// apply adds the points of an award and returns the records it set.
+func (s *Scorer) apply(a Award) []Record {
+	day := a.Time.Local().Format(history.DayFormat)
+	before := s.days[day]
+	s.total += a.Points
+	s.reasons[a.Reason] += a.Points
+	s.days[day] += a.Points
+	points := s.days[day]
+
+	var records []Record
+	switch {
+	case points > s.best.Points:
+		// Only the first time a day beats an earlier one is a record
+		if s.best.Date != day && s.best.Date != "" {
+			records = append(records, Record{Kind: RecordBestDay, Day: day, Value: points})
+		}
+		s.best = Day{Date: day, Points: points}
+	case s.best.Date == day && points < before:
+		s.best = Day{}
+		if best := s.bestDays(1); len(best) > 0 {
+			s.best = best[0]
+		}
+	}
+	if before <= 0 && points > 0 {
+		if streak := s.streakTo(a.Time.Local()); streak > s.longest {
+			if s.longest > 0 {
+				records = append(records, Record{Kind: RecordStreak, Day: day, Value: streak})
+			}
+			s.longest = streak
+		}
+	}
+	return records
+}
+
+// Total returns the points of all time.
+func (s *Scorer) Total() int {
+	return s.total
+}
+
+// Day is the points of one local calendar day.
+type Day struct {
+	Date   string `json:"date"`
+	Points int    `json:"points"`
+}
+
+// Summary is the score of a moment.
+type Summary struct {
+	Today         int            `json:"today"`
+	Week          int            `json:"week"` // since Monday
+	Total         int            `json:"total"`
+	Reasons       map[Reason]int `json:"reasons"` // all-time points by reason
+	BestDays      []Day          `json:"best_days"`
+	Streak        int            `json:"streak"` // consecutive days scoring points up to today
+	LongestStreak int            `json:"longest_streak"`
+}
+
+// Summary returns the scores of the day and week containing now, and the
+// personal records.
+func (s *Scorer) Summary(now time.Time) Summary {
+	now = now.Local()
+	summary := Summary{
+		Today:         s.days[now.Format(history.DayFormat)],
+		Total:         s.total,
+		Reasons:       make(map[Reason]int, len(Reasons)),
+		BestDays:      s.bestDays(BestDaysCount),
+		LongestStreak: s.longestStreak(),
+	}
+	for _, reason := range Reasons {
+		summary.Reasons[reason] = s.reasons[reason]
+	}
+	monday := now.AddDate(0, 0, -(int(now.Weekday())+6)%7)
+	for day := monday; !day.After(now); day = day.AddDate(0, 0, 1) {
+		summary.Week += s.days[day.Format(history.DayFormat)]
+	}
+	// A day without points yet does not break the streak
+	summary.Streak = s.streakTo(now)
+	if summary.Streak == 0 {
+		summary.Streak = s.streakTo(now.AddDate(0, 0, -1))
+	}
+	return summary
+}
+
+// bestDays returns up to n days with the most points, the earliest first
+// among equals. Days without points are left out.
+func (s *Scorer) bestDays(n int) []Day {
+	days := make([]Day, 0, len(s.days))
+	for date, points := range s.days {
+		if points > 0 {
+			days = append(days, Day{Date: date, Points: points})
+		}
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].Points != days[j].Points {
+			return days[i].Points > days[j].Points
+		}
+		return days[i].Date < days[j].Date
+	})
+	return days[:min(n, len(days))]
+}
+
+// streakTo returns the number of consecutive days scoring points ending on
+// the day of t.
+func (s *Scorer) streakTo(t time.Time) int {
+	streak := 0
+	for day := t; s.days[day.Format(history.DayFormat)] > 0; day = day.AddDate(0, 0, -1) {
+		streak++
+	}
+	return streak
+}
+
+// longestStreak returns the longest run of consecutive days scoring points.
+func (s *Scorer) longestStreak() int {
+	longest := 0
+	for date, points := range s.days {
+		day, err := time.ParseInLocation(history.DayFormat, date, time.Local)
+		if err != nil || points <= 0 || s.days[day.AddDate(0, 0, -1).Format(history.DayFormat)] > 0 {
+			continue
+		}
+		// Count every run forward from its first day
+		run := 0
+		for ; s.days[day.Format(history.DayFormat)] > 0; day = day.AddDate(0, 0, 1) {
+			run++
+		}
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// VisitPoints returns the points of a first visit to a country: 10 for the
+// country hosting most of the Internet, up to 100 for those hosting a
+// negligible share of it, inversely to their share.
+func VisitPoints(alpha2 string) int {
+	share := HostingShare[alpha2]
+	return 10 + int(math.Round(90/(1+share)))
+}
@@ -0,0 +1,133 @@
+package score
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"iptw/internal/history"
+)
+
+func testAlpha2(country string) string {
+	return map[string]string{"United States of America": "US", "Fiji": "FJ", "Peru": "PE", "Germany": "DE"}[country]
+}
+
+func TestVisitPoints(t *testing.T) {
+	for alpha2, want := range map[string]int{"US": 12, "DE": 21, "FJ": 100, "": 100} {
+		if got := VisitPoints(alpha2); got != want {
+			t.Errorf("VisitPoints(%q) = %d, want %d", alpha2, got, want)
+		}
+	}
+}
+
+func TestScorer(t *testing.T) {
+	monday := time.Date(2026, 3, 2, 10, 0, 0, 0, time.Local)
+	tuesday := monday.AddDate(0, 0, 1)
+	events := []history.Event{
+		{Time: monday, Type: history.EventTarget, Country: "Peru"},
+		{Time: monday, Type: history.EventVisit, Country: "United States of America"},
+		{Time: monday, Type: history.EventVisit, Country: "Fiji"},
+		{Time: monday, Type: history.EventVisit, Country: "Fiji"},
+		{Time: monday, Type: history.EventImprison, Country: "Germany"},
+		{Time: monday.Add(5 * time.Minute), Type: history.EventHit, Country: "Germany"},
+		{Time: monday.Add(40 * time.Minute), Type: history.EventHit, Country: "Germany"},
+		{Time: monday.Add(70 * time.Minute), Type: history.EventHit, Country: "Germany"},
+		{Time: tuesday, Type: history.EventVisit, Country: "Peru"},
+		{Time: tuesday, Type: history.EventHit, Country: "Peru"},
+		{Time: tuesday, Type: history.EventImprison, Country: "Peru", Liberated: true},
+		{Time: tuesday, Type: history.EventTarget, Country: "Fiji"},
+	}
+
+	s := New(testAlpha2)
+	var awards []Award
+	var records []Record
+	for _, e := range events {
+		a, r := s.Add(e)
+		awards = append(awards, a...)
+		records = append(records, r...)
+	}
+	if len(awards) != 7 || awards[3].Reason != ReasonPrison || awards[3].Points != -PrisonPenalty {
+		t.Errorf("unexpected awards %+v", awards)
+	}
+	wantRecords := []Record{{Kind: RecordBestDay, Day: "2026-03-03", Value: 100}, {Kind: RecordStreak, Day: "2026-03-03", Value: 2}}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("expected records %+v, got %+v", wantRecords, records)
+	}
+
+	summary := s.Summary(tuesday.Add(time.Hour))
+	want := Summary{
+		Today:         375,
+		Week:          467,
+		Total:         467,
+		Reasons:       map[Reason]int{ReasonVisit: 212, ReasonTarget: 25, ReasonLiberation: 250, ReasonPrison: -20},
+		BestDays:      []Day{{Date: "2026-03-03", Points: 375}, {Date: "2026-03-02", Points: 92}},
+		Streak:        2,
+		LongestStreak: 2,
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("expected %+v, got %+v", want, summary)
+	}
+
+	// The streak survives a day without points yet, not two
+	if summary := s.Summary(tuesday.AddDate(0, 0, 1)); summary.Today != 0 || summary.Streak != 2 {
+		t.Errorf("expected the streak to go on, got %+v", summary)
+	}
+	if summary := s.Summary(tuesday.AddDate(0, 0, 2)); summary.Streak != 0 || summary.LongestStreak != 2 || summary.Week != 467 {
+		t.Errorf("expected the streak to be broken, got %+v", summary)
+	}
+	if summary := s.Summary(monday.AddDate(0, 0, 7)); summary.Week != 0 {
+		t.Errorf("expected a new week, got %+v", summary)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	journal, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = journal.Close() }()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	for _, e := range []history.Event{
+		{Time: start, Type: history.EventVisit, Country: "Germany"},
+		{Time: start, Type: history.EventTarget, Country: "Fiji"},
+		{Time: start.Add(time.Hour), Type: history.EventHit, Country: "Fiji"},
+	} {
+		if err := journal.Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	s, err := Replay(journal, testAlpha2)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if s.Total() != 21+TargetPoints {
+		t.Errorf("expected %d points, got %d", 21+TargetPoints, s.Total())
+	}
+}
+
+func TestScorerLiberationAndRelease(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.Local)
+	events := []history.Event{
+		{Time: start, Type: history.EventImprison, Country: "Peru", Liberated: true},
+		{Time: start, Type: history.EventImprison, Country: "Germany"},
+		{Time: start.Add(time.Hour), Type: history.EventHit, Country: "Germany"},
+		// A new game frees the prisoners; liberating Peru again earns nothing
+		{Time: start.Add(2 * time.Hour), Type: history.EventRelease},
+		{Time: start.Add(3 * time.Hour), Type: history.EventHit, Country: "Germany"},
+		{Time: start.Add(4 * time.Hour), Type: history.EventImprison, Country: "Peru", Liberated: true},
+		{Time: start.Add(5 * time.Hour), Type: history.EventImprison, Country: "Germany"},
+		{Time: start.Add(6 * time.Hour), Type: history.EventHit, Country: "Germany"},
+		{Time: start.Add(7 * time.Hour), Type: history.EventRelease, Country: "Germany"},
+		{Time: start.Add(8 * time.Hour), Type: history.EventHit, Country: "Germany"},
+	}
+	s := New(testAlpha2)
+	for _, e := range events {
+		s.Add(e)
+	}
+	reasons := s.Summary(start).Reasons
+	if reasons[ReasonLiberation] != LiberationPoints || reasons[ReasonPrison] != -2*PrisonPenalty {
+		t.Errorf("expected one liberation and two penalties, got %v", reasons)
+	}
+}
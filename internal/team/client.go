@@ -0,0 +1,40 @@
+package team
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Push sends a signed summary to the team server at serverURL.
+func Push(ctx context.Context, client *http.Client, serverURL, key string, s Summary) error {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode summary: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(serverURL, "/")+SummariesPath, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(key, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach team server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		var apiErr errorEnvelope
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("team server refused the summary: %s", apiErr.Error.Message)
+		}
+		return fmt.Errorf("team server refused the summary: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package team
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxSummaryBytes bounds the body of a pushed summary.
+const maxSummaryBytes = 1 << 20
+
+// Standing is a player on the leaderboard.
+type Standing struct {
+	Rank         int          `json:"rank"`
+	Player       string       `json:"player"`
+	Visited      int          `json:"visited"`
+	Prison       int          `json:"prison"`
+	Achievements int          `json:"achievements"`
+	Score        ScoreSummary `json:"score"`
+	Updated      time.Time    `json:"updated"`
+}
+
+// Leaderboard ranks the players by all-time score, then by visited countries.
+type Leaderboard struct {
+	Players   int        `json:"players"`
+	Standings []Standing `json:"standings"`
+}
+
+// TeamCountry is a country of the team map with the players who visited it.
+type TeamCountry struct {
+	Country string   `json:"country"`
+	Players []string `json:"players"`
+	Hits    int      `json:"hits"`
+}
+
+// TeamMap combines the countries of every player, most shared first.
+type TeamMap struct {
+	Players   int           `json:"players"`
+	Countries []TeamCountry `json:"countries"`
+}
+
+// errorEnvelope is the body of every error response, as in the iptw API.
+type errorEnvelope struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Server collects the summaries of a team and serves the team map and
+// leaderboard. The latest summary of each player is kept, in a file when a
+// path is given. It is safe for concurrent use.
+type Server struct {
+	// RenderMap draws the team map from hit counts as understood by the map
+	// renderer; without it, /map.png is not served.
+	RenderMap func(hits map[string]int) (image.Image, error)
+
+	key       string
+	path      string
+	now       func() time.Time
+	mu        sync.Mutex
+	summaries map[string]Summary
+}
+
+// NewServer returns a server accepting summaries signed with key. The
+// summaries are stored at path, or only in memory when path is empty.
+func NewServer(key, path string) (*Server, error) {
+	if key == "" {
+		return nil, errors.New("a team key is required")
+	}
+	s := &Server{key: key, path: path, now: time.Now, summaries: make(map[string]Summary)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read team data: %w", err)
+	}
+	var stored []Summary
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse team data %s: %w", path, err)
+	}
+	for _, summary := range stored {
+		s.summaries[summary.Player] = summary
+	}
+	return s, nil
+}
+
+// Handler returns the HTTP routes of the server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+SummariesPath, s.handlePush)
+	mux.HandleFunc("GET /api/v1/leaderboard", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Leaderboard())
+	})
+	mux.HandleFunc("GET /api/v1/map", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Map())
+	})
+	mux.HandleFunc("GET /map.png", s.handleMapImage)
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	return mux
+}
+
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSummaryBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "Summary too large")
+		return
+	}
+	if !Verify(s.key, body, r.Header.Get(SignatureHeader)) {
+		writeError(w, http.StatusUnauthorized, "Invalid signature; check the team key")
+		return
+	}
+	var summary Summary
+	if err := json.Unmarshal(body, &summary); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid summary: %v", err))
+		return
+	}
+	if err := summary.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if skew := s.now().Sub(summary.Time); skew > MaxClockSkew || skew < -MaxClockSkew {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Summary time %s is too far from the server's clock", summary.Time.Format(time.RFC3339)))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A replayed or delayed push must not overwrite a newer summary
+	if previous, ok := s.summaries[summary.Player]; ok && !summary.Time.After(previous.Time) {
+		writeError(w, http.StatusConflict, "A newer summary of this player was already received")
+		return
+	}
+	s.summaries[summary.Player] = summary
+	if err := s.save(); err != nil {
+		slog.Error("Failed to save team data", "error", err)
+	}
+	slog.Debug("Summary received", "player", summary.Player, "countries", len(summary.Countries), "score", summary.Score.Total)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// save writes the summaries to the data file. The caller holds mu.
+func (s *Server) save() error {
+	if s.path == "" {
+		return nil
+	}
+	stored := make([]Summary, 0, len(s.summaries))
+	for _, player := range s.players() {
+		stored = append(stored, s.summaries[player])
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode team data: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create team data directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write team data: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write team data: %w", err)
+	}
+	return nil
+}
+
+// players returns the player names, sorted. The caller holds mu.
+func (s *Server) players() []string {
+	players := make([]string, 0, len(s.summaries))
+	for player := range s.summaries {
+		players = append(players, player)
+	}
+	sort.Strings(players)
+	return players
+}
+
+// Leaderboard returns the players ranked by all-time score, then by visited
+// countries; equal players share a rank.
+func (s *Server) Leaderboard() Leaderboard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	board := Leaderboard{Players: len(s.summaries), Standings: []Standing{}}
+	for _, player := range s.players() {
+		summary := s.summaries[player]
+		standing := Standing{
+			Player:       player,
+			Achievements: len(summary.Achievements),
+			Score:        summary.Score,
+			Updated:      summary.Time,
+		}
+		for _, c := range summary.Countries {
+			standing.Visited++
+			if c.Prison {
+				standing.Prison++
+			}
+		}
+		board.Standings = append(board.Standings, standing)
+	}
+	sort.SliceStable(board.Standings, func(i, j int) bool {
+		a, b := board.Standings[i], board.Standings[j]
+		if a.Score.Total != b.Score.Total {
+			return a.Score.Total > b.Score.Total
+		}
+		return a.Visited > b.Visited
+	})
+	for i := range board.Standings {
+		board.Standings[i].Rank = i + 1
+		if i > 0 {
+			prev := board.Standings[i-1]
+			if prev.Score.Total == board.Standings[i].Score.Total && prev.Visited == board.Standings[i].Visited {
+				board.Standings[i].Rank = prev.Rank
+			}
+		}
+	}
+	return board
+}
+
+// Map returns the countries visited by any player, most shared first.
+func (s *Server) Map() TeamMap {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byCountry := make(map[string]*TeamCountry)
+	for _, player := range s.players() {
+		for country, c := range s.summaries[player].Countries {
+			tc := byCountry[country]
+			if tc == nil {
+				tc = &TeamCountry{Country: country}
+				byCountry[country] = tc
+			}
+			tc.Players = append(tc.Players, player)
+			tc.Hits += c.Hits
+		}
+	}
+	teamMap := TeamMap{Players: len(s.summaries), Countries: make([]TeamCountry, 0, len(byCountry))}
+	for _, tc := range byCountry {
+		teamMap.Countries = append(teamMap.Countries, *tc)
+	}
+	sort.Slice(teamMap.Countries, func(i, j int) bool {
+		a, b := teamMap.Countries[i], teamMap.Countries[j]
+		if len(a.Players) != len(b.Players) {
+			return len(a.Players) > len(b.Players)
+		}
+		return a.Country < b.Country
+	})
+	return teamMap
+}
+
+// mapHits shades the countries of the team map by how many players visited
+// them: 1 for one player up to 9 for the whole team.
+func (m TeamMap) mapHits() map[string]int {
+	hits := make(map[string]int, len(m.Countries))
+	for _, c := range m.Countries {
+		hits[c.Country] = 1
+		if m.Players > 1 {
+			hits[c.Country] = 1 + 8*(len(c.Players)-1)/(m.Players-1)
+		}
+	}
+	return hits
+}
+
+func (s *Server) handleMapImage(w http.ResponseWriter, r *http.Request) {
+	if s.RenderMap == nil {
+		writeError(w, http.StatusNotFound, "The team map image is not available")
+		return
+	}
+	img, err := s.RenderMap(s.Map().mapHits())
+	if err != nil {
+		slog.Error("Failed to render team map", "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to render the team map")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := png.Encode(w, img); err != nil {
+		slog.Debug("Failed to send team map", "error", err)
+	}
+}
+
+// indexTemplate is the team page: the map and the leaderboard, refreshed
+// every minute.
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="60">
+<title>IP Travel Map – Team</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #f4f4f4; color: #222; }
+img { max-width: 100%; border: 1px solid #ccc; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { padding: 0.3em 1em; text-align: right; border-bottom: 1px solid #ddd; }
+th:nth-child(2), td:nth-child(2) { text-align: left; }
+</style>
+</head>
+<body>
+<h1>Team Map</h1>
+<p>{{.Map.Players}} players, {{len .Map.Countries}} countries</p>
+{{if .Image}}<img src="map.png" alt="Countries visited by the team">{{end}}
+<h2>Leaderboard</h2>
+<table>
+<tr><th>#</th><th>Player</th><th>Score</th><th>Today</th><th>Week</th><th>Countries</th><th>Prison</th><th>Achievements</th><th>Updated</th></tr>
+{{range .Leaderboard.Standings}}<tr><td>{{.Rank}}</td><td>{{.Player}}</td><td>{{.Score.Total}}</td><td>{{.Score.Today}}</td><td>{{.Score.Week}}</td><td>{{.Visited}}</td><td>{{.Prison}}</td><td>{{.Achievements}}</td><td>{{.Updated.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := indexTemplate.Execute(w, struct {
+		Map         TeamMap
+		Leaderboard Leaderboard
+		Image       bool
+	}{s.Map(), s.Leaderboard(), s.RenderMap != nil})
+	if err != nil {
+		slog.Debug("Failed to send team page", "error", err)
+	}
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error envelope.
+func writeError(w http.ResponseWriter, status int, message string) {
+	var body errorEnvelope
+	body.Error.Status = status
+	body.Error.Message = message
+	writeJSON(w, status, body)
+}
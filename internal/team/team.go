@@ -0,0 +1,144 @@
+// Package team shares game summaries with a team server that combines them
+// into a team map and leaderboard. Summaries hold per-country counts,
+// achievements and scores, never addresses, and are signed with a key shared
+// by the team.
+package team
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SummariesPath is where clients push their summaries.
+const SummariesPath = "/api/v1/summaries"
+
+// SignatureHeader carries the HMAC-SHA256 of a pushed body, hex encoded.
+const SignatureHeader = "X-IPTW-Signature"
+
+// MaxClockSkew is how far the time of a summary may be from the server's.
+const MaxClockSkew = 10 * time.Minute
+
+// DefaultServerAddress is where iptw-server listens by default.
+const DefaultServerAddress = "127.0.0.1:32790"
+
+// CountrySummary is a player's standing in one country.
+type CountrySummary struct {
+	Hits   int  `json:"hits"`
+	Prison bool `json:"prison,omitempty"`
+}
+
+// ScoreSummary is a player's score of the day, the week and all time.
+type ScoreSummary struct {
+	Today int `json:"today"`
+	Week  int `json:"week"`
+	Total int `json:"total"`
+}
+
+// Summary is what a client shares with its team: the visited countries by
+// name, the unlocked achievements by ID, and the score.
+type Summary struct {
+	Player       string                    `json:"player"`
+	Time         time.Time                 `json:"time"`
+	Countries    map[string]CountrySummary `json:"countries"`
+	Achievements []string                  `json:"achievements"`
+	Score        ScoreSummary              `json:"score"`
+}
+
+// Validate checks a summary received by the server.
+func (s Summary) Validate() error {
+	if !ValidPlayer(s.Player) {
+		return fmt.Errorf("invalid player name %q", s.Player)
+	}
+	if s.Time.IsZero() {
+		return fmt.Errorf("summary has no time")
+	}
+	for country, c := range s.Countries {
+		if strings.TrimSpace(country) == "" || c.Hits < 0 {
+			return fmt.Errorf("invalid country %q", country)
+		}
+	}
+	return nil
+}
+
+// ValidPlayer reports whether name can identify a player: 1 to 32 letters,
+// digits, '.', '-' and '_'.
+func ValidPlayer(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Sign returns the signature of body with the team key.
+func Sign(key string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body with the team key.
+func Verify(key string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// DefaultKeyPath returns the path of the team key, ~/.config/iptw/team-key.
+func DefaultKeyPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "iptw", "team-key"), nil
+}
+
+// LoadKey reads the team key at path.
+func LoadKey(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read team key: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("team key %s is empty", path)
+	}
+	return key, nil
+}
+
+// SaveKey writes the team key to path, readable only by the user.
+func SaveKey(path, key string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create team key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(key+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write team key: %w", err)
+	}
+	return nil
+}
+
+// NewKey returns a random team key.
+func NewKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate team key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
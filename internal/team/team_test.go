@@ -0,0 +1,126 @@
+package team
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"player": "ada"}`)
+	signature := Sign("secret", body)
+	if !Verify("secret", body, signature) {
+		t.Error("expected the signature to verify")
+	}
+	if Verify("other", body, signature) || Verify("secret", []byte(`{"player": "bob"}`), signature) || Verify("secret", body, "zz") {
+		t.Error("expected a wrong key, body or signature to fail")
+	}
+}
+
+func TestServer(t *testing.T) {
+	dataPath := filepath.Join(t.TempDir(), "team.json")
+	s, err := NewServer("secret", dataPath)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	var hits map[string]int
+	s.RenderMap = func(h map[string]int) (image.Image, error) {
+		hits = h
+		return image.NewRGBA(image.Rect(0, 0, 2, 1)), nil
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	ctx := context.Background()
+
+	now := time.Now()
+	ada := Summary{
+		Player:       "ada",
+		Time:         now,
+		Countries:    map[string]CountrySummary{"France": {Hits: 3}, "Peru": {Hits: 10, Prison: true}},
+		Achievements: []string{"first_steps"},
+		Score:        ScoreSummary{Today: 5, Week: 20, Total: 120},
+	}
+	bob := Summary{
+		Player:    "bob",
+		Time:      now,
+		Countries: map[string]CountrySummary{"France": {Hits: 1}},
+		Score:     ScoreSummary{Total: 40},
+	}
+	for _, summary := range []Summary{ada, bob} {
+		if err := Push(ctx, srv.Client(), srv.URL, "secret", summary); err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+	}
+
+	for _, c := range []struct {
+		name    string
+		key     string
+		summary Summary
+		want    string
+	}{
+		{"wrong key", "guess", ada, "Invalid signature"},
+		{"replay", "secret", ada, "newer summary"},
+		{"clock skew", "secret", Summary{Player: "eve", Time: now.Add(-time.Hour)}, "too far"},
+		{"bad player", "secret", Summary{Player: "eve/../x", Time: now}, "invalid player"},
+	} {
+		if err := Push(ctx, srv.Client(), srv.URL, c.key, c.summary); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error about %q, got %v", c.name, c.want, err)
+		}
+	}
+
+	board := s.Leaderboard()
+	if board.Players != 2 || board.Standings[0].Player != "ada" || board.Standings[0].Visited != 2 || board.Standings[0].Prison != 1 || board.Standings[1].Rank != 2 {
+		t.Errorf("unexpected leaderboard %+v", board)
+	}
+	var teamMap TeamMap
+	resp, err := srv.Client().Get(srv.URL + "/api/v1/map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.NewDecoder(resp.Body).Decode(&teamMap); err != nil {
+		t.Fatal(err)
+	}
+	if len(teamMap.Countries) != 2 || teamMap.Countries[0].Country != "France" || len(teamMap.Countries[0].Players) != 2 || teamMap.Countries[0].Hits != 4 {
+		t.Errorf("unexpected team map %+v", teamMap)
+	}
+
+	for _, path := range []string{"/", "/map.png"} {
+		resp, err := srv.Client().Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected %s to be served, got %s", path, resp.Status)
+		}
+	}
+	if hits["France"] != 9 || hits["Peru"] != 1 {
+		t.Errorf("expected the map shaded by players, got %v", hits)
+	}
+
+	// The summaries survive a restart
+	reopened, err := NewServer("secret", dataPath)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	if board := reopened.Leaderboard(); board.Players != 2 {
+		t.Errorf("expected 2 stored players, got %+v", board)
+	}
+}
+
+func TestPushServerDown(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+	err := Push(context.Background(), http.DefaultClient, url, "secret", Summary{Player: "ada", Time: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "failed to reach team server") {
+		t.Errorf("expected the server to be unreachable, got %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package timelapse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+)
+
+// pngSignature starts every PNG file.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// apngWriter streams an animated PNG. The standard library only encodes still
+// images, so every frame is encoded with image/png and its IDAT data is
+// re-wrapped into the APNG frame chunks (fcTL plus IDAT or fdAT).
+type apngWriter struct {
+	w      io.Writer
+	frames int    // total frames announced in acTL
+	n      int    // frames written so far
+	seq    uint32 // APNG sequence number shared by fcTL and fdAT chunks
+	ihdr   []byte // IHDR of the first frame; all frames must match
+	enc    png.Encoder
+	buf    bytes.Buffer
+}
+
+func newAPNGWriter(w io.Writer, frames int) (*apngWriter, error) {
+	if _, err := w.Write(pngSignature); err != nil {
+		return nil, err
+	}
+	return &apngWriter{w: w, frames: frames, enc: png.Encoder{CompressionLevel: png.BestSpeed}}, nil
+}
+
+// writeFrame appends a frame shown for delay hundredths of a second.
+func (a *apngWriter) writeFrame(img image.Image, delay int) error {
+	if a.n >= a.frames {
+		return fmt.Errorf("APNG already has %d frames", a.frames)
+	}
+	a.buf.Reset()
+	if err := a.enc.Encode(&a.buf, img); err != nil {
+		return fmt.Errorf("failed to encode APNG frame: %w", err)
+	}
+	chunks, err := readChunks(a.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var idat [][]byte
+	for _, c := range chunks {
+		switch c.typ {
+		case "IHDR":
+			if a.ihdr == nil {
+				a.ihdr = c.data
+				if err := a.writeChunk("IHDR", c.data); err != nil {
+					return err
+				}
+				actl := make([]byte, 8)
+				binary.BigEndian.PutUint32(actl[0:], uint32(a.frames))
+				binary.BigEndian.PutUint32(actl[4:], 0) // loop forever
+				if err := a.writeChunk("acTL", actl); err != nil {
+					return err
+				}
+			} else if !bytes.Equal(a.ihdr, c.data) {
+				return fmt.Errorf("APNG frame %d differs in size or color type", a.n+1)
+			}
+		case "PLTE", "tRNS":
+			if a.n == 0 {
+				if err := a.writeChunk(c.typ, c.data); err != nil {
+					return err
+				}
+			}
+		case "IDAT":
+			idat = append(idat, c.data)
+		}
+	}
+
+	bounds := img.Bounds()
+	fctl := make([]byte, 26)
+	binary.BigEndian.PutUint32(fctl[0:], a.seq)
+	binary.BigEndian.PutUint32(fctl[4:], uint32(bounds.Dx()))
+	binary.BigEndian.PutUint32(fctl[8:], uint32(bounds.Dy()))
+	// x/y offsets stay 0
+	binary.BigEndian.PutUint16(fctl[20:], uint16(delay))
+	binary.BigEndian.PutUint16(fctl[22:], 100) // delay denominator: hundredths
+	// dispose_op 0 (none), blend_op 0 (source)
+	a.seq++
+	if err := a.writeChunk("fcTL", fctl); err != nil {
+		return err
+	}
+
+	for _, data := range idat {
+		if a.n == 0 {
+			// The first frame doubles as the default image
+			if err := a.writeChunk("IDAT", data); err != nil {
+				return err
+			}
+			continue
+		}
+		fdat := make([]byte, 4+len(data))
+		binary.BigEndian.PutUint32(fdat, a.seq)
+		copy(fdat[4:], data)
+		a.seq++
+		if err := a.writeChunk("fdAT", fdat); err != nil {
+			return err
+		}
+	}
+	a.n++
+	return nil
+}
+
+// close writes the trailing IEND chunk.
+func (a *apngWriter) close() error {
+	if a.n != a.frames {
+		return fmt.Errorf("APNG announced %d frames but %d were written", a.frames, a.n)
+	}
+	return a.writeChunk("IEND", nil)
+}
+
+func (a *apngWriter) writeChunk(typ string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	trailer := binary.BigEndian.AppendUint32(nil, crc.Sum32())
+	for _, b := range [][]byte{header, data, trailer} {
+		if _, err := a.w.Write(b); err != nil {
+			return fmt.Errorf("failed to write APNG: %w", err)
+		}
+	}
+	return nil
+}
+
+// pngChunk is one chunk of an encoded PNG.
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readChunks splits an encoded PNG into its chunks.
+func readChunks(b []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(b, pngSignature) {
+		return nil, fmt.Errorf("not a PNG stream")
+	}
+	b = b[len(pngSignature):]
+	var chunks []pngChunk
+	for len(b) >= 12 {
+		n := int(binary.BigEndian.Uint32(b))
+		if len(b) < 12+n {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		chunks = append(chunks, pngChunk{typ: string(b[4:8]), data: b[8 : 8+n]})
+		b = b[12+n:]
+	}
+	return chunks, nil
+}
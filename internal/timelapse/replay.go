@@ -0,0 +1,208 @@
+package timelapse
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"iptw/internal/history"
+)
+
+// Day is the game state at the end of one day of travel history.
+type Day struct {
+	Date         time.Time       // local midnight starting the day
+	Hits         map[string]int  // hit counts as understood by RenderNaturalEarthMap
+	Prison       map[string]bool // countries in Matrix Prison
+	Liberated    map[string]bool // prison countries liberated while they were the target
+	Target       string          // target country at the end of the day
+	Expedition   []string        // unreached countries of the expedition open at the end of the day, sorted
+	Visited      int             // countries visited so far
+	Imprisoned   int             // countries in Matrix Prison and not liberated
+	Connections  int             // connections journaled so far
+	NewCountries []string        // countries first visited on this day, sorted
+}
+
+// replayState accumulates journal events in order.
+type replayState struct {
+	flows       map[string]int // journaled connections per country
+	visited     map[string]bool
+	prison      map[string]bool
+	liberated   map[string]bool
+	target      string
+	expedition  map[string]bool // unreached targets of the open expedition
+	connections int
+	newToday    []string
+}
+
+func newReplayState() *replayState {
+	return &replayState{
+		flows:     make(map[string]int),
+		visited:   make(map[string]bool),
+		prison:    make(map[string]bool),
+		liberated: make(map[string]bool),
+	}
+}
+
+func (s *replayState) apply(e history.Event) {
+	visit := func(country string) {
+		if country != "" && !s.visited[country] {
+			s.visited[country] = true
+			s.newToday = append(s.newToday, country)
+		}
+	}
+
+	switch e.Type {
+	case history.EventHit:
+		s.connections++
+		if e.Country != "" {
+			s.flows[e.Country]++
+			visit(e.Country)
+		}
+	case history.EventVisit:
+		visit(e.Country)
+	case history.EventImprison:
+		visit(e.Country)
+		s.prison[e.Country] = true
+		if e.Liberated {
+			s.liberated[e.Country] = true
+			if s.target == e.Country {
+				s.target = ""
+			}
+		}
+	case history.EventTarget:
+		s.target = e.Country
+	case history.EventExpedition:
+		switch e.Outcome {
+		case history.ExpeditionStarted:
+			s.expedition = make(map[string]bool, len(e.Countries))
+			for _, country := range e.Countries {
+				s.expedition[country] = true
+			}
+		case history.ExpeditionReached:
+			delete(s.expedition, e.Country)
+		default:
+			s.expedition = nil
+		}
+	}
+}
+
+// snapshot returns the state for the day starting at date and resets the
+// per-day bookkeeping.
+func (s *replayState) snapshot(date time.Time) Day {
+	day := Day{
+		Date:        date,
+		Hits:        make(map[string]int, len(s.visited)),
+		Prison:      make(map[string]bool, len(s.prison)),
+		Liberated:   make(map[string]bool, len(s.liberated)),
+		Target:      s.target,
+		Visited:     len(s.visited),
+		Connections: s.connections,
+	}
+	// The journal records connections rather than every per-cycle hit, so
+	// the connection count stands in for the hit count. Prison countries
+	// always render with 10 hits.
+	for country := range s.visited {
+		day.Hits[country] = min(max(s.flows[country], 1), 9)
+	}
+	for country := range s.prison {
+		day.Hits[country] = 10
+		day.Prison[country] = true
+		if s.liberated[country] {
+			day.Liberated[country] = true
+		} else {
+			day.Imprisoned++
+		}
+	}
+	for country := range s.expedition {
+		day.Expedition = append(day.Expedition, country)
+	}
+	sort.Strings(day.Expedition)
+	day.NewCountries = append(day.NewCountries, s.newToday...)
+	sort.Strings(day.NewCountries)
+	s.newToday = s.newToday[:0]
+	return day
+}
+
+// Targets returns the countries outlined as targets on the day: the target
+// country and the unreached countries of an open expedition.
+func (d Day) Targets() map[string]bool {
+	targets := make(map[string]bool, len(d.Expedition)+1)
+	if d.Target != "" {
+		targets[d.Target] = true
+	}
+	for _, country := range d.Expedition {
+		targets[country] = true
+	}
+	return targets
+}
+
+// Replay reconstructs the game state at the end of every day from from to to
+// (inclusive, local time) out of the journal. A zero from starts at the day of
+// the first journaled event; a zero to ends today.
+func Replay(journal *history.Journal, from, to time.Time) ([]Day, error) {
+	if from.IsZero() {
+		err := journal.Scan(time.Time{}, func(e history.Event) bool {
+			from = e.Time
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+		if from.IsZero() {
+			return nil, fmt.Errorf("travel history is empty")
+		}
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	from, to = startOfDay(from), startOfDay(to)
+	if to.Before(from) {
+		return nil, fmt.Errorf("end date %s is before start date %s", to.Format(time.DateOnly), from.Format(time.DateOnly))
+	}
+
+	state := newReplayState()
+	var days []Day
+	day := from
+	next := day.AddDate(0, 0, 1)
+	err := journal.Scan(time.Time{}, func(e history.Event) bool {
+		for !e.Time.Before(next) {
+			days = append(days, state.snapshot(day))
+			day, next = next, next.AddDate(0, 0, 1)
+			if day.After(to) {
+				return false
+			}
+		}
+		state.apply(e)
+		if e.Time.Before(from) {
+			// Earlier history shapes the starting state but is not new on day one
+			state.newToday = state.newToday[:0]
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for !day.After(to) {
+		days = append(days, state.snapshot(day))
+		day = day.AddDate(0, 0, 1)
+	}
+	return days, nil
+}
+
+// DayCount returns the number of days Replay returns from from to to, both
+// non-zero; zero when to is before from.
+func DayCount(from, to time.Time) int {
+	from, to = startOfDay(from), startOfDay(to)
+	if to.Before(from) {
+		return 0
+	}
+	// Days around a daylight saving change are an hour shorter or longer
+	return int(math.Round(to.Sub(from).Hours()/24)) + 1
+}
+
+// startOfDay returns local midnight of t's day.
+func startOfDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
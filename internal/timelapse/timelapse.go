@@ -0,0 +1,266 @@
+// Package timelapse renders the travel history as an animation.
+//
+// The journal (see package history) is replayed day by day and every day is
+// drawn with resources.RenderNaturalEarthMapLayers, so frames look exactly like the
+// live wallpaper. A caption with the date and running statistics is added to
+// each frame. Animations can be written as GIF, APNG or a numbered PNG image
+// sequence.
+package timelapse
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"iptw/internal/resources"
+)
+
+// Output formats.
+const (
+	FormatGIF    = "gif"
+	FormatAPNG   = "apng"
+	FormatFrames = "frames" // numbered PNG files in a directory
+)
+
+// Default and maximum settings.
+const (
+	DefaultFPS   = 4
+	DefaultWidth = 1000
+	MaxFPS       = 50
+	MaxWidth     = 3840
+)
+
+// holdLastFrameSeconds is how long the final state stays on screen before looping.
+const holdLastFrameSeconds = 2
+
+// gifPalette is the fixed palette GIF frames are dithered to. A shared palette
+// keeps colors stable between frames.
+var gifPalette color.Palette = palette.Plan9
+
+// Options configure a timelapse.
+type Options struct {
+	FPS    int                      // frames (days) per second
+	Width  int                      // frame width in pixels; height is half of it
+	Theme  *resources.Theme         // colors and fonts; nil for the light preset
+	Insets *resources.InsetOptions  // optional callouts for small countries
+	Labels *resources.LabelOptions  // optional country labels
+	Legend *resources.LegendOptions // optional legend box
+}
+
+// Renderer draws timelapse frames with the application's map resources.
+type Renderer struct {
+	NaturalEarth *resources.NaturalEarthData
+	Flags        *resources.FlagManager // optional
+	Fonts        *resources.FontManager // optional; required for Matrix rain and captions
+	Options      Options
+}
+
+// normalized returns the options with defaults applied and values clamped.
+func (o Options) normalized() Options {
+	if o.FPS <= 0 {
+		o.FPS = DefaultFPS
+	}
+	if o.FPS > MaxFPS {
+		o.FPS = MaxFPS
+	}
+	if o.Theme == nil {
+		o.Theme = resources.DefaultTheme(false)
+	}
+	if o.Width <= 0 {
+		o.Width = DefaultWidth
+	}
+	if o.Width > MaxWidth {
+		o.Width = MaxWidth
+	}
+	o.Width -= o.Width % 2
+	return o
+}
+
+// RenderFrame draws the map for one day with its caption.
+func (r *Renderer) RenderFrame(day Day) (*image.RGBA, error) {
+	img, err := r.RenderMap(day)
+	if err != nil {
+		return nil, err
+	}
+	r.drawCaption(img, day, r.Options.normalized().Theme)
+	return img, nil
+}
+
+// RenderMap draws the map for one day without a caption.
+func (r *Renderer) RenderMap(day Day) (*image.RGBA, error) {
+	opts := r.Options.normalized()
+	width, height := opts.Width, opts.Width/2
+
+	layers := resources.MapLayers{Ocean: true, Unvisited: true, Insets: opts.Insets, Labels: opts.Labels, Legend: opts.Legend}
+	img, err := resources.RenderNaturalEarthMapLayers(r.NaturalEarth, width, height, opts.Theme, day.Hits, day.Targets(), r.Flags, r.Fonts, day.Prison, nil, day.Liberated, layers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", day.Date.Format("2006-01-02"), err)
+	}
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+	return rgba, nil
+}
+
+// drawCaption draws the date and running statistics in the bottom-left corner.
+func (r *Renderer) drawCaption(img *image.RGBA, day Day, theme *resources.Theme) {
+	if r.Fonts == nil {
+		return
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	lines := []string{
+		day.Date.Format("Monday 2 January 2006"),
+		fmt.Sprintf("Countries visited: %d", day.Visited),
+		fmt.Sprintf("Matrix Prison: %d", day.Imprisoned),
+		fmt.Sprintf("Connections: %d", day.Connections),
+	}
+	if len(day.NewCountries) > 0 {
+		newLine := []rune("New: " + strings.Join(day.NewCountries, ", "))
+		if len(newLine) > 48 {
+			newLine = append(newLine[:45], []rune("...")...)
+		}
+		lines = append(lines, string(newLine))
+	}
+
+	fontSize := math.Max(12, math.Floor(float64(height)*0.03+0.5))
+	padding := int(float64(width) * 0.012)
+	lineHeight := int(fontSize * 1.5)
+	rectWidth := int(float64(width) * 0.3)
+	for _, line := range lines {
+		rectWidth = max(rectWidth, len(line)*int(fontSize*0.55)+padding*2)
+	}
+	rectHeight := padding*3 + len(lines)*lineHeight
+	margin := int(float64(width) * 0.02)
+	rect := image.Rect(margin, height-rectHeight-margin, margin+rectWidth, height-margin)
+
+	cfg := theme.GameInfoConfig(r.Fonts, fontSize, padding)
+	bg := cfg.BackgroundColor
+	draw.Draw(img, rect, image.NewUniform(color.NRGBA{bg.R, bg.G, bg.B, bg.A}), image.Point{}, draw.Over)
+	// A missing UI font only loses the caption; the frame is still useful
+	_ = resources.DrawGameInfoRectangle(img, r.Fonts, rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy(), lines, cfg)
+}
+
+// frameDelays returns the per-frame delay in 1/100 s, holding the last frame.
+func frameDelays(frames, fps int) []int {
+	delays := make([]int, frames)
+	for i := range delays {
+		delays[i] = max(2, 100/fps)
+	}
+	if frames > 0 {
+		delays[frames-1] += holdLastFrameSeconds * 100
+	}
+	return delays
+}
+
+// WriteGIF encodes the days as a looping animated GIF.
+func (r *Renderer) WriteGIF(ctx context.Context, w io.Writer, days []Day) error {
+	if len(days) == 0 {
+		return fmt.Errorf("no days to render")
+	}
+	opts := r.Options.normalized()
+	anim := &gif.GIF{Delay: frameDelays(len(days), opts.FPS)}
+	for _, day := range days {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		frame, err := r.RenderFrame(day)
+		if err != nil {
+			return err
+		}
+		anim.Image = append(anim.Image, quantize(frame))
+	}
+	if err := gif.EncodeAll(w, anim); err != nil {
+		return fmt.Errorf("failed to encode GIF: %w", err)
+	}
+	return nil
+}
+
+// quantize converts a frame to the GIF palette with Floyd–Steinberg dithering.
+func quantize(img *image.RGBA) *image.Paletted {
+	paletted := image.NewPaletted(img.Bounds(), gifPalette)
+	draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, img.Bounds().Min)
+	return paletted
+}
+
+// WriteAPNG encodes the days as a looping animated PNG.
+func (r *Renderer) WriteAPNG(ctx context.Context, w io.Writer, days []Day) error {
+	if len(days) == 0 {
+		return fmt.Errorf("no days to render")
+	}
+	opts := r.Options.normalized()
+	enc, err := newAPNGWriter(w, len(days))
+	if err != nil {
+		return err
+	}
+	for i, delay := range frameDelays(len(days), opts.FPS) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		frame, err := r.RenderFrame(days[i])
+		if err != nil {
+			return err
+		}
+		if err := enc.writeFrame(frame, delay); err != nil {
+			return err
+		}
+	}
+	return enc.close()
+}
+
+// WriteFrames writes every day as dir/frame-0001.png, dir/frame-0002.png, ...
+func (r *Renderer) WriteFrames(ctx context.Context, dir string, days []Day) error {
+	if len(days) == 0 {
+		return fmt.Errorf("no days to render")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create frame directory: %w", err)
+	}
+	for i, day := range days {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		frame, err := r.RenderFrame(day)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("frame-%04d.png", i+1))
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create frame: %w", err)
+		}
+		if err := png.Encode(file, frame); err != nil {
+			_ = file.Close()
+			return fmt.Errorf("failed to encode frame %s: %w", path, err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write frame %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// FormatFromPath infers the output format from a file name.
+func FormatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		return FormatGIF, nil
+	case ".png", ".apng":
+		return FormatAPNG, nil
+	case "":
+		return FormatFrames, nil
+	}
+	return "", fmt.Errorf("cannot infer format from %q; use gif, apng or frames", path)
+}
@@ -0,0 +1,186 @@
+package timelapse
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"iptw/internal/history"
+)
+
+func writeJournal(t *testing.T, events []history.Event) *history.Journal {
+	t.Helper()
+	journal, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { _ = journal.Close() })
+	for _, e := range events {
+		if err := journal.Append(e); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	return journal
+}
+
+func TestReplay(t *testing.T) {
+	day1 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	at := func(day, hour int) time.Time { return day1.AddDate(0, 0, day).Add(time.Duration(hour) * time.Hour) }
+
+	journal := writeJournal(t, []history.Event{
+		{Time: at(-2, 9), Type: history.EventHit, Country: "Germany"},
+		{Time: at(0, 9), Type: history.EventTarget, Country: "Japan"},
+		{Time: at(0, 10), Type: history.EventHit, Country: "France"},
+		{Time: at(0, 11), Type: history.EventHit, Country: "France"},
+		{Time: at(0, 12), Type: history.EventExpedition, Outcome: history.ExpeditionStarted, Countries: []string{"Peru", "Chile"}},
+		{Time: at(1, 12), Type: history.EventExpedition, Outcome: history.ExpeditionReached, Country: "Chile"},
+		{Time: at(2, 12), Type: history.EventExpedition, Outcome: history.ExpeditionFailed},
+		{Time: at(2, 8), Type: history.EventVisit, Country: "Japan"},
+		{Time: at(2, 9), Type: history.EventImprison, Country: "Japan", Liberated: true},
+		{Time: at(2, 10), Type: history.EventImprison, Country: "Germany"},
+		{Time: at(5, 10), Type: history.EventHit, Country: "Brazil"},
+	})
+
+	days, err := Replay(journal, day1, day1.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(days) != 3 {
+		t.Fatalf("expected 3 days, got %d", len(days))
+	}
+
+	// Day one starts from earlier history
+	if days[0].Visited != 2 || days[0].Connections != 3 {
+		t.Errorf("day 1: expected 2 visited and 3 connections, got %d and %d", days[0].Visited, days[0].Connections)
+	}
+	if len(days[0].NewCountries) != 1 || days[0].NewCountries[0] != "France" {
+		t.Errorf("day 1: expected new [France], got %v", days[0].NewCountries)
+	}
+	if days[0].Target != "Japan" || days[0].Hits["France"] != 2 {
+		t.Errorf("day 1: expected target Japan and 2 hits for France, got %q and %d", days[0].Target, days[0].Hits["France"])
+	}
+
+	if targets := days[0].Targets(); len(targets) != 3 || !targets["Japan"] || !targets["Peru"] || !targets["Chile"] {
+		t.Errorf("day 1: expected Japan and the expedition as targets, got %v", targets)
+	}
+	if len(days[1].Expedition) != 1 || days[1].Expedition[0] != "Peru" {
+		t.Errorf("day 2: expected Peru left on the expedition, got %v", days[1].Expedition)
+	}
+
+	// Quiet day carries the state forward
+	if days[1].Visited != 2 || len(days[1].NewCountries) != 0 {
+		t.Errorf("day 2: expected 2 visited and nothing new, got %d and %v", days[1].Visited, days[1].NewCountries)
+	}
+
+	last := days[2]
+	if last.Target != "" || len(last.Expedition) != 0 {
+		t.Errorf("day 3: expected target cleared by liberation and the expedition over, got %q and %v", last.Target, last.Expedition)
+	}
+	if !last.Prison["Japan"] || !last.Liberated["Japan"] || last.Hits["Japan"] != 10 {
+		t.Errorf("day 3: expected Japan liberated in prison with 10 hits, got %v %v %d", last.Prison["Japan"], last.Liberated["Japan"], last.Hits["Japan"])
+	}
+	if last.Imprisoned != 1 || last.Visited != 3 {
+		t.Errorf("day 3: expected 1 imprisoned and 3 visited, got %d and %d", last.Imprisoned, last.Visited)
+	}
+}
+
+func TestReplayDefaultsToFirstEvent(t *testing.T) {
+	start := time.Date(2026, 3, 1, 15, 0, 0, 0, time.Local)
+	journal := writeJournal(t, []history.Event{
+		{Time: start, Type: history.EventHit, Country: "Chile"},
+	})
+	days, err := Replay(journal, time.Time{}, start.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(days) != 2 || !days[0].Date.Equal(startOfDay(start)) {
+		t.Errorf("expected 2 days starting %v, got %d", startOfDay(start), len(days))
+	}
+
+	if _, err := Replay(writeJournal(t, nil), time.Time{}, time.Time{}); err == nil {
+		t.Error("expected an error for an empty journal")
+	}
+}
+
+func TestDayCount(t *testing.T) {
+	from := time.Date(2026, 1, 1, 23, 0, 0, 0, time.Local)
+	for _, c := range []struct {
+		to   time.Time
+		want int
+	}{
+		{from, 1},
+		{time.Date(2026, 1, 2, 1, 0, 0, 0, time.Local), 2},
+		{time.Date(2026, 12, 31, 0, 0, 0, 0, time.Local), 365}, // across both daylight saving changes
+		{time.Date(2025, 12, 31, 0, 0, 0, 0, time.Local), 0},
+	} {
+		if got := DayCount(from, c.to); got != c.want {
+			t.Errorf("DayCount(%v, %v) = %d, want %d", from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestAPNGWriter(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := newAPNGWriter(&buf, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []color.RGBA{{255, 0, 0, 255}, {0, 0, 255, 255}} {
+		img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		if err := enc.writeFrame(img, 25); err != nil {
+			t.Fatalf("writeFrame failed: %v", err)
+		}
+	}
+	if err := enc.close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	chunks, err := readChunks(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, c := range chunks {
+		types = append(types, c.typ)
+	}
+	expected := []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "IEND"}
+	if len(types) != len(expected) {
+		t.Fatalf("expected chunks %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatalf("expected chunks %v, got %v", expected, types)
+		}
+	}
+
+	// Plain PNG decoders show the first frame
+	img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("png.Decode failed: %v", err)
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r>>8 != 255 {
+		t.Errorf("expected first frame red, got %v", img.At(0, 0))
+	}
+
+	if err := enc.writeFrame(image.NewRGBA(image.Rect(0, 0, 4, 2)), 25); err == nil {
+		t.Error("expected an error when writing more frames than announced")
+	}
+}
+
+func TestWriteGIFCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := &Renderer{}
+	var buf bytes.Buffer
+	if err := r.WriteGIF(ctx, &buf, []Day{{}}); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}